@@ -5,12 +5,98 @@ const (
 	PathRegister = "/auth/register"
 )
 
+// 消息相关
+const (
+	PathMsgSendSingle = "/im/message/send/single"
+	PathMsgSendGroup  = "/im/message/send/group"
+	PathMsgSync       = "/im/message/sync"
+	PathMsgRecall     = "/im/message/recall"
+	PathMsgEdit       = "/im/message/edit"
+	PathMsgRevisions  = "/im/message/revisions"
+	PathMsgThread     = "/im/message/thread"
+	PathMsgReactAdd   = "/im/message/reaction/add"
+	PathMsgReactDel   = "/im/message/reaction/remove"
+	PathMsgReactions  = "/im/message/reactions"
+	PathMsgRead       = "/im/message/read"
+	PathMsgMentions   = "/im/message/mentions"
+	PathMsgPlay       = "/im/message/voice/play"
+	PathMsgPlayed     = "/im/message/voice/played"
+	PathMsgTypeReg    = "/im/message/custom/register"
+	PathMsgTypes      = "/im/message/custom/types"
+	PathMsgCardAction = "/im/message/card/action"
+	PathMsgSearch     = "/im/message/search"
+	PathMsgHistory    = "/im/message/history"
+	PathMsgDelete     = "/im/message/delete"
+	PathMsgTTL        = "/im/message/ttl"
+	PathMsgSignal     = "/im/message/signal"
+	PathMsgForward    = "/im/message/forward"
+	PathMsgMerge      = "/im/message/forward/merge"
+	PathMsgSchedule   = "/im/message/schedule"
+	PathMsgSchedules  = "/im/message/schedules"
+	PathMsgSchedEdit  = "/im/message/schedule/edit"
+	PathMsgSchedDel   = "/im/message/schedule/cancel"
+)
+
 const (
 	AuthField       = "Authorization"
 	AuthBearerField = "Bearer"
+	AuthBotField    = "Bot"
 )
 
 const (
 	HeadUid      = "uid"
 	HeadUserName = "username"
 )
+
+// 媒体文件相关
+const (
+	PathMediaImageUpload  = "/im/media/image/upload"
+	PathMediaVoiceUpload  = "/im/media/voice/upload"
+	PathMediaFileInit     = "/im/media/file/init"
+	PathMediaFileChunk    = "/im/media/file/chunk"
+	PathMediaFileProgress = "/im/media/file/progress"
+	PathMediaFileComplete = "/im/media/file/complete"
+	PathMediaURL          = "/im/media/url"
+	PathMediaInstant      = "/im/media/instant"
+	PathMediaDelete       = "/im/media/delete"
+	PathBlob              = "/im/blob/" // 本地存储签名地址，不走jwt鉴权
+)
+
+// 会话列表相关
+const (
+	PathConvList    = "/im/conversation/list"
+	PathConvSync    = "/im/conversation/sync"
+	PathConvSetting = "/im/conversation/setting"
+	PathConvDelete  = "/im/conversation/delete"
+)
+
+// 端到端加密公钥目录相关
+const (
+	PathKeyPublish = "/im/keys/publish"
+	PathKeySigned  = "/im/keys/signed"
+	PathKeyPreKeys = "/im/keys/prekeys"
+	PathKeyStatus  = "/im/keys/status"
+	PathKeyBundle  = "/im/keys/bundle"
+	PathKeyRemove  = "/im/keys/remove"
+)
+
+// 系统广播相关
+const (
+	PathBroadcastCreate = "/im/broadcast/create"
+	PathBroadcastCancel = "/im/broadcast/cancel"
+	PathBroadcastStats  = "/im/broadcast/stats"
+	PathBroadcastSync   = "/im/broadcast/sync"
+	PathBroadcastRead   = "/im/broadcast/read"
+)
+
+// 机器人相关，api下的接口使用机器人令牌鉴权
+const (
+	PathBotCreate = "/im/bot/create"
+	PathBotUpdate = "/im/bot/update"
+	PathBotToken  = "/im/bot/token"
+	PathBotList   = "/im/bot/list"
+	PathBotJoin   = "/im/bot/join"
+	PathBotLeave  = "/im/bot/leave"
+	PathBotDead   = "/im/bot/dead"
+	PathBotSend   = "/im/bot/api/send"
+)
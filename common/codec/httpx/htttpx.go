@@ -2,6 +2,7 @@ package httpx
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/binbin6363/icuc/common/err"
 	"github.com/gin-gonic/gin"
@@ -9,16 +10,18 @@ import (
 
 // Response 统一的 http 返回格式
 type Response struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Data    any    `json:"data"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after,omitempty"` // 限流时建议的重试间隔，单位秒
+	Data       any    `json:"data"`
 }
 
 func newResponse(data interface{}, e error) *Response {
 	return &Response{
-		Code:    err.Code(e),
-		Message: err.Msg(e),
-		Data:    data,
+		Code:       err.Code(e),
+		Message:    err.Msg(e),
+		RetryAfter: err.RetryAfter(e),
+		Data:       data,
 	}
 }
 
@@ -29,5 +32,8 @@ func SendResponse(c *gin.Context, data interface{}, err error) {
 	}
 
 	rsp := newResponse(data, err)
+	if rsp.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(rsp.RetryAfter))
+	}
 	c.JSON(http.StatusOK, rsp)
 }
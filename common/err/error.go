@@ -4,14 +4,16 @@ import "fmt"
 
 // icuc定义的错误
 type ICIUError struct {
-	Code int    // 错误码
-	Msg  string // 错误消息
+	Code       int    // 错误码
+	Msg        string // 错误消息
+	RetryAfter int    // 建议多久之后重试，单位秒，只有限流类错误设置
 }
 
 // 通用错误码定义 100 - 10000
 const (
 	CodeSystem   = 100  // CodeSystem 系统错误
 	CodeUnknown  = 101  // CodeUnknown 未知错误
+	CodeParam    = 102  // CodeParam 请求参数错误
 	CodeNoAuth   = 1000 // CodeNoAuth 缺少认证鉴权信息
 	CodeAuthFail = 1001 // CodeAuthFail 认证鉴权信息失败
 )
@@ -20,6 +22,7 @@ const (
 var (
 	ErrSystem  = New(CodeSystem, "系统错误")
 	ErrUnknown = New(CodeUnknown, "未知错误")
+	ErrParam   = New(CodeParam, "请求参数错误")
 
 	ErrNoAuth   = New(CodeNoAuth, "没有认证信息")
 	ErrAuthFail = New(CodeAuthFail, "认证信息鉴权失败")
@@ -56,3 +59,11 @@ func Msg(e error) string {
 	}
 	return Msg(ErrUnknown)
 }
+
+// RetryAfter 从error获取建议的重试间隔，单位秒
+func RetryAfter(e error) int {
+	if ie, ok := e.(*ICIUError); ok {
+		return ie.RetryAfter
+	}
+	return 0
+}
@@ -1,3 +1,96 @@
 package err
 
-// im业务错误码
+import "time"
+
+// im业务错误码 20000 - 29999
+const (
+	CodeMsgNotFound    = 20000 // CodeMsgNotFound 消息不存在
+	CodeMsgNoPerm      = 20001 // CodeMsgNoPerm 无权操作该消息
+	CodeMsgRecallLate  = 20002 // CodeMsgRecallLate 超过可撤回时间
+	CodeMsgRecalled    = 20003 // CodeMsgRecalled 消息已撤回
+	CodeNotGroupMember = 20004 // CodeNotGroupMember 不是群成员
+	CodeMsgEditLate    = 20005 // CodeMsgEditLate 超过可编辑时间
+	CodeMsgNotEditable = 20006 // CodeMsgNotEditable 该类型消息不支持编辑
+	CodeMentionAllPerm = 20007 // CodeMentionAllPerm 只有群主和管理员可以@所有人
+	CodeConvNoPerm     = 20008 // CodeConvNoPerm 不是会话成员
+	CodeCustomType     = 20009 // CodeCustomType 未注册的自定义消息类型
+	CodeCustomPayload  = 20010 // CodeCustomPayload 自定义消息内容不符合schema
+	CodeCustomOwner    = 20011 // CodeCustomOwner 自定义消息类型已被其他用户注册
+	CodeCardAction     = 20012 // CodeCardAction 卡片按钮不存在或没有回调
+	CodeCardCallback   = 20013 // CodeCardCallback 卡片回调失败
+	CodeMsgTooLong     = 20014 // CodeMsgTooLong 消息内容过长
+	CodeConvNotFound   = 20015 // CodeConvNotFound 会话不存在
+	CodeContentBlocked = 20016 // CodeContentBlocked 内容包含违规信息
+	CodeRateLimited    = 20017 // CodeRateLimited 发送过于频繁
+	CodeDeviceMismatch = 20018 // CodeDeviceMismatch 加密消息的设备列表与密钥目录不一致
+	CodeE2ERequired    = 20019 // CodeE2ERequired 单聊只允许端到端加密消息
+	CodeKeyNotFound    = 20020 // CodeKeyNotFound 用户或设备没有发布密钥
+	CodeNotAdmin       = 20021 // CodeNotAdmin 没有运营管理权限
+	CodeBroadcastGone  = 20022 // CodeBroadcastGone 广播不存在或已取消
+	CodeMsgNoForward   = 20023 // CodeMsgNoForward 该消息不支持转发
+	CodeScheduleGone   = 20024 // CodeScheduleGone 定时消息不存在或已发送
+	CodeBotNotFound    = 20025 // CodeBotNotFound 机器人不存在
+	CodeBotAuth        = 20026 // CodeBotAuth 机器人令牌无效
+	CodeMsgConflict    = 20027 // CodeMsgConflict 消息已被其他请求修改
+	CodeReactionLimit  = 20028 // CodeReactionLimit 表情回应数量达到上限
+	CodeScheduleBroken = 20029 // CodeScheduleBroken 定时消息投递中断，无法确认是否发出
+	CodeMediaType      = 20100 // CodeMediaType 不支持的媒体类型
+	CodeMediaTooLarge  = 20101 // CodeMediaTooLarge 媒体文件过大
+	CodeMediaNotFound  = 20102 // CodeMediaNotFound 媒体文件不存在
+	CodeUploadNotFound = 20103 // CodeUploadNotFound 上传任务不存在或已过期
+	CodeChunkChecksum  = 20104 // CodeChunkChecksum 分片校验失败
+	CodeUploadPartial  = 20105 // CodeUploadPartial 还有分片未上传
+	CodeFileChecksum   = 20106 // CodeFileChecksum 文件sha256校验失败
+	CodeVoiceTooLong   = 20107 // CodeVoiceTooLong 语音时长超过限制
+)
+
+// im错误定义
+var (
+	ErrMsgNotFound    = New(CodeMsgNotFound, "消息不存在")
+	ErrMsgNoPerm      = New(CodeMsgNoPerm, "无权操作该消息")
+	ErrMsgRecallLate  = New(CodeMsgRecallLate, "超过可撤回时间")
+	ErrMsgRecalled    = New(CodeMsgRecalled, "消息已撤回")
+	ErrNotGroupMember = New(CodeNotGroupMember, "不是群成员")
+	ErrMsgEditLate    = New(CodeMsgEditLate, "超过可编辑时间")
+	ErrMsgNotEditable = New(CodeMsgNotEditable, "该类型消息不支持编辑")
+	ErrMentionAllPerm = New(CodeMentionAllPerm, "只有群主和管理员可以@所有人")
+	ErrConvNoPerm     = New(CodeConvNoPerm, "不是会话成员")
+	ErrCustomType     = New(CodeCustomType, "未注册的自定义消息类型")
+	ErrCustomPayload  = New(CodeCustomPayload, "自定义消息内容不符合schema")
+	ErrCustomOwner    = New(CodeCustomOwner, "自定义消息类型已被其他用户注册")
+	ErrCardAction     = New(CodeCardAction, "卡片按钮不存在或没有回调")
+	ErrCardCallback   = New(CodeCardCallback, "卡片回调失败")
+	ErrMsgTooLong     = New(CodeMsgTooLong, "消息内容过长")
+	ErrConvNotFound   = New(CodeConvNotFound, "会话不存在")
+	ErrContentBlocked = New(CodeContentBlocked, "内容包含违规信息")
+	ErrRateLimited    = New(CodeRateLimited, "发送过于频繁")
+	ErrDeviceMismatch = New(CodeDeviceMismatch, "设备列表已变化，请重新获取密钥")
+	ErrE2ERequired    = New(CodeE2ERequired, "单聊只允许端到端加密消息")
+	ErrKeyNotFound    = New(CodeKeyNotFound, "用户或设备没有发布密钥")
+	ErrNotAdmin       = New(CodeNotAdmin, "没有运营管理权限")
+	ErrBroadcastGone  = New(CodeBroadcastGone, "广播不存在或已取消")
+	ErrMsgNoForward   = New(CodeMsgNoForward, "该消息不支持转发")
+	ErrScheduleGone   = New(CodeScheduleGone, "定时消息不存在或已发送")
+	ErrBotNotFound    = New(CodeBotNotFound, "机器人不存在")
+	ErrBotAuth        = New(CodeBotAuth, "机器人令牌无效")
+	ErrMsgConflict    = New(CodeMsgConflict, "消息已被修改，请刷新后重试")
+	ErrReactionLimit  = New(CodeReactionLimit, "表情回应数量已达上限")
+	ErrScheduleBroken = New(CodeScheduleBroken, "定时消息投递中断，无法确认是否发出，请检查后重新发送")
+	ErrMediaType      = New(CodeMediaType, "不支持的媒体类型")
+	ErrMediaTooLarge  = New(CodeMediaTooLarge, "媒体文件过大")
+	ErrMediaNotFound  = New(CodeMediaNotFound, "媒体文件不存在")
+	ErrUploadNotFound = New(CodeUploadNotFound, "上传任务不存在或已过期")
+	ErrChunkChecksum  = New(CodeChunkChecksum, "分片校验失败")
+	ErrUploadPartial  = New(CodeUploadPartial, "还有分片未上传")
+	ErrFileChecksum   = New(CodeFileChecksum, "文件sha256校验失败")
+	ErrVoiceTooLong   = New(CodeVoiceTooLong, "语音时长超过限制")
+)
+
+// RateLimited 带重试间隔的限流错误，不足一秒按一秒计
+func RateLimited(retryAfter time.Duration) *ICIUError {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return &ICIUError{Code: CodeRateLimited, Msg: ErrRateLimited.Msg, RetryAfter: secs}
+}
@@ -0,0 +1,66 @@
+package idgen
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	epoch          = int64(1704067200000) // 2024-01-01 00:00:00 UTC，单位毫秒
+	workerBits     = 5
+	dataCenterBits = 5
+	sequenceBits   = 12
+
+	maxWorkerID     = -1 ^ (-1 << workerBits)
+	maxDataCenterID = -1 ^ (-1 << dataCenterBits)
+	maxSequence     = -1 ^ (-1 << sequenceBits)
+
+	workerShift     = sequenceBits
+	dataCenterShift = sequenceBits + workerBits
+	timestampShift  = sequenceBits + workerBits + dataCenterBits
+)
+
+// Snowflake 雪花算法id生成器
+type Snowflake struct {
+	mu           sync.Mutex
+	lastStamp    int64
+	sequence     int64
+	workerID     int64
+	dataCenterID int64
+}
+
+// NewSnowflake 新建生成器，dataCenterID和workerID取值0-31
+func NewSnowflake(dataCenterID, workerID int64) *Snowflake {
+	return &Snowflake{
+		workerID:     workerID & maxWorkerID,
+		dataCenterID: dataCenterID & maxDataCenterID,
+	}
+}
+
+// Next 生成下一个id
+func (s *Snowflake) Next() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	if now < s.lastStamp {
+		// 时钟回拨，沿用上次的时间戳继续递增
+		now = s.lastStamp
+	}
+	if now == s.lastStamp {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			for now <= s.lastStamp {
+				now = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastStamp = now
+
+	return uint64((now-epoch)<<timestampShift |
+		s.dataCenterID<<dataCenterShift |
+		s.workerID<<workerShift |
+		s.sequence)
+}
@@ -0,0 +1,50 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("blob not found")
+
+// Info 对象元信息
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// Store 对象存储，key为不带前导/的相对路径
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*Info, error)
+	// URL 给客户端访问的地址，开启签名时返回带有效期的签名地址
+	URL(ctx context.Context, key string) (string, error)
+	// PresignGet 生成有效期为expire的下载地址
+	PresignGet(ctx context.Context, key string, expire time.Duration) (string, error)
+	// PresignPut 生成有效期为expire的上传地址，客户端可以直接上传
+	PresignPut(ctx context.Context, key string, expire time.Duration) (string, error)
+}
+
+// Buckets 按用途区分的存储，头像和媒体消息分开存放
+type Buckets struct {
+	Avatar Store
+	Media  Store
+}
+
+// cleanKey 规范化key，避免../跳出根目录
+func cleanKey(key string) (string, bool) {
+	k := path.Clean("/" + key)[1:]
+	if k == "" {
+		return "", false
+	}
+	return k, true
+}
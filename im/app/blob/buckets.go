@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	cfg "github.com/binbin6363/icuc/im/app/config"
+)
+
+// 本地存储时的默认目录名
+const (
+	LocalAvatar = "avatar"
+	LocalMedia  = "media"
+)
+
+// NewBuckets 根据配置创建存储，配置了cos时使用S3协议，否则落到资源根目录下的本地磁盘
+func NewBuckets(server *cfg.ServerInfo, cos *cfg.CosInfo) *Buckets {
+	if cos != nil && cos.Domain != "" && cos.SecretID != "" {
+		newS3 := func(bucket string) Store {
+			return NewS3Store(S3Option{
+				Endpoint:       cos.Domain,
+				Region:         cos.Region,
+				Bucket:         bucket,
+				SecretID:       cos.SecretID,
+				SecretKey:      cos.SecretKey,
+				DisableSSL:     cos.DisableSSL,
+				ForcePathStyle: cos.ForcePathStyle,
+				Sign:           cos.SignFlag,
+				Expire:         expireOf(cos),
+				Timeout:        time.Duration(cos.Timeout) * time.Second,
+			})
+		}
+		return &Buckets{Avatar: newS3(cos.AvatarBucket), Media: newS3(cos.MediaBucket)}
+	}
+
+	sign := cos != nil && cos.SignFlag
+	signRoot := server.BlobUrlRoot
+	if signRoot == "" {
+		signRoot = server.RemoteUrlRoot
+	}
+	newLocal := func(name string) Store {
+		return NewLocalStore(
+			filepath.Join(server.ResourceRoot, name),
+			strings.TrimRight(server.RemoteUrlRoot, "/")+"/"+name,
+			strings.TrimRight(signRoot, "/")+"/"+name,
+			server.BlobSecret, sign, expireOf(cos))
+	}
+	return &Buckets{Avatar: newLocal(LocalAvatar), Media: newLocal(LocalMedia)}
+}
+
+// expireOf 签名地址有效期，配置单位为小时，默认24小时
+func expireOf(cos *cfg.CosInfo) time.Duration {
+	if cos == nil || cos.Expire <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(cos.Expire) * time.Hour
+}
@@ -0,0 +1,246 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// typeSuffix 记录对象类型的附属文件的后缀，对象的key不能以它结尾
+const typeSuffix = ".ctype"
+
+// LocalStore 本地磁盘存储，文件放在dir下，写入时的类型记在同名的附属文件中
+// 未开启签名时通过urlRoot下的静态地址访问，开启签名或预签名上传时通过signRoot指向的ServeHTTP访问
+type LocalStore struct {
+	dir      string
+	urlRoot  string
+	signRoot string
+	secret   []byte
+	sign     bool
+	expire   time.Duration
+}
+
+// NewLocalStore dir为存储目录，urlRoot为静态访问地址的根，signRoot为签名地址的根，secret为空时不能生成签名地址
+func NewLocalStore(dir, urlRoot, signRoot, secret string, sign bool, expire time.Duration) *LocalStore {
+	return &LocalStore{
+		dir:      dir,
+		urlRoot:  strings.TrimRight(urlRoot, "/"),
+		signRoot: strings.TrimRight(signRoot, "/"),
+		secret:   []byte(secret),
+		sign:     sign,
+		expire:   expire,
+	}
+}
+
+func (s *LocalStore) file(key string) (string, error) {
+	k, ok := cleanKey(key)
+	if !ok || strings.HasSuffix(k, typeSuffix) {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(k)), nil
+}
+
+// writeTemp 在name所在目录写临时文件，校验长度后改名为name
+func writeTemp(name string, r io.Reader, size int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("short write, want:%d, got:%d", size, n)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Put 先写临时文件再改名，读到的对象总是完整的，类型先于对象写入
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.file(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err = writeTemp(name+typeSuffix, strings.NewReader(contentType), int64(len(contentType))); err != nil {
+		return err
+	}
+	return writeTemp(name, r, size)
+}
+
+// Get .
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.file(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete 不存在时不报错
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.file(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = os.Remove(name + typeSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat .
+func (s *LocalStore) Stat(ctx context.Context, key string) (*Info, error) {
+	name, err := s.file(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 没有记录类型的对象按二进制流处理，不根据扩展名猜测
+	ctype := "application/octet-stream"
+	if data, err := os.ReadFile(name + typeSuffix); err == nil && len(data) > 0 {
+		ctype = string(data)
+	}
+	return &Info{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: ctype,
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+// URL .
+func (s *LocalStore) URL(ctx context.Context, key string) (string, error) {
+	if s.sign {
+		return s.PresignGet(ctx, key, s.expire)
+	}
+	k, ok := cleanKey(key)
+	if !ok {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return s.urlRoot + "/" + k, nil
+}
+
+// PresignGet .
+func (s *LocalStore) PresignGet(ctx context.Context, key string, expire time.Duration) (string, error) {
+	return s.presign(http.MethodGet, key, expire)
+}
+
+// PresignPut .
+func (s *LocalStore) PresignPut(ctx context.Context, key string, expire time.Duration) (string, error) {
+	return s.presign(http.MethodPut, key, expire)
+}
+
+func (s *LocalStore) presign(method, key string, expire time.Duration) (string, error) {
+	k, ok := cleanKey(key)
+	if !ok {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	if len(s.secret) == 0 {
+		return "", fmt.Errorf("no signing secret")
+	}
+	expires := strconv.FormatInt(time.Now().Add(expire).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("sign", s.signature(method, k, expires))
+	return s.signRoot + "/" + k + "?" + q.Encode(), nil
+}
+
+func (s *LocalStore) signature(method, key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// serveFile 以附件形式返回对象，类型使用存储时记录的类型，禁止浏览器嗅探，
+// 避免用户上传的文件在本服务的域名下被当作网页执行
+func (s *LocalStore) serveFile(w http.ResponseWriter, r *http.Request, key string) {
+	info, err := s.Stat(r.Context(), key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	name, _ := s.file(key)
+	f, err := os.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", info.ContentType)
+	h.Set("Content-Disposition", "attachment")
+	h.Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// ServeHTTP 处理签名地址的下载和上传，请求路径去掉前缀后即为key
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k, ok := cleanKey(r.URL.Path)
+	if !ok || len(s.secret) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	expires := r.URL.Query().Get("expires")
+	ts, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > ts {
+		http.Error(w, "url expired", http.StatusForbidden)
+		return
+	}
+	want := s.signature(r.Method, k, expires)
+	if !hmac.Equal([]byte(want), []byte(r.URL.Query().Get("sign"))) {
+		http.Error(w, "bad signature", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.serveFile(w, r, k)
+	case http.MethodPut:
+		if err = s.Put(r.Context(), k, r.Body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+			http.Error(w, "put fail", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
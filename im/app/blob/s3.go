@@ -0,0 +1,300 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	maxPresign      = 7 * 24 * time.Hour // SigV4签名地址的最长有效期
+	amzDateFormat   = "20060102T150405Z"
+	defaultTimeout  = time.Minute // 单次请求的默认超时，包含上传和下载内容的时间
+)
+
+// S3Option S3兼容存储的配置，腾讯云COS、MinIO等都可以使用
+type S3Option struct {
+	Endpoint       string // 服务地址，不带协议，如cos.ap-guangzhou.myqcloud.com、127.0.0.1:9000
+	Region         string
+	Bucket         string
+	SecretID       string
+	SecretKey      string
+	DisableSSL     bool
+	ForcePathStyle bool          // 使用endpoint/bucket/key的路径风格，本地MinIO等需要开启
+	Sign           bool          // 下载地址是否需要签名，关闭时要求bucket公有读
+	Expire         time.Duration // 签名地址的有效期
+	Timeout        time.Duration // 单次请求的超时，避免连接卡住时一直阻塞上传和清理任务
+}
+
+// S3Store 基于S3协议的对象存储，使用AWS SigV4签名
+type S3Store struct {
+	opt    S3Option
+	client *http.Client
+	now    func() time.Time // 签名使用的当前时间
+}
+
+// NewS3Store .
+func NewS3Store(opt S3Option) *S3Store {
+	if opt.Expire <= 0 || opt.Expire > maxPresign {
+		opt.Expire = maxPresign
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = defaultTimeout
+	}
+	return &S3Store{opt: opt, client: &http.Client{Timeout: opt.Timeout}, now: time.Now}
+}
+
+// objectURL 对象的访问地址，不带签名
+func (s *S3Store) objectURL(key string) (*url.URL, error) {
+	k, ok := cleanKey(key)
+	if !ok {
+		return nil, fmt.Errorf("invalid key: %q", key)
+	}
+	scheme := "https"
+	if s.opt.DisableSSL {
+		scheme = "http"
+	}
+	u := &url.URL{Scheme: scheme, Host: s.opt.Endpoint, Path: "/" + k}
+	if s.opt.ForcePathStyle {
+		u.Path = "/" + s.opt.Bucket + "/" + k
+	} else {
+		u.Host = s.opt.Bucket + "." + s.opt.Endpoint
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	return u, nil
+}
+
+func (s *S3Store) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signHeader(req, s.now().UTC())
+	return s.client.Do(req)
+}
+
+// Put .
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	rsp, err := s.do(ctx, http.MethodPut, key, r, size, contentType)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	return checkStatus(rsp)
+}
+
+// Get .
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rsp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatus(rsp); err != nil {
+		rsp.Body.Close()
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// Delete 不存在时S3同样返回成功
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	rsp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	return checkStatus(rsp)
+}
+
+// Stat .
+func (s *S3Store) Stat(ctx context.Context, key string) (*Info, error) {
+	rsp, err := s.do(ctx, http.MethodHead, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if err = checkStatus(rsp); err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Key:         key,
+		Size:        rsp.ContentLength,
+		ContentType: rsp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(rsp.Header.Get("ETag"), `"`),
+	}
+	info.ModTime, _ = http.ParseTime(rsp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+// URL .
+func (s *S3Store) URL(ctx context.Context, key string) (string, error) {
+	if s.opt.Sign {
+		return s.PresignGet(ctx, key, s.opt.Expire)
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// PresignGet .
+func (s *S3Store) PresignGet(ctx context.Context, key string, expire time.Duration) (string, error) {
+	return s.presign(http.MethodGet, key, expire)
+}
+
+// PresignPut .
+func (s *S3Store) PresignPut(ctx context.Context, key string, expire time.Duration) (string, error) {
+	return s.presign(http.MethodPut, key, expire)
+}
+
+func checkStatus(rsp *http.Response) error {
+	if rsp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if rsp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("s3 status:%d, body:%s", rsp.StatusCode, msg)
+	}
+	return nil
+}
+
+// ======== AWS SigV4 ========
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.opt.Region + "/s3/aws4_request"
+}
+
+// signHeader 使用Authorization头签名请求
+func (s *S3Store) signHeader(req *http.Request, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		names = append(names, "content-type")
+		values["content-type"] = ct
+		sort.Strings(names)
+	}
+	sig := s.signature(req.Method, req.URL, req.URL.Query(), names, values, now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opt.SecretID, s.scope(now), strings.Join(names, ";"), sig))
+}
+
+// presign 生成查询参数签名的地址
+func (s *S3Store) presign(method, key string, expire time.Duration) (string, error) {
+	if expire <= 0 || expire > maxPresign {
+		expire = maxPresign
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	now := s.now().UTC()
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.opt.SecretID+"/"+s.scope(now))
+	q.Set("X-Amz-Date", now.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expire/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+	sig := s.signature(method, u, q, []string{"host"}, map[string]string{"host": u.Host}, now)
+	q.Set("X-Amz-Signature", sig)
+	u.RawQuery = canonicalQuery(q)
+	return u.String(), nil
+}
+
+func (s *S3Store) signature(method string, u *url.URL, q url.Values, names []string, values map[string]string, now time.Time) string {
+	var headers strings.Builder
+	for _, n := range names {
+		headers.WriteString(n + ":" + strings.TrimSpace(values[n]) + "\n")
+	}
+	canonical := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		canonicalQuery(q),
+		headers.String(),
+		strings.Join(names, ";"),
+		unsignedPayload,
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateFormat),
+		s.scope(now),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.opt.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.opt.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery 按key排序并编码查询参数
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode 按SigV4的规则编码，只保留非保留字符，encodeSlash为false时保留/
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -15,10 +15,13 @@ type ServerInfo struct {
 	Secret        string `yaml:"secret"`
 	TokenExpire   int    `yaml:"token_expire"`
 	DataCenterId  int64  `yaml:"data_center_id"`
+	WorkerId      int64  `yaml:"worker_id"`
 	DebugReqRsp   bool   `yaml:"debug_req_rsp"`
 	ResourceRoot  string `yaml:"resource_root"`
 	RemoteUrlRoot string `yaml:"remote_url_root"`
-	Mode          string `yaml:"mode"` // debug, release, test
+	BlobUrlRoot   string `yaml:"blob_url_root"` // 本地存储签名地址的根，指向本服务的/im/blob/
+	BlobSecret    string `yaml:"blob_secret"`   // 本地存储签名地址的密钥，与token的secret分开，为空时不能生成签名地址
+	Mode          string `yaml:"mode"`          // debug, release, test
 }
 
 // DBInfo db信息
@@ -42,6 +45,121 @@ type ServerCfg struct {
 	ConnInfo   *ConnInfo   `yaml:"conn"`
 	CosInfo    *CosInfo    `yaml:"cos"`
 	LogInfo    *LogInfo    `yaml:"log"`
+	MsgInfo    *MsgInfo    `yaml:"message"`
+	MediaInfo  *MediaInfo  `yaml:"media"`
+	Tenants    []*Tenant   `yaml:"tenants"`
+
+	ModerationInfo *ModerationInfo `yaml:"moderation"`
+	LimitInfo      *LimitInfo      `yaml:"limit"`
+	BroadcastInfo  *BroadcastInfo  `yaml:"broadcast"`
+	BotInfo        *BotInfo        `yaml:"bot"`
+}
+
+// MsgInfo 消息相关配置
+type MsgInfo struct {
+	RecallWindow    int      `yaml:"recall_window"`    // 发送者可撤回时间，单位秒
+	MaxReactors     int      `yaml:"max_reactors"`     // 每个表情返回的回应用户数上限
+	MaxEmojis       int      `yaml:"max_emojis"`       // 每条消息上不同表情的数量上限
+	MaxUserEmojis   int      `yaml:"max_user_emojis"`  // 每个用户在一条消息上回应的不同表情数上限
+	DedupWindow     int      `yaml:"dedup_window"`     // 客户端消息id去重窗口，单位秒
+	DedupSize       int      `yaml:"dedup_size"`       // 去重记录的最大条数
+	CallbackTimeout int      `yaml:"callback_timeout"` // 卡片按钮回调超时，单位毫秒
+	MaxRichText     int      `yaml:"max_rich_text"`    // 富文本渲染成纯文本后的最大字符数
+	LinkSchemes     []string `yaml:"link_schemes"`     // 富文本链接允许的scheme
+	GroupDiffusion  string   `yaml:"group_diffusion"`  // 群消息扩散方式，write写扩散或read读扩散
+	MaxTTL          int      `yaml:"max_ttl"`          // 消息存活时间上限，单位秒
+	ExpireSweep     int      `yaml:"expire_sweep"`     // 清理到期消息的间隔，单位秒
+	SignalTTL       int      `yaml:"signal_ttl"`       // 正在输入等状态的有效期，单位秒
+	SignalInterval  int      `yaml:"signal_interval"`  // 同一发送者在同一会话重复发送同一状态的最小间隔，单位毫秒
+	SignalMaxGroup  int      `yaml:"signal_max_group"` // 超过该人数的群不转发状态
+	ScheduleSweep   int      `yaml:"schedule_sweep"`   // 投递到时间的定时消息的间隔，单位秒
+	IndexSync       int      `yaml:"index_sync"`       // 从存储补齐其他实例上消息改动的索引的间隔，单位秒
+}
+
+// 群消息扩散方式
+const (
+	DiffusionWrite = "write" // 写扩散，新消息写入每个成员的收件箱和会话索引
+	DiffusionRead  = "read"  // 读扩散，新消息只在线推送，成员按会话拉取历史
+)
+
+// MediaInfo 媒体文件相关配置
+type MediaInfo struct {
+	MaxImageSize   int64 `yaml:"max_image_size"`   // 图片最大字节数
+	MaxImagePixels int64 `yaml:"max_image_pixels"` // 图片最大像素数，动图按全部帧累计
+	MaxGIFFrames   int   `yaml:"max_gif_frames"`   // 动图最大帧数
+	ThumbEdge      int   `yaml:"thumb_edge"`       // 缩略图最长边
+	PreviewEdge    int   `yaml:"preview_edge"`     // 预览图最长边
+	MaxFileSize    int64 `yaml:"max_file_size"`    // 文件最大字节数
+	ChunkSize      int64 `yaml:"chunk_size"`       // 分片上传的分片大小
+	UploadExpire   int   `yaml:"upload_expire"`    // 分片上传任务多久没有进展后清理，单位小时
+	MediaExpire    int   `yaml:"media_expire"`     // 上传后一直没有发送的媒体记录多久后清理，单位小时
+	MaxVoiceSize   int64 `yaml:"max_voice_size"`   // 语音最大字节数
+	MaxVoiceTime   int   `yaml:"max_voice_time"`   // 语音最长时长，单位秒
+	WaveformPoints int   `yaml:"waveform_points"`  // 语音波形的采样点数
+	CleanInterval  int   `yaml:"clean_interval"`   // 清理过期上传任务和没有使用的媒体记录的间隔，单位秒
+}
+
+// ModerationInfo 内容审核相关配置
+type ModerationInfo struct {
+	WordFile       string `yaml:"word_file"`       // 敏感词表文件，不配置时不过滤
+	DefaultAction  string `yaml:"default_action"`  // 词表中没有指定处置的词的默认处置，block、mask或flag
+	Mask           string `yaml:"mask"`            // 掩码字符
+	ReloadInterval int    `yaml:"reload_interval"` // 检查词表变化的间隔，单位秒
+}
+
+// RateLimit 令牌桶参数
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`  // 每秒补充的条数
+	Burst int     `yaml:"burst"` // 允许的突发条数
+}
+
+// LimitInfo 发送限流和反垃圾配置
+type LimitInfo struct {
+	Single          *RateLimit `yaml:"single"`            // 单聊
+	Group           *RateLimit `yaml:"group"`             // 群聊
+	NewAccount      *RateLimit `yaml:"new_account"`       // 新账号，叠加在会话类型的限制之上
+	Stranger        *RateLimit `yaml:"stranger"`          // 单聊发给非好友，叠加在会话类型的限制之上
+	Bundle          *RateLimit `yaml:"bundle"`            // 每个用户获取他人公钥包，每次获取会消耗对方的一次性公钥
+	BundlePeer      *RateLimit `yaml:"bundle_peer"`       // 同一用户获取同一个人的公钥包，叠加在bundle之上
+	Bot             *RateLimit `yaml:"bot"`               // 机器人发消息，不叠加其他限制
+	NewAccountHours int        `yaml:"new_account_hours"` // 注册多少小时内算新账号
+	DupWindow       int        `yaml:"dup_window"`        // 重复内容检测窗口，单位秒
+	DupConvs        int        `yaml:"dup_convs"`         // 窗口内同一内容发往的会话数达到该值时判定为群发
+	DupMinLen       int        `yaml:"dup_min_len"`       // 参与重复检测的最短字符数
+	Strikes         int        `yaml:"strikes"`           // 一分钟内被限流的次数达到该值时判定为刷屏
+	MuteTime        int        `yaml:"mute_time"`         // 判定为垃圾消息后自动禁言的时长，单位秒
+}
+
+// BroadcastInfo 系统广播配置
+type BroadcastInfo struct {
+	Admins   []uint64 `yaml:"admins"`   // 可以发送和管理广播的运营账号
+	Interval int      `yaml:"interval"` // 检查定时广播的间隔，单位秒
+}
+
+// IsAdmin 是否是运营账号
+func (b *BroadcastInfo) IsAdmin(uid uint64) bool {
+	for _, id := range b.Admins {
+		if id == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// BotInfo 机器人和出站事件配置
+type BotInfo struct {
+	MaxBots     int `yaml:"max_bots"`     // 每个用户最多创建的机器人数
+	Timeout     int `yaml:"timeout"`      // 出站事件的请求超时，单位毫秒
+	MaxAttempts int `yaml:"max_attempts"` // 出站事件的最多投递次数，用完后记为死信
+	Backoff     int `yaml:"backoff"`      // 首次重试的间隔，单位秒，之后每次翻倍
+	Interval    int `yaml:"interval"`     // 检查待投递事件的间隔，单位秒
+}
+
+// Tenant 租户级别的配置
+type Tenant struct {
+	ID          string `yaml:"id"`
+	AuditRecall bool   `yaml:"audit_recall"` // 撤回的消息是否保留原文用于审计
+	E2ERequired bool   `yaml:"e2e_required"` // 单聊是否只允许端到端加密消息，发送方或接收方的租户开启即生效
 }
 
 type CosInfo struct {
@@ -55,6 +173,7 @@ type CosInfo struct {
 	MediaBucket    string `yaml:"media_bucket"`  // 媒体消息专用，包含图片，语音，文件
 	Expire         int64  `yaml:"expire"`        // 单位小时
 	SignFlag       bool   `yaml:"sign"`          // 是否需要签名，默认需要
+	Timeout        int    `yaml:"timeout"`       // 单次请求的超时，单位秒，默认60秒
 }
 
 type LogInfo struct {
@@ -74,6 +193,16 @@ func AppConfig() *ServerCfg {
 	return cfg
 }
 
+// Tenant 按id获取租户配置，不存在时返回nil
+func (c *ServerCfg) Tenant(id string) *Tenant {
+	for _, t := range c.Tenants {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
 // Init 初始化配置
 func Init(file string) {
 	configFile, err := os.ReadFile(file)
@@ -84,6 +213,192 @@ func Init(file string) {
 	if err = yaml.Unmarshal(configFile, cfg); err != nil {
 		log.Fatalf("Unmarshal conf fail, err:%v", err)
 	}
+	if cfg.MsgInfo == nil {
+		cfg.MsgInfo = &MsgInfo{}
+	}
+	if cfg.MsgInfo.RecallWindow <= 0 {
+		cfg.MsgInfo.RecallWindow = 120
+	}
+	if cfg.MsgInfo.MaxReactors <= 0 {
+		cfg.MsgInfo.MaxReactors = 20
+	}
+	if cfg.MsgInfo.MaxEmojis <= 0 {
+		cfg.MsgInfo.MaxEmojis = 20
+	}
+	if cfg.MsgInfo.MaxUserEmojis <= 0 {
+		cfg.MsgInfo.MaxUserEmojis = 5
+	}
+	if cfg.MsgInfo.DedupWindow <= 0 {
+		cfg.MsgInfo.DedupWindow = 300
+	}
+	if cfg.MsgInfo.DedupSize <= 0 {
+		cfg.MsgInfo.DedupSize = 100000
+	}
+	if cfg.MsgInfo.CallbackTimeout <= 0 {
+		cfg.MsgInfo.CallbackTimeout = 3000
+	}
+	if cfg.MsgInfo.MaxRichText <= 0 {
+		cfg.MsgInfo.MaxRichText = 10000
+	}
+	if len(cfg.MsgInfo.LinkSchemes) == 0 {
+		cfg.MsgInfo.LinkSchemes = []string{"http", "https", "mailto"}
+	}
+	if cfg.MsgInfo.GroupDiffusion != DiffusionRead {
+		cfg.MsgInfo.GroupDiffusion = DiffusionWrite
+	}
+	if cfg.MsgInfo.MaxTTL <= 0 {
+		cfg.MsgInfo.MaxTTL = 7 * 24 * 3600
+	}
+	if cfg.MsgInfo.ExpireSweep <= 0 {
+		cfg.MsgInfo.ExpireSweep = 5
+	}
+	if cfg.MsgInfo.SignalTTL <= 0 {
+		cfg.MsgInfo.SignalTTL = 5
+	}
+	if cfg.MsgInfo.SignalInterval <= 0 {
+		cfg.MsgInfo.SignalInterval = 2000
+	}
+	if cfg.MsgInfo.SignalMaxGroup <= 0 {
+		cfg.MsgInfo.SignalMaxGroup = 50
+	}
+	if cfg.MsgInfo.ScheduleSweep <= 0 {
+		cfg.MsgInfo.ScheduleSweep = 1
+	}
+	if cfg.MsgInfo.IndexSync <= 0 {
+		cfg.MsgInfo.IndexSync = 10
+	}
+	if cfg.MediaInfo == nil {
+		cfg.MediaInfo = &MediaInfo{}
+	}
+	if cfg.MediaInfo.MaxImageSize <= 0 {
+		cfg.MediaInfo.MaxImageSize = 20 << 20
+	}
+	if cfg.MediaInfo.MaxImagePixels <= 0 {
+		cfg.MediaInfo.MaxImagePixels = 50000000
+	}
+	if cfg.MediaInfo.MaxGIFFrames <= 0 {
+		cfg.MediaInfo.MaxGIFFrames = 300
+	}
+	if cfg.MediaInfo.ThumbEdge <= 0 {
+		cfg.MediaInfo.ThumbEdge = 240
+	}
+	if cfg.MediaInfo.PreviewEdge <= 0 {
+		cfg.MediaInfo.PreviewEdge = 1280
+	}
+	if cfg.MediaInfo.MaxFileSize <= 0 {
+		cfg.MediaInfo.MaxFileSize = 2 << 30
+	}
+	if cfg.MediaInfo.ChunkSize <= 0 {
+		cfg.MediaInfo.ChunkSize = 4 << 20
+	}
+	if cfg.MediaInfo.UploadExpire <= 0 {
+		cfg.MediaInfo.UploadExpire = 24
+	}
+	if cfg.MediaInfo.MediaExpire <= 0 {
+		cfg.MediaInfo.MediaExpire = 72
+	}
+	if cfg.MediaInfo.MaxVoiceSize <= 0 {
+		cfg.MediaInfo.MaxVoiceSize = 10 << 20
+	}
+	if cfg.MediaInfo.MaxVoiceTime <= 0 {
+		cfg.MediaInfo.MaxVoiceTime = 60
+	}
+	if cfg.MediaInfo.WaveformPoints <= 0 {
+		cfg.MediaInfo.WaveformPoints = 64
+	}
+	if cfg.MediaInfo.CleanInterval <= 0 {
+		cfg.MediaInfo.CleanInterval = 600
+	}
+
+	if cfg.ModerationInfo == nil {
+		cfg.ModerationInfo = &ModerationInfo{}
+	}
+	if cfg.ModerationInfo.DefaultAction == "" {
+		cfg.ModerationInfo.DefaultAction = "block"
+	}
+	if cfg.ModerationInfo.Mask == "" {
+		cfg.ModerationInfo.Mask = "*"
+	}
+	if cfg.ModerationInfo.ReloadInterval <= 0 {
+		cfg.ModerationInfo.ReloadInterval = 30
+	}
+	initLimit()
+	if cfg.BroadcastInfo == nil {
+		cfg.BroadcastInfo = &BroadcastInfo{}
+	}
+	if cfg.BroadcastInfo.Interval <= 0 {
+		cfg.BroadcastInfo.Interval = 5
+	}
+	initBot()
 
 	log.Printf("load conf ok, path:%s, conf:%v", file, string(configFile))
 }
+
+// initBot 填充机器人配置的默认值
+func initBot() {
+	if cfg.BotInfo == nil {
+		cfg.BotInfo = &BotInfo{}
+	}
+	if cfg.BotInfo.MaxBots <= 0 {
+		cfg.BotInfo.MaxBots = 10
+	}
+	if cfg.BotInfo.Timeout <= 0 {
+		cfg.BotInfo.Timeout = 3000
+	}
+	if cfg.BotInfo.MaxAttempts <= 0 {
+		cfg.BotInfo.MaxAttempts = 6
+	}
+	if cfg.BotInfo.Backoff <= 0 {
+		cfg.BotInfo.Backoff = 2
+	}
+	if cfg.BotInfo.Interval <= 0 {
+		cfg.BotInfo.Interval = 1
+	}
+}
+
+// initLimit 填充限流配置的默认值
+func initLimit() {
+	if cfg.LimitInfo == nil {
+		cfg.LimitInfo = &LimitInfo{}
+	}
+	info := cfg.LimitInfo
+	if info.Single == nil {
+		info.Single = &RateLimit{Rate: 5, Burst: 20}
+	}
+	if info.Group == nil {
+		info.Group = &RateLimit{Rate: 2, Burst: 10}
+	}
+	if info.NewAccount == nil {
+		info.NewAccount = &RateLimit{Rate: 0.5, Burst: 5}
+	}
+	if info.Stranger == nil {
+		info.Stranger = &RateLimit{Rate: 0.2, Burst: 3}
+	}
+	if info.Bundle == nil {
+		info.Bundle = &RateLimit{Rate: 0.2, Burst: 10}
+	}
+	if info.BundlePeer == nil {
+		info.BundlePeer = &RateLimit{Rate: 0.01, Burst: 3}
+	}
+	if info.Bot == nil {
+		info.Bot = &RateLimit{Rate: 20, Burst: 100}
+	}
+	if info.NewAccountHours <= 0 {
+		info.NewAccountHours = 24
+	}
+	if info.DupWindow <= 0 {
+		info.DupWindow = 60
+	}
+	if info.DupConvs <= 0 {
+		info.DupConvs = 5
+	}
+	if info.DupMinLen <= 0 {
+		info.DupMinLen = 10
+	}
+	if info.Strikes <= 0 {
+		info.Strikes = 20
+	}
+	if info.MuteTime <= 0 {
+		info.MuteTime = 600
+	}
+}
@@ -0,0 +1,361 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// 图片处理的错误
+var (
+	ErrUnsupported = errors.New("unsupported media type")
+	ErrTooLarge    = errors.New("media too large")
+	ErrTooManyPix  = errors.New("image has too many pixels")
+)
+
+// ImageOption 图片处理参数
+type ImageOption struct {
+	MaxSize     int64 // 原图最大字节数
+	MaxPixels   int64 // 原图最大像素数，防止解码炸弹，动图按全部帧累计
+	MaxFrames   int   // 动图最大帧数
+	ThumbEdge   int   // 缩略图最长边
+	PreviewEdge int   // 预览图最长边
+}
+
+// Rendition 处理后的一份图片数据
+type Rendition struct {
+	Data   []byte
+	Mime   string
+	Ext    string
+	Width  int
+	Height int
+}
+
+// ImageResult 图片处理结果
+type ImageResult struct {
+	Origin  *Rendition // 去除EXIF等元数据后的原图
+	Thumb   *Rendition // 缩略图
+	Preview *Rendition // 预览图
+}
+
+// imageExt 支持的图片类型及扩展名，类型以内容嗅探为准，不信任客户端声明
+var imageExt = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// SniffImage 嗅探图片真实类型，不支持时返回ErrUnsupported
+func SniffImage(data []byte) (string, error) {
+	mime := http.DetectContentType(data)
+	if _, ok := imageExt[mime]; !ok {
+		return "", ErrUnsupported
+	}
+	return mime, nil
+}
+
+// ProcessImage 校验图片并去除元数据，生成缩略图和预览图
+func ProcessImage(data []byte, opt *ImageOption) (*ImageResult, error) {
+	if opt.MaxSize > 0 && int64(len(data)) > opt.MaxSize {
+		return nil, ErrTooLarge
+	}
+	mime, err := SniffImage(data)
+	if err != nil {
+		return nil, err
+	}
+	var conf image.Config
+	if mime == "image/webp" {
+		conf, err = webp.DecodeConfig(bytes.NewReader(data))
+	} else {
+		conf, _, err = image.DecodeConfig(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	frames := 1
+	if mime == "image/gif" {
+		// 解码全部帧之前先数帧数，每帧不超过画布大小，按帧数累计像素
+		if frames, err = gifFrames(data); err != nil {
+			return nil, err
+		}
+		if opt.MaxFrames > 0 && frames > opt.MaxFrames {
+			return nil, ErrTooManyPix
+		}
+	}
+	if opt.MaxPixels > 0 && int64(conf.Width)*int64(conf.Height)*int64(frames) > opt.MaxPixels {
+		return nil, ErrTooManyPix
+	}
+
+	origin := &Rendition{Mime: mime, Ext: imageExt[mime]}
+	var img image.Image
+	switch mime {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrUnsupported
+		}
+		// EXIF会被去掉，先按方向信息把像素转正
+		img = orient(img, jpegOrientation(data))
+		origin.Data, err = encodeJPEG(img, 90)
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrUnsupported
+		}
+		origin.Data, err = encodePNG(img)
+	case "image/gif":
+		var g *gif.GIF
+		g, err = gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(g.Image) == 0 {
+			return nil, ErrUnsupported
+		}
+		// 重新编码会丢弃注释和应用扩展，保留动画帧
+		img = g.Image[0]
+		buf := &bytes.Buffer{}
+		err = gif.EncodeAll(buf, g)
+		origin.Data = buf.Bytes()
+	case "image/webp":
+		img, err = webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrUnsupported
+		}
+		origin.Data, err = stripWebP(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	origin.Width, origin.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	res := &ImageResult{Origin: origin}
+	if res.Thumb, err = scale(img, opt.ThumbEdge); err != nil {
+		return nil, err
+	}
+	if res.Preview, err = scale(img, opt.PreviewEdge); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// gifFrames 按块结构统计gif的帧数，只跳过数据块不解压像素
+func gifFrames(data []byte) (int, error) {
+	if len(data) < 13 {
+		return 0, ErrUnsupported
+	}
+	i := 13
+	if data[10]&0x80 != 0 { // 全局调色板
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x3B: // 结束
+			return frames, nil
+		case 0x21: // 扩展块，标签之后是数据子块
+			i += 2
+		case 0x2C: // 图像描述符，之后是可选的局部调色板、LZW码长和数据子块
+			if i+10 > len(data) {
+				return 0, ErrUnsupported
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++
+			frames++
+		default:
+			return 0, ErrUnsupported
+		}
+		for i < len(data) && data[i] != 0 {
+			i += int(data[i]) + 1
+		}
+		i++
+	}
+	// 没有结束标记时解码器同样接受已读到的帧
+	return frames, nil
+}
+
+// scale 等比缩放到最长边不超过edge，不放大，不透明的图片输出jpeg，否则输出png
+func scale(img image.Image, edge int) (*Rendition, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if edge > 0 && (w > edge || h > edge) {
+		if w >= h {
+			w, h = edge, max1(h*edge/w)
+		} else {
+			w, h = max1(w*edge/h), edge
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	r := &Rendition{Width: w, Height: h}
+	var err error
+	if dst.Opaque() {
+		r.Mime, r.Ext = "image/jpeg", "jpg"
+		r.Data, err = encodeJPEG(dst, 80)
+	} else {
+		r.Mime, r.Ext = "image/png", "png"
+		r.Data, err = encodePNG(dst)
+	}
+	return r, err
+}
+
+func max1(v int) int {
+	if v < 1 {
+		return 1
+	}
+	return v
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jpegOrientation 读取jpeg中EXIF的方向信息，没有时返回1
+func jpegOrientation(data []byte) int {
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // 图像数据开始，后面不会再有EXIF
+			break
+		}
+		segLen := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + segLen
+		if segLen < 2 || end > len(data) {
+			break
+		}
+		if marker == 0xE1 && segLen >= 8 && string(data[i+4:i+10]) == "Exif\x00\x00" {
+			return tiffOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+	return 1
+}
+
+// tiffOrientation 在TIFF结构的IFD0中查找方向标签0x0112
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < n; k++ {
+		entry := ifd + 2 + k*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orient 按EXIF方向值旋转或翻转图片
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// stripWebP 去掉webp中的EXIF和XMP块，并清除VP8X中对应的标志位
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrUnsupported
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for i := 12; i+8 <= len(data); {
+		fourcc := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size&1
+		if end > len(data) {
+			if i+8+size > len(data) {
+				return nil, ErrUnsupported
+			}
+			end = len(data)
+		}
+		switch fourcc {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF和XMP标志位
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/blob"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// RelPath 媒体文件相对资源根目录的存储路径，按日期分目录，suffix用于区分缩略图等
+func RelPath(kind string, id uint64, t time.Time, suffix, ext string) string {
+	return path.Join(kind, t.Format("20060102"), fmt.Sprintf("%d%s.%s", id, suffix, ext))
+}
+
+// URLFunc 把存储key转换成客户端访问地址
+type URLFunc func(key string) string
+
+// StoreURL 使用对象存储生成访问地址，开启签名时为带有效期的签名地址
+func StoreURL(ctx context.Context, bs blob.Store) URLFunc {
+	return func(key string) string {
+		if key == "" {
+			return ""
+		}
+		u, err := bs.URL(ctx, key)
+		if err != nil {
+			log.ErrorContextf(ctx, "get blob url fail, key:%s, err:%v", key, err)
+		}
+		return u
+	}
+}
+
+// ImageContent 由媒体记录生成图片消息内容
+func ImageContent(m *model.Media, url URLFunc) *model.ImageContent {
+	return &model.ImageContent{
+		MediaID:    m.ID,
+		Width:      m.Width,
+		Height:     m.Height,
+		Size:       m.Size,
+		Mime:       m.Mime,
+		URL:        url(m.Path),
+		ThumbURL:   url(m.ThumbPath),
+		PreviewURL: url(m.PreviewPath),
+	}
+}
+
+// FileContent 由媒体记录生成文件消息内容
+func FileContent(m *model.Media, url URLFunc) *model.FileContent {
+	return &model.FileContent{
+		MediaID: m.ID,
+		Name:    m.Name,
+		Size:    m.Size,
+		Mime:    m.Mime,
+		SHA256:  m.SHA256,
+		URL:     url(m.Path),
+	}
+}
+
+// VoiceContent 由媒体记录生成语音消息内容
+func VoiceContent(m *model.Media, url URLFunc) *model.VoiceContent {
+	return &model.VoiceContent{
+		MediaID:  m.ID,
+		Size:     m.Size,
+		Mime:     m.Mime,
+		Duration: m.Duration,
+		Waveform: m.Waveform,
+		URL:      url(m.Path),
+	}
+}
+
+// Content 按媒体类型生成消息内容
+func Content(m *model.Media, url URLFunc) interface{} {
+	switch m.Kind {
+	case model.MediaImage:
+		return ImageContent(m, url)
+	case model.MediaVoice:
+		return VoiceContent(m, url)
+	}
+	return FileContent(m, url)
+}
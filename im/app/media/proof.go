@@ -0,0 +1,63 @@
+package media
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"math/big"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+const (
+	proofCount  = 8    // 每个对象抽取的区间数
+	proofLength = 4096 // 每个区间的长度，内容更短时取整个内容
+)
+
+// NewProofs 在上传的原始内容中随机抽取若干区间并计算sha256，只知道整体sha256和大小的客户端无法给出
+func NewProofs(r io.ReaderAt, size int64) ([]model.Proof, error) {
+	length := int64(proofLength)
+	if size < length {
+		length = size
+	}
+	buf := make([]byte, length)
+	proofs := make([]model.Proof, 0, proofCount)
+	for i := 0; i < proofCount; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(size-length+1))
+		if err != nil {
+			return nil, err
+		}
+		offset := n.Int64()
+		if _, err = r.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		sum := sha256.Sum256(buf)
+		proofs = append(proofs, model.Proof{Offset: offset, Length: length, Digest: hex.EncodeToString(sum[:])})
+	}
+	return proofs, nil
+}
+
+// Challenge 随机选一个区间让客户端证明持有内容，返回的区间不带摘要，对象没有抽取区间时返回nil
+func Challenge(obj *model.Object) *model.Proof {
+	if len(obj.Proofs) == 0 {
+		return nil
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(obj.Proofs))))
+	if err != nil {
+		return nil
+	}
+	p := obj.Proofs[n.Int64()]
+	return &model.Proof{Offset: p.Offset, Length: p.Length}
+}
+
+// CheckProof 校验客户端给出的区间摘要，区间必须是对象创建时抽取的区间之一
+func CheckProof(obj *model.Object, offset, length int64, digest string) bool {
+	for _, p := range obj.Proofs {
+		if p.Offset == offset && p.Length == length {
+			return subtle.ConstantTimeCompare([]byte(p.Digest), []byte(digest)) == 1
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package media
+
+import (
+	"context"
+	"time"
+
+	"github.com/binbin6363/icuc/common/idgen"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/blob"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// Refs 管理媒体记录对存储对象的引用，同样内容只存一份，最后一个引用释放时才删除
+type Refs struct {
+	st    *store.Store
+	blobs blob.Store
+	ids   *idgen.Snowflake
+}
+
+// NewRefs .
+func NewRefs(st *store.Store, blobs blob.Store, ids *idgen.Snowflake) *Refs {
+	return &Refs{st: st, blobs: blobs, ids: ids}
+}
+
+// Get 按key查找已存在的对象，不增加引用，不存在时返回nil
+func (r *Refs) Get(ctx context.Context, key string) (*model.Object, error) {
+	obj, err := r.st.Object.Get(ctx, key)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	return obj, err
+}
+
+// Acquire 按key查找已存在的对象并增加引用，不存在时返回nil
+func (r *Refs) Acquire(ctx context.Context, key string) (*model.Object, error) {
+	obj, err := r.st.Object.Acquire(ctx, key)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	return obj, err
+}
+
+// Create 保存新上传的对象，并发上传了相同内容时使用先保存的对象，删除本次写入的数据
+func (r *Refs) Create(ctx context.Context, obj *model.Object) (*model.Object, error) {
+	obj.CreateTime = time.Now().UnixMilli()
+	saved, created, err := r.st.Object.Create(ctx, obj)
+	if err != nil {
+		r.deleteBlobs(ctx, obj)
+		return nil, err
+	}
+	if !created {
+		r.deleteBlobs(ctx, obj)
+	}
+	return saved, nil
+}
+
+// NewMedia 为已持有引用的对象生成上传记录，失败时释放引用
+func (r *Refs) NewMedia(ctx context.Context, obj *model.Object, owner uint64, name, sha256 string) (*model.Media, error) {
+	return r.newMedia(ctx, obj, owner, name, sha256, false)
+}
+
+func (r *Refs) newMedia(ctx context.Context, obj *model.Object, owner uint64, name, sha256 string, attached bool) (*model.Media, error) {
+	m := obj.NewMedia(r.ids.Next(), owner, name, sha256, time.Now().UnixMilli())
+	m.Attached = attached
+	if err := r.st.Media.Save(ctx, m); err != nil {
+		r.release(ctx, obj.Key)
+		return nil, err
+	}
+	return m, nil
+}
+
+// Clone 复制一条引用同一对象的媒体记录，每条消息持有自己的附件记录，复制出的记录不会过期清理
+func (r *Refs) Clone(ctx context.Context, m *model.Media, owner uint64) (*model.Media, error) {
+	obj, err := r.st.Object.Acquire(ctx, m.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return r.newMedia(ctx, obj, owner, m.Name, m.SHA256, true)
+}
+
+// Release 删除媒体记录并释放对象引用
+func (r *Refs) Release(ctx context.Context, mediaID uint64) error {
+	m, err := r.st.Media.Get(ctx, mediaID)
+	if err == store.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = r.st.Media.Delete(ctx, mediaID); err != nil {
+		return err
+	}
+	r.release(ctx, m.ObjectKey)
+	return nil
+}
+
+func (r *Refs) release(ctx context.Context, key string) {
+	obj, last, err := r.st.Object.Release(ctx, key)
+	if err != nil {
+		log.WarnContextf(ctx, "release object fail, key:%s, err:%v", key, err)
+		return
+	}
+	if last {
+		r.deleteBlobs(ctx, obj)
+	}
+}
+
+func (r *Refs) deleteBlobs(ctx context.Context, obj *model.Object) {
+	for _, key := range obj.Paths() {
+		if err := r.blobs.Delete(ctx, key); err != nil {
+			log.WarnContextf(ctx, "delete blob fail, key:%s, err:%v", key, err)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrTooLong   = errors.New("voice too long")
+	ErrBadFormat = errors.New("malformed audio")
+)
+
+// VoiceOption 语音校验参数
+type VoiceOption struct {
+	MaxSize        int64
+	MaxDuration    int64 // 最长时长，单位毫秒
+	WaveformPoints int   // 波形采样点数
+}
+
+// VoiceResult 语音解析结果
+type VoiceResult struct {
+	Mime     string
+	Ext      string
+	Codec    string
+	Duration int64 // 单位毫秒
+	Waveform []int // 每个点取值0-100，格式不支持服务端解码时为空
+}
+
+// voiceFormat 白名单中的语音格式
+type voiceFormat struct {
+	mime  string
+	ext   string
+	codec string
+	match func(data []byte) bool
+	probe func(data []byte, res *VoiceResult, points int) error
+}
+
+var voiceFormats = []*voiceFormat{
+	{mime: "audio/ogg", ext: "ogg", codec: "opus", match: isOgg, probe: probeOggOpus},
+	{mime: "audio/mp4", ext: "m4a", codec: "aac", match: isMP4, probe: probeMP4AAC},
+	{mime: "audio/aac", ext: "aac", codec: "aac", match: isADTS, probe: probeADTS},
+	{mime: "audio/wav", ext: "wav", codec: "pcm", match: isWAV, probe: probeWAV},
+}
+
+// ProcessVoice 校验语音的容器和编码是否在白名单中，计算时长，可解码的格式同时计算波形
+func ProcessVoice(data []byte, opt *VoiceOption) (*VoiceResult, error) {
+	if opt.MaxSize > 0 && int64(len(data)) > opt.MaxSize {
+		return nil, ErrTooLarge
+	}
+	for _, f := range voiceFormats {
+		if !f.match(data) {
+			continue
+		}
+		res := &VoiceResult{Mime: f.mime, Ext: f.ext, Codec: f.codec}
+		if err := f.probe(data, res, opt.WaveformPoints); err != nil {
+			return nil, err
+		}
+		if res.Duration <= 0 {
+			return nil, ErrBadFormat
+		}
+		if opt.MaxDuration > 0 && res.Duration > opt.MaxDuration {
+			return nil, ErrTooLong
+		}
+		return res, nil
+	}
+	return nil, ErrUnsupported
+}
+
+func isOgg(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("OggS"))
+}
+
+// probeOggOpus 只接受单路Opus流，时长由最后一页的granule position减去pre-skip得到，采样率固定48k
+func probeOggOpus(data []byte, res *VoiceResult, _ int) error {
+	var (
+		serial  uint32
+		preSkip int64
+		granule int64 = -1
+	)
+	for off, first := 0, true; off < len(data); first = false {
+		if len(data)-off < 27 || !bytes.Equal(data[off:off+4], []byte("OggS")) {
+			return ErrBadFormat
+		}
+		page := data[off:]
+		segs := int(page[26])
+		if len(page) < 27+segs {
+			return ErrBadFormat
+		}
+		size := 0
+		for _, n := range page[27 : 27+segs] {
+			size += int(n)
+		}
+		body := 27 + segs
+		if len(page) < body+size {
+			return ErrBadFormat
+		}
+		if first {
+			serial = binary.LittleEndian.Uint32(page[14:18])
+			head := page[body : body+size]
+			if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+				return ErrUnsupported
+			}
+			preSkip = int64(binary.LittleEndian.Uint16(head[10:12]))
+		} else if binary.LittleEndian.Uint32(page[14:18]) != serial {
+			return ErrUnsupported
+		}
+		if g := int64(binary.LittleEndian.Uint64(page[6:14])); g >= 0 {
+			granule = g
+		}
+		off += body + size
+	}
+	if granule < preSkip {
+		return ErrBadFormat
+	}
+	res.Duration = (granule - preSkip) * 1000 / 48000
+	return nil
+}
+
+func isMP4(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp"))
+}
+
+// probeMP4AAC 只接受全部轨道都是音频且编码为mp4a的文件，时长取自mvhd
+func probeMP4AAC(data []byte, res *VoiceResult, _ int) error {
+	moov, ok := findBox(data, "moov")
+	if !ok {
+		return ErrBadFormat
+	}
+	mvhd, ok := findBox(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return ErrBadFormat
+	}
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return ErrBadFormat
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return ErrBadFormat
+	}
+
+	tracks := 0
+	err := eachBox(moov, func(typ string, trak []byte) error {
+		if typ != "trak" {
+			return nil
+		}
+		tracks++
+		mdia, ok := findBox(trak, "mdia")
+		if !ok {
+			return ErrBadFormat
+		}
+		hdlr, ok := findBox(mdia, "hdlr")
+		if !ok || len(hdlr) < 12 || string(hdlr[8:12]) != "soun" {
+			return ErrUnsupported
+		}
+		stsd, ok := findPath(mdia, "minf", "stbl", "stsd")
+		if !ok || len(stsd) < 16 {
+			return ErrBadFormat
+		}
+		// stsd: version/flags(4) entry_count(4)，之后是sample entry
+		if string(stsd[12:16]) != "mp4a" {
+			return ErrUnsupported
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if tracks != 1 {
+		return ErrUnsupported
+	}
+	res.Duration = int64(duration * 1000 / timescale)
+	return nil
+}
+
+// eachBox 遍历data中的同级box，fn的参数为box类型和box内容
+func eachBox(data []byte, fn func(typ string, body []byte) error) error {
+	for off := 0; off+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[off : off+4]))
+		typ := string(data[off+4 : off+8])
+		head := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - off)
+		case 1:
+			if off+16 > len(data) {
+				return ErrBadFormat
+			}
+			size = binary.BigEndian.Uint64(data[off+8 : off+16])
+			head = 16
+		}
+		if size < head || size > uint64(len(data)-off) {
+			return ErrBadFormat
+		}
+		if err := fn(typ, data[off+int(head):off+int(size)]); err != nil {
+			return err
+		}
+		off += int(size)
+	}
+	return nil
+}
+
+// findBox 查找第一个指定类型的同级box
+func findBox(data []byte, typ string) ([]byte, bool) {
+	var found []byte
+	errFound := errors.New("found")
+	err := eachBox(data, func(t string, body []byte) error {
+		if t == typ {
+			found = body
+			return errFound
+		}
+		return nil
+	})
+	return found, err == errFound
+}
+
+// findPath 按路径逐层查找box
+func findPath(data []byte, path ...string) ([]byte, bool) {
+	for _, typ := range path {
+		var ok bool
+		if data, ok = findBox(data, typ); !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+var adtsRates = []int64{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+func isADTS(data []byte) bool {
+	data = skipID3(data)
+	return len(data) >= 7 && data[0] == 0xFF && data[1]&0xF6 == 0xF0
+}
+
+// skipID3 跳过文件开头的ID3v2标签，部分录音软件会在ADTS前写入
+func skipID3(data []byte) []byte {
+	if len(data) < 10 || !bytes.HasPrefix(data, []byte("ID3")) {
+		return data
+	}
+	size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+	if 10+size > len(data) {
+		return nil
+	}
+	return data[10+size:]
+}
+
+// probeADTS 逐帧解析ADTS头，每帧1024个采样，要求采样率在整个文件中保持不变
+func probeADTS(data []byte, res *VoiceResult, _ int) error {
+	data = skipID3(data)
+	var rate, frames int64
+	for off := 0; off < len(data); {
+		h := data[off:]
+		if len(h) < 7 || h[0] != 0xFF || h[1]&0xF6 != 0xF0 {
+			return ErrBadFormat
+		}
+		idx := int(h[2]>>2) & 0x0F
+		if idx >= len(adtsRates) {
+			return ErrBadFormat
+		}
+		if rate == 0 {
+			rate = adtsRates[idx]
+		} else if rate != adtsRates[idx] {
+			return ErrBadFormat
+		}
+		size := int(h[3]&0x03)<<11 | int(h[4])<<3 | int(h[5]>>5)
+		if size < 7 || size > len(h) {
+			return ErrBadFormat
+		}
+		frames += int64(h[6]&0x03) + 1
+		off += size
+	}
+	res.Duration = frames * 1024 * 1000 / rate
+	return nil
+}
+
+func isWAV(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE"))
+}
+
+// probeWAV 只接受16位PCM，可以直接计算波形
+func probeWAV(data []byte, res *VoiceResult, points int) error {
+	var (
+		channels, bits int
+		rate           int64
+		pcm            []byte
+	)
+	err := eachChunk(data[12:], func(id string, body []byte) error {
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return ErrBadFormat
+			}
+			if binary.LittleEndian.Uint16(body[0:2]) != 1 {
+				return ErrUnsupported
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			rate = int64(binary.LittleEndian.Uint32(body[4:8]))
+			bits = int(binary.LittleEndian.Uint16(body[14:16]))
+		case "data":
+			pcm = body
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if bits != 16 {
+		return ErrUnsupported
+	}
+	if channels == 0 || rate == 0 || pcm == nil {
+		return ErrBadFormat
+	}
+	frame := channels * 2
+	samples := len(pcm) / frame
+	res.Duration = int64(samples) * 1000 / rate
+	res.Waveform = pcmWaveform(pcm, frame, samples, points)
+	return nil
+}
+
+// eachChunk 遍历RIFF chunk，chunk按偶数字节对齐
+func eachChunk(data []byte, fn func(id string, body []byte) error) error {
+	for off := 0; off+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[off+4 : off+8]))
+		if size < 0 || size > len(data)-off-8 {
+			return ErrBadFormat
+		}
+		if err := fn(string(data[off:off+4]), data[off+8:off+8+size]); err != nil {
+			return err
+		}
+		off += 8 + size + size&1
+	}
+	return nil
+}
+
+// pcmWaveform 把采样分成points段，每段取第一声道的峰值，再按全局峰值归一化到0-100
+func pcmWaveform(pcm []byte, frame, samples, points int) []int {
+	if points <= 0 || samples == 0 {
+		return nil
+	}
+	if points > samples {
+		points = samples
+	}
+	peaks := make([]float64, points)
+	var max float64
+	for i := 0; i < samples; i++ {
+		v := math.Abs(float64(int16(binary.LittleEndian.Uint16(pcm[i*frame:]))))
+		p := i * points / samples
+		if v > peaks[p] {
+			peaks[p] = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	wave := make([]int, points)
+	if max == 0 {
+		return wave
+	}
+	for i, v := range peaks {
+		wave[i] = int(math.Round(v * 100 / max))
+	}
+	return wave
+}
@@ -0,0 +1,117 @@
+package model
+
+// 出站事件类型
+const (
+	HookMessage     = "message"      // 会话中有新消息
+	HookCommand     = "command"      // 会话中有发给该机器人的斜杠命令
+	HookMemberJoin  = "member.join"  // 有成员加入群
+	HookMemberLeave = "member.leave" // 有成员离开群
+	HookCardAction  = "card.action"  // 机器人发出的卡片上的按钮被点击，同步推送并等待机器人响应
+)
+
+// HookEvents 机器人可以订阅的事件，斜杠命令和卡片按钮只推给对应的机器人，不需要订阅
+var HookEvents = []string{HookMessage, HookMemberJoin, HookMemberLeave}
+
+// Bot 机器人账号，以自己的uid在加入的会话中收发消息
+type Bot struct {
+	Uid        uint64   `json:"uid"`
+	Name       string   `json:"name"`
+	Owner      uint64   `json:"owner"`              // 创建者，只有创建者可以管理
+	TokenHash  string   `json:"-"`                  // 调用接口的令牌的sha256，令牌本身只在创建和重置时返回一次
+	Secret     string   `json:"-"`                  // 出站事件的签名密钥
+	Webhook    string   `json:"webhook,omitempty"`  // 出站事件的回调地址，为空时不推送
+	Events     []string `json:"events,omitempty"`   // 订阅的事件，为空时订阅全部
+	Commands   []string `json:"commands,omitempty"` // 处理的斜杠命令，不带/
+	CreateTime int64    `json:"create_time"`        // 单位毫秒
+	UpdateTime int64    `json:"update_time"`        // 单位毫秒
+}
+
+// Clone .
+func (b *Bot) Clone() *Bot {
+	c := *b
+	c.Events = append([]string(nil), b.Events...)
+	c.Commands = append([]string(nil), b.Commands...)
+	return &c
+}
+
+// Subscribed 是否订阅了事件
+func (b *Bot) Subscribed(event string) bool {
+	if b.Webhook == "" {
+		return false
+	}
+	if len(b.Events) == 0 {
+		return true
+	}
+	for _, e := range b.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCommand 是否处理该斜杠命令
+func (b *Bot) HasCommand(name string) bool {
+	if b.Webhook == "" {
+		return false
+	}
+	for _, c := range b.Commands {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Command 斜杠命令，消息文本为 /name args
+type Command struct {
+	Name string `json:"name"`
+	Args string `json:"args"`
+}
+
+// HookEvent 推送给机器人的出站事件，重试时ID不变，接收方按ID去重
+type HookEvent struct {
+	ID       uint64       `json:"id,string"`
+	Type     string       `json:"type"`
+	Bot      uint64       `json:"bot"`
+	ConvID   string       `json:"conv_id"`
+	Message  *Message     `json:"message,omitempty"`
+	Command  *Command     `json:"command,omitempty"`
+	Member   *GroupMember `json:"member,omitempty"`
+	Action   *CardAction  `json:"action,omitempty"`
+	Operator uint64       `json:"operator,omitempty"`
+	Time     int64        `json:"time"` // 单位毫秒
+}
+
+// HookStatus 出站事件的投递状态
+type HookStatus int
+
+const (
+	HookPending   HookStatus = 0 // 等待投递或重试
+	HookDelivered HookStatus = 1 // 已投递
+	HookDead      HookStatus = 2 // 多次投递失败，记为死信
+)
+
+// HookDelivery 出站事件的投递记录，失败后按退避时间重试，次数用完后保留为死信
+type HookDelivery struct {
+	ID         uint64     `json:"id,string"` // 与事件ID相同
+	Bot        uint64     `json:"bot"`
+	Event      *HookEvent `json:"event"`
+	Status     HookStatus `json:"status"`
+	Attempts   int        `json:"attempts"`
+	NextTime   int64      `json:"next_time"`            // 下次投递时间，单位毫秒
+	LastError  string     `json:"last_error,omitempty"` // 最近一次失败的原因
+	CreateTime int64      `json:"create_time"`          // 单位毫秒
+	UpdateTime int64      `json:"update_time"`          // 单位毫秒
+}
+
+// NewHookDelivery 新建立即投递的记录
+func NewHookDelivery(ev *HookEvent) *HookDelivery {
+	return &HookDelivery{ID: ev.ID, Bot: ev.Bot, Event: ev, NextTime: ev.Time, CreateTime: ev.Time, UpdateTime: ev.Time}
+}
+
+// Clone 事件在投递过程中不会修改，共享同一份
+func (d *HookDelivery) Clone() *HookDelivery {
+	c := *d
+	return &c
+}
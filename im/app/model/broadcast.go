@@ -0,0 +1,53 @@
+package model
+
+// BroadcastStatus 广播状态
+type BroadcastStatus int
+
+const (
+	BroadcastScheduled BroadcastStatus = 0 // 等待发布时间
+	BroadcastPublished BroadcastStatus = 1 // 已发布到广播时间线
+	BroadcastCanceled  BroadcastStatus = 2 // 已取消，不再下发
+)
+
+// BroadcastTarget 广播的目标用户，各条件之间为且，条件为空时不限
+type BroadcastTarget struct {
+	Tenants    []string `json:"tenants,omitempty"`     // 租户
+	Uids       []uint64 `json:"uids,omitempty"`        // 指定用户分组
+	Platforms  []string `json:"platforms,omitempty"`   // 客户端平台，如ios、android、web
+	MinVersion string   `json:"min_version,omitempty"` // 客户端最低版本，包含
+	MaxVersion string   `json:"max_version,omitempty"` // 客户端最高版本，包含
+}
+
+// Broadcast 系统广播或公告，只存一份，用户同步时按目标条件过滤
+type Broadcast struct {
+	ID          uint64           `json:"id,string"`
+	Seq         uint64           `json:"seq"` // 在广播时间线上的序号，发布时分配
+	Title       string           `json:"title"`
+	Content     string           `json:"content"`
+	Target      *BroadcastTarget `json:"target,omitempty"`
+	Status      BroadcastStatus  `json:"status"`
+	Creator     uint64           `json:"creator"`
+	CreateTime  int64            `json:"create_time"`           // 单位毫秒
+	PublishTime int64            `json:"publish_time"`          // 定时发布时间，单位毫秒
+	ExpireTime  int64            `json:"expire_time,omitempty"` // 过期时间，单位毫秒，0表示不过期
+}
+
+// Clone 拷贝一份广播
+func (b *Broadcast) Clone() *Broadcast {
+	c := *b
+	if b.Target != nil {
+		t := *b.Target
+		t.Tenants = append([]string(nil), b.Target.Tenants...)
+		t.Uids = append([]uint64(nil), b.Target.Uids...)
+		t.Platforms = append([]string(nil), b.Target.Platforms...)
+		c.Target = &t
+	}
+	return &c
+}
+
+// BroadcastStats 广播的投递和阅读统计，按用户去重
+type BroadcastStats struct {
+	BroadcastID uint64 `json:"broadcast_id,string"`
+	Delivered   int    `json:"delivered"`
+	Read        int    `json:"read"`
+}
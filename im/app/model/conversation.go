@@ -0,0 +1,63 @@
+package model
+
+// ConvPreview 会话最后一条消息的摘要
+type ConvPreview struct {
+	MsgID    uint64  `json:"msg_id,string"`
+	Sender   uint64  `json:"sender"`
+	Type     MsgType `json:"type"`
+	Snippet  string  `json:"snippet"`
+	Recalled bool    `json:"recalled,omitempty"`
+	Time     int64   `json:"time"`                  // 单位毫秒
+	Expire   int64   `json:"expire_time,omitempty"` // 消息的到期时间，单位毫秒，到期后不再展示摘要
+}
+
+// NewConvPreview 由消息生成摘要
+func NewConvPreview(msg *Message) *ConvPreview {
+	return &ConvPreview{
+		MsgID:    msg.ID,
+		Sender:   msg.Sender,
+		Type:     msg.Type,
+		Snippet:  msg.Snippet(),
+		Recalled: msg.Recalled(),
+		Time:     msg.SendTime,
+		Expire:   msg.ExpireTime,
+	}
+}
+
+// Conversation 用户视角的会话，最近会话列表中的一项
+// 未读数按会话seq计算，用户自己发消息视为已读到该消息
+type Conversation struct {
+	Uid        uint64       `json:"-"`
+	ConvID     string       `json:"conv_id"`
+	ConvType   ConvType     `json:"conv_type"`
+	Last       *ConvPreview `json:"last,omitempty"`
+	LastSeq    uint64       `json:"last_seq"`
+	ReadSeq    uint64       `json:"read_seq"`
+	Unread     int          `json:"unread"`
+	Mentioned  bool         `json:"mentioned,omitempty"` // 有未读的@
+	MentionSeq uint64       `json:"-"`                   // 最近一次被@的seq，已读到这里后清除提醒
+	ActiveTime int64        `json:"active_time"`         // 最后一条消息的时间，单位毫秒
+	Pinned     bool         `json:"pinned,omitempty"`
+	PinTime    int64        `json:"pin_time,omitempty"` // 单位毫秒
+	Muted      bool         `json:"muted,omitempty"`
+	Archived   bool         `json:"archived,omitempty"`
+	Hidden     bool         `json:"hidden,omitempty"` // 用户删除了会话，有新消息时重新出现
+	Version    uint64       `json:"version"`          // 用户维度递增，多端据此增量同步
+}
+
+// Clone 拷贝一份会话，避免存储层数据被外部修改
+func (c *Conversation) Clone() *Conversation {
+	n := *c
+	if c.Last != nil {
+		last := *c.Last
+		n.Last = &last
+	}
+	return &n
+}
+
+// HideDue 最后一条消息已过存活时间、清理任务还没处理到时清空摘要，与清理后的摘要一致
+func (c *Conversation) HideDue(now int64) {
+	if c.Last != nil && c.Last.Expire > 0 && c.Last.Expire <= now {
+		c.Last.Snippet = ""
+	}
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+
+	"github.com/binbin6363/icuc/im/app/richtext"
+)
+
+// CustomType 注册的自定义消息类型，负载按Schema校验
+type CustomType struct {
+	Name       string          `json:"name"`
+	Schema     json.RawMessage `json:"schema"`
+	Fallback   string          `json:"fallback,omitempty"` // 消息未带兼容文本时使用
+	Owner      uint64          `json:"owner"`              // 注册者，内置类型为0
+	Callback   string          `json:"callback,omitempty"` // 按钮回调地址
+	Secret     string          `json:"-"`                  // 回调签名密钥
+	Version    int             `json:"version"`            // 每次更新加一
+	CreateTime int64           `json:"create_time"`        // 单位毫秒
+	UpdateTime int64           `json:"update_time"`        // 单位毫秒
+}
+
+// CustomContent 自定义消息的内容，序列化后存在Message.Content中
+type CustomContent struct {
+	Type     string          `json:"type"`
+	Version  int             `json:"version"` // 发送时校验所用的类型版本
+	Payload  json.RawMessage `json:"payload"`
+	Fallback string          `json:"fallback"` // 不认识该类型的旧客户端展示的文本
+}
+
+// RichContent 富文本消息的内容，客户端按语法树渲染
+type RichContent struct {
+	Markdown string         `json:"markdown"` // 由过滤后的语法树重新生成，用于编辑，不含原文中被去掉的内容
+	Doc      *richtext.Node `json:"doc"`      // 服务端解析并过滤后的语法树
+}
+
+// CardButton 卡片按钮，带按钮的类型统一把按钮放在payload.buttons中
+type CardButton struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Kind  string `json:"kind"`            // callback回调卡片所属方，url由客户端直接打开
+	Value string `json:"value,omitempty"` // 回调时原样带给所属方，或要打开的地址
+}
+
+const (
+	ButtonCallback = "callback"
+	ButtonURL      = "url"
+)
+
+// CardAction 卡片按钮回调，发给卡片所属的bot或webhook
+type CardAction struct {
+	Type     string `json:"type"` // 自定义消息类型
+	MsgID    uint64 `json:"msg_id,string"`
+	ConvID   string `json:"conv_id"`
+	Sender   uint64 `json:"sender"`   // 卡片发送者
+	Operator uint64 `json:"operator"` // 点击按钮的用户
+	ActionID string `json:"action_id"`
+	Value    string `json:"value,omitempty"`
+	Time     int64  `json:"time"` // 单位毫秒
+}
+
+// CardActionResult 所属方对按钮回调的响应
+type CardActionResult struct {
+	Toast string `json:"toast,omitempty"` // 给点击者的提示
+}
@@ -0,0 +1,72 @@
+package model
+
+// EventType 下发给客户端的事件类型
+type EventType int
+
+const (
+	EventNewMessage EventType = 1  // 新消息
+	EventRecall     EventType = 2  // 消息撤回
+	EventEdit       EventType = 3  // 消息编辑
+	EventReaction   EventType = 4  // 表情回应变化，只在线推送
+	EventMention    EventType = 5  // 被@提醒
+	EventPlayed     EventType = 6  // 语音被收听，只在线推送
+	EventConv       EventType = 7  // 会话设置或已读变化，只在线推送给用户自己的各端
+	EventDelete     EventType = 8  // 用户仅对自己删除了消息，只发给用户自己
+	EventExpire     EventType = 9  // 消息到期，内容已删除
+	EventExpireAt   EventType = 10 // 阅后即焚的消息被首次阅读，开始倒计时，只在线推送
+	EventConvTTL    EventType = 11 // 会话的消息存活时间设置变化
+	EventPreKeyLow  EventType = 12 // 设备的一次性公钥不足，只在线推送给设备所属的用户
+	EventBroadcast  EventType = 13 // 有新的系统广播，只在线推送给指定用户分组，其余用户同步时拉取
+	EventSignal     EventType = 14 // 正在输入等瞬时状态，只在线推送，不落地不计未读
+	EventSchedule   EventType = 15 // 定时消息已发送或发送失败，同步给作者的各端
+)
+
+// Priority 推送优先级，接入服务据此决定是否忽略免打扰
+type Priority int
+
+const (
+	PrioritySilent Priority = -1 // 静默推送，会话免打扰时只更新不提醒
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1 // 高优先级，免打扰时仍然提醒
+)
+
+// Event 在线推送及离线同步的事件
+type Event struct {
+	Type      EventType      `json:"type"`
+	ConvID    string         `json:"conv_id"`
+	MsgID     uint64         `json:"msg_id,string,omitempty"`
+	Operator  uint64         `json:"operator,omitempty"` // 触发事件的用户
+	Time      int64          `json:"time"`               // 事件时间，单位毫秒
+	Priority  Priority       `json:"priority,omitempty"`
+	Message   *Message       `json:"message,omitempty"` // 事件关联的消息
+	Reaction  *ReactionDelta `json:"reaction,omitempty"`
+	Played    *Played        `json:"played,omitempty"`
+	Conv      *Conversation  `json:"conv,omitempty"`
+	TTL       *ConvTTL       `json:"ttl,omitempty"`
+	Device    string         `json:"device,omitempty"` // 事件针对的设备
+	Broadcast *Broadcast     `json:"broadcast,omitempty"`
+	Signal    *Signal        `json:"signal,omitempty"`
+	Schedule  *ScheduledMsg  `json:"schedule,omitempty"`
+}
+
+// SignalKind 会话中的瞬时状态
+type SignalKind int
+
+const (
+	SignalStop      SignalKind = 0 // 结束之前的状态
+	SignalTyping    SignalKind = 1 // 正在输入
+	SignalRecording SignalKind = 2 // 正在录音
+	SignalUploading SignalKind = 3 // 正在发送图片或文件
+)
+
+// Signal 瞬时状态，超过到期时间没有刷新时客户端自动清除
+type Signal struct {
+	Kind       SignalKind `json:"kind"`
+	ExpireTime int64      `json:"expire_time"` // 单位毫秒
+}
+
+// InboxItem 用户收件箱中的一条记录，Seq在用户维度递增
+type InboxItem struct {
+	Seq   uint64 `json:"seq"`
+	Event *Event `json:"event"`
+}
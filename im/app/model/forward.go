@@ -0,0 +1,28 @@
+package model
+
+// ForwardInfo 转发消息的来源，多次转发时保留最初的来源
+type ForwardInfo struct {
+	MsgID    uint64 `json:"msg_id,string"` // 原消息id
+	Sender   uint64 `json:"sender"`        // 原消息发送者
+	SendTime int64  `json:"send_time"`     // 原消息发送时间，单位毫秒
+}
+
+// MergedContent 合并转发的内容，是转发时原消息的快照，原消息之后撤回或编辑不影响已转发的记录
+type MergedContent struct {
+	Title string        `json:"title"`
+	Items []*MergedItem `json:"items"`
+}
+
+// MergedItem 合并转发中的一条消息
+type MergedItem struct {
+	MsgID    uint64  `json:"msg_id,string"`
+	Sender   uint64  `json:"sender"`
+	Type     MsgType `json:"type"`
+	Content  string  `json:"content"` // 原消息内容，媒体消息指向合并转发自己持有的媒体记录
+	SendTime int64   `json:"send_time"`
+}
+
+// HasMedia 消息类型是否持有媒体记录
+func (t MsgType) HasMedia() bool {
+	return t == MsgImage || t == MsgFile || t == MsgVoice
+}
@@ -0,0 +1,23 @@
+package model
+
+// GroupRole 群成员角色
+type GroupRole int
+
+const (
+	RoleMember GroupRole = 0 // 普通成员
+	RoleAdmin  GroupRole = 1 // 管理员
+	RoleOwner  GroupRole = 2 // 群主
+)
+
+// GroupMember 群成员
+type GroupMember struct {
+	GroupID  uint64    `json:"group_id"`
+	Uid      uint64    `json:"uid"`
+	Role     GroupRole `json:"role"`
+	JoinTime int64     `json:"join_time"` // 单位毫秒
+}
+
+// IsManager 是否是群主或管理员
+func (m *GroupMember) IsManager() bool {
+	return m.Role == RoleOwner || m.Role == RoleAdmin
+}
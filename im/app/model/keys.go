@@ -0,0 +1,56 @@
+package model
+
+// PreKey 一次性公钥，被其他用户取走建立会话后即删除
+type PreKey struct {
+	ID  uint32 `json:"id"`
+	Key string `json:"key"` // base64编码的公钥
+}
+
+// SignedPreKey 用身份密钥签名的预共享公钥，由客户端定期轮换，签名由对端客户端校验
+type SignedPreKey struct {
+	ID        uint32 `json:"id"`
+	Key       string `json:"key"`       // base64编码的公钥
+	Signature string `json:"signature"` // base64编码的签名
+}
+
+// DeviceKeys 一个设备公开的长期密钥
+type DeviceKeys struct {
+	Uid          uint64        `json:"uid"`
+	DeviceID     string        `json:"device_id"`
+	IdentityKey  string        `json:"identity_key"` // base64编码的身份公钥
+	SignedPreKey *SignedPreKey `json:"signed_pre_key"`
+	UpdateTime   int64         `json:"update_time"` // 单位毫秒
+}
+
+// Clone 拷贝一份设备密钥
+func (d *DeviceKeys) Clone() *DeviceKeys {
+	c := *d
+	if d.SignedPreKey != nil {
+		spk := *d.SignedPreKey
+		c.SignedPreKey = &spk
+	}
+	return &c
+}
+
+// PreKeyBundle 与一个设备建立加密会话需要的公钥，一次性公钥用完时PreKey为空
+type PreKeyBundle struct {
+	Uid          uint64        `json:"uid"`
+	DeviceID     string        `json:"device_id"`
+	IdentityKey  string        `json:"identity_key"`
+	SignedPreKey *SignedPreKey `json:"signed_pre_key"`
+	PreKey       *PreKey       `json:"pre_key,omitempty"`
+}
+
+// Envelope 发给一个设备的密文
+type Envelope struct {
+	Uid      uint64 `json:"uid"`
+	DeviceID string `json:"device_id"`
+	Type     int    `json:"type"` // 密文类型由客户端定义，如是否携带建立会话用的预共享密钥
+	Body     string `json:"body"` // base64编码的密文
+}
+
+// CipherContent 端到端加密消息的内容，服务端不解密，只校验信封覆盖了双方的全部设备
+type CipherContent struct {
+	SenderDevice string      `json:"sender_device"`
+	Envelopes    []*Envelope `json:"envelopes"`
+}
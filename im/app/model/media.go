@@ -0,0 +1,151 @@
+package model
+
+import "fmt"
+
+// MediaKind 媒体文件类型
+type MediaKind int
+
+const (
+	MediaImage MediaKind = 1 // 图片
+	MediaFile  MediaKind = 2 // 文件
+	MediaVoice MediaKind = 3 // 语音
+)
+
+// Media 上传后的媒体文件记录，路径都是相对于资源根目录的路径
+type Media struct {
+	ID          uint64    `json:"id,string"`
+	Kind        MediaKind `json:"kind"`
+	Owner       uint64    `json:"owner"` // 上传者
+	Mime        string    `json:"mime"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	Duration    int64     `json:"duration,omitempty"` // 语音时长，单位毫秒
+	Waveform    []int     `json:"waveform,omitempty"` // 语音波形，每个点取值0-100
+	Name        string    `json:"name,omitempty"`     // 原始文件名
+	SHA256      string    `json:"sha256,omitempty"`   // 上传内容的sha256，十六进制
+	ObjectKey   string    `json:"object_key"`         // 引用的存储对象，多条媒体记录可共享同一对象
+	Path        string    `json:"path"`
+	ThumbPath   string    `json:"thumb_path,omitempty"`
+	PreviewPath string    `json:"preview_path,omitempty"`
+	Attached    bool      `json:"attached,omitempty"` // 是否由消息或定时消息持有，上传后一直没有使用的记录过期后清理
+	CreateTime  int64     `json:"create_time"`        // 单位毫秒
+}
+
+// Proof 对象原始内容中一段区间的sha256，秒传时用来校验客户端确实持有内容
+type Proof struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Digest string `json:"digest"`
+}
+
+// Object 按内容去重的存储对象，被媒体记录引用计数，计数归零时删除
+type Object struct {
+	Key         string    `json:"key"` // 由类型、上传内容的sha256和大小组成
+	Kind        MediaKind `json:"kind"`
+	Mime        string    `json:"mime"`
+	Size        int64     `json:"size"` // 存储后的大小，图片去除元数据后可能与上传时不同
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	Duration    int64     `json:"duration,omitempty"` // 语音时长，单位毫秒
+	Waveform    []int     `json:"waveform,omitempty"` // 语音波形，每个点取值0-100
+	Path        string    `json:"path"`
+	ThumbPath   string    `json:"thumb_path,omitempty"`
+	PreviewPath string    `json:"preview_path,omitempty"`
+	Proofs      []Proof   `json:"proofs,omitempty"` // 创建时从上传内容中随机抽取的区间，没有时不能秒传
+	RefCount    int       `json:"ref_count"`
+	CreateTime  int64     `json:"create_time"` // 单位毫秒
+}
+
+// ObjectKey 存储对象的去重key
+func ObjectKey(kind MediaKind, sha256 string, size int64) string {
+	return fmt.Sprintf("%d:%s:%d", kind, sha256, size)
+}
+
+// Paths 对象在存储中的全部key
+func (o *Object) Paths() []string {
+	paths := []string{o.Path}
+	if o.ThumbPath != "" {
+		paths = append(paths, o.ThumbPath)
+	}
+	if o.PreviewPath != "" {
+		paths = append(paths, o.PreviewPath)
+	}
+	return paths
+}
+
+// NewMedia 由存储对象生成一条新的媒体记录
+func (o *Object) NewMedia(id, owner uint64, name, sha256 string, now int64) *Media {
+	return &Media{
+		ID:          id,
+		Kind:        o.Kind,
+		Owner:       owner,
+		Mime:        o.Mime,
+		Size:        o.Size,
+		Width:       o.Width,
+		Height:      o.Height,
+		Duration:    o.Duration,
+		Waveform:    append([]int(nil), o.Waveform...),
+		Name:        name,
+		SHA256:      sha256,
+		ObjectKey:   o.Key,
+		Path:        o.Path,
+		ThumbPath:   o.ThumbPath,
+		PreviewPath: o.PreviewPath,
+		CreateTime:  now,
+	}
+}
+
+// ImageContent 图片消息的内容，序列化后存在Message.Content中
+type ImageContent struct {
+	MediaID    uint64 `json:"media_id,string"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Size       int64  `json:"size"`
+	Mime       string `json:"mime"`
+	URL        string `json:"url"`
+	ThumbURL   string `json:"thumb_url"`
+	PreviewURL string `json:"preview_url"`
+}
+
+// FileContent 文件消息的内容，序列化后存在Message.Content中
+type FileContent struct {
+	MediaID uint64 `json:"media_id,string"`
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Mime    string `json:"mime"`
+	SHA256  string `json:"sha256"`
+	URL     string `json:"url"`
+}
+
+// VoiceContent 语音消息的内容，序列化后存在Message.Content中
+type VoiceContent struct {
+	MediaID  uint64 `json:"media_id,string"`
+	Size     int64  `json:"size"`
+	Mime     string `json:"mime"`
+	Duration int64  `json:"duration"` // 单位毫秒
+	Waveform []int  `json:"waveform,omitempty"`
+	URL      string `json:"url"`
+}
+
+// Upload 分片上传任务
+type Upload struct {
+	ID         uint64 `json:"id,string"`
+	Owner      uint64 `json:"owner"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"` // 客户端声明的整个文件的sha256
+	ChunkSize  int64  `json:"chunk_size"`
+	ChunkCount int    `json:"chunk_count"`
+	Done       []bool `json:"-"`           // 各分片是否已上传
+	CreateTime int64  `json:"create_time"` // 单位毫秒
+	UpdateTime int64  `json:"update_time"` // 最后一次上传分片的时间，单位毫秒
+}
+
+// ChunkLen 第index个分片应有的长度
+func (u *Upload) ChunkLen(index int) int64 {
+	if index == u.ChunkCount-1 {
+		return u.Size - int64(index)*u.ChunkSize
+	}
+	return u.ChunkSize
+}
@@ -0,0 +1,11 @@
+package model
+
+// Mention 用户在某个会话中被@的标记，会话已读后清除
+type Mention struct {
+	ConvID string `json:"conv_id"`
+	MsgID  uint64 `json:"msg_id,string"`
+	Seq    uint64 `json:"seq"`
+	Sender uint64 `json:"sender"`
+	All    bool   `json:"all"`  // 是否是@all
+	Time   int64  `json:"time"` // 单位毫秒
+}
@@ -0,0 +1,245 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConvType 会话类型
+type ConvType int
+
+const (
+	ConvSingle ConvType = 1 // 单聊
+	ConvGroup  ConvType = 2 // 群聊
+)
+
+// MsgType 消息类型
+type MsgType int
+
+const (
+	MsgText   MsgType = 1 // 文本消息
+	MsgImage  MsgType = 2 // 图片消息
+	MsgFile   MsgType = 3 // 文件消息
+	MsgVoice  MsgType = 4 // 语音消息
+	MsgCustom MsgType = 5 // 卡片等自定义消息，内容为CustomContent
+	MsgRich   MsgType = 6 // Markdown富文本消息，内容为RichContent
+	MsgCipher MsgType = 7 // 端到端加密消息，内容为CipherContent，仅支持单聊
+	MsgMerged MsgType = 8 // 合并转发的聊天记录，内容为MergedContent
+)
+
+// MsgStatus 消息状态
+type MsgStatus int
+
+const (
+	MsgNormal   MsgStatus = 0 // 正常
+	MsgRecalled MsgStatus = 1 // 已撤回
+	MsgExpired  MsgStatus = 2 // 已到期删除
+)
+
+// TTLFrom 消息存活时间的计时起点
+type TTLFrom int
+
+const (
+	TTLFromSend TTLFrom = 0 // 从发送时开始计时
+	TTLFromRead TTLFrom = 1 // 从发送者以外的成员首次阅读开始计时，即阅后即焚
+)
+
+// Message 存储的一条消息
+type Message struct {
+	ID         uint64       `json:"id,string"`             // 服务端消息id，雪花算法生成
+	ClientID   string       `json:"client_id,omitempty"`   // 客户端生成的消息id，用于发送去重
+	ConvID     string       `json:"conv_id"`               // 会话id
+	ConvType   ConvType     `json:"conv_type"`             // 会话类型
+	Seq        uint64       `json:"seq"`                   // 会话内递增的序号
+	Sender     uint64       `json:"sender"`                // 发送者uid
+	Receiver   uint64       `json:"receiver,omitempty"`    // 单聊接收者uid
+	GroupID    uint64       `json:"group_id,omitempty"`    // 群聊的群id
+	Type       MsgType      `json:"type"`                  // 消息类型
+	Content    string       `json:"content"`               // 消息内容，撤回或到期后清空
+	Status     MsgStatus    `json:"status"`                // 消息状态
+	SendTime   int64        `json:"send_time"`             // 发送时间，单位毫秒
+	RecallTime int64        `json:"recall_time,omitempty"` // 撤回时间，单位毫秒
+	RecallBy   uint64       `json:"recall_by,omitempty"`   // 撤回操作人
+	EditTime   int64        `json:"edit_time,omitempty"`   // 最后一次编辑时间，单位毫秒，非0表示已编辑
+	Version    int          `json:"version,omitempty"`     // 编辑版本号，未编辑时为0
+	Ref        *MsgRef      `json:"ref,omitempty"`         // 引用或回复的消息
+	Mentions   []uint64     `json:"mentions,omitempty"`    // 被@的用户
+	MentionAll bool         `json:"mention_all,omitempty"` // 是否@all
+	TTL        int          `json:"ttl,omitempty"`         // 存活时间，单位秒，0表示不过期
+	TTLFrom    TTLFrom      `json:"ttl_from,omitempty"`    // 存活时间的计时起点
+	ExpireTime int64        `json:"expire_time,omitempty"` // 到期时间，单位毫秒，阅后即焚的消息首次阅读前为0
+	Forward    *ForwardInfo `json:"forward,omitempty"`     // 转发来源，非空表示是转发的消息
+	MediaID    uint64       `json:"-"`                     // 媒体消息持有的媒体记录，每条消息独立引用
+	Media      []uint64     `json:"-"`                     // 合并转发持有的媒体记录，按聊天记录中媒体条目的顺序排列
+	Plain      string       `json:"-"`                     // 富文本的纯文本渲染，用于搜索和摘要
+	HTML       string       `json:"-"`                     // 富文本的html渲染，用于邮件摘要
+	Rev        int          `json:"-"`                     // 存储中的修改次数，条件更新时判断读取之后是否被其他请求修改
+	Change     uint64       `json:"-"`                     // 存储中最后一次写入的全局序号，各实例按它补齐检索索引
+}
+
+// RefMode 消息引用方式
+type RefMode int
+
+const (
+	RefQuote  RefMode = 1 // 引用回复，展示在会话中
+	RefThread RefMode = 2 // 话题回复，归属到根消息的话题下
+)
+
+// MsgRef 引用或回复的父消息信息
+type MsgRef struct {
+	Mode     RefMode `json:"mode"`
+	MsgID    uint64  `json:"msg_id,string"`            // 父消息id
+	RootID   uint64  `json:"root_id,string,omitempty"` // 话题根消息id，仅话题回复
+	Sender   uint64  `json:"sender"`                   // 父消息发送者
+	Snippet  string  `json:"snippet"`                  // 父消息摘要，父消息撤回后为空
+	Recalled bool    `json:"recalled,omitempty"`       // 父消息已撤回
+	Edited   bool    `json:"edited,omitempty"`         // 父消息被编辑过
+}
+
+// ThreadInfo 话题统计信息
+type ThreadInfo struct {
+	RootID        uint64 `json:"root_id,string"`
+	ReplyCount    int    `json:"reply_count"`
+	LastReplyTime int64  `json:"last_reply_time"` // 单位毫秒
+}
+
+// Clone 拷贝一份消息，避免存储层数据被外部修改
+func (m *Message) Clone() *Message {
+	c := *m
+	if m.Ref != nil {
+		ref := *m.Ref
+		c.Ref = &ref
+	}
+	if m.Forward != nil {
+		fwd := *m.Forward
+		c.Forward = &fwd
+	}
+	c.Media = append([]uint64(nil), m.Media...)
+	c.Mentions = append([]uint64(nil), m.Mentions...)
+	return &c
+}
+
+const snippetLen = 50
+
+// Snippet 消息摘要，用于引用和会话列表展示，撤回、到期删除或已过存活时间的消息为空
+func (m *Message) Snippet() string {
+	if m.Recalled() || m.Expired() || m.Due(time.Now().UnixMilli()) {
+		return ""
+	}
+	switch m.Type {
+	case MsgImage:
+		return "[图片]"
+	case MsgFile:
+		return "[文件]"
+	case MsgVoice:
+		return "[语音]"
+	case MsgCipher:
+		return "[加密消息]"
+	case MsgMerged:
+		return "[聊天记录]"
+	}
+	text := m.Content
+	if m.Type == MsgRich {
+		text = m.Plain
+	}
+	if m.Type == MsgCustom {
+		c := &CustomContent{}
+		if json.Unmarshal([]byte(m.Content), c) != nil {
+			return ""
+		}
+		text = c.Fallback
+	}
+	r := []rune(text)
+	if len(r) > snippetLen {
+		return string(r[:snippetLen]) + "..."
+	}
+	return text
+}
+
+// Edited 消息是否被编辑过
+func (m *Message) Edited() bool {
+	return m.EditTime > 0
+}
+
+// Recalled 消息是否已撤回
+func (m *Message) Recalled() bool {
+	return m.Status == MsgRecalled
+}
+
+// Expired 消息是否已到期删除
+func (m *Message) Expired() bool {
+	return m.Status == MsgExpired
+}
+
+// Due 消息在now(毫秒)时是否已过存活时间，清理任务还没处理到时也不能再被查看或修改
+func (m *Message) Due(now int64) bool {
+	return m.ExpireTime > 0 && m.ExpireTime <= now
+}
+
+// ConvTTL 会话的消息存活时间设置，对之后发送的消息生效
+type ConvTTL struct {
+	ConvID   string  `json:"conv_id"`
+	TTL      int     `json:"ttl"` // 单位秒，0表示关闭
+	From     TTLFrom `json:"from"`
+	Operator uint64  `json:"operator"`
+	Time     int64   `json:"time"` // 单位毫秒
+}
+
+// AuditRecord 撤回消息保留的审计记录
+type AuditRecord struct {
+	Msg      *Message `json:"msg"`      // 撤回前的消息原文
+	Operator uint64   `json:"operator"` // 撤回操作人
+	Time     int64    `json:"time"`     // 单位毫秒
+}
+
+// SendResult 一次发送的结果，用于重试时返回
+type SendResult struct {
+	MsgID    uint64 `json:"msg_id,string"`
+	Seq      uint64 `json:"seq"`
+	SendTime int64  `json:"send_time"`
+}
+
+// Revision 消息的一个历史版本
+type Revision struct {
+	MsgID   uint64 `json:"msg_id,string"`
+	Version int    `json:"version"` // 版本号，原始内容为0
+	Content string `json:"content"`
+	Editor  uint64 `json:"editor"`
+	Time    int64  `json:"time"` // 单位毫秒
+}
+
+// SingleConvID 单聊会话id，与双方顺序无关
+func SingleConvID(a, b uint64) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("s_%d_%d", a, b)
+}
+
+// GroupConvID 群聊会话id
+func GroupConvID(groupID uint64) string {
+	return fmt.Sprintf("g_%d", groupID)
+}
+
+// ParseConvID 解析会话id，单聊返回双方uid，群聊返回群id
+func ParseConvID(convID string) (ConvType, []uint64, bool) {
+	parts := strings.Split(convID, "_")
+	ids := make([]uint64, 0, 2)
+	for _, p := range parts[1:] {
+		id, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return 0, nil, false
+		}
+		ids = append(ids, id)
+	}
+	switch {
+	case parts[0] == "s" && len(ids) == 2:
+		return ConvSingle, ids, true
+	case parts[0] == "g" && len(ids) == 1:
+		return ConvGroup, ids, true
+	}
+	return 0, nil, false
+}
@@ -0,0 +1,7 @@
+package model
+
+// Played 语音消息的一条收听记录
+type Played struct {
+	Uid  uint64 `json:"uid"`
+	Time int64  `json:"time"` // 首次收听时间，单位毫秒
+}
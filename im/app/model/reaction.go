@@ -0,0 +1,17 @@
+package model
+
+// Reaction 消息上某个表情的回应
+type Reaction struct {
+	Emoji    string   `json:"emoji"`
+	Count    int      `json:"count"`
+	Reacted  bool     `json:"reacted"`  // 当前用户是否回应过
+	Reactors []uint64 `json:"reactors"` // 最早回应的若干用户，数量有上限
+}
+
+// ReactionDelta 表情回应变化，随事件推送
+type ReactionDelta struct {
+	Emoji string `json:"emoji"`
+	Uid   uint64 `json:"uid"`
+	Added bool   `json:"added"` // true添加，false取消
+	Count int    `json:"count"` // 变化后的数量
+}
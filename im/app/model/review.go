@@ -0,0 +1,13 @@
+package model
+
+// ReviewRecord 审核标记为待复核的消息
+type ReviewRecord struct {
+	MsgID   uint64   `json:"msg_id,string"`
+	ConvID  string   `json:"conv_id"`
+	Sender  uint64   `json:"sender"`
+	Type    MsgType  `json:"type"`
+	Content string   `json:"content"`
+	Words   []string `json:"words,omitempty"`  // 命中的敏感词
+	Reason  string   `json:"reason,omitempty"` // 外部审核给出的原因
+	Time    int64    `json:"time"`             // 单位毫秒
+}
@@ -0,0 +1,40 @@
+package model
+
+// ScheduleStatus 定时消息状态
+type ScheduleStatus int
+
+const (
+	SchedulePending  ScheduleStatus = 0 // 等待发送
+	ScheduleSent     ScheduleStatus = 1 // 已发送
+	ScheduleCanceled ScheduleStatus = 2 // 已取消
+	ScheduleFailed   ScheduleStatus = 3 // 到时间后发送失败，如已不是群成员
+	ScheduleSending  ScheduleStatus = 4 // 已记录消息id正在投递，中断后不会重新发送
+)
+
+// ScheduledMsg 定时发送的消息，到时间后以作者的身份按普通消息发送
+type ScheduledMsg struct {
+	ID         uint64         `json:"id,string"`
+	Sender     uint64         `json:"sender"`                    // 作者
+	Receiver   uint64         `json:"receiver,omitempty"`        // 单聊接收者uid
+	GroupID    uint64         `json:"group_id,omitempty"`        // 群聊群id
+	Type       MsgType        `json:"type"`                      // 消息类型
+	Content    string         `json:"content"`                   // 消息内容，媒体消息在发送时由服务端生成
+	MediaID    uint64         `json:"media_id,string,omitempty"` // 定时消息持有的媒体记录，由上传得到的记录复制
+	ReplyTo    uint64         `json:"reply_to,string,omitempty"` // 引用或回复的父消息id
+	RefMode    RefMode        `json:"ref_mode,omitempty"`
+	TTL        int            `json:"ttl,omitempty"`
+	TTLFrom    TTLFrom        `json:"ttl_from,omitempty"`
+	SendAt     int64          `json:"send_at"` // 计划发送时间，单位毫秒
+	Status     ScheduleStatus `json:"status"`
+	MsgID      uint64         `json:"msg_id,string,omitempty"` // 发送后的消息id
+	Code       int            `json:"code,omitempty"`          // 发送失败的错误码
+	Reason     string         `json:"reason,omitempty"`        // 发送失败的原因
+	CreateTime int64          `json:"create_time"`             // 单位毫秒
+	UpdateTime int64          `json:"update_time"`             // 单位毫秒
+}
+
+// Clone .
+func (m *ScheduledMsg) Clone() *ScheduledMsg {
+	c := *m
+	return &c
+}
@@ -0,0 +1,8 @@
+package model
+
+// User 用户基础信息
+type User struct {
+	Uid        uint64 `json:"uid"`
+	TenantID   string `json:"tenant_id"`   // 所属租户
+	CreateTime int64  `json:"create_time"` // 注册时间，单位毫秒
+}
@@ -0,0 +1,29 @@
+package moderation
+
+import (
+	"context"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// Content 送外部审核的内容
+type Content struct {
+	MsgType model.MsgType
+	Text    string       // 消息中可见的文本
+	Media   *model.Media // 图片、语音和文件消息的媒体记录
+	URL     string       // 媒体的下载地址
+}
+
+// Checker 外部内容审核，如云厂商的文本和图片审核接口
+// 只支持放行、标记和拦截，返回掩码时按拦截处理
+type Checker interface {
+	Check(ctx context.Context, c *Content) (*Result, error)
+}
+
+// LocalChecker 本地占位实现，全部放行，没有接入外部审核时使用
+type LocalChecker struct{}
+
+// Check .
+func (LocalChecker) Check(ctx context.Context, c *Content) (*Result, error) {
+	return &Result{Action: ActionPass}, nil
+}
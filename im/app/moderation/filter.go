@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/binbin6363/icuc/common/log"
+)
+
+// Result 审核结果
+type Result struct {
+	Action Action
+	Text   string   // 掩码后的文本，Action为ActionMask时有效
+	Words  []string // 命中的敏感词
+	Reason string   // 外部审核给出的原因
+}
+
+// Filter 敏感词过滤器，词表文件变化后重新加载，加载失败时保留旧词表
+type Filter struct {
+	file    string
+	action  Action // 词表中没有指定处置的词使用的默认处置
+	mask    rune
+	matcher atomic.Pointer[Matcher]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewFilter file为空时只能通过SetWords设置词表
+func NewFilter(file string, action Action, mask rune) *Filter {
+	f := &Filter{file: file, action: action, mask: mask}
+	f.matcher.Store(NewMatcher(nil))
+	return f
+}
+
+// SetWords 直接替换词表
+func (f *Filter) SetWords(words []*Word) {
+	f.matcher.Store(NewMatcher(words))
+}
+
+// Load 词表文件有变化时重新加载
+func (f *Filter) Load() error {
+	if f.file == "" {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.file)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+	words, err := f.readWords()
+	if err != nil {
+		return err
+	}
+	m := NewMatcher(words)
+	f.matcher.Store(m)
+	f.modTime, f.size = info.ModTime(), info.Size()
+	log.Infof("load sensitive words done, file:%s, count:%d", f.file, m.Len())
+	return nil
+}
+
+// readWords 每行一个词，可在词后以空白分隔指定block、mask或flag，#开头为注释
+func (f *Filter) readWords() ([]*Word, error) {
+	fp, err := os.Open(f.file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	var words []*Word
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		w := &Word{Text: fields[0], Action: f.action}
+		if len(fields) > 1 {
+			if a, ok := ParseAction(fields[1]); ok {
+				w.Action = a
+			}
+		}
+		words = append(words, w)
+	}
+	return words, scanner.Err()
+}
+
+// Watch 定期检查词表文件，ctx结束后退出
+func (f *Filter) Watch(ctx context.Context, interval time.Duration) {
+	if f.file == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Load(); err != nil {
+				log.Errorf("reload sensitive words fail, file:%s, err:%v", f.file, err)
+			}
+		}
+	}
+}
+
+// Check 过滤文本，处置取命中词中最严格的；结果为掩码时，处置为掩码的词替换为掩码字符
+func (f *Filter) Check(text string) *Result {
+	hits := f.matcher.Load().Find(text)
+	res := &Result{Text: text}
+	if len(hits) == 0 {
+		return res
+	}
+	seen := make(map[string]bool)
+	for _, h := range hits {
+		if h.Word.Action > res.Action {
+			res.Action = h.Word.Action
+		}
+		if !seen[h.Word.Text] {
+			seen[h.Word.Text] = true
+			res.Words = append(res.Words, h.Word.Text)
+		}
+	}
+	if res.Action == ActionMask {
+		res.Text = f.apply(text, hits)
+	}
+	return res
+}
+
+// apply 把处置为掩码的命中区间替换为掩码字符，区间内跳过的字符一并替换
+func (f *Filter) apply(text string, hits []*Hit) string {
+	runes := []rune(text)
+	for _, h := range hits {
+		if h.Word.Action != ActionMask {
+			continue
+		}
+		for i := h.Start; i < h.End; i++ {
+			runes[i] = f.mask
+		}
+	}
+	return string(runes)
+}
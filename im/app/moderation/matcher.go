@@ -0,0 +1,189 @@
+// Package moderation 消息落地前的内容审核：敏感词过滤及外部审核接入
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Action 命中后的处置，数值越大越严格
+type Action int
+
+const (
+	ActionPass  Action = 0
+	ActionFlag  Action = 1 // 放行但记录，供人工复核
+	ActionMask  Action = 2 // 命中的词替换为掩码后放行
+	ActionBlock Action = 3 // 拒绝发送
+)
+
+var actionNames = map[string]Action{"pass": ActionPass, "flag": ActionFlag, "mask": ActionMask, "block": ActionBlock}
+
+// ParseAction 解析配置和词表中的处置名称
+func ParseAction(name string) (Action, bool) {
+	a, ok := actionNames[strings.ToLower(name)]
+	return a, ok
+}
+
+func (a Action) String() string {
+	for name, v := range actionNames {
+		if v == a {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Word 敏感词及其处置
+type Word struct {
+	Text   string
+	Action Action
+}
+
+// Hit 一处命中，Start和End为原文中按字符计数的左闭右开区间
+type Hit struct {
+	Start int
+	End   int
+	Word  *Word
+}
+
+// fold 统一大小写并把全角字母数字转成半角
+func fold(r rune) rune {
+	if r >= 0xFF01 && r <= 0xFF5E {
+		r -= 0xFEE0
+	}
+	return unicode.ToLower(r)
+}
+
+// noise 匹配时跳过的字符，防止在敏感词中间插入空格、标点或表情绕过
+func noise(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// normalize 词表中的词按匹配规则归一化
+func normalize(text string) []rune {
+	var out []rune
+	for _, r := range text {
+		if r = fold(r); !noise(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+type acNode struct {
+	next map[rune]int
+	fail int
+	word int   // 以该节点结尾的词，没有时为-1
+	out  []int // 匹配到该节点时命中的全部词，包含后缀链接上的词
+}
+
+// Matcher Aho-Corasick自动机，构建后只读，可以并发使用
+type Matcher struct {
+	nodes []acNode
+	words []*Word
+	lens  []int // 归一化后的词长
+}
+
+// NewMatcher 构建自动机，归一化后相同的词取更严格的处置
+func NewMatcher(words []*Word) *Matcher {
+	m := &Matcher{nodes: []acNode{{next: make(map[rune]int), word: -1}}}
+	for _, w := range words {
+		key := normalize(w.Text)
+		if len(key) == 0 {
+			continue
+		}
+		cur := 0
+		for _, r := range key {
+			nxt, ok := m.nodes[cur].next[r]
+			if !ok {
+				nxt = len(m.nodes)
+				m.nodes = append(m.nodes, acNode{next: make(map[rune]int), word: -1})
+				m.nodes[cur].next[r] = nxt
+			}
+			cur = nxt
+		}
+		if i := m.nodes[cur].word; i >= 0 {
+			if w.Action > m.words[i].Action {
+				m.words[i].Action = w.Action
+			}
+			continue
+		}
+		m.nodes[cur].word = len(m.words)
+		m.words = append(m.words, &Word{Text: w.Text, Action: w.Action})
+		m.lens = append(m.lens, len(key))
+	}
+	m.build()
+	return m
+}
+
+// build 按层次遍历计算失败指针，并把后缀链接上的词合并到输出
+func (m *Matcher) build() {
+	queue := []int{0}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		if w := m.nodes[u].word; w >= 0 {
+			m.nodes[u].out = append(m.nodes[u].out, w)
+		}
+		if u != 0 {
+			m.nodes[u].out = append(m.nodes[u].out, m.nodes[m.nodes[u].fail].out...)
+		}
+		for r, v := range m.nodes[u].next {
+			if u != 0 {
+				f := m.nodes[u].fail
+				for {
+					if nxt, ok := m.nodes[f].next[r]; ok {
+						m.nodes[v].fail = nxt
+						break
+					}
+					if f == 0 {
+						break
+					}
+					f = m.nodes[f].fail
+				}
+			}
+			queue = append(queue, v)
+		}
+	}
+}
+
+// Len 词表中的词数
+func (m *Matcher) Len() int {
+	return len(m.words)
+}
+
+// Find 返回文本中全部命中，可能重叠
+func (m *Matcher) Find(text string) []*Hit {
+	if len(m.words) == 0 {
+		return nil
+	}
+	var (
+		hits  []*Hit
+		pos   []int // 参与匹配的字符在原文中的位置
+		state int
+		i     int
+	)
+	for _, r := range text {
+		idx := i
+		i++
+		if r = fold(r); noise(r) {
+			continue
+		}
+		pos = append(pos, idx)
+		for {
+			if nxt, ok := m.nodes[state].next[r]; ok {
+				state = nxt
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = m.nodes[state].fail
+		}
+		for _, w := range m.nodes[state].out {
+			start := pos[len(pos)-m.lens[w]]
+			hits = append(hits, &Hit{Start: start, End: idx + 1, Word: m.words[w]})
+		}
+	}
+	return hits
+}
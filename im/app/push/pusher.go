@@ -0,0 +1,72 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// Pusher 在线推送，用户不在线时由接入服务丢弃，客户端上线后通过同步补齐
+type Pusher interface {
+	Push(ctx context.Context, uids []uint64, ev *model.Event) error
+}
+
+// pushReq 发给接入服务的推送请求
+type pushReq struct {
+	Uids  []uint64     `json:"uids"`
+	Event *model.Event `json:"event"`
+}
+
+// ConnPusher 通过http调用接入服务推送
+type ConnPusher struct {
+	url    string
+	client *http.Client
+}
+
+// NewConnPusher addr为接入服务地址，timeout单位毫秒
+func NewConnPusher(addr string, timeout int) *ConnPusher {
+	return &ConnPusher{
+		url:    fmt.Sprintf("http://%s/push", addr),
+		client: &http.Client{Timeout: time.Duration(timeout) * time.Millisecond},
+	}
+}
+
+// Push .
+func (p *ConnPusher) Push(ctx context.Context, uids []uint64, ev *model.Event) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(&pushReq{Uids: uids, Event: ev})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("push to conn fail, status:%d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// LogPusher 只打印日志的推送实现，没有配置接入服务时使用
+type LogPusher struct{}
+
+// Push .
+func (LogPusher) Push(ctx context.Context, uids []uint64, ev *model.Event) error {
+	log.DebugContextf(ctx, "push event, uids:%v, type:%d, conv:%s", uids, ev.Type, ev.ConvID)
+	return nil
+}
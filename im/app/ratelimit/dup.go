@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DupDetector 检测同一发送者在时间窗口内把相同内容发往多个会话
+type DupDetector struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]map[string]time.Time // 发送者和内容摘要 -> 会话id -> 最近发送时间
+	lastSweep time.Time
+}
+
+// NewDupDetector .
+func NewDupDetector(window time.Duration) *DupDetector {
+	return &DupDetector{window: window, entries: make(map[string]map[string]time.Time)}
+}
+
+// Add 记录一次发送，返回窗口内该内容发往的不同会话数
+func (d *DupDetector) Add(sender uint64, content, convID string, now time.Time) int {
+	sum := sha1.Sum([]byte(strings.Join(strings.Fields(content), " ")))
+	key := strconv.FormatUint(sender, 10) + ":" + hex.EncodeToString(sum[:])
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(now)
+	convs, ok := d.entries[key]
+	if !ok {
+		convs = make(map[string]time.Time)
+		d.entries[key] = convs
+	}
+	convs[convID] = now
+	n := 0
+	for id, t := range convs {
+		if now.Sub(t) > d.window {
+			delete(convs, id)
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func (d *DupDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.window {
+		return
+	}
+	d.lastSweep = now
+	for key, convs := range d.entries {
+		for id, t := range convs {
+			if now.Sub(t) > d.window {
+				delete(convs, id)
+			}
+		}
+		if len(convs) == 0 {
+			delete(d.entries, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package ratelimit 发送限流和垃圾消息检测
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	idleTimeout   = 10 * time.Minute // 桶多久没有使用后清理
+	sweepInterval = time.Minute
+)
+
+// Limit 令牌桶参数，Rate为每秒补充的令牌数，Burst为桶容量
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Req 一次取令牌的请求
+type Req struct {
+	Key   string
+	Limit Limit
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter 按key划分的令牌桶，长时间未使用的桶自动清理
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter .
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket)}
+}
+
+// Allow 从每个桶各取一个令牌，全部满足时才扣除，否则返回最长需要等待的时间
+// Rate或Burst不大于0的请求不限制
+func (l *Limiter) Allow(now time.Time, reqs ...Req) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	var wait time.Duration
+	buckets := make([]*bucket, len(reqs))
+	for i, r := range reqs {
+		if r.Limit.Rate <= 0 || r.Limit.Burst <= 0 {
+			continue
+		}
+		b, ok := l.buckets[r.Key]
+		if !ok {
+			b = &bucket{tokens: float64(r.Limit.Burst), last: now}
+			l.buckets[r.Key] = b
+		}
+		b.tokens += now.Sub(b.last).Seconds() * r.Limit.Rate
+		if b.tokens > float64(r.Limit.Burst) {
+			b.tokens = float64(r.Limit.Burst)
+		}
+		b.last = now
+		buckets[i] = b
+		if b.tokens < 1 {
+			if w := time.Duration((1 - b.tokens) / r.Limit.Rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range buckets {
+		if b != nil {
+			b.tokens--
+		}
+	}
+	return true, 0
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Package richtext 把富文本消息使用的Markdown子集解析成安全的语法树，并渲染为纯文本和html
+//
+// 支持的块：段落、标题、围栏代码块、引用、有序和无序列表、分隔线；
+// 支持的行内元素：粗体、斜体、删除线、行内代码、链接、自动识别的网址和换行。
+// 原始html一律去掉，链接只保留白名单中的scheme，其余降级为文本。
+package richtext
+
+// NodeType 语法树节点类型
+type NodeType string
+
+const (
+	NodeDoc       NodeType = "doc"
+	NodePara      NodeType = "p"
+	NodeHeading   NodeType = "heading"
+	NodeCodeBlock NodeType = "code_block"
+	NodeQuote     NodeType = "quote"
+	NodeList      NodeType = "list"
+	NodeItem      NodeType = "item"
+	NodeRule      NodeType = "hr"
+	NodeText      NodeType = "text"
+	NodeStrong    NodeType = "strong"
+	NodeEm        NodeType = "em"
+	NodeDel       NodeType = "del"
+	NodeCode      NodeType = "code"
+	NodeLink      NodeType = "link"
+	NodeBreak     NodeType = "br"
+)
+
+// Node 语法树节点，客户端按节点渲染，不需要再解析Markdown
+type Node struct {
+	Type     NodeType `json:"type"`
+	Level    int      `json:"level,omitempty"`   // 标题级别
+	Ordered  bool     `json:"ordered,omitempty"` // 有序列表
+	Start    int      `json:"start,omitempty"`   // 有序列表起始序号
+	Lang     string   `json:"lang,omitempty"`    // 代码块语言
+	Text     string   `json:"text,omitempty"`    // 文本、行内代码和代码块的内容
+	Href     string   `json:"href,omitempty"`    // 链接地址
+	Children []*Node  `json:"children,omitempty"`
+}
+
+// appendText 追加文本节点，与前一个文本节点合并
+func appendText(nodes []*Node, text string) []*Node {
+	if text == "" {
+		return nodes
+	}
+	if n := len(nodes); n > 0 && nodes[n-1].Type == NodeText {
+		nodes[n-1].Text += text
+		return nodes
+	}
+	return append(nodes, &Node{Type: NodeText, Text: text})
+}
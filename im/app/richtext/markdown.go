@@ -0,0 +1,147 @@
+package richtext
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Markdown 由过滤后的语法树重新生成Markdown，用于客户端编辑，原文中被去掉的html和链接不会出现
+// 文本中的标记字符都加上转义，重新解析得到的仍是这棵语法树
+func Markdown(doc *Node) string {
+	var b strings.Builder
+	mdBlocks(&b, doc.Children, "")
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func mdBlocks(b *strings.Builder, nodes []*Node, prefix string) {
+	for i, n := range nodes {
+		if i > 0 {
+			b.WriteString(strings.TrimRight(prefix, " ") + "\n")
+		}
+		switch n.Type {
+		case NodeHeading:
+			b.WriteString(prefix + strings.Repeat("#", n.Level) + " ")
+			mdInline(b, n.Children, prefix, false)
+			b.WriteString("\n")
+		case NodeCodeBlock:
+			fence := strings.Repeat("`", maxRun(n.Text, '`')+1)
+			if len(fence) < 3 {
+				fence = "```"
+			}
+			b.WriteString(prefix + fence + n.Lang + "\n")
+			if n.Text != "" {
+				for _, line := range strings.Split(n.Text, "\n") {
+					b.WriteString(prefix + line + "\n")
+				}
+			}
+			b.WriteString(prefix + fence + "\n")
+		case NodeQuote:
+			mdBlocks(b, n.Children, prefix+"> ")
+		case NodeList:
+			for k, item := range n.Children {
+				mark := "- "
+				if n.Ordered {
+					mark = strconv.Itoa(listStart(n)+k) + ". "
+				}
+				b.WriteString(prefix + mark)
+				mdInline(b, item.Children, prefix+strings.Repeat(" ", len(mark)), false)
+				b.WriteString("\n")
+			}
+		case NodeRule:
+			b.WriteString(prefix + "---\n")
+		default:
+			b.WriteString(prefix)
+			mdInline(b, n.Children, prefix, true)
+			b.WriteString("\n")
+		}
+	}
+}
+
+// mdInline lineStart表示当前位置是否在行首，行首的列表、标题等块标记也要转义
+func mdInline(b *strings.Builder, nodes []*Node, prefix string, lineStart bool) {
+	for _, n := range nodes {
+		switch n.Type {
+		case NodeText:
+			b.WriteString(escapeText(n.Text, lineStart))
+		case NodeCode:
+			fence := strings.Repeat("`", maxRun(n.Text, '`')+1)
+			text := n.Text
+			if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") || strings.HasPrefix(text, " ") || strings.HasSuffix(text, " ") {
+				text = " " + text + " "
+			}
+			b.WriteString(fence + text + fence)
+		case NodeBreak:
+			b.WriteString("\n" + prefix)
+			lineStart = true
+			continue
+		case NodeLink:
+			if len(n.Children) == 1 && n.Children[0].Type == NodeText && n.Children[0].Text == n.Href && autoRegexp.FindString(n.Href) == n.Href {
+				b.WriteString("<" + n.Href + ">")
+				break
+			}
+			b.WriteString("[")
+			mdInline(b, n.Children, prefix, false)
+			b.WriteString("](" + mdHref(n.Href) + ")")
+		case NodeStrong:
+			mdSpan(b, "**", n.Children, prefix)
+		case NodeEm:
+			mdSpan(b, "*", n.Children, prefix)
+		case NodeDel:
+			mdSpan(b, "~~", n.Children, prefix)
+		}
+		lineStart = false
+	}
+}
+
+func mdSpan(b *strings.Builder, delim string, children []*Node, prefix string) {
+	b.WriteString(delim)
+	mdInline(b, children, prefix, false)
+	b.WriteString(delim)
+}
+
+// hrefReplacer 地址中的括号和尖括号按百分号编码，不影响地址含义，避免提前结束链接
+var hrefReplacer = strings.NewReplacer("(", "%28", ")", "%29", "<", "%3C", ">", "%3E")
+
+// mdHref 括号成对且没有尖括号时保持原样
+func mdHref(href string) string {
+	if strings.Count(href, "(") == strings.Count(href, ")") && matchParen(href) < 0 && !strings.ContainsAny(href, "<>") {
+		return href
+	}
+	return hrefReplacer.Replace(href)
+}
+
+// escapeText 转义行内标记字符，行首时额外转义块标记
+func escapeText(s string, lineStart bool) string {
+	var b strings.Builder
+	digits := lineStart
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte("\\`*_~[]<>#", c) >= 0:
+			b.WriteByte('\\')
+		case lineStart && i == 0 && (c == '-' || c == '+'):
+			b.WriteByte('\\')
+		case digits && i > 0 && (c == '.' || c == ')'):
+			b.WriteByte('\\')
+		}
+		digits = digits && c >= '0' && c <= '9'
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// maxRun 字符c最长的连续次数
+func maxRun(s string, c byte) int {
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != c {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
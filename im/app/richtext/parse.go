@@ -0,0 +1,467 @@
+package richtext
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxQuoteDepth  = 3    // 引用最多嵌套层数
+	maxInlineDepth = 8    // 行内元素最多嵌套层数
+	maxSpanLen     = 2000 // 行内元素结束标记最远的查找距离，避免恶意输入导致平方级耗时
+)
+
+var (
+	headingRegexp = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	ruleRegexp    = regexp.MustCompile(`^\s{0,3}((-\s*){3,}|(\*\s*){3,}|(_\s*){3,})$`)
+	bulletRegexp  = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedRegexp = regexp.MustCompile(`^\s{0,3}(\d{1,9})[.)]\s+(.*)$`)
+	fenceRegexp   = regexp.MustCompile("^\\s{0,3}(```+|~~~+)\\s*([A-Za-z0-9_+#.-]{0,20})")
+	htmlRegexp    = regexp.MustCompile(`^(<!--[\s\S]*?-->|</?[A-Za-z][A-Za-z0-9-]*(\s[^<>]*)?/?>)`)
+	autoRegexp    = regexp.MustCompile(`^https?://[^\s<>]+`)
+)
+
+// Options 解析参数
+type Options struct {
+	Schemes []string // 允许的链接scheme，为空时只允许http和https
+}
+
+type parser struct {
+	schemes map[string]bool
+}
+
+// Parse 解析Markdown子集
+func Parse(src string, opt *Options) *Node {
+	p := &parser{schemes: map[string]bool{}}
+	schemes := []string{"http", "https"}
+	if opt != nil && len(opt.Schemes) > 0 {
+		schemes = opt.Schemes
+	}
+	for _, s := range schemes {
+		p.schemes[strings.ToLower(s)] = true
+	}
+	src = strings.ToValidUTF8(src, "�")
+	src = strings.ReplaceAll(strings.ReplaceAll(src, "\r\n", "\n"), "\r", "\n")
+	src = strings.ReplaceAll(src, "\x00", "")
+	return &Node{Type: NodeDoc, Children: p.blocks(strings.Split(src, "\n"), 0)}
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// blocks 逐行解析块级元素
+func (p *parser) blocks(lines []string, depth int) []*Node {
+	var nodes []*Node
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRegexp.MatchString(line):
+			var n *Node
+			n, i = p.codeBlock(lines, i)
+			nodes = append(nodes, n)
+		case headingRegexp.MatchString(line):
+			m := headingRegexp.FindStringSubmatch(line)
+			nodes = append(nodes, &Node{Type: NodeHeading, Level: len(m[1]), Children: p.inline(m[2], 0)})
+			i++
+		case ruleRegexp.MatchString(line):
+			nodes = append(nodes, &Node{Type: NodeRule})
+			i++
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			var inner []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i], " "), ">"); i++ {
+				l := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				inner = append(inner, strings.TrimPrefix(l, " "))
+			}
+			if depth >= maxQuoteDepth {
+				nodes = append(nodes, &Node{Type: NodePara, Children: p.inline(strings.Join(inner, "\n"), 0)})
+				continue
+			}
+			nodes = append(nodes, &Node{Type: NodeQuote, Children: p.blocks(inner, depth+1)})
+		case bulletRegexp.MatchString(line) || orderedRegexp.MatchString(line):
+			var n *Node
+			n, i = p.list(lines, i)
+			nodes = append(nodes, n)
+		default:
+			var para []string
+			for ; i < len(lines) && !isBlank(lines[i]) && (len(para) == 0 || !p.startsBlock(lines[i])); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			nodes = append(nodes, &Node{Type: NodePara, Children: p.inline(strings.Join(para, "\n"), 0)})
+		}
+	}
+	return nodes
+}
+
+// startsBlock 行是否开始一个新的块，用于结束段落
+func (p *parser) startsBlock(line string) bool {
+	return fenceRegexp.MatchString(line) || headingRegexp.MatchString(line) ||
+		strings.HasPrefix(strings.TrimLeft(line, " "), ">") ||
+		bulletRegexp.MatchString(line) || orderedRegexp.MatchString(line)
+}
+
+// codeBlock 围栏代码块，没有结束标记时到文本末尾
+func (p *parser) codeBlock(lines []string, i int) (*Node, int) {
+	m := fenceRegexp.FindStringSubmatch(lines[i])
+	fence := m[1]
+	n := &Node{Type: NodeCodeBlock, Lang: strings.ToLower(m[2])}
+	var body []string
+	for i++; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+			i++
+			break
+		}
+		body = append(body, lines[i])
+	}
+	n.Text = strings.Join(body, "\n")
+	return n, i
+}
+
+// list 连续的同类列表项，缩进的行归入上一项
+func (p *parser) list(lines []string, i int) (*Node, int) {
+	n := &Node{Type: NodeList, Ordered: !bulletRegexp.MatchString(lines[i])}
+	var item []string
+	flush := func() {
+		if item != nil {
+			n.Children = append(n.Children, &Node{Type: NodeItem, Children: p.inline(strings.Join(item, "\n"), 0)})
+		}
+	}
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if n.Ordered {
+			if m := orderedRegexp.FindStringSubmatch(line); m != nil {
+				if n.Start == 0 && len(n.Children) == 0 && item == nil {
+					n.Start, _ = strconv.Atoi(m[1])
+				}
+				flush()
+				item = []string{m[2]}
+				continue
+			}
+		} else if m := bulletRegexp.FindStringSubmatch(line); m != nil {
+			flush()
+			item = []string{m[1]}
+			continue
+		}
+		if isBlank(line) || !strings.HasPrefix(line, "  ") {
+			break
+		}
+		item = append(item, strings.TrimSpace(line))
+	}
+	flush()
+	if n.Start == 1 {
+		n.Start = 0
+	}
+	return n, i
+}
+
+// inline 解析行内元素
+func (p *parser) inline(s string, depth int) []*Node {
+	var (
+		nodes []*Node
+		text  strings.Builder
+	)
+	flush := func() {
+		nodes = appendText(nodes, text.String())
+		text.Reset()
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '\n':
+			flush()
+			nodes = append(nodes, &Node{Type: NodeBreak})
+			i++
+			continue
+		case c == '`':
+			n, end := codeSpan(s, i)
+			if n != nil {
+				flush()
+				nodes = append(nodes, n)
+			} else {
+				text.WriteString(s[i:end])
+			}
+			i = end
+			continue
+		case c == '<':
+			if m := htmlRegexp.FindString(s[i:]); m != "" {
+				i += len(m)
+				continue
+			}
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if u := s[i+1 : i+end]; autoRegexp.MatchString(u) && autoRegexp.FindString(u) == u {
+					flush()
+					nodes = append(nodes, p.link(u, []*Node{{Type: NodeText, Text: u}}))
+					i += end + 1
+					continue
+				}
+			}
+		case c == '[':
+			if n, end := p.linkSpan(s, i, depth); n != nil {
+				flush()
+				nodes = append(nodes, n...)
+				i = end
+				continue
+			}
+		case (c == 'h' || c == 'H') && wordStart(s, i):
+			if u := trimURL(autoRegexp.FindString(s[i:])); u != "" {
+				flush()
+				nodes = append(nodes, p.link(u, []*Node{{Type: NodeText, Text: u}}))
+				i += len(u)
+				continue
+			}
+		case depth < maxInlineDepth && (c == '*' || c == '_' || c == '~'):
+			if n, end := p.emphasis(s, i, depth); n != nil {
+				flush()
+				nodes = append(nodes, n)
+				i = end
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		text.WriteString(s[i : i+size])
+		i += size
+	}
+	flush()
+	return nodes
+}
+
+// codeSpan 行内代码，结束标记与开始标记的反引号数量相同，不匹配时返回nil和反引号串的结尾
+func codeSpan(s string, i int) (*Node, int) {
+	n := 0
+	for i+n < len(s) && s[i+n] == '`' {
+		n++
+	}
+	fence := s[i : i+n]
+	limit := len(s)
+	if limit > i+maxSpanLen {
+		limit = i + maxSpanLen
+	}
+	for j := i + n; j < limit; {
+		k := strings.Index(s[j:limit], fence)
+		if k < 0 {
+			return nil, i + n
+		}
+		k += j
+		end := k + n
+		if end < len(s) && s[end] == '`' {
+			for end < len(s) && s[end] == '`' {
+				end++
+			}
+			j = end
+			continue
+		}
+		code := strings.ReplaceAll(s[i+n:k], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+			code = code[1 : len(code)-1]
+		}
+		if code == "" {
+			return nil, i + n
+		}
+		return &Node{Type: NodeCode, Text: code}, end
+	}
+	return nil, i + n
+}
+
+// emphasis **粗体**、*斜体*、_斜体_、~~删除线~~，内容不能以空白开头或结尾
+func (p *parser) emphasis(s string, i, depth int) (*Node, int) {
+	delim, typ := s[i:i+1], NodeEm
+	switch {
+	case strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__"):
+		delim, typ = s[i:i+2], NodeStrong
+	case strings.HasPrefix(s[i:], "~~"):
+		delim, typ = "~~", NodeDel
+	case s[i] == '~':
+		return nil, 0
+	}
+	// 下划线只在单词边界生效，避免误伤snake_case
+	if delim[0] == '_' && !wordStart(s, i) {
+		return nil, 0
+	}
+	start := i + len(delim)
+	if start >= len(s) || isSpace(s[start]) {
+		return nil, 0
+	}
+	limit := len(s) - len(delim)
+	if limit > start+maxSpanLen {
+		limit = start + maxSpanLen
+	}
+	for j := start + 1; j <= limit; j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] == '`' {
+			_, end := codeSpan(s, j)
+			j = end - 1
+			continue
+		}
+		if !strings.HasPrefix(s[j:], delim) || isSpace(s[j-1]) {
+			continue
+		}
+		// 单个*不能匹配**的一部分
+		if len(delim) == 1 && j+1 < len(s) && s[j+1] == delim[0] {
+			j++
+			continue
+		}
+		end := j + len(delim)
+		if delim[0] == '_' && end < len(s) && isWord(s[end]) {
+			continue
+		}
+		return &Node{Type: typ, Children: p.inline(s[start:j], depth+1)}, end
+	}
+	return nil, 0
+}
+
+// linkSpan [文本](地址)，地址不在白名单时只保留文本
+func (p *parser) linkSpan(s string, i, depth int) ([]*Node, int) {
+	close := matchBracket(s, i)
+	if close < 0 || close+1 >= len(s) || s[close+1] != '(' {
+		return nil, 0
+	}
+	rest := s[close+2:]
+	if len(rest) > maxSpanLen {
+		rest = rest[:maxSpanLen]
+	}
+	end := matchParen(rest)
+	if end < 0 {
+		return nil, 0
+	}
+	end += close + 2
+	href := strings.TrimSpace(s[close+2 : end])
+	if strings.ContainsAny(href, " \n") {
+		return nil, 0
+	}
+	href = strings.Trim(href, "<>")
+	children := p.inline(s[i+1:close], maxInlineDepth-1)
+	children = unlink(children)
+	if depth >= maxInlineDepth {
+		return children, end + 1
+	}
+	if !p.allowed(href) {
+		return children, end + 1
+	}
+	return []*Node{p.link(href, children)}, end + 1
+}
+
+// unlink 链接文本里不允许再嵌套链接
+func unlink(nodes []*Node) []*Node {
+	var out []*Node
+	for _, n := range nodes {
+		if n.Type == NodeLink {
+			out = append(out, n.Children...)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func (p *parser) link(href string, children []*Node) *Node {
+	if !p.allowed(href) {
+		return &Node{Type: NodeText, Text: href}
+	}
+	return &Node{Type: NodeLink, Href: href, Children: children}
+}
+
+// allowed 链接必须是绝对地址且scheme在白名单中
+func (p *parser) allowed(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme == "" || !p.schemes[strings.ToLower(u.Scheme)] {
+		return false
+	}
+	if u.Scheme == "mailto" {
+		return u.Opaque != ""
+	}
+	return u.Host != ""
+}
+
+// matchBracket 找到与s[i]处'['匹配的']'
+func matchBracket(s string, i int) int {
+	level := 0
+	for j := i; j < len(s) && j < i+maxSpanLen; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			level++
+		case ']':
+			level--
+			if level == 0 {
+				return j
+			}
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+// matchParen 地址中允许成对的括号，返回结束的')'位置
+func matchParen(s string) int {
+	level := 0
+	for j := 0; j < len(s); j++ {
+		switch s[j] {
+		case '(':
+			level++
+		case ')':
+			if level == 0 {
+				return j
+			}
+			level--
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+// trimURL 去掉自动识别网址末尾的标点
+func trimURL(u string) string {
+	for u != "" {
+		last := u[len(u)-1]
+		if strings.IndexByte(".,;:!?'\"*_~", last) >= 0 {
+			u = u[:len(u)-1]
+			continue
+		}
+		if last == ')' && strings.Count(u, "(") < strings.Count(u, ")") {
+			u = u[:len(u)-1]
+			continue
+		}
+		break
+	}
+	if !strings.Contains(u, "://") || strings.HasSuffix(u, "://") {
+		return ""
+	}
+	return u
+}
+
+func wordStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= utf8.RuneSelf
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || c == '`' || c == '~' || c == '<' || c == '>' || c == '|' || c == '+' || c == '=' || c == '^' || c == '$'
+}
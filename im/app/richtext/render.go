@@ -0,0 +1,146 @@
+package richtext
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// PlainText 纯文本渲染，用于搜索、摘要和长度限制，块之间用换行分隔
+func PlainText(doc *Node) string {
+	var b strings.Builder
+	plainBlocks(&b, doc.Children, "")
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func plainBlocks(b *strings.Builder, nodes []*Node, prefix string) {
+	for _, n := range nodes {
+		switch n.Type {
+		case NodeCodeBlock:
+			for _, line := range strings.Split(n.Text, "\n") {
+				b.WriteString(prefix + line + "\n")
+			}
+		case NodeQuote:
+			plainBlocks(b, n.Children, prefix+"> ")
+		case NodeList:
+			for i, item := range n.Children {
+				mark := "- "
+				if n.Ordered {
+					mark = strconv.Itoa(listStart(n)+i) + ". "
+				}
+				b.WriteString(prefix + mark)
+				plainInline(b, item.Children, prefix+strings.Repeat(" ", len(mark)))
+				b.WriteString("\n")
+			}
+		case NodeRule:
+			b.WriteString(prefix + "---\n")
+		default:
+			b.WriteString(prefix)
+			plainInline(b, n.Children, prefix)
+			b.WriteString("\n")
+		}
+	}
+}
+
+func plainInline(b *strings.Builder, nodes []*Node, prefix string) {
+	for _, n := range nodes {
+		switch n.Type {
+		case NodeText, NodeCode:
+			b.WriteString(n.Text)
+		case NodeBreak:
+			b.WriteString("\n" + prefix)
+		case NodeLink:
+			var text strings.Builder
+			plainInline(&text, n.Children, prefix)
+			b.WriteString(text.String())
+			if text.String() != n.Href {
+				b.WriteString(" (" + n.Href + ")")
+			}
+		default:
+			plainInline(b, n.Children, prefix)
+		}
+	}
+}
+
+func listStart(n *Node) int {
+	if n.Start > 0 {
+		return n.Start
+	}
+	return 1
+}
+
+// HTML html渲染，用于邮件摘要，所有文本都经过转义
+func HTML(doc *Node) string {
+	var b strings.Builder
+	htmlBlocks(&b, doc.Children)
+	return b.String()
+}
+
+func htmlBlocks(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Type {
+		case NodePara:
+			b.WriteString("<p>")
+			htmlInline(b, n.Children)
+			b.WriteString("</p>")
+		case NodeHeading:
+			tag := "h" + strconv.Itoa(n.Level)
+			b.WriteString("<" + tag + ">")
+			htmlInline(b, n.Children)
+			b.WriteString("</" + tag + ">")
+		case NodeCodeBlock:
+			b.WriteString("<pre><code")
+			if n.Lang != "" {
+				b.WriteString(` class="language-` + html.EscapeString(n.Lang) + `"`)
+			}
+			b.WriteString(">" + html.EscapeString(n.Text) + "</code></pre>")
+		case NodeQuote:
+			b.WriteString("<blockquote>")
+			htmlBlocks(b, n.Children)
+			b.WriteString("</blockquote>")
+		case NodeList:
+			tag := "ul"
+			if n.Ordered {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag)
+			if n.Start > 1 {
+				b.WriteString(` start="` + strconv.Itoa(n.Start) + `"`)
+			}
+			b.WriteString(">")
+			for _, item := range n.Children {
+				b.WriteString("<li>")
+				htmlInline(b, item.Children)
+				b.WriteString("</li>")
+			}
+			b.WriteString("</" + tag + ">")
+		case NodeRule:
+			b.WriteString("<hr>")
+		}
+	}
+}
+
+var inlineTags = map[NodeType]string{NodeStrong: "strong", NodeEm: "em", NodeDel: "del"}
+
+func htmlInline(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Type {
+		case NodeText:
+			b.WriteString(html.EscapeString(n.Text))
+		case NodeCode:
+			b.WriteString("<code>" + html.EscapeString(n.Text) + "</code>")
+		case NodeBreak:
+			b.WriteString("<br>")
+		case NodeLink:
+			b.WriteString(`<a href="` + html.EscapeString(n.Href) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+			htmlInline(b, n.Children)
+			b.WriteString("</a>")
+		default:
+			if tag, ok := inlineTags[n.Type]; ok {
+				b.WriteString("<" + tag + ">")
+				htmlInline(b, n.Children)
+				b.WriteString("</" + tag + ">")
+			}
+		}
+	}
+}
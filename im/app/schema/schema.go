@@ -0,0 +1,260 @@
+// Package schema 实现消息负载校验用到的JSON Schema子集
+//
+// 支持的关键字：type、properties、required、additionalProperties(bool)、items、enum、
+// minLength、maxLength、pattern、minimum、maximum、minItems、maxItems，其余关键字编译时报错，
+// 避免注册方以为生效实际却被忽略。
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema 编译后的schema
+type Schema struct {
+	Types      []string
+	Properties map[string]*Schema
+	Required   []string
+	Additional *bool
+	Items      *Schema
+	Enum       []interface{}
+	MinLength  *int
+	MaxLength  *int
+	Pattern    *regexp.Regexp
+	Minimum    *float64
+	Maximum    *float64
+	MinItems   *int
+	MaxItems   *int
+}
+
+// rawSchema schema的json形式，type既可以是字符串也可以是数组
+type rawSchema struct {
+	Schema     string                     `json:"$schema"`
+	ID         string                     `json:"$id"`
+	Title      string                     `json:"title"`
+	Desc       string                     `json:"description"`
+	Default    json.RawMessage            `json:"default"`
+	Examples   json.RawMessage            `json:"examples"`
+	Type       json.RawMessage            `json:"type"`
+	Properties map[string]json.RawMessage `json:"properties"`
+	Required   []string                   `json:"required"`
+	Additional *bool                      `json:"additionalProperties"`
+	Items      json.RawMessage            `json:"items"`
+	Enum       []interface{}              `json:"enum"`
+	MinLength  *int                       `json:"minLength"`
+	MaxLength  *int                       `json:"maxLength"`
+	Pattern    *string                    `json:"pattern"`
+	Minimum    *float64                   `json:"minimum"`
+	Maximum    *float64                   `json:"maximum"`
+	MinItems   *int                       `json:"minItems"`
+	MaxItems   *int                       `json:"maxItems"`
+}
+
+var knownTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// Compile 解析并检查schema
+func Compile(data []byte) (*Schema, error) {
+	return compile(data, "#")
+}
+
+func compile(data []byte, at string) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	raw := &rawSchema{}
+	if err := dec.Decode(raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", at, err)
+	}
+	s := &Schema{
+		Required:   raw.Required,
+		Additional: raw.Additional,
+		Enum:       raw.Enum,
+		MinLength:  raw.MinLength,
+		MaxLength:  raw.MaxLength,
+		Minimum:    raw.Minimum,
+		Maximum:    raw.Maximum,
+		MinItems:   raw.MinItems,
+		MaxItems:   raw.MaxItems,
+	}
+	if len(raw.Type) > 0 {
+		var one string
+		if json.Unmarshal(raw.Type, &one) == nil {
+			s.Types = []string{one}
+		} else if err := json.Unmarshal(raw.Type, &s.Types); err != nil {
+			return nil, fmt.Errorf("%s: invalid type", at)
+		}
+		for _, t := range s.Types {
+			if !knownTypes[t] {
+				return nil, fmt.Errorf("%s: unknown type %q", at, t)
+			}
+		}
+	}
+	if raw.Pattern != nil {
+		re, err := regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern: %v", at, err)
+		}
+		s.Pattern = re
+	}
+	if len(raw.Properties) > 0 {
+		s.Properties = make(map[string]*Schema, len(raw.Properties))
+		for name, p := range raw.Properties {
+			sub, err := compile(p, at+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			s.Properties[name] = sub
+		}
+	}
+	if len(raw.Items) > 0 {
+		sub, err := compile(raw.Items, at+"/items")
+		if err != nil {
+			return nil, err
+		}
+		s.Items = sub
+	}
+	return s, nil
+}
+
+// ValidateJSON 校验json文本，数字按json.Number解析以便区分整数
+func (s *Schema) ValidateJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid json: %v", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid json: trailing data")
+	}
+	return s.validate(v, "$")
+}
+
+func (s *Schema) validate(v interface{}, at string) error {
+	if len(s.Types) > 0 && !s.matchType(v) {
+		return fmt.Errorf("%s: expect %s", at, strings.Join(s.Types, "|"))
+	}
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return fmt.Errorf("%s: not in enum", at)
+	}
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %d", at, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d", at, *s.MaxLength)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(val) {
+			return fmt.Errorf("%s: not match pattern", at)
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			return fmt.Errorf("%s: less than %v", at, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fmt.Errorf("%s: greater than %v", at, *s.Maximum)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			return fmt.Errorf("%s: fewer than %d items", at, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			return fmt.Errorf("%s: more than %d items", at, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing %s", at, name)
+			}
+		}
+		// 按字段名排序，保证同一负载每次报同一个错误
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sub, ok := s.Properties[name]
+			if !ok {
+				if s.Additional != nil && !*s.Additional {
+					return fmt.Errorf("%s: unexpected field %s", at, name)
+				}
+				continue
+			}
+			if err := sub.validate(val[name], at+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) matchType(v interface{}) bool {
+	for _, t := range s.Types {
+		switch val := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if _, err := val.Int64(); t == "integer" && err == nil {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inEnum 枚举值只支持字符串、数字、布尔和null
+func (s *Schema) inEnum(v interface{}) bool {
+	for _, e := range s.Enum {
+		switch ev := e.(type) {
+		case float64:
+			if n, ok := v.(json.Number); ok {
+				if f, err := n.Float64(); err == nil && f == ev {
+					return true
+				}
+			}
+		case string, bool, nil:
+			if e == v {
+				return true
+			}
+		}
+	}
+	return false
+}
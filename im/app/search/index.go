@@ -0,0 +1,248 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const batchSize = 256 // 每次持锁取出的候选数量，权限校验在锁外进行
+
+// Doc 索引中的一条消息
+type Doc struct {
+	ID     uint64
+	ConvID string
+	Seq    uint64 // 会话内的seq
+	Sender uint64
+	Type   int
+	Time   int64 // 发送时间，单位毫秒
+	Text   string
+}
+
+// Range 高亮区间，按字符计数的左闭右开区间
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Hit 一条命中结果
+type Hit struct {
+	Doc        *Doc
+	Highlights []Range
+}
+
+// Query 检索条件，Keyword必填，其余为空时不限
+type Query struct {
+	Keyword string
+	ConvID  string
+	Sender  uint64
+	Type    int
+	Start   int64  // 发送时间下限，单位毫秒
+	End     int64  // 发送时间上限，单位毫秒
+	Before  uint64 // 游标，只返回id小于它的结果
+	Limit   int
+	Visible func(doc *Doc) bool // 当前用户能否看到这条消息
+}
+
+// Index 基于内存的倒排索引，倒排表按消息id升序，检索时从新到旧返回
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string][]uint64
+	docs     map[uint64]*Doc
+}
+
+// NewIndex .
+func NewIndex() *Index {
+	return &Index{postings: make(map[string][]uint64), docs: make(map[uint64]*Doc)}
+}
+
+// Put 新增或更新文档，更新时先删除旧的索引词
+func (x *Index) Put(doc *Doc) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(doc.ID)
+	if strings.TrimSpace(doc.Text) == "" {
+		return
+	}
+	c := *doc
+	x.docs[doc.ID] = &c
+	for _, t := range Tokenize(doc.Text) {
+		x.postings[t] = insertID(x.postings[t], doc.ID)
+	}
+}
+
+// Delete 删除文档
+func (x *Index) Delete(id uint64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *Index) remove(id uint64) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	delete(x.docs, id)
+	for _, t := range Tokenize(doc.Text) {
+		list := removeID(x.postings[t], id)
+		if len(list) == 0 {
+			delete(x.postings, t)
+			continue
+		}
+		x.postings[t] = list
+	}
+}
+
+// insertID 有序插入，消息id随时间递增，通常直接追加
+func insertID(list []uint64, id uint64) []uint64 {
+	n := len(list)
+	if n == 0 || list[n-1] < id {
+		return append(list, id)
+	}
+	i := sort.Search(n, func(i int) bool { return list[i] >= id })
+	if list[i] == id {
+		return list
+	}
+	list = append(list, 0)
+	copy(list[i+1:], list[i:])
+	list[i] = id
+	return list
+}
+
+func removeID(list []uint64, id uint64) []uint64 {
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+	if i == len(list) || list[i] != id {
+		return list
+	}
+	return append(list[:i], list[i+1:]...)
+}
+
+func contains(list []uint64, id uint64) bool {
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+	return i < len(list) && list[i] == id
+}
+
+// Search 按id从大到小返回最多Limit条结果，more表示是否还有更多
+func (x *Index) Search(q *Query) ([]*Hit, bool) {
+	tokens := queryTokens(q.Keyword)
+	terms := queryTerms(q.Keyword)
+	if len(tokens) == 0 || q.Limit <= 0 {
+		return nil, false
+	}
+	var hits []*Hit
+	before := q.Before
+	for {
+		docs, last, done := x.candidates(tokens, q, before)
+		for _, doc := range docs {
+			if q.Visible != nil && !q.Visible(doc) {
+				continue
+			}
+			ranges, ok := highlight(doc.Text, terms)
+			if !ok {
+				continue
+			}
+			if len(hits) == q.Limit {
+				return hits, true
+			}
+			hits = append(hits, &Hit{Doc: doc, Highlights: ranges})
+		}
+		if done {
+			return hits, false
+		}
+		before = last
+	}
+}
+
+// candidates 持锁取出一批满足索引词和过滤条件的文档，last为本批扫描到的最小id
+func (x *Index) candidates(tokens []string, q *Query, before uint64) ([]*Doc, uint64, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	lists := make([][]uint64, 0, len(tokens))
+	for _, t := range tokens {
+		list, ok := x.postings[t]
+		if !ok {
+			return nil, 0, true
+		}
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	shortest := lists[0]
+	i := len(shortest)
+	if before > 0 {
+		i = sort.Search(len(shortest), func(i int) bool { return shortest[i] >= before })
+	}
+	var docs []*Doc
+	scanned := 0
+	for i--; i >= 0; i-- {
+		id := shortest[i]
+		if scanned++; scanned > batchSize*4 || len(docs) == batchSize {
+			return docs, id + 1, false
+		}
+		match := true
+		for _, list := range lists[1:] {
+			if !contains(list, id) {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		doc := x.docs[id]
+		// 消息id随时间递增，早于时间下限后不需要再往前扫描
+		if q.Start > 0 && doc.Time < q.Start {
+			return docs, 0, true
+		}
+		if q.ConvID != "" && doc.ConvID != q.ConvID || q.Sender != 0 && doc.Sender != q.Sender ||
+			q.Type != 0 && doc.Type != q.Type || q.End > 0 && doc.Time > q.End {
+			continue
+		}
+		c := *doc
+		docs = append(docs, &c)
+	}
+	return docs, 0, true
+}
+
+// Highlight 按查询词校验文本并返回高亮区间，用于文本已在其他实例上变化时重新校验
+func Highlight(text, keyword string) ([]Range, bool) {
+	return highlight(text, queryTerms(keyword))
+}
+
+// highlight 文本中须包含全部查询片段，返回各片段出现的位置
+func highlight(text string, terms []string) ([]Range, bool) {
+	norm := []rune(Normalize(text))
+	var ranges []Range
+	for _, term := range terms {
+		tr := []rune(term)
+		found := false
+		for i := 0; i+len(tr) <= len(norm); i++ {
+			if string(norm[i:i+len(tr)]) == term {
+				ranges = append(ranges, Range{Start: i, End: i + len(tr)})
+				found = true
+				i += len(tr) - 1
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	return mergeRanges(ranges), true
+}
+
+// mergeRanges 合并重叠的高亮区间
+func mergeRanges(ranges []Range) []Range {
+	var out []Range
+	for _, r := range ranges {
+		if n := len(out); n > 0 && r.Start <= out[n-1].End {
+			if r.End > out[n-1].End {
+				out[n-1].End = r.End
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package search
+
+import "testing"
+
+func search(x *Index, keyword string) []uint64 {
+	hits, _ := x.Search(&Query{Keyword: keyword, Limit: 10})
+	ids := make([]uint64, 0, len(hits))
+	for _, h := range hits {
+		ids = append(ids, h.Doc.ID)
+	}
+	return ids
+}
+
+func TestIndexSearch(t *testing.T) {
+	x := NewIndex()
+	x.Put(&Doc{ID: 1, ConvID: "s_1_2", Text: "Meeting at 10am"})
+	x.Put(&Doc{ID: 2, ConvID: "s_1_2", Text: "明天下午开会"})
+	x.Put(&Doc{ID: 3, ConvID: "s_1_2", Text: "internationalization review"})
+
+	cases := []struct {
+		keyword string
+		want    []uint64
+	}{
+		{"meet", []uint64{1}},
+		{"MEETING", []uint64{1}},
+		{"meetings", nil},
+		{"eting", nil}, // 拉丁文字只按前缀匹配
+		{"10", []uint64{1}},
+		{"meet 10am", []uint64{1}},
+		{"下午", []uint64{2}},
+		{"开", []uint64{2}},
+		{"下开", nil},
+		{"internationalization", []uint64{3}}, // 超过最长前缀的词按前缀找候选后校验全文
+		{"internationalizatio", []uint64{3}},
+		{"internationalizer", nil},
+	}
+	for _, c := range cases {
+		got := search(x, c.keyword)
+		if len(got) != len(c.want) || len(got) > 0 && got[0] != c.want[0] {
+			t.Errorf("search %q got %v, want %v", c.keyword, got, c.want)
+		}
+	}
+
+	hits, _ := x.Search(&Query{Keyword: "meet", Limit: 10})
+	if len(hits) != 1 || len(hits[0].Highlights) != 1 || hits[0].Highlights[0] != (Range{Start: 0, End: 4}) {
+		t.Fatalf("highlights got %+v", hits)
+	}
+
+	// 更新后旧的索引词失效，删除后搜不到
+	x.Put(&Doc{ID: 1, ConvID: "s_1_2", Text: "lunch"})
+	if got := search(x, "meet"); len(got) != 0 {
+		t.Fatalf("search after update got %v", got)
+	}
+	if got := search(x, "lun"); len(got) != 1 {
+		t.Fatalf("search updated text got %v", got)
+	}
+	x.Delete(1)
+	if got := search(x, "lun"); len(got) != 0 {
+		t.Fatalf("search after delete got %v", got)
+	}
+	if len(x.postings) != len(Tokenize("明天下午开会"))+len(Tokenize("internationalization review")) {
+		t.Fatalf("postings not cleaned, %d left", len(x.postings))
+	}
+}
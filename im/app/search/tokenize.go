@@ -0,0 +1,135 @@
+// Package search 消息全文检索用的内嵌倒排索引
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+const maxPrefix = 16 // 拉丁文字索引的最长前缀，更长的查询词先按前缀找候选再校验全文
+
+// isCJK 中日韩文字没有空格分词，按字切分
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Normalize 统一大小写并把全角字母数字转成半角，索引、查询和高亮都基于归一化后的文本
+func Normalize(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+// segment 切分后的一段连续文本，cjk表示是否为中日韩文字
+type segment struct {
+	runes []rune
+	cjk   bool
+}
+
+// segments 按文字类别切分归一化后的文本，标点和空白作为分隔
+func segments(text string) []segment {
+	var (
+		segs []segment
+		cur  []rune
+		cjk  bool
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			segs = append(segs, segment{runes: cur, cjk: cjk})
+			cur = nil
+		}
+	}
+	for _, r := range Normalize(text) {
+		switch {
+		case isCJK(r):
+			if !cjk {
+				flush()
+			}
+			cjk = true
+			cur = append(cur, r)
+		case isWordRune(r):
+			if cjk {
+				flush()
+			}
+			cjk = false
+			cur = append(cur, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return segs
+}
+
+// Tokenize 生成索引词：拉丁文字生成词的各个前缀，中日韩文字同时生成单字和相邻两字，结果去重
+func Tokenize(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+	for _, seg := range segments(text) {
+		if !seg.cjk {
+			for i := 1; i <= len(seg.runes) && i <= maxPrefix; i++ {
+				add(string(seg.runes[:i]))
+			}
+			continue
+		}
+		for i := range seg.runes {
+			add(string(seg.runes[i]))
+			if i+1 < len(seg.runes) {
+				add(string(seg.runes[i : i+2]))
+			}
+		}
+	}
+	return tokens
+}
+
+// queryTokens 生成查询词：拉丁文字按前缀查找，中日韩文字超过一个字时只用相邻两字，缩小候选集
+func queryTokens(query string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+	for _, seg := range segments(query) {
+		if !seg.cjk {
+			n := len(seg.runes)
+			if n > maxPrefix {
+				n = maxPrefix
+			}
+			add(string(seg.runes[:n]))
+			continue
+		}
+		if len(seg.runes) == 1 {
+			add(string(seg.runes))
+			continue
+		}
+		for i := 0; i+1 < len(seg.runes); i++ {
+			add(string(seg.runes[i : i+2]))
+		}
+	}
+	return tokens
+}
+
+// queryTerms 用于校验和高亮的查询片段，即切分后的各段原文
+func queryTerms(query string) []string {
+	var terms []string
+	for _, seg := range segments(query) {
+		terms = append(terms, string(seg.runes))
+	}
+	return terms
+}
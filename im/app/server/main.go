@@ -3,18 +3,31 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 
 	apipb "github.com/binbin6363/icuc-pb/protobuf/api"
 	apppb "github.com/binbin6363/icuc-pb/protobuf/im/app"
+	"github.com/binbin6363/icuc/common/api"
+	"github.com/binbin6363/icuc/common/idgen"
 	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/common/plugins"
+	"github.com/binbin6363/icuc/im/app/blob"
 	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/push"
 	"github.com/binbin6363/icuc/im/app/service/auth"
+	"github.com/binbin6363/icuc/im/app/service/bot"
+	"github.com/binbin6363/icuc/im/app/service/broadcast"
 	"github.com/binbin6363/icuc/im/app/service/config"
+	"github.com/binbin6363/icuc/im/app/service/conversation"
+	"github.com/binbin6363/icuc/im/app/service/keys"
+	"github.com/binbin6363/icuc/im/app/service/media"
 	"github.com/binbin6363/icuc/im/app/service/message"
+	"github.com/binbin6363/icuc/im/app/store"
 
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel"
@@ -95,6 +108,41 @@ func main() {
 	r := gin.New()
 	r.Use(gin.Recovery())
 	//r.Use(gin.Logger())
+	plugins.InitOption(plugins.WithSecret(cfg.AppConfig().ServerInfo.Secret),
+		plugins.WithSkipPaths(api.PathLogin),
+		plugins.WithSkipPaths(api.PathRegister))
+
+	// 各服务共享的存储和推送
+	st := store.NewMemStore()
+	st.Dedup = store.NewMemDedupStore(cfg.AppConfig().MsgInfo.DedupSize,
+		time.Duration(cfg.AppConfig().MsgInfo.DedupWindow)*time.Second)
+	// 配置了数据库时定时消息和消息的到期登记保存在数据库中，重启后保留，多个实例共享
+	if dbInfo := cfg.AppConfig().DBInfo; dbInfo != nil && dbInfo.Dsn != "" {
+		db, err := store.OpenDB(dbInfo.Dsn, dbInfo.MaxIdleConns, dbInfo.MaxOpenConns,
+			time.Duration(dbInfo.MaxLifeTime)*time.Second)
+		if err != nil {
+			log.Fatalf("Failed to connect to db: %v", err)
+		}
+		if st.Schedule, err = store.NewSQLScheduleStore(db); err != nil {
+			log.Fatalf("Failed to init schedule store: %v", err)
+		}
+		if st.Expiry, err = store.NewSQLExpiryStore(db); err != nil {
+			log.Fatalf("Failed to init expiry store: %v", err)
+		}
+	}
+	var pusher push.Pusher = push.LogPusher{}
+	if connInfo := cfg.AppConfig().ConnInfo; connInfo != nil && connInfo.Addr != "" {
+		pusher = push.NewConnPusher(connInfo.Addr, connInfo.Timeout)
+	}
+	blobs := blob.NewBuckets(cfg.AppConfig().ServerInfo, cfg.AppConfig().CosInfo)
+	// 各服务写入同一份存储，共用一个id生成器，相同的机器编号下不会生成重复的id
+	ids := idgen.NewSnowflake(cfg.AppConfig().ServerInfo.DataCenterId, cfg.AppConfig().ServerInfo.WorkerId)
+	convService := conversation.New(conversation.WithStore(st), conversation.WithPusher(pusher))
+	// 机器人发出的卡片按钮回调到机器人的回调地址，其他卡片回调到类型注册的地址
+	callbackTimeout := cfg.AppConfig().MsgInfo.CallbackTimeout
+	cardRouter := bot.NewActionRouter(st, ids, message.NewWebhookRouter(callbackTimeout), callbackTimeout)
+	msgService := message.New(message.WithStore(st), message.WithBlobs(blobs), message.WithIDs(ids), message.WithPusher(pusher),
+		message.WithConvFeed(convService), message.WithActionRouter(cardRouter))
 
 	//service.Init()
 	// 创建 gRPC 服务器
@@ -113,7 +161,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to register gRPC-Gateway AuthService handler: %v", err)
 	}
-	err = apppb.RegisterMessageServiceHandlerServer(context.Background(), mux, message.New())
+	err = apppb.RegisterMessageServiceHandlerServer(context.Background(), mux, msgService)
 	if err != nil {
 		log.Fatalf("Failed to register gRPC-Gateway MessageService handler: %v", err)
 	}
@@ -122,7 +170,41 @@ func main() {
 		log.Fatalf("Failed to register gRPC-Gateway ConfigService handler: %v", err)
 	}
 
-	r.Use(gin.WrapH(mux))
+	// pb未覆盖的接口直接注册在gin上，其余请求交给gRPC-Gateway
+	authed := r.Group("/", plugins.ZapTraceLogger(), plugins.JWTAuthMiddleware())
+	msgService.RegisterRoutes(authed)
+	convService.RegisterRoutes(authed)
+	keys.New(keys.WithStore(st), keys.WithPusher(pusher)).RegisterRoutes(authed)
+	broadcastService := broadcast.New(broadcast.WithStore(st), broadcast.WithIDs(ids), broadcast.WithPusher(pusher))
+	broadcastService.RegisterRoutes(authed)
+	go broadcastService.RunScheduler(context.Background(),
+		time.Duration(cfg.AppConfig().BroadcastInfo.Interval)*time.Second)
+	go msgService.WatchWords(context.Background(),
+		time.Duration(cfg.AppConfig().ModerationInfo.ReloadInterval)*time.Second)
+	go msgService.RunSweeper(context.Background(),
+		time.Duration(cfg.AppConfig().MsgInfo.ExpireSweep)*time.Second)
+	go msgService.RunScheduler(context.Background(),
+		time.Duration(cfg.AppConfig().MsgInfo.ScheduleSweep)*time.Second)
+	go msgService.RunIndexer(context.Background(),
+		time.Duration(cfg.AppConfig().MsgInfo.IndexSync)*time.Second)
+	botService := bot.New(bot.WithStore(st), bot.WithIDs(ids), bot.WithSender(msgService))
+	botService.RegisterRoutes(authed)
+	botService.RegisterAPI(r.Group("/", plugins.ZapTraceLogger()))
+	go botService.RunDispatcher(context.Background(),
+		time.Duration(cfg.AppConfig().BotInfo.Interval)*time.Second)
+	mediaService := media.New(media.WithStore(st), media.WithBlobs(blobs), media.WithIDs(ids),
+		media.WithViewer(msgService))
+	mediaService.RegisterRoutes(authed)
+	go mediaService.RunCleaner(context.Background(),
+		time.Duration(cfg.AppConfig().MediaInfo.CleanInterval)*time.Second)
+	// 本地存储的签名地址由签名校验，不需要jwt
+	for name, bs := range map[string]blob.Store{blob.LocalAvatar: blobs.Avatar, blob.LocalMedia: blobs.Media} {
+		if h, ok := bs.(http.Handler); ok {
+			prefix := api.PathBlob + name
+			r.Any(prefix+"/*key", gin.WrapH(http.StripPrefix(prefix, h)))
+		}
+	}
+	r.NoRoute(gin.WrapH(mux))
 	//r.Any("/api/", gin.WrapH(mux))
 
 	if err := r.Run(cfg.AppConfig().ServerInfo.Listen); err != nil {
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/binbin6363/icuc/common/api"
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/service/message"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// authBot 校验请求头中的机器人令牌，格式为 Authorization: Bot <token>
+func (s *Service) authBot(ctx context.Context, header string) (*model.Bot, error) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 || parts[0] != api.AuthBotField {
+		return nil, ierr.ErrBotAuth
+	}
+	b, err := s.store.Bot.ByToken(ctx, hashToken(parts[1]))
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrBotAuth
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get bot by token fail, err:%v", err)
+		return nil, ierr.ErrSystem
+	}
+	return b, nil
+}
+
+// PostReq 机器人发消息，To和GroupID只能填一个
+type PostReq struct {
+	ClientID string        `json:"client_id"` // 调用方生成的消息id，重试时保持不变
+	To       uint64        `json:"to"`        // 单聊接收者uid
+	GroupID  uint64        `json:"group_id"`  // 群聊群id
+	Type     model.MsgType `json:"type"`      // 支持文本、富文本和卡片等自定义消息，默认文本
+	Content  string        `json:"content"`
+	ReplyTo  uint64        `json:"reply_to,string"` // 引用回复的消息id，如回复斜杠命令
+}
+
+// Post 机器人往加入的群或用户找过它的单聊发消息，消息和普通消息一样经过审核并推送给成员
+func (s *Service) Post(ctx context.Context, b *model.Bot, req *PostReq) (*message.SendRsp, error) {
+	if req.Type == 0 {
+		req.Type = model.MsgText
+	}
+	if req.Type != model.MsgText && req.Type != model.MsgRich && req.Type != model.MsgCustom ||
+		(req.To == 0) == (req.GroupID == 0) || s.sender == nil {
+		return nil, ierr.ErrParam
+	}
+	send := &message.SendReq{ClientID: req.ClientID, To: req.To, GroupID: req.GroupID, Type: req.Type, Content: req.Content, ReplyTo: req.ReplyTo}
+	if req.GroupID != 0 {
+		return s.sender.SendGroup(ctx, b.Uid, send)
+	}
+	// 机器人不能主动找用户单聊，用户先给机器人发过消息才有会话
+	_, err := s.store.Conversation.Get(ctx, b.Uid, model.SingleConvID(b.Uid, req.To))
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrConvNoPerm
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get bot conversation fail, bot:%d, to:%d, err:%v", b.Uid, req.To, err)
+		return nil, ierr.ErrSystem
+	}
+	return s.sender.SendSingle(ctx, b.Uid, send)
+}
@@ -0,0 +1,354 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+	"github.com/binbin6363/icuc/im/app/webhook"
+)
+
+const (
+	maxNameLen    = 32   // 机器人名称最多的字符数
+	maxWebhookLen = 1024 // 回调地址的最大长度
+	maxCommands   = 20   // 每个机器人最多处理的斜杠命令数
+)
+
+var commandRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// newSecret 生成随机的令牌或签名密钥
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken 令牌只保存sha256，泄露存储不会泄露令牌
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkHook 校验回调地址、订阅的事件和斜杠命令，回调地址不能指向内网、本机等地址
+func checkHook(ctx context.Context, hook string, events, commands []string) bool {
+	if hook != "" {
+		if len(hook) > maxWebhookLen {
+			return false
+		}
+		if err := webhook.CheckURL(ctx, hook); err != nil {
+			log.InfoContextf(ctx, "bad bot webhook, url:%s, err:%v", hook, err)
+			return false
+		}
+	}
+	for _, e := range events {
+		known := false
+		for _, k := range model.HookEvents {
+			known = known || e == k
+		}
+		if !known {
+			return false
+		}
+	}
+	if len(commands) > maxCommands {
+		return false
+	}
+	seen := make(map[string]bool, len(commands))
+	for _, c := range commands {
+		if !commandRegexp.MatchString(c) || seen[c] {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
+// loadBot 获取当前用户创建的机器人，不是创建者时视为不存在
+func (s *Service) loadBot(ctx context.Context, uid, botUid uint64) (*model.Bot, error) {
+	b, err := s.store.Bot.Get(ctx, botUid)
+	if err == store.ErrNotFound || err == nil && b.Owner != uid {
+		return nil, ierr.ErrBotNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get bot fail, uid:%d, err:%v", botUid, err)
+		return nil, ierr.ErrSystem
+	}
+	return b, nil
+}
+
+// resetSecrets 生成新的令牌和签名密钥，旧的立即失效
+func resetSecrets(b *model.Bot, rsp *CreateRsp) error {
+	token, err := newSecret()
+	if err != nil {
+		return err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	b.TokenHash, b.Secret = hashToken(token), secret
+	rsp.Bot, rsp.Token, rsp.Secret = b, token, secret
+	return nil
+}
+
+// CreateReq 创建机器人
+type CreateReq struct {
+	Name     string   `json:"name"`
+	Webhook  string   `json:"webhook"`  // 出站事件的回调地址，可以为空
+	Events   []string `json:"events"`   // 订阅的事件，为空时订阅全部
+	Commands []string `json:"commands"` // 处理的斜杠命令，不带/
+}
+
+// CreateRsp 令牌和签名密钥只在创建和重置时返回，需要妥善保存
+type CreateRsp struct {
+	Bot    *model.Bot `json:"bot"`
+	Token  string     `json:"token"`
+	Secret string     `json:"secret"`
+}
+
+// Create 创建机器人账号，机器人属于创建者的租户
+func (s *Service) Create(ctx context.Context, uid uint64, req *CreateReq) (*CreateRsp, error) {
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxNameLen || !checkHook(ctx, req.Webhook, req.Events, req.Commands) {
+		return nil, ierr.ErrParam
+	}
+	list, err := s.store.Bot.List(ctx, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list bots fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	if len(list) >= cfg.AppConfig().BotInfo.MaxBots {
+		return nil, ierr.ErrParam
+	}
+	user := &model.User{}
+	if owner, err := s.store.User.Get(ctx, uid); err == nil {
+		user.TenantID = owner.TenantID
+	} else if err != store.ErrNotFound {
+		log.ErrorContextf(ctx, "get user fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+
+	now := time.Now().UnixMilli()
+	b := &model.Bot{
+		Uid:        s.ids.Next(),
+		Name:       req.Name,
+		Owner:      uid,
+		Webhook:    req.Webhook,
+		Events:     req.Events,
+		Commands:   req.Commands,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	rsp := &CreateRsp{}
+	if err = resetSecrets(b, rsp); err != nil {
+		log.ErrorContextf(ctx, "generate bot token fail, err:%v", err)
+		return nil, ierr.ErrSystem
+	}
+	user.Uid, user.CreateTime = b.Uid, now
+	if err = s.store.User.Save(ctx, user); err != nil {
+		log.ErrorContextf(ctx, "save bot user fail, uid:%d, err:%v", b.Uid, err)
+		return nil, ierr.ErrSystem
+	}
+	if err = s.store.Bot.Save(ctx, b); err != nil {
+		log.ErrorContextf(ctx, "save bot fail, uid:%d, err:%v", b.Uid, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "create bot, uid:%d, owner:%d, name:%s", b.Uid, uid, b.Name)
+	return rsp, nil
+}
+
+// UpdateReq 修改机器人的名称、回调地址、订阅的事件和斜杠命令，名称为空时保持不变
+type UpdateReq struct {
+	Bot      uint64   `json:"bot"`
+	Name     string   `json:"name"`
+	Webhook  string   `json:"webhook"`
+	Events   []string `json:"events"`
+	Commands []string `json:"commands"`
+}
+
+// Update 修改机器人的配置，令牌和签名密钥不变
+func (s *Service) Update(ctx context.Context, uid uint64, req *UpdateReq) (*model.Bot, error) {
+	if utf8.RuneCountInString(req.Name) > maxNameLen || !checkHook(ctx, req.Webhook, req.Events, req.Commands) {
+		return nil, ierr.ErrParam
+	}
+	b, err := s.loadBot(ctx, uid, req.Bot)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != "" {
+		b.Name = req.Name
+	}
+	b.Webhook, b.Events, b.Commands = req.Webhook, req.Events, req.Commands
+	b.UpdateTime = time.Now().UnixMilli()
+	if err = s.store.Bot.Save(ctx, b); err != nil {
+		log.ErrorContextf(ctx, "save bot fail, uid:%d, err:%v", b.Uid, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "update bot, uid:%d, webhook:%s, commands:%v", b.Uid, b.Webhook, b.Commands)
+	return b, nil
+}
+
+// TokenReq 重置机器人的令牌和签名密钥
+type TokenReq struct {
+	Bot uint64 `json:"bot"`
+}
+
+// ResetToken 重置令牌和签名密钥，令牌泄露时使用，旧令牌立即失效
+func (s *Service) ResetToken(ctx context.Context, uid uint64, req *TokenReq) (*CreateRsp, error) {
+	b, err := s.loadBot(ctx, uid, req.Bot)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &CreateRsp{}
+	if err = resetSecrets(b, rsp); err != nil {
+		log.ErrorContextf(ctx, "generate bot token fail, err:%v", err)
+		return nil, ierr.ErrSystem
+	}
+	b.UpdateTime = time.Now().UnixMilli()
+	if err = s.store.Bot.Save(ctx, b); err != nil {
+		log.ErrorContextf(ctx, "save bot fail, uid:%d, err:%v", b.Uid, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "reset bot token, uid:%d, operator:%d", b.Uid, uid)
+	return rsp, nil
+}
+
+// ListReq .
+type ListReq struct{}
+
+// ListRsp .
+type ListRsp struct {
+	Bots []*model.Bot `json:"bots"`
+}
+
+// List 列出当前用户创建的机器人
+func (s *Service) List(ctx context.Context, uid uint64, req *ListReq) (*ListRsp, error) {
+	list, err := s.store.Bot.List(ctx, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list bots fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	if list == nil {
+		list = []*model.Bot{}
+	}
+	return &ListRsp{Bots: list}, nil
+}
+
+// MemberReq 把机器人加入群或移出群
+type MemberReq struct {
+	GroupID uint64 `json:"group_id"`
+	Bot     uint64 `json:"bot"`
+}
+
+// MemberRsp .
+type MemberRsp struct{}
+
+// Join 群主或管理员把机器人加入群，机器人之后可以在群里发消息并收到群里的事件
+func (s *Service) Join(ctx context.Context, uid uint64, req *MemberReq) (*MemberRsp, error) {
+	if err := s.checkManager(ctx, uid, req.GroupID); err != nil {
+		return nil, err
+	}
+	if _, err := s.store.Bot.Get(ctx, req.Bot); err != nil {
+		if err == store.ErrNotFound {
+			return nil, ierr.ErrBotNotFound
+		}
+		log.ErrorContextf(ctx, "get bot fail, uid:%d, err:%v", req.Bot, err)
+		return nil, ierr.ErrSystem
+	}
+	if _, err := s.store.Group.Member(ctx, req.GroupID, req.Bot); err == nil {
+		return &MemberRsp{}, nil
+	}
+	member := &model.GroupMember{GroupID: req.GroupID, Uid: req.Bot, Role: model.RoleMember, JoinTime: time.Now().UnixMilli()}
+	if err := s.store.Group.AddMember(ctx, member); err != nil {
+		log.ErrorContextf(ctx, "add bot member fail, group:%d, bot:%d, err:%v", req.GroupID, req.Bot, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "bot join group, group:%d, bot:%d, operator:%d", req.GroupID, req.Bot, uid)
+	s.hookMember(ctx, model.HookMemberJoin, member, uid)
+	return &MemberRsp{}, nil
+}
+
+// Leave 群主、管理员或机器人的创建者把机器人移出群
+func (s *Service) Leave(ctx context.Context, uid uint64, req *MemberReq) (*MemberRsp, error) {
+	if _, err := s.loadBot(ctx, uid, req.Bot); err != nil {
+		if err != ierr.ErrBotNotFound {
+			return nil, err
+		}
+		if err = s.checkManager(ctx, uid, req.GroupID); err != nil {
+			return nil, err
+		}
+	}
+	member, err := s.store.Group.Member(ctx, req.GroupID, req.Bot)
+	if err == store.ErrNotFound {
+		return &MemberRsp{}, nil
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", req.GroupID, req.Bot, err)
+		return nil, ierr.ErrSystem
+	}
+	if err = s.store.Group.RemoveMember(ctx, req.GroupID, req.Bot); err != nil && err != store.ErrNotFound {
+		log.ErrorContextf(ctx, "remove bot member fail, group:%d, bot:%d, err:%v", req.GroupID, req.Bot, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "bot leave group, group:%d, bot:%d, operator:%d", req.GroupID, req.Bot, uid)
+	s.hookMember(ctx, model.HookMemberLeave, member, uid)
+	return &MemberRsp{}, nil
+}
+
+// checkManager 校验uid是群主或管理员
+func (s *Service) checkManager(ctx context.Context, uid, groupID uint64) error {
+	member, err := s.store.Group.Member(ctx, groupID, uid)
+	if err == store.ErrNotFound {
+		return ierr.ErrNotGroupMember
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", groupID, uid, err)
+		return ierr.ErrSystem
+	}
+	if !member.IsManager() {
+		return ierr.ErrConvNoPerm
+	}
+	return nil
+}
+
+// DeadReq 查询机器人的死信
+type DeadReq struct {
+	Bot   uint64 `form:"bot"`
+	Limit int    `form:"limit"`
+}
+
+// DeadRsp .
+type DeadRsp struct {
+	Items []*model.HookDelivery `json:"items"`
+}
+
+const maxDeadLimit = 100
+
+// Dead 查询多次投递失败的出站事件，便于创建者排查回调地址的问题
+func (s *Service) Dead(ctx context.Context, uid uint64, req *DeadReq) (*DeadRsp, error) {
+	if req.Limit <= 0 || req.Limit > maxDeadLimit {
+		req.Limit = maxDeadLimit
+	}
+	if _, err := s.loadBot(ctx, uid, req.Bot); err != nil {
+		return nil, err
+	}
+	list, err := s.store.Hook.Dead(ctx, req.Bot, req.Limit)
+	if err != nil {
+		log.ErrorContextf(ctx, "list dead hooks fail, bot:%d, err:%v", req.Bot, err)
+		return nil, ierr.ErrSystem
+	}
+	if list == nil {
+		list = []*model.HookDelivery{}
+	}
+	return &DeadRsp{Items: list}, nil
+}
@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/binbin6363/icuc/common/idgen"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/service/message"
+	"github.com/binbin6363/icuc/im/app/store"
+	"github.com/binbin6363/icuc/im/app/webhook"
+)
+
+// ActionRouter 机器人发出的卡片，按钮回调推送到机器人的回调地址，其他卡片交给fallback
+type ActionRouter struct {
+	store    *store.Store
+	client   *webhook.Client
+	ids      *idgen.Snowflake
+	fallback message.ActionRouter
+}
+
+// NewActionRouter ids与机器人服务共用，回调事件和队列投递的事件id不会重复，timeout单位毫秒
+func NewActionRouter(st *store.Store, ids *idgen.Snowflake, fallback message.ActionRouter, timeout int) *ActionRouter {
+	return &ActionRouter{store: st, client: webhook.NewClient(timeout), ids: ids, fallback: fallback}
+}
+
+// Route 点击者在等待结果，不进入出站事件队列，签名方式与出站事件相同，机器人没有回调地址时按类型注册的地址回调
+func (r *ActionRouter) Route(ctx context.Context, msg *model.Message, ct *model.CustomType, action *model.CardAction) (*model.CardActionResult, error) {
+	b, err := r.store.Bot.Get(ctx, msg.Sender)
+	if err == store.ErrNotFound || err == nil && b.Webhook == "" {
+		return r.fallback.Route(ctx, msg, ct, action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ev := &model.HookEvent{
+		ID:       r.ids.Next(),
+		Type:     model.HookCardAction,
+		Bot:      b.Uid,
+		ConvID:   msg.ConvID,
+		Action:   action,
+		Operator: action.Operator,
+		Time:     action.Time,
+	}
+	res := &model.CardActionResult{}
+	if err = r.client.Post(ctx, b.Webhook, b.Secret, ev, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	hookLease  = time.Minute // 领取投递任务的租约，实例中途退出时由其他实例在租约过期后接手，接收方按事件id去重
+	hookBatch  = 10          // 每次领取的投递任务数，按请求超时估算不超过租约
+	maxBackoff = time.Hour   // 重试间隔的上限
+)
+
+// hookMember 群成员变化时为群里订阅了该事件的机器人生成出站事件，离开的机器人自己也会收到
+func (s *Service) hookMember(ctx context.Context, typ string, member *model.GroupMember, operator uint64) {
+	members, err := s.store.Group.Members(ctx, member.GroupID)
+	if err != nil {
+		log.ErrorContextf(ctx, "get group members fail, group:%d, err:%v", member.GroupID, err)
+		return
+	}
+	uids := []uint64{member.Uid}
+	for _, m := range members {
+		if m.Uid != member.Uid {
+			uids = append(uids, m.Uid)
+		}
+	}
+	bots, err := s.store.Bot.Bots(ctx, uids)
+	if err != nil {
+		log.ErrorContextf(ctx, "get group bots fail, group:%d, err:%v", member.GroupID, err)
+		return
+	}
+	now := time.Now().UnixMilli()
+	for _, b := range bots {
+		if !b.Subscribed(typ) {
+			continue
+		}
+		ev := &model.HookEvent{
+			ID:       s.ids.Next(),
+			Type:     typ,
+			Bot:      b.Uid,
+			ConvID:   model.GroupConvID(member.GroupID),
+			Member:   member,
+			Operator: operator,
+			Time:     now,
+		}
+		if err = s.store.Hook.Enqueue(ctx, model.NewHookDelivery(ev)); err != nil {
+			log.ErrorContextf(ctx, "enqueue hook event fail, bot:%d, type:%s, err:%v", b.Uid, typ, err)
+		}
+	}
+}
+
+// backoff 第n次失败后的重试间隔，从配置的间隔开始每次翻倍
+func backoff(n int) time.Duration {
+	d := time.Duration(cfg.AppConfig().BotInfo.Backoff) * time.Second
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// RunDispatcher 定期投递出站事件，直到ctx结束，多个实例可以同时运行
+func (s *Service) RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Dispatch(ctx)
+		}
+	}
+}
+
+// Dispatch 分批领取到了投递时间的出站事件并投递
+func (s *Service) Dispatch(ctx context.Context) {
+	for {
+		list, err := s.store.Hook.Claim(ctx, s.owner, time.Now().UnixMilli(), hookLease, hookBatch)
+		if err != nil {
+			log.ErrorContextf(ctx, "claim hook events fail, err:%v", err)
+			return
+		}
+		for _, d := range list {
+			s.deliver(ctx, d)
+		}
+		if len(list) < hookBatch {
+			return
+		}
+	}
+}
+
+// deliver 按机器人当前的回调地址和密钥签名投递，失败时退避重试，次数用完后记为死信
+func (s *Service) deliver(ctx context.Context, d *model.HookDelivery) {
+	var reason string
+	b, err := s.store.Bot.Get(ctx, d.Bot)
+	switch {
+	case err == store.ErrNotFound:
+		reason = "bot not found"
+	case err != nil:
+		log.ErrorContextf(ctx, "get bot fail, uid:%d, err:%v", d.Bot, err)
+		return
+	case b.Webhook == "":
+		reason = "webhook not set"
+	default:
+		if err = s.client.Post(ctx, b.Webhook, b.Secret, d.Event, nil); err != nil {
+			reason = err.Error()
+		}
+	}
+
+	now := time.Now()
+	d.Attempts++
+	d.UpdateTime = now.UnixMilli()
+	switch {
+	case reason == "":
+		d.Status = model.HookDelivered
+	case d.Attempts >= cfg.AppConfig().BotInfo.MaxAttempts:
+		d.Status, d.LastError = model.HookDead, reason
+		log.WarnContextf(ctx, "hook event dead, id:%d, bot:%d, attempts:%d, err:%s", d.ID, d.Bot, d.Attempts, reason)
+	default:
+		d.LastError = reason
+		d.NextTime = now.Add(backoff(d.Attempts)).UnixMilli()
+		log.InfoContextf(ctx, "hook event fail, retry later, id:%d, bot:%d, attempts:%d, err:%s", d.ID, d.Bot, d.Attempts, reason)
+	}
+	if err = s.store.Hook.Finish(ctx, d, s.owner); err != nil {
+		log.WarnContextf(ctx, "finish hook event fail, id:%d, err:%v", d.ID, err)
+	}
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"strconv"
+
+	"github.com/binbin6363/icuc/common/api"
+	"github.com/binbin6363/icuc/common/codec/httpx"
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册机器人管理的http接口，需要挂在jwt鉴权中间件之后
+func (s *Service) RegisterRoutes(r gin.IRoutes) {
+	r.POST(api.PathBotCreate, s.handleCreate)
+	r.POST(api.PathBotUpdate, s.handleUpdate)
+	r.POST(api.PathBotToken, s.handleResetToken)
+	r.GET(api.PathBotList, s.handleList)
+	r.POST(api.PathBotJoin, s.handleJoin)
+	r.POST(api.PathBotLeave, s.handleLeave)
+	r.GET(api.PathBotDead, s.handleDead)
+}
+
+// RegisterAPI 注册机器人调用的http接口，使用机器人令牌鉴权，不能挂在jwt鉴权中间件之后
+func (s *Service) RegisterAPI(r gin.IRoutes) {
+	r.POST(api.PathBotSend, s.handlePost)
+}
+
+// currentUid 从鉴权中间件写入的上下文中获取当前用户
+func currentUid(c *gin.Context) uint64 {
+	uid, _ := strconv.ParseUint(c.GetString(api.HeadUid), 10, 64)
+	return uid
+}
+
+func (s *Service) handleCreate(c *gin.Context) {
+	req := &CreateReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Create(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleUpdate(c *gin.Context) {
+	req := &UpdateReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Update(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleResetToken(c *gin.Context) {
+	req := &TokenReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.ResetToken(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleList(c *gin.Context) {
+	req := &ListReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.List(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleJoin(c *gin.Context) {
+	req := &MemberReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Join(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleLeave(c *gin.Context) {
+	req := &MemberReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Leave(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleDead(c *gin.Context) {
+	req := &DeadReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Dead(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handlePost(c *gin.Context) {
+	b, e := s.authBot(c, c.GetHeader(api.AuthField))
+	if e != nil {
+		httpx.SendResponse(c, nil, e)
+		return
+	}
+	req := &PostReq{}
+	if e = c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Post(c, b, req)
+	httpx.SendResponse(c, rsp, e)
+}
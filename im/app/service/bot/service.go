@@ -0,0 +1,75 @@
+// Package bot 机器人账号和集成：机器人用自己的令牌往加入的会话发消息，会话中的事件签名后推送到机器人的回调地址
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/binbin6363/icuc/common/idgen"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/service/message"
+	"github.com/binbin6363/icuc/im/app/store"
+	"github.com/binbin6363/icuc/im/app/webhook"
+)
+
+// Sender 以机器人的身份走普通的发送流程，由消息服务实现
+type Sender interface {
+	SendSingle(ctx context.Context, uid uint64, req *message.SendReq) (*message.SendRsp, error)
+	SendGroup(ctx context.Context, uid uint64, req *message.SendReq) (*message.SendRsp, error)
+}
+
+// Service 机器人服务
+type Service struct {
+	store  *store.Store
+	sender Sender
+	client *webhook.Client
+	ids    *idgen.Snowflake
+	owner  string // 领取投递任务时的实例标识
+}
+
+// Option 创建Service时的可选项
+type Option func(*Service)
+
+// WithStore 指定存储，不指定时使用内存存储
+func WithStore(st *store.Store) Option {
+	return func(s *Service) {
+		s.store = st
+	}
+}
+
+// WithSender 指定发送消息的实现，不指定时机器人不能发消息
+func WithSender(sender Sender) Option {
+	return func(s *Service) {
+		s.sender = sender
+	}
+}
+
+// WithIDs 指定出站事件的id生成器，与卡片按钮回调和其他服务共用同一个，不指定时按配置新建
+func WithIDs(ids *idgen.Snowflake) Option {
+	return func(s *Service) {
+		s.ids = ids
+	}
+}
+
+func New(opts ...Option) *Service {
+	host, _ := os.Hostname()
+	s := &Service{
+		client: webhook.NewClient(cfg.AppConfig().BotInfo.Timeout),
+		owner:  fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.ids == nil {
+		if info := cfg.AppConfig().ServerInfo; info != nil {
+			s.ids = idgen.NewSnowflake(info.DataCenterId, info.WorkerId)
+		} else {
+			s.ids = idgen.NewSnowflake(0, 0)
+		}
+	}
+	if s.store == nil {
+		s.store = store.NewMemStore()
+	}
+	return s
+}
@@ -0,0 +1,302 @@
+package broadcast
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	maxTitleLen   = 100   // 标题最多的字符数
+	maxContentLen = 5000  // 内容最多的字符数
+	maxTargetUids = 10000 // 指定用户分组的最大人数，更大的范围按租户等条件圈选
+	maxSyncLimit  = 100
+)
+
+// checkAdmin 只有配置的运营账号可以管理广播
+func checkAdmin(uid uint64) error {
+	if info := cfg.AppConfig().BroadcastInfo; info == nil || !info.IsAdmin(uid) {
+		return ierr.ErrNotAdmin
+	}
+	return nil
+}
+
+func checkTarget(t *model.BroadcastTarget) bool {
+	if t == nil {
+		return true
+	}
+	if len(t.Uids) > maxTargetUids {
+		return false
+	}
+	for i, p := range t.Platforms {
+		t.Platforms[i] = strings.ToLower(p)
+	}
+	if t.MinVersion != "" && !validVersion(t.MinVersion) || t.MaxVersion != "" && !validVersion(t.MaxVersion) {
+		return false
+	}
+	return t.MinVersion == "" || t.MaxVersion == "" || compareVersion(t.MinVersion, t.MaxVersion) <= 0
+}
+
+// CreateReq 创建广播
+type CreateReq struct {
+	Title       string                 `json:"title"`
+	Content     string                 `json:"content"`
+	Target      *model.BroadcastTarget `json:"target"`       // 为空时发给全部用户
+	PublishTime int64                  `json:"publish_time"` // 定时发布时间，单位毫秒，为空或已过时立即发布
+	ExpireTime  int64                  `json:"expire_time"`  // 过期时间，单位毫秒，过期后不再下发
+}
+
+// CreateRsp .
+type CreateRsp struct {
+	ID     uint64                `json:"id,string"`
+	Status model.BroadcastStatus `json:"status"`
+}
+
+// Create 运营创建广播，到发布时间后追加到广播时间线
+func (s *Service) Create(ctx context.Context, uid uint64, req *CreateReq) (*CreateRsp, error) {
+	if err := checkAdmin(uid); err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	if req.PublishTime < now {
+		req.PublishTime = now
+	}
+	if req.Content == "" || utf8.RuneCountInString(req.Content) > maxContentLen ||
+		utf8.RuneCountInString(req.Title) > maxTitleLen || !checkTarget(req.Target) ||
+		req.ExpireTime != 0 && req.ExpireTime <= req.PublishTime {
+		return nil, ierr.ErrParam
+	}
+	b := &model.Broadcast{
+		ID:          s.ids.Next(),
+		Title:       req.Title,
+		Content:     req.Content,
+		Target:      req.Target,
+		Status:      model.BroadcastScheduled,
+		Creator:     uid,
+		CreateTime:  now,
+		PublishTime: req.PublishTime,
+		ExpireTime:  req.ExpireTime,
+	}
+	if err := s.store.Broadcast.Create(ctx, b); err != nil {
+		log.ErrorContextf(ctx, "create broadcast fail, err:%v", err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "create broadcast, id:%d, creator:%d, publish:%d", b.ID, uid, b.PublishTime)
+	if b.PublishTime <= now {
+		s.PublishDue(ctx)
+		b.Status = model.BroadcastPublished
+	}
+	return &CreateRsp{ID: b.ID, Status: b.Status}, nil
+}
+
+// RunScheduler 定期发布到时间的定时广播，直到ctx结束，多个实例可以同时运行
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.PublishDue(ctx)
+		}
+	}
+}
+
+// PublishDue 发布到时间的广播，指定了用户分组的在线提醒，其余用户在下次同步时拉取
+func (s *Service) PublishDue(ctx context.Context) {
+	list, err := s.store.Broadcast.PublishDue(ctx, time.Now().UnixMilli())
+	if err != nil {
+		log.ErrorContextf(ctx, "publish broadcasts fail, err:%v", err)
+		return
+	}
+	for _, b := range list {
+		log.InfoContextf(ctx, "publish broadcast, id:%d, seq:%d", b.ID, b.Seq)
+		if b.Target == nil || len(b.Target.Uids) == 0 {
+			continue
+		}
+		ev := &model.Event{Type: model.EventBroadcast, Time: b.PublishTime, Broadcast: b}
+		if err = s.pusher.Push(ctx, b.Target.Uids, ev); err != nil {
+			log.WarnContextf(ctx, "push broadcast fail, id:%d, err:%v", b.ID, err)
+		}
+	}
+}
+
+// CancelReq 取消广播
+type CancelReq struct {
+	ID uint64 `json:"id,string"`
+}
+
+// CancelRsp .
+type CancelRsp struct{}
+
+// Cancel 取消广播，未发布的不再发布，已发布的不再下发
+func (s *Service) Cancel(ctx context.Context, uid uint64, req *CancelReq) (*CancelRsp, error) {
+	if err := checkAdmin(uid); err != nil {
+		return nil, err
+	}
+	err := s.store.Broadcast.Cancel(ctx, req.ID)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrBroadcastGone
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "cancel broadcast fail, id:%d, err:%v", req.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "cancel broadcast, id:%d, operator:%d", req.ID, uid)
+	return &CancelRsp{}, nil
+}
+
+// StatsReq 查询广播的投递和阅读统计
+type StatsReq struct {
+	ID uint64 `form:"id"`
+}
+
+// Stats 查询广播的投递和阅读统计
+func (s *Service) Stats(ctx context.Context, uid uint64, req *StatsReq) (*model.BroadcastStats, error) {
+	if err := checkAdmin(uid); err != nil {
+		return nil, err
+	}
+	stats, err := s.store.Broadcast.Stats(ctx, req.ID)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrBroadcastGone
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get broadcast stats fail, id:%d, err:%v", req.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	return stats, nil
+}
+
+// SyncReq 同步广播，客户端上报平台和版本用于目标过滤
+type SyncReq struct {
+	Seq      uint64 `form:"seq"` // 客户端已同步到的广播seq
+	Limit    int    `form:"limit"`
+	Platform string `form:"platform"`
+	Version  string `form:"version"`
+}
+
+// SyncRsp 同步广播回包，NextSeq为本次扫描到的位置，不在目标范围内的广播也会被跳过
+type SyncRsp struct {
+	Items   []*model.Broadcast `json:"items"`
+	NextSeq uint64             `json:"next_seq"`
+	HasMore bool               `json:"has_more"`
+}
+
+// Sync 从共享的广播时间线拉取seq之后发给当前用户的广播，首次拉到的计入投递数
+func (s *Service) Sync(ctx context.Context, uid uint64, req *SyncReq) (*SyncRsp, error) {
+	if req.Limit <= 0 || req.Limit > maxSyncLimit {
+		req.Limit = maxSyncLimit
+	}
+	c, err := s.client(ctx, uid, req.Platform, req.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	rsp := &SyncRsp{Items: []*model.Broadcast{}, NextSeq: req.Seq}
+	for len(rsp.Items) < req.Limit {
+		batch, err := s.store.Broadcast.Since(ctx, rsp.NextSeq, req.Limit)
+		if err != nil {
+			log.ErrorContextf(ctx, "list broadcasts fail, seq:%d, err:%v", rsp.NextSeq, err)
+			return nil, ierr.ErrSystem
+		}
+		for _, b := range batch {
+			if len(rsp.Items) == req.Limit {
+				break
+			}
+			rsp.NextSeq = b.Seq
+			if b.Status != model.BroadcastPublished || b.ExpireTime > 0 && b.ExpireTime <= now || !match(b.Target, c) {
+				continue
+			}
+			b.Target = nil
+			rsp.Items = append(rsp.Items, b)
+		}
+		if len(batch) < req.Limit {
+			break
+		}
+	}
+	more, err := s.store.Broadcast.Since(ctx, rsp.NextSeq, 1)
+	if err != nil {
+		log.ErrorContextf(ctx, "list broadcasts fail, seq:%d, err:%v", rsp.NextSeq, err)
+		return nil, ierr.ErrSystem
+	}
+	rsp.HasMore = len(more) > 0
+	s.countDelivered(ctx, uid, rsp)
+	return rsp, nil
+}
+
+// client 查询用户所属租户，与客户端上报的平台和版本一起用于匹配广播范围
+func (s *Service) client(ctx context.Context, uid uint64, platform, version string) (*client, error) {
+	c := &client{uid: uid, platform: platform, version: version}
+	user, err := s.store.User.Get(ctx, uid)
+	if err == nil {
+		c.tenant = user.TenantID
+	} else if err != store.ErrNotFound {
+		log.ErrorContextf(ctx, "get user fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	return c, nil
+}
+
+// countDelivered 用户的投递游标只前进，游标之后首次拉到的广播计入投递数，换设备重新同步不重复计数
+func (s *Service) countDelivered(ctx context.Context, uid uint64, rsp *SyncRsp) {
+	old, err := s.store.Broadcast.Advance(ctx, uid, rsp.NextSeq)
+	if err != nil {
+		log.WarnContextf(ctx, "advance broadcast cursor fail, uid:%d, err:%v", uid, err)
+		return
+	}
+	var ids []uint64
+	for _, b := range rsp.Items {
+		if b.Seq > old {
+			ids = append(ids, b.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err = s.store.Broadcast.AddDelivered(ctx, ids); err != nil {
+		log.WarnContextf(ctx, "add broadcast delivered fail, uid:%d, err:%v", uid, err)
+	}
+}
+
+// ReadReq 上报广播已读，平台和版本与同步时上报的一致
+type ReadReq struct {
+	ID       uint64 `json:"id,string"`
+	Platform string `json:"platform"`
+	Version  string `json:"version"`
+}
+
+// ReadRsp .
+type ReadRsp struct{}
+
+// Read 上报广播已读，同一用户只计一次，不在广播范围内的用户和已过期的广播视为不存在，不计入阅读数
+func (s *Service) Read(ctx context.Context, uid uint64, req *ReadReq) (*ReadRsp, error) {
+	b, err := s.store.Broadcast.Get(ctx, req.ID)
+	if err == store.ErrNotFound || err == nil && b.Status != model.BroadcastPublished {
+		return nil, ierr.ErrBroadcastGone
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get broadcast fail, id:%d, err:%v", req.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	c, err := s.client(ctx, uid, req.Platform, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	if b.ExpireTime > 0 && b.ExpireTime <= time.Now().UnixMilli() || !match(b.Target, c) {
+		return nil, ierr.ErrBroadcastGone
+	}
+	if _, err = s.store.Broadcast.MarkRead(ctx, req.ID, uid); err != nil {
+		log.ErrorContextf(ctx, "mark broadcast read fail, id:%d, uid:%d, err:%v", req.ID, uid, err)
+		return nil, ierr.ErrSystem
+	}
+	return &ReadRsp{}, nil
+}
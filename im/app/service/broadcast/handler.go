@@ -0,0 +1,75 @@
+package broadcast
+
+import (
+	"strconv"
+
+	"github.com/binbin6363/icuc/common/api"
+	"github.com/binbin6363/icuc/common/codec/httpx"
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册广播相关的http接口，需要挂在jwt鉴权中间件之后，管理接口另外校验运营账号
+func (s *Service) RegisterRoutes(r gin.IRoutes) {
+	r.POST(api.PathBroadcastCreate, s.handleCreate)
+	r.POST(api.PathBroadcastCancel, s.handleCancel)
+	r.GET(api.PathBroadcastStats, s.handleStats)
+	r.GET(api.PathBroadcastSync, s.handleSync)
+	r.POST(api.PathBroadcastRead, s.handleRead)
+}
+
+// currentUid 从鉴权中间件写入的上下文中获取当前用户
+func currentUid(c *gin.Context) uint64 {
+	uid, _ := strconv.ParseUint(c.GetString(api.HeadUid), 10, 64)
+	return uid
+}
+
+func (s *Service) handleCreate(c *gin.Context) {
+	req := &CreateReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Create(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleCancel(c *gin.Context) {
+	req := &CancelReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Cancel(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleStats(c *gin.Context) {
+	req := &StatsReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Stats(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSync(c *gin.Context) {
+	req := &SyncReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Sync(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRead(c *gin.Context) {
+	req := &ReadReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Read(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
@@ -0,0 +1,58 @@
+// Package broadcast 系统广播和公告，只存一份并发布到共享的广播时间线，用户同步时按目标条件过滤
+package broadcast
+
+import (
+	"github.com/binbin6363/icuc/common/idgen"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/push"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// Service 系统广播服务
+type Service struct {
+	store  *store.Store
+	pusher push.Pusher
+	ids    *idgen.Snowflake
+}
+
+// Option 创建Service时的可选项
+type Option func(*Service)
+
+// WithStore 指定存储，不指定时使用内存存储
+func WithStore(st *store.Store) Option {
+	return func(s *Service) {
+		s.store = st
+	}
+}
+
+// WithPusher 指定在线推送的实现
+func WithPusher(p push.Pusher) Option {
+	return func(s *Service) {
+		s.pusher = p
+	}
+}
+
+// WithIDs 指定广播的id生成器，不指定时按配置新建
+func WithIDs(ids *idgen.Snowflake) Option {
+	return func(s *Service) {
+		s.ids = ids
+	}
+}
+
+func New(opts ...Option) *Service {
+	s := &Service{pusher: push.LogPusher{}}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.ids == nil {
+		if info := cfg.AppConfig().ServerInfo; info != nil {
+			s.ids = idgen.NewSnowflake(info.DataCenterId, info.WorkerId)
+		} else {
+			s.ids = idgen.NewSnowflake(0, 0)
+		}
+	}
+	if s.store == nil {
+		s.store = store.NewMemStore()
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package broadcast
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// client 同步广播的用户及其客户端信息
+type client struct {
+	uid      uint64
+	tenant   string
+	platform string
+	version  string
+}
+
+// match 用户是否在广播的目标范围内，限定了平台或版本而客户端没有上报时不下发
+func match(t *model.BroadcastTarget, c *client) bool {
+	if t == nil {
+		return true
+	}
+	if len(t.Tenants) > 0 && !containsString(t.Tenants, c.tenant) {
+		return false
+	}
+	if len(t.Uids) > 0 && !containsUid(t.Uids, c.uid) {
+		return false
+	}
+	if len(t.Platforms) > 0 && !containsString(t.Platforms, strings.ToLower(c.platform)) {
+		return false
+	}
+	if t.MinVersion != "" && (c.version == "" || compareVersion(c.version, t.MinVersion) < 0) {
+		return false
+	}
+	if t.MaxVersion != "" && (c.version == "" || compareVersion(c.version, t.MaxVersion) > 0) {
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsUid(list []uint64, uid uint64) bool {
+	for _, v := range list {
+		if v == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// validVersion 版本号为点分隔的数字，如1.2.10
+func validVersion(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, p := range strings.Split(v, ".") {
+		if _, err := strconv.Atoi(p); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersion 按段比较点分隔的版本号，缺少的段视为0，无法解析的段视为0
+func compareVersion(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	n := len(pa)
+	if len(pb) > n {
+		n = len(pb)
+	}
+	for i := 0; i < n; i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package conversation
+
+import (
+	"context"
+	"time"
+
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// setUnread 按seq重新计算未读数，已读到最近一次@之后清除提醒
+func setUnread(c *model.Conversation) {
+	if c.ReadSeq > c.LastSeq {
+		c.ReadSeq = c.LastSeq
+	}
+	c.Unread = int(c.LastSeq - c.ReadSeq)
+	if c.Mentioned && c.ReadSeq >= c.MentionSeq {
+		c.Mentioned = false
+	}
+}
+
+// mentioned 消息是否@了uid
+func mentioned(msg *model.Message, uid uint64) bool {
+	if uid == msg.Sender {
+		return false
+	}
+	if msg.MentionAll {
+		return true
+	}
+	for _, m := range msg.Mentions {
+		if m == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// Deliver 新消息更新各接收者的会话，返回其中设置了免打扰的用户
+// 被删除的会话重新出现，归档的会话没有免打扰时移出归档
+func (s *Service) Deliver(ctx context.Context, msg *model.Message, uids []uint64) map[uint64]bool {
+	muted := make(map[uint64]bool)
+	preview := model.NewConvPreview(msg)
+	for _, uid := range uids {
+		conv, err := s.store.Conversation.Update(ctx, uid, msg.ConvID, func(c *model.Conversation) bool {
+			if msg.Seq <= c.LastSeq {
+				return false
+			}
+			if c.Version == 0 {
+				c.ConvType = msg.ConvType
+				c.ReadSeq = msg.Seq - 1
+			}
+			c.Last = preview
+			c.LastSeq = msg.Seq
+			c.ActiveTime = msg.SendTime
+			c.Hidden = false
+			if c.Archived && !c.Muted {
+				c.Archived = false
+			}
+			if uid == msg.Sender {
+				c.ReadSeq = msg.Seq
+			} else if mentioned(msg, uid) {
+				c.Mentioned = true
+				c.MentionSeq = msg.Seq
+			}
+			setUnread(c)
+			return true
+		})
+		if err != nil {
+			log.ErrorContextf(ctx, "update conversation fail, uid:%d, conv:%s, err:%v", uid, msg.ConvID, err)
+			continue
+		}
+		if conv != nil && conv.Muted {
+			muted[uid] = true
+		}
+	}
+	// 自己发消息视为已读，同时清除之前的@标记
+	if err := s.store.Mention.Clear(ctx, msg.Sender, msg.ConvID, msg.Seq); err != nil {
+		log.ErrorContextf(ctx, "clear mention fail, uid:%d, conv:%s, err:%v", msg.Sender, msg.ConvID, err)
+	}
+	return muted
+}
+
+// Refresh 消息编辑或撤回后，更新以它为最后一条消息的会话摘要
+func (s *Service) Refresh(ctx context.Context, msg *model.Message, uids []uint64) {
+	preview := model.NewConvPreview(msg)
+	for _, uid := range uids {
+		_, err := s.store.Conversation.Update(ctx, uid, msg.ConvID, func(c *model.Conversation) bool {
+			if c.Last == nil || c.Last.MsgID != msg.ID {
+				return false
+			}
+			c.Last = preview
+			return true
+		})
+		if err != nil {
+			log.ErrorContextf(ctx, "refresh conversation fail, uid:%d, conv:%s, err:%v", uid, msg.ConvID, err)
+		}
+	}
+}
+
+// Unmention 撤回@了用户的消息后删除被@用户的标记，会话提醒改为指向剩余未读的最近一次@，没有时清除
+func (s *Service) Unmention(ctx context.Context, msg *model.Message, uids []uint64) {
+	for _, uid := range uids {
+		if !mentioned(msg, uid) {
+			continue
+		}
+		if err := s.store.Mention.Remove(ctx, uid, msg.ID); err != nil {
+			log.ErrorContextf(ctx, "remove mention fail, uid:%d, msg:%d, err:%v", uid, msg.ID, err)
+			continue
+		}
+		list, err := s.store.Mention.List(ctx, uid)
+		if err != nil {
+			log.ErrorContextf(ctx, "list mention fail, uid:%d, err:%v", uid, err)
+			continue
+		}
+		var latest uint64
+		for _, m := range list {
+			if m.ConvID == msg.ConvID && m.Seq > latest {
+				latest = m.Seq
+			}
+		}
+		conv, err := s.store.Conversation.Update(ctx, uid, msg.ConvID, func(c *model.Conversation) bool {
+			if !c.Mentioned || c.MentionSeq != msg.Seq {
+				return false
+			}
+			c.MentionSeq = latest
+			c.Mentioned = latest > c.ReadSeq
+			return true
+		})
+		if err != nil {
+			log.ErrorContextf(ctx, "unmention conversation fail, uid:%d, conv:%s, err:%v", uid, msg.ConvID, err)
+			continue
+		}
+		if conv != nil {
+			s.push(ctx, conv)
+		}
+	}
+}
+
+// Read 用户已读到seq，已读位置只前进不后退，变化同步到用户的其他端
+func (s *Service) Read(ctx context.Context, uid uint64, convID string, seq uint64) {
+	conv, err := s.store.Conversation.Update(ctx, uid, convID, func(c *model.Conversation) bool {
+		if c.Version == 0 || seq <= c.ReadSeq || c.ReadSeq == c.LastSeq {
+			return false
+		}
+		c.ReadSeq = seq
+		setUnread(c)
+		return true
+	})
+	if err != nil {
+		log.ErrorContextf(ctx, "read conversation fail, uid:%d, conv:%s, err:%v", uid, convID, err)
+		return
+	}
+	if conv != nil {
+		s.push(ctx, conv)
+	}
+}
+
+// push 会话变化推送给用户自己的各端
+func (s *Service) push(ctx context.Context, conv *model.Conversation) {
+	conv.HideDue(time.Now().UnixMilli())
+	ev := &model.Event{
+		Type:     model.EventConv,
+		ConvID:   conv.ConvID,
+		Operator: conv.Uid,
+		Time:     time.Now().UnixMilli(),
+		Priority: model.PrioritySilent,
+		Conv:     conv,
+	}
+	if err := s.pusher.Push(ctx, []uint64{conv.Uid}, ev); err != nil {
+		log.WarnContextf(ctx, "push conversation fail, uid:%d, conv:%s, err:%v", conv.Uid, conv.ConvID, err)
+	}
+}
@@ -0,0 +1,64 @@
+package conversation
+
+import (
+	"strconv"
+
+	"github.com/binbin6363/icuc/common/api"
+	"github.com/binbin6363/icuc/common/codec/httpx"
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册会话相关的http接口，需要挂在jwt鉴权中间件之后
+func (s *Service) RegisterRoutes(r gin.IRoutes) {
+	r.GET(api.PathConvList, s.handleList)
+	r.GET(api.PathConvSync, s.handleSync)
+	r.POST(api.PathConvSetting, s.handleSetting)
+	r.POST(api.PathConvDelete, s.handleDelete)
+}
+
+// currentUid 从鉴权中间件写入的上下文中获取当前用户
+func currentUid(c *gin.Context) uint64 {
+	uid, _ := strconv.ParseUint(c.GetString(api.HeadUid), 10, 64)
+	return uid
+}
+
+func (s *Service) handleList(c *gin.Context) {
+	req := &ListReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.List(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSync(c *gin.Context) {
+	req := &SyncReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Sync(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSetting(c *gin.Context) {
+	req := &SettingReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Setting(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleDelete(c *gin.Context) {
+	req := &DeleteReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Delete(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
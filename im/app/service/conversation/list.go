@@ -0,0 +1,273 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+// sortTime 置顶的会话按置顶时间排序，其余按最后消息时间
+func sortTime(c *model.Conversation) int64 {
+	if c.Pinned {
+		return c.PinTime
+	}
+	return c.ActiveTime
+}
+
+// cursor 列表排序位置，依次比较置顶、时间和会话id
+type cursor struct {
+	pinned bool
+	time   int64
+	convID string
+}
+
+func cursorOf(c *model.Conversation) *cursor {
+	return &cursor{pinned: c.Pinned, time: sortTime(c), convID: c.ConvID}
+}
+
+// before 排序时a是否在b前面
+func (a *cursor) before(b *cursor) bool {
+	if a.pinned != b.pinned {
+		return a.pinned
+	}
+	if a.time != b.time {
+		return a.time > b.time
+	}
+	return a.convID < b.convID
+}
+
+func (a *cursor) String() string {
+	pinned := 0
+	if a.pinned {
+		pinned = 1
+	}
+	return fmt.Sprintf("%d_%d_%s", pinned, a.time, a.convID)
+}
+
+func parseCursor(s string) (*cursor, bool) {
+	parts := strings.SplitN(s, "_", 3)
+	if len(parts) != 3 || (parts[0] != "0" && parts[0] != "1") {
+		return nil, false
+	}
+	t, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &cursor{pinned: parts[0] == "1", time: t, convID: parts[2]}, true
+}
+
+// ListReq 分页拉取最近会话
+type ListReq struct {
+	Cursor   string `form:"cursor"`   // 上一页返回的next_cursor，首页不填
+	Limit    int    `form:"limit"`    // 单页数量
+	Archived bool   `form:"archived"` // 拉取归档的会话
+}
+
+// ListRsp 最近会话列表，置顶在前，其余按最后消息时间从新到旧
+type ListRsp struct {
+	Convs      []*model.Conversation `json:"convs"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	HasMore    bool                  `json:"has_more"`
+	Version    uint64                `json:"version"` // 当前最大版本号，之后用于增量同步
+}
+
+// List 分页拉取最近会话，不包含已删除的会话
+func (s *Service) List(ctx context.Context, uid uint64, req *ListReq) (*ListRsp, error) {
+	if req.Limit <= 0 || req.Limit > maxLimit {
+		req.Limit = defaultLimit
+	}
+	var after *cursor
+	if req.Cursor != "" {
+		c, ok := parseCursor(req.Cursor)
+		if !ok {
+			return nil, ierr.ErrParam
+		}
+		after = c
+	}
+	all, err := s.store.Conversation.List(ctx, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list conversations fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+
+	rsp := &ListRsp{Convs: make([]*model.Conversation, 0, req.Limit)}
+	list := all[:0]
+	for _, c := range all {
+		if c.Version > rsp.Version {
+			rsp.Version = c.Version
+		}
+		if c.Hidden || c.Archived != req.Archived {
+			continue
+		}
+		if after != nil && !after.before(cursorOf(c)) {
+			continue
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return cursorOf(list[i]).before(cursorOf(list[j])) })
+	if len(list) > req.Limit {
+		list = list[:req.Limit]
+		rsp.HasMore = true
+		rsp.NextCursor = cursorOf(list[len(list)-1]).String()
+	}
+	now := time.Now().UnixMilli()
+	for _, c := range list {
+		c.HideDue(now)
+	}
+	rsp.Convs = append(rsp.Convs, list...)
+	return rsp, nil
+}
+
+// SyncReq 按版本号增量同步会话
+type SyncReq struct {
+	Version uint64 `form:"version"` // 客户端已同步到的版本号
+	Limit   int    `form:"limit"`
+}
+
+// SyncRsp 版本号大于请求版本的会话，包含已删除的会话，客户端据此移除
+type SyncRsp struct {
+	Convs   []*model.Conversation `json:"convs"`
+	Version uint64                `json:"version"`
+	HasMore bool                  `json:"has_more"`
+}
+
+// Sync 增量同步其他端或新消息引起的会话变化
+func (s *Service) Sync(ctx context.Context, uid uint64, req *SyncReq) (*SyncRsp, error) {
+	if req.Limit <= 0 || req.Limit > maxLimit {
+		req.Limit = defaultLimit
+	}
+	list, err := s.store.Conversation.Changes(ctx, uid, req.Version, req.Limit+1)
+	if err != nil {
+		log.ErrorContextf(ctx, "sync conversations fail, uid:%d, version:%d, err:%v", uid, req.Version, err)
+		return nil, ierr.ErrSystem
+	}
+	rsp := &SyncRsp{Version: req.Version}
+	if len(list) > req.Limit {
+		list = list[:req.Limit]
+		rsp.HasMore = true
+	}
+	if n := len(list); n > 0 {
+		rsp.Version = list[n-1].Version
+	}
+	now := time.Now().UnixMilli()
+	for _, c := range list {
+		c.HideDue(now)
+	}
+	rsp.Convs = list
+	return rsp, nil
+}
+
+// SettingReq 修改会话设置，不填的字段保持不变
+type SettingReq struct {
+	ConvID  string `json:"conv_id"`
+	Pin     *bool  `json:"pin"`
+	Mute    *bool  `json:"mute"`
+	Archive *bool  `json:"archive"`
+}
+
+// SettingRsp 修改后的会话
+type SettingRsp struct {
+	Conv *model.Conversation `json:"conv"`
+}
+
+// Setting 置顶、免打扰和归档
+func (s *Service) Setting(ctx context.Context, uid uint64, req *SettingReq) (*SettingRsp, error) {
+	if req.ConvID == "" || (req.Pin == nil && req.Mute == nil && req.Archive == nil) {
+		return nil, ierr.ErrParam
+	}
+	now := time.Now().UnixMilli()
+	found := false
+	conv, err := s.store.Conversation.Update(ctx, uid, req.ConvID, func(c *model.Conversation) bool {
+		if c.Version == 0 || c.Hidden {
+			return false
+		}
+		found = true
+		changed := false
+		if req.Pin != nil && *req.Pin != c.Pinned {
+			c.Pinned, c.PinTime = *req.Pin, 0
+			if c.Pinned {
+				c.PinTime = now
+			}
+			changed = true
+		}
+		if req.Mute != nil && *req.Mute != c.Muted {
+			c.Muted = *req.Mute
+			changed = true
+		}
+		if req.Archive != nil && *req.Archive != c.Archived {
+			c.Archived = *req.Archive
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		log.ErrorContextf(ctx, "update conversation setting fail, uid:%d, conv:%s, err:%v", uid, req.ConvID, err)
+		return nil, ierr.ErrSystem
+	}
+	if !found {
+		return nil, ierr.ErrConvNotFound
+	}
+	if conv == nil {
+		return s.get(ctx, uid, req.ConvID)
+	}
+	s.push(ctx, conv)
+	return &SettingRsp{Conv: conv}, nil
+}
+
+func (s *Service) get(ctx context.Context, uid uint64, convID string) (*SettingRsp, error) {
+	conv, err := s.store.Conversation.Get(ctx, uid, convID)
+	if err != nil {
+		log.ErrorContextf(ctx, "get conversation fail, uid:%d, conv:%s, err:%v", uid, convID, err)
+		return nil, ierr.ErrSystem
+	}
+	conv.HideDue(time.Now().UnixMilli())
+	return &SettingRsp{Conv: conv}, nil
+}
+
+// DeleteReq 删除会话
+type DeleteReq struct {
+	ConvID string `json:"conv_id"`
+}
+
+// DeleteRsp .
+type DeleteRsp struct{}
+
+// Delete 从列表中删除会话并标记全部已读，消息本身不删除，有新消息时会话重新出现
+func (s *Service) Delete(ctx context.Context, uid uint64, req *DeleteReq) (*DeleteRsp, error) {
+	found := false
+	conv, err := s.store.Conversation.Update(ctx, uid, req.ConvID, func(c *model.Conversation) bool {
+		if c.Version == 0 || c.Hidden {
+			return false
+		}
+		found = true
+		c.Hidden = true
+		c.Pinned, c.PinTime = false, 0
+		c.ReadSeq = c.LastSeq
+		setUnread(c)
+		return true
+	})
+	if err != nil {
+		log.ErrorContextf(ctx, "delete conversation fail, uid:%d, conv:%s, err:%v", uid, req.ConvID, err)
+		return nil, ierr.ErrSystem
+	}
+	if !found {
+		return nil, ierr.ErrConvNotFound
+	}
+	if err = s.store.Mention.Clear(ctx, uid, req.ConvID, conv.LastSeq); err != nil {
+		log.ErrorContextf(ctx, "clear mention fail, uid:%d, conv:%s, err:%v", uid, req.ConvID, err)
+	}
+	s.push(ctx, conv)
+	return &DeleteRsp{}, nil
+}
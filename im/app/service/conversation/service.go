@@ -0,0 +1,41 @@
+// Package conversation 最近会话列表，由消息服务的发送、编辑、撤回和已读事件驱动
+package conversation
+
+import (
+	"github.com/binbin6363/icuc/im/app/push"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// Service 最近会话服务
+type Service struct {
+	store  *store.Store
+	pusher push.Pusher
+}
+
+// Option 创建Service时的可选项
+type Option func(*Service)
+
+// WithStore 指定存储，不指定时使用内存存储
+func WithStore(st *store.Store) Option {
+	return func(s *Service) {
+		s.store = st
+	}
+}
+
+// WithPusher 指定在线推送的实现
+func WithPusher(p push.Pusher) Option {
+	return func(s *Service) {
+		s.pusher = p
+	}
+}
+
+func New(opts ...Option) *Service {
+	s := &Service{pusher: push.LogPusher{}}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.store == nil {
+		s.store = store.NewMemStore()
+	}
+	return s
+}
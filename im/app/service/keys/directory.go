@@ -0,0 +1,290 @@
+package keys
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	maxDevices       = 10  // 每个用户最多发布密钥的设备数
+	maxPreKeys       = 200 // 每个设备最多保存的一次性公钥数
+	maxPreKeysPerReq = 100 // 单次上传的一次性公钥数
+	lowPreKeys       = 10  // 剩余一次性公钥少于该值时提醒设备补充
+)
+
+var deviceIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// checkKey 公钥为base64编码的32字节，兼容带一字节类型前缀的33字节格式
+func checkKey(key string) bool {
+	b, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && (len(b) == 32 || len(b) == 33)
+}
+
+// checkSigned 签名预共享公钥的签名为base64编码的64字节，签名本身由对端客户端用身份公钥校验
+func checkSigned(spk *model.SignedPreKey) bool {
+	if spk == nil || !checkKey(spk.Key) {
+		return false
+	}
+	b, err := base64.StdEncoding.DecodeString(spk.Signature)
+	return err == nil && len(b) == 64
+}
+
+func checkPreKeys(keys []*model.PreKey) bool {
+	if len(keys) > maxPreKeysPerReq {
+		return false
+	}
+	for _, pk := range keys {
+		if pk == nil || !checkKey(pk.Key) {
+			return false
+		}
+	}
+	return true
+}
+
+// device 获取当前用户的设备，没有发布过时返回ErrKeyNotFound
+func (s *Service) device(ctx context.Context, uid uint64, deviceID string) (*model.DeviceKeys, []*model.DeviceKeys, error) {
+	devices, err := s.store.Key.Devices(ctx, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list devices fail, uid:%d, err:%v", uid, err)
+		return nil, nil, ierr.ErrSystem
+	}
+	for _, d := range devices {
+		if d.DeviceID == deviceID {
+			return d, devices, nil
+		}
+	}
+	return nil, devices, ierr.ErrKeyNotFound
+}
+
+// addPreKeys 追加一次性公钥，超过上限时拒绝，返回剩余数量
+func (s *Service) addPreKeys(ctx context.Context, uid uint64, deviceID string, keys []*model.PreKey) (int, error) {
+	n, err := s.store.Key.CountPreKeys(ctx, uid, deviceID)
+	if err != nil {
+		log.ErrorContextf(ctx, "count prekeys fail, uid:%d, device:%s, err:%v", uid, deviceID, err)
+		return 0, ierr.ErrSystem
+	}
+	if len(keys) == 0 {
+		return n, nil
+	}
+	if n+len(keys) > maxPreKeys {
+		return 0, ierr.ErrParam
+	}
+	n, err = s.store.Key.AddPreKeys(ctx, uid, deviceID, keys)
+	if err != nil {
+		log.ErrorContextf(ctx, "add prekeys fail, uid:%d, device:%s, err:%v", uid, deviceID, err)
+		return 0, ierr.ErrSystem
+	}
+	return n, nil
+}
+
+// PublishReq 发布设备的公钥
+type PublishReq struct {
+	DeviceID     string              `json:"device_id"`
+	IdentityKey  string              `json:"identity_key"`
+	SignedPreKey *model.SignedPreKey `json:"signed_pre_key"`
+	PreKeys      []*model.PreKey     `json:"pre_keys"`
+}
+
+// StatusRsp 设备的一次性公钥余量
+type StatusRsp struct {
+	PreKeyCount int  `json:"pre_key_count"`
+	Low         bool `json:"low"` // 余量不足，需要补充
+}
+
+func newStatus(n int) *StatusRsp {
+	return &StatusRsp{PreKeyCount: n, Low: n < lowPreKeys}
+}
+
+// Publish 发布或重新发布设备的公钥，身份公钥变化(如重装)时丢弃旧的一次性公钥
+func (s *Service) Publish(ctx context.Context, uid uint64, req *PublishReq) (*StatusRsp, error) {
+	if !deviceIDRegexp.MatchString(req.DeviceID) || !checkKey(req.IdentityKey) ||
+		!checkSigned(req.SignedPreKey) || !checkPreKeys(req.PreKeys) {
+		return nil, ierr.ErrParam
+	}
+	old, devices, err := s.device(ctx, uid, req.DeviceID)
+	switch {
+	case err == ierr.ErrKeyNotFound:
+		if len(devices) >= maxDevices {
+			return nil, ierr.ErrParam
+		}
+	case err != nil:
+		return nil, err
+	case old.IdentityKey != req.IdentityKey:
+		log.InfoContextf(ctx, "identity key changed, uid:%d, device:%s", uid, req.DeviceID)
+		if err = s.store.Key.RemoveDevice(ctx, uid, req.DeviceID); err != nil {
+			log.ErrorContextf(ctx, "remove device fail, uid:%d, device:%s, err:%v", uid, req.DeviceID, err)
+			return nil, ierr.ErrSystem
+		}
+	}
+
+	keys := &model.DeviceKeys{
+		Uid:          uid,
+		DeviceID:     req.DeviceID,
+		IdentityKey:  req.IdentityKey,
+		SignedPreKey: req.SignedPreKey,
+		UpdateTime:   time.Now().UnixMilli(),
+	}
+	if err = s.store.Key.SaveDevice(ctx, keys); err != nil {
+		log.ErrorContextf(ctx, "save device keys fail, uid:%d, device:%s, err:%v", uid, req.DeviceID, err)
+		return nil, ierr.ErrSystem
+	}
+	n, err := s.addPreKeys(ctx, uid, req.DeviceID, req.PreKeys)
+	if err != nil {
+		return nil, err
+	}
+	log.InfoContextf(ctx, "publish device keys, uid:%d, device:%s, prekeys:%d", uid, req.DeviceID, n)
+	return newStatus(n), nil
+}
+
+// SignedReq 轮换签名预共享公钥
+type SignedReq struct {
+	DeviceID     string              `json:"device_id"`
+	SignedPreKey *model.SignedPreKey `json:"signed_pre_key"`
+}
+
+// RotateSigned 轮换设备的签名预共享公钥，身份公钥不变
+func (s *Service) RotateSigned(ctx context.Context, uid uint64, req *SignedReq) (*StatusRsp, error) {
+	if !checkSigned(req.SignedPreKey) {
+		return nil, ierr.ErrParam
+	}
+	keys, _, err := s.device(ctx, uid, req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	keys.SignedPreKey = req.SignedPreKey
+	keys.UpdateTime = time.Now().UnixMilli()
+	if err = s.store.Key.SaveDevice(ctx, keys); err != nil {
+		log.ErrorContextf(ctx, "save device keys fail, uid:%d, device:%s, err:%v", uid, req.DeviceID, err)
+		return nil, ierr.ErrSystem
+	}
+	return s.Status(ctx, uid, &StatusReq{DeviceID: req.DeviceID})
+}
+
+// PreKeysReq 补充一次性公钥
+type PreKeysReq struct {
+	DeviceID string          `json:"device_id"`
+	PreKeys  []*model.PreKey `json:"pre_keys"`
+}
+
+// AddPreKeys 补充设备的一次性公钥
+func (s *Service) AddPreKeys(ctx context.Context, uid uint64, req *PreKeysReq) (*StatusRsp, error) {
+	if len(req.PreKeys) == 0 || !checkPreKeys(req.PreKeys) {
+		return nil, ierr.ErrParam
+	}
+	if _, _, err := s.device(ctx, uid, req.DeviceID); err != nil {
+		return nil, err
+	}
+	n, err := s.addPreKeys(ctx, uid, req.DeviceID, req.PreKeys)
+	if err != nil {
+		return nil, err
+	}
+	return newStatus(n), nil
+}
+
+// StatusReq 查询设备的一次性公钥余量
+type StatusReq struct {
+	DeviceID string `form:"device_id"`
+}
+
+// Status 查询设备的一次性公钥余量，客户端据此决定是否补充
+func (s *Service) Status(ctx context.Context, uid uint64, req *StatusReq) (*StatusRsp, error) {
+	if _, _, err := s.device(ctx, uid, req.DeviceID); err != nil {
+		return nil, err
+	}
+	n, err := s.store.Key.CountPreKeys(ctx, uid, req.DeviceID)
+	if err != nil {
+		log.ErrorContextf(ctx, "count prekeys fail, uid:%d, device:%s, err:%v", uid, req.DeviceID, err)
+		return nil, ierr.ErrSystem
+	}
+	return newStatus(n), nil
+}
+
+// BundleReq 获取用户的公钥包，不指定设备时返回全部设备
+// 不是好友、不在同一租户且双方都不要求端到端加密时，需指定双方所在的会话，单聊会话要求已有过往来
+type BundleReq struct {
+	Uid      uint64 `form:"uid"`
+	DeviceID string `form:"device_id"`
+	ConvID   string `form:"conv_id"`
+}
+
+// BundleRsp .
+type BundleRsp struct {
+	Bundles []*model.PreKeyBundle `json:"bundles"`
+}
+
+// Bundle 获取用户各设备的公钥包，每个设备取走一个一次性公钥，余量不足时提醒该用户补充
+func (s *Service) Bundle(ctx context.Context, uid uint64, req *BundleReq) (*BundleRsp, error) {
+	if req.Uid == 0 {
+		return nil, ierr.ErrParam
+	}
+	if err := s.checkFetch(ctx, uid, req.Uid, req.ConvID); err != nil {
+		return nil, err
+	}
+	devices, err := s.store.Key.Devices(ctx, req.Uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list devices fail, uid:%d, err:%v", req.Uid, err)
+		return nil, ierr.ErrSystem
+	}
+	rsp := &BundleRsp{Bundles: make([]*model.PreKeyBundle, 0, len(devices))}
+	for _, d := range devices {
+		if req.DeviceID != "" && d.DeviceID != req.DeviceID {
+			continue
+		}
+		b := &model.PreKeyBundle{Uid: d.Uid, DeviceID: d.DeviceID, IdentityKey: d.IdentityKey, SignedPreKey: d.SignedPreKey}
+		pk, left, err := s.store.Key.TakePreKey(ctx, d.Uid, d.DeviceID)
+		switch err {
+		case nil:
+			b.PreKey = pk
+			if left == lowPreKeys-1 || left == 0 {
+				s.remindLow(ctx, d.Uid, d.DeviceID)
+			}
+		case store.ErrNotFound:
+			// 一次性公钥用完时只用签名预共享公钥建立会话
+		default:
+			log.ErrorContextf(ctx, "take prekey fail, uid:%d, device:%s, err:%v", d.Uid, d.DeviceID, err)
+			return nil, ierr.ErrSystem
+		}
+		rsp.Bundles = append(rsp.Bundles, b)
+	}
+	if len(rsp.Bundles) == 0 {
+		return nil, ierr.ErrKeyNotFound
+	}
+	log.InfoContextf(ctx, "fetch prekey bundles, uid:%d, target:%d, devices:%d", uid, req.Uid, len(rsp.Bundles))
+	return rsp, nil
+}
+
+// remindLow 提醒设备补充一次性公钥
+func (s *Service) remindLow(ctx context.Context, uid uint64, deviceID string) {
+	ev := &model.Event{Type: model.EventPreKeyLow, Time: time.Now().UnixMilli(), Device: deviceID}
+	if err := s.pusher.Push(ctx, []uint64{uid}, ev); err != nil {
+		log.WarnContextf(ctx, "push prekey low fail, uid:%d, device:%s, err:%v", uid, deviceID, err)
+	}
+}
+
+// RemoveReq 注销设备的公钥
+type RemoveReq struct {
+	DeviceID string `json:"device_id"`
+}
+
+// RemoveRsp .
+type RemoveRsp struct{}
+
+// Remove 注销设备的公钥，如设备登出，之后发给该用户的加密消息不再需要这个设备的信封
+func (s *Service) Remove(ctx context.Context, uid uint64, req *RemoveReq) (*RemoveRsp, error) {
+	if _, _, err := s.device(ctx, uid, req.DeviceID); err != nil {
+		return nil, err
+	}
+	if err := s.store.Key.RemoveDevice(ctx, uid, req.DeviceID); err != nil {
+		log.ErrorContextf(ctx, "remove device fail, uid:%d, device:%s, err:%v", uid, req.DeviceID, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "remove device keys, uid:%d, device:%s", uid, req.DeviceID)
+	return &RemoveRsp{}, nil
+}
@@ -0,0 +1,116 @@
+package keys
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/ratelimit"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+func limitOf(l *cfg.RateLimit) ratelimit.Limit {
+	if l == nil {
+		return ratelimit.Limit{}
+	}
+	return ratelimit.Limit{Rate: l.Rate, Burst: l.Burst}
+}
+
+// checkFetch 校验uid是否可以获取target的公钥包，每次获取都会取走对方的一次性公钥，
+// 只允许自己的其他设备、好友、同租户或要求加密才能开始聊天的用户，以及与对方在同一会话(convID)中的用户获取，并按获取者限流
+func (s *Service) checkFetch(ctx context.Context, uid, target uint64, convID string) error {
+	if uid != target {
+		if err := s.checkRelation(ctx, uid, target, convID); err != nil {
+			return err
+		}
+	}
+	info := cfg.AppConfig().LimitInfo
+	if info == nil {
+		return nil
+	}
+	key := "bundle:" + strconv.FormatUint(uid, 10)
+	reqs := []ratelimit.Req{
+		{Key: key, Limit: limitOf(info.Bundle)},
+		{Key: key + ":" + strconv.FormatUint(target, 10), Limit: limitOf(info.BundlePeer)},
+	}
+	if ok, wait := s.limiter.Allow(time.Now(), reqs...); !ok {
+		log.InfoContextf(ctx, "fetch bundle limited, uid:%d, target:%d, wait:%v", uid, target, wait)
+		return ierr.RateLimited(wait)
+	}
+	return nil
+}
+
+// checkRelation 不指定会话时要求是好友、同一租户，或任一方的租户要求端到端加密(第一条消息只能加密发送，
+// 必须先取到公钥才能建立会话)；指定会话时双方都要是会话成员
+func (s *Service) checkRelation(ctx context.Context, uid, target uint64, convID string) error {
+	if convID == "" {
+		friend, err := s.store.Friend.IsFriend(ctx, uid, target)
+		if err != nil {
+			log.ErrorContextf(ctx, "check friend fail, uid:%d, target:%d, err:%v", uid, target, err)
+			return ierr.ErrSystem
+		}
+		if friend {
+			return nil
+		}
+		return s.checkTenant(ctx, uid, target)
+	}
+	typ, ids, ok := model.ParseConvID(convID)
+	if !ok {
+		return ierr.ErrParam
+	}
+	if typ == model.ConvGroup {
+		for _, id := range []uint64{uid, target} {
+			_, err := s.store.Group.Member(ctx, ids[0], id)
+			if err == store.ErrNotFound {
+				return ierr.ErrConvNoPerm
+			}
+			if err != nil {
+				log.ErrorContextf(ctx, "get member fail, group:%d, uid:%d, err:%v", ids[0], id, err)
+				return ierr.ErrSystem
+			}
+		}
+		return nil
+	}
+	// 单聊要求已经有过往来，会话出现在获取者的会话列表中
+	if convID != model.SingleConvID(uid, target) {
+		return ierr.ErrConvNoPerm
+	}
+	_, err := s.store.Conversation.Get(ctx, uid, convID)
+	if err == store.ErrNotFound {
+		return ierr.ErrConvNoPerm
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get conv fail, uid:%d, conv:%s, err:%v", uid, convID, err)
+		return ierr.ErrSystem
+	}
+	return nil
+}
+
+// checkTenant 陌生人之间按租户判断，用户不存在时不允许获取
+func (s *Service) checkTenant(ctx context.Context, uid, target uint64) error {
+	users := make([]*model.User, 0, 2)
+	for _, id := range []uint64{uid, target} {
+		user, err := s.store.User.Get(ctx, id)
+		if err == store.ErrNotFound {
+			return ierr.ErrConvNoPerm
+		}
+		if err != nil {
+			log.ErrorContextf(ctx, "get user fail, uid:%d, err:%v", id, err)
+			return ierr.ErrSystem
+		}
+		users = append(users, user)
+	}
+	if users[0].TenantID != "" && users[0].TenantID == users[1].TenantID {
+		return nil
+	}
+	for _, user := range users {
+		if t := cfg.AppConfig().Tenant(user.TenantID); t != nil && t.E2ERequired {
+			return nil
+		}
+	}
+	return ierr.ErrConvNoPerm
+}
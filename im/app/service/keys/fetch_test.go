@@ -0,0 +1,77 @@
+package keys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+func TestMain(m *testing.M) {
+	cfg.Init("../../etc/config.yaml")
+	dir, err := os.MkdirTemp("", "keys")
+	if err != nil {
+		panic(err)
+	}
+	log.InitLogger(filepath.Join(dir, "test.log"), 10, 1, 1, 0, 1)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestCheckFetch(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemStore()
+	s := New(WithStore(st))
+	cfg.AppConfig().Tenants = append(cfg.AppConfig().Tenants, &cfg.Tenant{ID: "secure", E2ERequired: true})
+	for _, u := range []*model.User{
+		{Uid: 1, TenantID: "default"},
+		{Uid: 2, TenantID: "default"},
+		{Uid: 3, TenantID: "other"},
+		{Uid: 4, TenantID: "secure"},
+		{Uid: 5, TenantID: "secure"},
+	} {
+		if err := st.User.Save(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		uid, target uint64
+		want        error
+	}{
+		{1, 1, nil},                // 自己的其他设备
+		{1, 2, nil},                // 同租户
+		{1, 3, ierr.ErrConvNoPerm}, // 不同租户且都不要求加密
+		{3, 4, nil},                // 对方租户要求加密，第一条消息只能加密发送
+		{4, 5, nil},                // 要求加密的租户内第一次聊天
+		{1, 9, ierr.ErrConvNoPerm}, // 用户不存在
+	}
+	for _, c := range cases {
+		if err := s.checkFetch(ctx, c.uid, c.target, ""); err != c.want {
+			t.Errorf("fetch %d -> %d got %v, want %v", c.uid, c.target, err, c.want)
+		}
+	}
+
+	if err := st.Friend.Add(ctx, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkFetch(ctx, 3, 1, ""); err != nil {
+		t.Fatalf("friend fetch got %v", err)
+	}
+
+	// 同一对用户反复获取会被限流
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = s.checkFetch(ctx, 2, 1, "")
+	}
+	if e, ok := err.(*ierr.ICIUError); !ok || e.Code != ierr.CodeRateLimited {
+		t.Fatalf("repeated fetch got %v", err)
+	}
+}
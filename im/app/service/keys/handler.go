@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"strconv"
+
+	"github.com/binbin6363/icuc/common/api"
+	"github.com/binbin6363/icuc/common/codec/httpx"
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册公钥目录的http接口，需要挂在jwt鉴权中间件之后
+func (s *Service) RegisterRoutes(r gin.IRoutes) {
+	r.POST(api.PathKeyPublish, s.handlePublish)
+	r.POST(api.PathKeySigned, s.handleRotateSigned)
+	r.POST(api.PathKeyPreKeys, s.handleAddPreKeys)
+	r.GET(api.PathKeyStatus, s.handleStatus)
+	r.GET(api.PathKeyBundle, s.handleBundle)
+	r.POST(api.PathKeyRemove, s.handleRemove)
+}
+
+// currentUid 从鉴权中间件写入的上下文中获取当前用户
+func currentUid(c *gin.Context) uint64 {
+	uid, _ := strconv.ParseUint(c.GetString(api.HeadUid), 10, 64)
+	return uid
+}
+
+func (s *Service) handlePublish(c *gin.Context) {
+	req := &PublishReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Publish(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRotateSigned(c *gin.Context) {
+	req := &SignedReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.RotateSigned(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleAddPreKeys(c *gin.Context) {
+	req := &PreKeysReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.AddPreKeys(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleStatus(c *gin.Context) {
+	req := &StatusReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Status(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleBundle(c *gin.Context) {
+	req := &BundleReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Bundle(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRemove(c *gin.Context) {
+	req := &RemoveReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Remove(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
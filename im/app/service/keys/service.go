@@ -0,0 +1,43 @@
+// Package keys 端到端加密的公钥目录，发布身份公钥和预共享公钥，供对端获取后在客户端建立加密会话
+package keys
+
+import (
+	"github.com/binbin6363/icuc/im/app/push"
+	"github.com/binbin6363/icuc/im/app/ratelimit"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// Service 公钥目录服务
+type Service struct {
+	store   *store.Store
+	pusher  push.Pusher
+	limiter *ratelimit.Limiter
+}
+
+// Option 创建Service时的可选项
+type Option func(*Service)
+
+// WithStore 指定存储，不指定时使用内存存储
+func WithStore(st *store.Store) Option {
+	return func(s *Service) {
+		s.store = st
+	}
+}
+
+// WithPusher 指定在线推送的实现
+func WithPusher(p push.Pusher) Option {
+	return func(s *Service) {
+		s.pusher = p
+	}
+}
+
+func New(opts ...Option) *Service {
+	s := &Service{pusher: push.LogPusher{}, limiter: ratelimit.NewLimiter()}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.store == nil {
+		s.store = store.NewMemStore()
+	}
+	return s
+}
@@ -0,0 +1,409 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	maxFileNameLen  = 255
+	staleMediaBatch = 100 // 每次清理的媒体记录数
+)
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// InitUploadReq 创建分片上传任务
+type InitUploadReq struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // 整个文件的sha256，十六进制
+	InstantProof
+}
+
+// InitUploadRsp 分片上传任务信息
+type InitUploadRsp struct {
+	UploadID   uint64             `json:"upload_id,string,omitempty"`
+	ChunkSize  int64              `json:"chunk_size,omitempty"`
+	ChunkCount int                `json:"chunk_count,omitempty"`
+	Instant    *model.FileContent `json:"instant,omitempty"`   // 服务端已有相同内容且证明了持有时直接返回文件，不需要再上传
+	Challenge  *model.Proof       `json:"challenge,omitempty"` // 服务端已有相同内容，带上这个区间的证明再次请求可以秒传
+}
+
+// InitUpload 创建分片上传任务，分片大小由服务端决定，已有相同内容时要求证明持有后秒传
+func (s *Service) InitUpload(ctx context.Context, uid uint64, req *InitUploadReq) (*InitUploadRsp, error) {
+	name, ok := fileName(req.Name)
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if !ok || req.Size <= 0 || !sha256Regexp.MatchString(req.SHA256) {
+		return nil, ierr.ErrParam
+	}
+	info := cfg.AppConfig().MediaInfo
+	if req.Size > info.MaxFileSize {
+		return nil, ierr.ErrMediaTooLarge
+	}
+	m, challenge, err := s.instantFile(ctx, uid, name, req.SHA256, req.Size, &req.InstantProof)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		return &InitUploadRsp{Instant: media.FileContent(m, media.StoreURL(ctx, s.blobs.Media))}, nil
+	}
+	if challenge != nil {
+		return &InitUploadRsp{Challenge: challenge}, nil
+	}
+	now := time.Now().UnixMilli()
+	up := &model.Upload{
+		ID:         s.ids.Next(),
+		Owner:      uid,
+		Name:       name,
+		Size:       req.Size,
+		SHA256:     req.SHA256,
+		ChunkSize:  info.ChunkSize,
+		ChunkCount: int((req.Size + info.ChunkSize - 1) / info.ChunkSize),
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	up.Done = make([]bool, up.ChunkCount)
+	if err := os.MkdirAll(s.chunkDir(up.ID), 0755); err != nil {
+		log.ErrorContextf(ctx, "create chunk dir fail, upload:%d, err:%v", up.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	if err := s.store.Upload.Create(ctx, up); err != nil {
+		log.ErrorContextf(ctx, "create upload fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "init upload, id:%d, uid:%d, name:%s, size:%d, chunks:%d", up.ID, uid, name, up.Size, up.ChunkCount)
+	return &InitUploadRsp{UploadID: up.ID, ChunkSize: up.ChunkSize, ChunkCount: up.ChunkCount}, nil
+}
+
+// UploadChunkReq 上传一个分片，分片可以乱序上传，重复上传会覆盖
+type UploadChunkReq struct {
+	UploadID uint64 `form:"upload_id"`
+	Index    int    `form:"index"`    // 分片序号，从0开始
+	Checksum string `form:"checksum"` // 分片内容的sha256，十六进制
+}
+
+// UploadChunkRsp 分片上传结果
+type UploadChunkRsp struct{}
+
+// UploadChunk 校验并保存一个分片
+func (s *Service) UploadChunk(ctx context.Context, uid uint64, req *UploadChunkReq, data []byte) (*UploadChunkRsp, error) {
+	up, err := s.loadUpload(ctx, uid, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Index < 0 || req.Index >= up.ChunkCount || int64(len(data)) != up.ChunkLen(req.Index) {
+		return nil, ierr.ErrParam
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(req.Checksum) {
+		return nil, ierr.ErrChunkChecksum
+	}
+	// 先写临时文件再改名，避免并发重传时读到半个分片
+	file := s.chunkPath(up.ID, req.Index)
+	tmp := file + ".tmp" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err = os.WriteFile(tmp, data, 0644); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.ErrorContextf(ctx, "write chunk fail, upload:%d, index:%d, err:%v", up.ID, req.Index, err)
+		return nil, ierr.ErrSystem
+	}
+	if err = s.store.Upload.MarkChunk(ctx, up.ID, req.Index, time.Now().UnixMilli()); err != nil {
+		log.ErrorContextf(ctx, "mark chunk fail, upload:%d, index:%d, err:%v", up.ID, req.Index, err)
+		return nil, ierr.ErrSystem
+	}
+	return &UploadChunkRsp{}, nil
+}
+
+// ProgressReq 查询上传进度
+type ProgressReq struct {
+	UploadID uint64 `form:"upload_id"`
+}
+
+// ProgressRsp 上传进度，客户端据此续传缺失的分片
+type ProgressRsp struct {
+	InitUploadRsp
+	Uploaded []int `json:"uploaded"` // 已上传的分片序号
+}
+
+// Progress 查询已上传的分片
+func (s *Service) Progress(ctx context.Context, uid uint64, req *ProgressReq) (*ProgressRsp, error) {
+	up, err := s.loadUpload(ctx, uid, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &ProgressRsp{
+		InitUploadRsp: InitUploadRsp{UploadID: up.ID, ChunkSize: up.ChunkSize, ChunkCount: up.ChunkCount},
+		Uploaded:      make([]int, 0, up.ChunkCount),
+	}
+	for i, done := range up.Done {
+		if done {
+			rsp.Uploaded = append(rsp.Uploaded, i)
+		}
+	}
+	return rsp, nil
+}
+
+// CompleteReq 完成分片上传
+type CompleteReq struct {
+	UploadID uint64 `json:"upload_id,string"`
+}
+
+// CompleteRsp 合并后的文件信息
+type CompleteRsp struct {
+	*model.FileContent
+}
+
+// Complete 按顺序合并分片，校验整个文件的sha256后生成媒体记录
+func (s *Service) Complete(ctx context.Context, uid uint64, req *CompleteReq) (*CompleteRsp, error) {
+	up, err := s.loadUpload(ctx, uid, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	for _, done := range up.Done {
+		if !done {
+			return nil, ierr.ErrUploadPartial
+		}
+	}
+
+	// 存储路径不使用客户端文件名的扩展名，避免html等文件按扩展名被当作网页返回
+	now := time.Now()
+	obj := &model.Object{
+		Key:  model.ObjectKey(model.MediaFile, up.SHA256, up.Size),
+		Kind: model.MediaFile,
+		Size: up.Size,
+		Path: media.RelPath("file", s.ids.Next(), now, "", "bin"),
+	}
+	merged := filepath.Join(s.chunkDir(up.ID), "merged")
+	head, sum, err := s.mergeChunks(up, merged)
+	if err != nil {
+		log.ErrorContextf(ctx, "merge chunks fail, upload:%d, err:%v", up.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	if sum != up.SHA256 {
+		os.Remove(merged)
+		log.WarnContextf(ctx, "file sha256 mismatch, upload:%d, want:%s, got:%s", up.ID, up.SHA256, sum)
+		return nil, ierr.ErrFileChecksum
+	}
+	obj.Mime = fileMime(head)
+	if obj.Proofs, err = fileProofs(merged, up.Size); err != nil {
+		os.Remove(merged)
+		log.ErrorContextf(ctx, "new proofs fail, upload:%d, err:%v", up.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	if err = s.putFile(ctx, obj.Path, merged, obj.Mime); err != nil {
+		log.ErrorContextf(ctx, "put file fail, upload:%d, key:%s, err:%v", up.ID, obj.Path, err)
+		return nil, ierr.ErrSystem
+	}
+	if obj, err = s.refs.Create(ctx, obj); err != nil {
+		log.ErrorContextf(ctx, "create object fail, upload:%d, err:%v", up.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	m, err := s.refs.NewMedia(ctx, obj, uid, up.Name, up.SHA256)
+	if err != nil {
+		log.ErrorContextf(ctx, "save media fail, upload:%d, err:%v", up.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	s.dropUpload(ctx, up.ID)
+	log.InfoContextf(ctx, "complete upload, upload:%d, media:%d, size:%d", up.ID, m.ID, m.Size)
+	return &CompleteRsp{media.FileContent(m, media.StoreURL(ctx, s.blobs.Media))}, nil
+}
+
+// putFile 把本地文件写入媒体存储
+func (s *Service) putFile(ctx context.Context, key, name, contentType string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return s.blobs.Media.Put(ctx, key, f, fi.Size(), contentType)
+}
+
+// fileProofs 从合并后的本地文件抽取秒传校验的区间
+func fileProofs(name string, size int64) ([]model.Proof, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return media.NewProofs(f, size)
+}
+
+// mergeChunks 合并分片到本地文件dst，返回文件头部用于类型嗅探以及整个文件的sha256
+func (s *Service) mergeChunks(up *model.Upload, dst string) ([]byte, string, error) {
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	w := io.MultiWriter(out, h)
+	var head []byte
+	for i := 0; i < up.ChunkCount; i++ {
+		data, err := os.ReadFile(s.chunkPath(up.ID, i))
+		if err != nil {
+			return nil, "", err
+		}
+		if len(head) < 512 {
+			head = append(head, data[:min(len(data), 512-len(head))]...)
+		}
+		if _, err = w.Write(data); err != nil {
+			return nil, "", err
+		}
+	}
+	return head, hex.EncodeToString(h.Sum(nil)), out.Sync()
+}
+
+// CleanStaleUploads 清理长时间没有进展的分片上传任务
+func (s *Service) CleanStaleUploads(ctx context.Context) {
+	expire := time.Duration(cfg.AppConfig().MediaInfo.UploadExpire) * time.Hour
+	list, err := s.store.Upload.Stale(ctx, time.Now().Add(-expire).UnixMilli())
+	if err != nil {
+		log.ErrorContextf(ctx, "list stale uploads fail, err:%v", err)
+		return
+	}
+	for _, up := range list {
+		s.dropUpload(ctx, up.ID)
+		log.InfoContextf(ctx, "clean stale upload, id:%d, owner:%d", up.ID, up.Owner)
+	}
+}
+
+// CleanStaleMedia 释放上传后一直没有被消息持有的媒体记录，最后一个引用释放时删除存储的内容
+func (s *Service) CleanStaleMedia(ctx context.Context) {
+	expire := time.Duration(cfg.AppConfig().MediaInfo.MediaExpire) * time.Hour
+	before := time.Now().Add(-expire).UnixMilli()
+	for {
+		list, err := s.store.Media.Stale(ctx, before, staleMediaBatch)
+		if err != nil {
+			log.ErrorContextf(ctx, "list stale media fail, err:%v", err)
+			return
+		}
+		for _, m := range list {
+			if err = s.ReleaseMedia(ctx, m.ID); err != nil {
+				return
+			}
+			log.InfoContextf(ctx, "clean stale media, id:%d, owner:%d, object:%s", m.ID, m.Owner, m.ObjectKey)
+		}
+		if len(list) < staleMediaBatch {
+			return
+		}
+	}
+}
+
+// RunCleaner 定期清理过期的分片上传任务和没有使用的媒体记录，直到ctx结束
+func (s *Service) RunCleaner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.CleanStaleUploads(ctx)
+			s.CleanStaleMedia(ctx)
+		}
+	}
+}
+
+// loadUpload 获取当前用户的上传任务
+func (s *Service) loadUpload(ctx context.Context, uid, id uint64) (*model.Upload, error) {
+	up, err := s.store.Upload.Get(ctx, id)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrUploadNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get upload fail, id:%d, err:%v", id, err)
+		return nil, ierr.ErrSystem
+	}
+	if up.Owner != uid {
+		return nil, ierr.ErrUploadNotFound
+	}
+	return up, nil
+}
+
+// dropUpload 删除上传任务及其分片
+func (s *Service) dropUpload(ctx context.Context, id uint64) {
+	if err := os.RemoveAll(s.chunkDir(id)); err != nil {
+		log.WarnContextf(ctx, "remove chunk dir fail, upload:%d, err:%v", id, err)
+	}
+	if err := s.store.Upload.Delete(ctx, id); err != nil {
+		log.WarnContextf(ctx, "delete upload fail, id:%d, err:%v", id, err)
+	}
+}
+
+func (s *Service) chunkDir(id uint64) string {
+	return resourcePath(path.Join("tmp", "upload", strconv.FormatUint(id, 10)))
+}
+
+func (s *Service) chunkPath(id uint64, index int) string {
+	return filepath.Join(s.chunkDir(id), strconv.Itoa(index))
+}
+
+// fileName 去掉客户端文件名中的目录部分
+func fileName(name string) (string, bool) {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || len(name) > maxFileNameLen {
+		return "", false
+	}
+	return name, true
+}
+
+// safeMimes 文件可以声明的类型，浏览器不会当作网页或脚本执行
+var safeMimes = map[string]bool{
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/gif":                    true,
+	"image/webp":                   true,
+	"image/bmp":                    true,
+	"audio/mpeg":                   true,
+	"audio/wave":                   true,
+	"audio/aiff":                   true,
+	"audio/midi":                   true,
+	"application/ogg":              true,
+	"video/mp4":                    true,
+	"video/webm":                   true,
+	"video/avi":                    true,
+	"application/pdf":              true,
+	"application/zip":              true,
+	"application/x-gzip":           true,
+	"application/x-rar-compressed": true,
+	"text/plain; charset=utf-8":    true,
+}
+
+// fileMime 只使用内容嗅探的类型，不在白名单中的一律按二进制流处理，不信任客户端声明和文件名
+func fileMime(head []byte) string {
+	if t := http.DetectContentType(head); safeMimes[t] {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
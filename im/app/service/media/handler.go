@@ -0,0 +1,161 @@
+package media
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/binbin6363/icuc/common/api"
+	"github.com/binbin6363/icuc/common/codec/httpx"
+	ierr "github.com/binbin6363/icuc/common/err"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册媒体相关的http接口，需要挂在jwt鉴权中间件之后
+func (s *Service) RegisterRoutes(r gin.IRoutes) {
+	r.POST(api.PathMediaImageUpload, s.handleUploadImage)
+	r.POST(api.PathMediaVoiceUpload, s.handleUploadVoice)
+	r.POST(api.PathMediaFileInit, s.handleInitUpload)
+	r.POST(api.PathMediaFileChunk, s.handleUploadChunk)
+	r.GET(api.PathMediaFileProgress, s.handleProgress)
+	r.POST(api.PathMediaFileComplete, s.handleComplete)
+	r.GET(api.PathMediaURL, s.handleURL)
+	r.POST(api.PathMediaInstant, s.handleInstant)
+	r.POST(api.PathMediaDelete, s.handleDelete)
+}
+
+// currentUid 从鉴权中间件写入的上下文中获取当前用户
+func currentUid(c *gin.Context) uint64 {
+	uid, _ := strconv.ParseUint(c.GetString(api.HeadUid), 10, 64)
+	return uid
+}
+
+// readFile 读取multipart表单中的file字段，超过limit字节返回错误
+func readFile(c *gin.Context, limit int64) ([]byte, error) {
+	fh, e := c.FormFile("file")
+	if e != nil {
+		return nil, ierr.ErrParam
+	}
+	if fh.Size > limit {
+		return nil, ierr.ErrMediaTooLarge
+	}
+	f, e := fh.Open()
+	if e != nil {
+		return nil, ierr.ErrParam
+	}
+	defer f.Close()
+	data, e := io.ReadAll(io.LimitReader(f, limit+1))
+	if e != nil {
+		return nil, ierr.ErrParam
+	}
+	if int64(len(data)) > limit {
+		return nil, ierr.ErrMediaTooLarge
+	}
+	return data, nil
+}
+
+func (s *Service) handleUploadImage(c *gin.Context) {
+	data, e := readFile(c, cfg.AppConfig().MediaInfo.MaxImageSize)
+	if e != nil {
+		httpx.SendResponse(c, nil, e)
+		return
+	}
+	rsp, e := s.UploadImage(c, currentUid(c), data)
+	httpx.SendResponse(c, rsp, e)
+}
+
+// handleUploadVoice 语音放在multipart的file字段，可选的waveform字段为json数组
+func (s *Service) handleUploadVoice(c *gin.Context) {
+	data, e := readFile(c, cfg.AppConfig().MediaInfo.MaxVoiceSize)
+	if e != nil {
+		httpx.SendResponse(c, nil, e)
+		return
+	}
+	var waveform []int
+	if w := c.PostForm("waveform"); w != "" {
+		if json.Unmarshal([]byte(w), &waveform) != nil {
+			httpx.SendResponse(c, nil, ierr.ErrParam)
+			return
+		}
+	}
+	rsp, e := s.UploadVoice(c, currentUid(c), data, waveform)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleInitUpload(c *gin.Context) {
+	req := &InitUploadReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.InitUpload(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+// handleUploadChunk 分片内容放在请求体中，其余参数放在query中
+func (s *Service) handleUploadChunk(c *gin.Context) {
+	req := &UploadChunkReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	limit := cfg.AppConfig().MediaInfo.ChunkSize
+	data, e := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if e != nil || int64(len(data)) > limit {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.UploadChunk(c, currentUid(c), req, data)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleProgress(c *gin.Context) {
+	req := &ProgressReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Progress(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleComplete(c *gin.Context) {
+	req := &CompleteReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Complete(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleURL(c *gin.Context) {
+	req := &URLReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.URL(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleInstant(c *gin.Context) {
+	req := &InstantReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Instant(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleDelete(c *gin.Context) {
+	req := &DeleteReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Delete(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
@@ -0,0 +1,107 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// UploadImageRsp 图片上传结果
+type UploadImageRsp struct {
+	*model.ImageContent
+}
+
+// UploadImage 校验并处理图片，原图、缩略图和预览图保存到媒体存储，相同内容只处理和保存一次
+func (s *Service) UploadImage(ctx context.Context, uid uint64, data []byte) (*UploadImageRsp, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key := model.ObjectKey(model.MediaImage, hash, int64(len(data)))
+	obj, err := s.refs.Acquire(ctx, key)
+	if err != nil {
+		log.ErrorContextf(ctx, "acquire object fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+	if obj == nil {
+		if obj, err = s.storeImage(ctx, key, data); err != nil {
+			return nil, err
+		}
+	}
+	m, err := s.refs.NewMedia(ctx, obj, uid, "", hash)
+	if err != nil {
+		log.ErrorContextf(ctx, "save media fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "upload image done, id:%d, uid:%d, size:%d, %dx%d, object:%s", m.ID, uid, m.Size, m.Width, m.Height, key)
+	return &UploadImageRsp{media.ImageContent(m, media.StoreURL(ctx, s.blobs.Media))}, nil
+}
+
+// storeImage 处理图片并保存为新的存储对象
+func (s *Service) storeImage(ctx context.Context, key string, data []byte) (*model.Object, error) {
+	info := cfg.AppConfig().MediaInfo
+	res, err := media.ProcessImage(data, &media.ImageOption{
+		MaxSize:     info.MaxImageSize,
+		MaxPixels:   info.MaxImagePixels,
+		MaxFrames:   info.MaxGIFFrames,
+		ThumbEdge:   info.ThumbEdge,
+		PreviewEdge: info.PreviewEdge,
+	})
+	switch err {
+	case nil:
+	case media.ErrUnsupported:
+		return nil, ierr.ErrMediaType
+	case media.ErrTooLarge, media.ErrTooManyPix:
+		return nil, ierr.ErrMediaTooLarge
+	default:
+		log.ErrorContextf(ctx, "process image fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+
+	proofs, err := media.NewProofs(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		log.ErrorContextf(ctx, "new proofs fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+	id, now := s.ids.Next(), time.Now()
+	obj := &model.Object{
+		Key:         key,
+		Kind:        model.MediaImage,
+		Mime:        res.Origin.Mime,
+		Size:        int64(len(res.Origin.Data)),
+		Width:       res.Origin.Width,
+		Height:      res.Origin.Height,
+		Path:        media.RelPath("image", id, now, "", res.Origin.Ext),
+		ThumbPath:   media.RelPath("image", id, now, "_t", res.Thumb.Ext),
+		PreviewPath: media.RelPath("image", id, now, "_p", res.Preview.Ext),
+		Proofs:      proofs,
+	}
+	files := map[string]*media.Rendition{
+		obj.Path:        res.Origin,
+		obj.ThumbPath:   res.Thumb,
+		obj.PreviewPath: res.Preview,
+	}
+	for path, r := range files {
+		if err = s.blobs.Media.Put(ctx, path, bytes.NewReader(r.Data), int64(len(r.Data)), r.Mime); err != nil {
+			log.ErrorContextf(ctx, "put image fail, key:%s, err:%v", path, err)
+			return nil, ierr.ErrSystem
+		}
+	}
+	if obj, err = s.refs.Create(ctx, obj); err != nil {
+		log.ErrorContextf(ctx, "create object fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+	return obj, nil
+}
+
+// resourcePath 相对路径对应的本地绝对路径，用于分片等临时文件
+func resourcePath(rel string) string {
+	return filepath.Join(cfg.AppConfig().ServerInfo.ResourceRoot, filepath.FromSlash(rel))
+}
@@ -0,0 +1,135 @@
+package media
+
+import (
+	"context"
+	"strings"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// InstantProof 持有证明，服务端已有相同内容时先返回一个区间，客户端带上该区间内容的sha256再次请求才能秒传
+type InstantProof struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Proof  string `json:"proof"` // 区间内容的sha256，十六进制
+}
+
+// InstantReq 秒传，客户端上传前先用内容的sha256和大小查询服务端是否已有相同内容
+type InstantReq struct {
+	Kind   model.MediaKind `json:"kind"`
+	SHA256 string          `json:"sha256"`
+	Size   int64           `json:"size"`
+	Name   string          `json:"name"` // 文件的原始文件名，图片和语音可不填
+	InstantProof
+}
+
+// InstantRsp 秒传结果，未命中也没有要求证明时客户端走正常的上传流程
+type InstantRsp struct {
+	Hit       bool         `json:"hit"`
+	Challenge *model.Proof `json:"challenge,omitempty"` // 需要证明持有的区间，只有offset和length
+	Content   interface{}  `json:"content,omitempty"`   // 命中时为对应类型的消息内容
+}
+
+// Instant 命中已有的存储对象且客户端证明持有内容时直接生成媒体记录，不需要再上传内容
+func (s *Service) Instant(ctx context.Context, uid uint64, req *InstantReq) (*InstantRsp, error) {
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if req.Size <= 0 || !sha256Regexp.MatchString(req.SHA256) {
+		return nil, ierr.ErrParam
+	}
+	name := ""
+	switch req.Kind {
+	case model.MediaImage, model.MediaVoice:
+	case model.MediaFile:
+		var ok bool
+		if name, ok = fileName(req.Name); !ok {
+			return nil, ierr.ErrParam
+		}
+	default:
+		return nil, ierr.ErrMediaType
+	}
+	m, challenge, err := s.instantMedia(ctx, uid, req.Kind, name, req.SHA256, req.Size, &req.InstantProof)
+	if err != nil || m == nil {
+		return &InstantRsp{Challenge: challenge}, err
+	}
+	return &InstantRsp{Hit: true, Content: media.Content(m, media.StoreURL(ctx, s.blobs.Media))}, nil
+}
+
+// instantFile 按文件内容秒传，未命中时返回nil
+func (s *Service) instantFile(ctx context.Context, uid uint64, name, sha256 string, size int64, proof *InstantProof) (*model.Media, *model.Proof, error) {
+	return s.instantMedia(ctx, uid, model.MediaFile, name, sha256, size, proof)
+}
+
+// instantMedia 对象存在且没有带证明时返回要证明的区间，证明不对时视为未命中
+func (s *Service) instantMedia(ctx context.Context, uid uint64, kind model.MediaKind, name, sha256 string, size int64,
+	proof *InstantProof) (*model.Media, *model.Proof, error) {
+	key := model.ObjectKey(kind, sha256, size)
+	obj, err := s.refs.Get(ctx, key)
+	if err != nil {
+		log.ErrorContextf(ctx, "get object fail, key:%s, err:%v", key, err)
+		return nil, nil, ierr.ErrSystem
+	}
+	if obj == nil {
+		return nil, nil, nil
+	}
+	if proof.Proof == "" {
+		return nil, media.Challenge(obj), nil
+	}
+	if !media.CheckProof(obj, proof.Offset, proof.Length, strings.ToLower(proof.Proof)) {
+		log.WarnContextf(ctx, "instant upload proof mismatch, uid:%d, object:%s", uid, key)
+		return nil, nil, nil
+	}
+	if obj, err = s.refs.Acquire(ctx, key); err != nil {
+		log.ErrorContextf(ctx, "acquire object fail, key:%s, err:%v", key, err)
+		return nil, nil, ierr.ErrSystem
+	}
+	if obj == nil {
+		return nil, nil, nil
+	}
+	m, err := s.refs.NewMedia(ctx, obj, uid, name, sha256)
+	if err != nil {
+		log.ErrorContextf(ctx, "save media fail, uid:%d, key:%s, err:%v", uid, key, err)
+		return nil, nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "instant upload hit, media:%d, uid:%d, object:%s", m.ID, uid, key)
+	return m, nil, nil
+}
+
+// DeleteReq 删除媒体记录
+type DeleteReq struct {
+	MediaID uint64 `json:"media_id,string"`
+}
+
+// DeleteRsp .
+type DeleteRsp struct{}
+
+// Delete 删除自己上传的媒体记录，其他记录仍在引用的内容不会被删除
+func (s *Service) Delete(ctx context.Context, uid uint64, req *DeleteReq) (*DeleteRsp, error) {
+	m, err := s.store.Media.Get(ctx, req.MediaID)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrMediaNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get media fail, id:%d, err:%v", req.MediaID, err)
+		return nil, ierr.ErrSystem
+	}
+	if m.Owner != uid {
+		return nil, ierr.ErrMediaNotFound
+	}
+	if err = s.ReleaseMedia(ctx, m.ID); err != nil {
+		return nil, ierr.ErrSystem
+	}
+	return &DeleteRsp{}, nil
+}
+
+// ReleaseMedia 删除媒体记录并释放存储对象，最后一个引用释放时删除存储的内容
+func (s *Service) ReleaseMedia(ctx context.Context, id uint64) error {
+	if err := s.refs.Release(ctx, id); err != nil {
+		log.ErrorContextf(ctx, "release media fail, id:%d, err:%v", id, err)
+		return err
+	}
+	return nil
+}
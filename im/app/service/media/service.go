@@ -0,0 +1,78 @@
+package media
+
+import (
+	"context"
+
+	"github.com/binbin6363/icuc/common/idgen"
+	"github.com/binbin6363/icuc/im/app/blob"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// Viewer 校验用户能否查看引用了媒体的消息，由消息服务实现
+type Viewer interface {
+	ViewMedia(ctx context.Context, uid, msgID, mediaID uint64) error
+}
+
+// Service 媒体文件上传服务
+type Service struct {
+	store  *store.Store
+	blobs  *blob.Buckets
+	ids    *idgen.Snowflake
+	refs   *media.Refs
+	viewer Viewer
+}
+
+// Option 创建Service时的可选项
+type Option func(*Service)
+
+// WithStore 指定存储，不指定时使用内存存储
+func WithStore(st *store.Store) Option {
+	return func(s *Service) {
+		s.store = st
+	}
+}
+
+// WithBlobs 指定对象存储，不指定时按配置创建
+func WithBlobs(b *blob.Buckets) Option {
+	return func(s *Service) {
+		s.blobs = b
+	}
+}
+
+// WithViewer 指定消息的查看权限校验，不指定时只有上传者可以刷新媒体地址
+func WithViewer(v Viewer) Option {
+	return func(s *Service) {
+		s.viewer = v
+	}
+}
+
+// WithIDs 指定媒体记录的id生成器，和消息服务共用存储时要传入同一个，否则同一毫秒可能生成相同的媒体id
+func WithIDs(ids *idgen.Snowflake) Option {
+	return func(s *Service) {
+		s.ids = ids
+	}
+}
+
+func New(opts ...Option) *Service {
+	s := &Service{}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.ids == nil {
+		if info := cfg.AppConfig().ServerInfo; info != nil {
+			s.ids = idgen.NewSnowflake(info.DataCenterId, info.WorkerId)
+		} else {
+			s.ids = idgen.NewSnowflake(0, 0)
+		}
+	}
+	if s.store == nil {
+		s.store = store.NewMemStore()
+	}
+	if s.blobs == nil {
+		s.blobs = blob.NewBuckets(cfg.AppConfig().ServerInfo, cfg.AppConfig().CosInfo)
+	}
+	s.refs = media.NewRefs(s.store, s.blobs.Media, s.ids)
+	return s
+}
@@ -0,0 +1,38 @@
+package media
+
+import (
+	"context"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// URLReq 刷新媒体访问地址
+type URLReq struct {
+	MediaID uint64 `form:"media_id"`
+	MsgID   uint64 `form:"msg_id"` // 引用该媒体的消息，不是上传者时必填
+}
+
+// URL 重新生成媒体的访问地址，开启签名时消息里的地址会过期，客户端据此刷新
+// 上传者可以直接刷新，其他用户需要能查看引用了该媒体的消息
+func (s *Service) URL(ctx context.Context, uid uint64, req *URLReq) (interface{}, error) {
+	m, err := s.store.Media.Get(ctx, req.MediaID)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrMediaNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get media fail, id:%d, err:%v", req.MediaID, err)
+		return nil, ierr.ErrSystem
+	}
+	if m.Owner != uid {
+		if s.viewer == nil || req.MsgID == 0 {
+			return nil, ierr.ErrMediaNotFound
+		}
+		if err = s.viewer.ViewMedia(ctx, uid, req.MsgID, m.ID); err != nil {
+			return nil, err
+		}
+	}
+	return media.Content(m, media.StoreURL(ctx, s.blobs.Media)), nil
+}
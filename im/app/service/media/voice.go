@@ -0,0 +1,109 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// UploadVoiceRsp 语音上传结果
+type UploadVoiceRsp struct {
+	*model.VoiceContent
+}
+
+// UploadVoice 校验语音格式和时长后保存，服务端无法解码的格式使用客户端上报的波形
+func (s *Service) UploadVoice(ctx context.Context, uid uint64, data []byte, waveform []int) (*UploadVoiceRsp, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key := model.ObjectKey(model.MediaVoice, hash, int64(len(data)))
+	obj, err := s.refs.Acquire(ctx, key)
+	if err != nil {
+		log.ErrorContextf(ctx, "acquire object fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+	if obj == nil {
+		if obj, err = s.storeVoice(ctx, key, data, waveform); err != nil {
+			return nil, err
+		}
+	}
+	m, err := s.refs.NewMedia(ctx, obj, uid, "", hash)
+	if err != nil {
+		log.ErrorContextf(ctx, "save media fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "upload voice done, id:%d, uid:%d, size:%d, duration:%d, object:%s", m.ID, uid, m.Size, m.Duration, key)
+	return &UploadVoiceRsp{media.VoiceContent(m, media.StoreURL(ctx, s.blobs.Media))}, nil
+}
+
+// storeVoice 解析语音并保存为新的存储对象
+func (s *Service) storeVoice(ctx context.Context, key string, data []byte, waveform []int) (*model.Object, error) {
+	info := cfg.AppConfig().MediaInfo
+	res, err := media.ProcessVoice(data, &media.VoiceOption{
+		MaxSize:        info.MaxVoiceSize,
+		MaxDuration:    int64(info.MaxVoiceTime) * 1000,
+		WaveformPoints: info.WaveformPoints,
+	})
+	switch err {
+	case nil:
+	case media.ErrUnsupported, media.ErrBadFormat:
+		return nil, ierr.ErrMediaType
+	case media.ErrTooLarge:
+		return nil, ierr.ErrMediaTooLarge
+	case media.ErrTooLong:
+		return nil, ierr.ErrVoiceTooLong
+	default:
+		log.ErrorContextf(ctx, "process voice fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+	if res.Waveform == nil {
+		if res.Waveform, err = checkWaveform(waveform, info.WaveformPoints); err != nil {
+			return nil, err
+		}
+	}
+
+	proofs, err := media.NewProofs(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		log.ErrorContextf(ctx, "new proofs fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+	obj := &model.Object{
+		Key:      key,
+		Kind:     model.MediaVoice,
+		Mime:     res.Mime,
+		Size:     int64(len(data)),
+		Duration: res.Duration,
+		Waveform: res.Waveform,
+		Path:     media.RelPath("voice", s.ids.Next(), time.Now(), "", res.Ext),
+		Proofs:   proofs,
+	}
+	if err = s.blobs.Media.Put(ctx, obj.Path, bytes.NewReader(data), obj.Size, obj.Mime); err != nil {
+		log.ErrorContextf(ctx, "put voice fail, key:%s, err:%v", obj.Path, err)
+		return nil, ierr.ErrSystem
+	}
+	if obj, err = s.refs.Create(ctx, obj); err != nil {
+		log.ErrorContextf(ctx, "create object fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+	return obj, nil
+}
+
+// checkWaveform 校验客户端上报的波形
+func checkWaveform(waveform []int, points int) ([]int, error) {
+	if len(waveform) > points {
+		return nil, ierr.ErrParam
+	}
+	for _, v := range waveform {
+		if v < 0 || v > 100 {
+			return nil, ierr.ErrParam
+		}
+	}
+	return waveform, nil
+}
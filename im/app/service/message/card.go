@@ -0,0 +1,211 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+	"github.com/binbin6363/icuc/im/app/webhook"
+)
+
+// buttonsSchema 带按钮的类型共用的按钮定义
+const buttonsSchema = `{
+	"type": "array", "maxItems": 6,
+	"items": {
+		"type": "object", "required": ["id", "text", "kind"], "additionalProperties": false,
+		"properties": {
+			"id": {"type": "string", "minLength": 1, "maxLength": 64},
+			"text": {"type": "string", "minLength": 1, "maxLength": 20},
+			"kind": {"enum": ["callback", "url"]},
+			"value": {"type": "string", "maxLength": 1024}
+		}
+	}
+}`
+
+const cardSchema = `{
+	"type": "object", "required": ["title"], "additionalProperties": false,
+	"properties": {
+		"title": {"type": "string", "minLength": 1, "maxLength": 100},
+		"summary": {"type": "string", "maxLength": 500},
+		"fields": {
+			"type": "array", "maxItems": 20,
+			"items": {
+				"type": "object", "required": ["label", "value"], "additionalProperties": false,
+				"properties": {
+					"label": {"type": "string", "maxLength": 50},
+					"value": {"type": "string", "maxLength": 500}
+				}
+			}
+		},
+		"images": {"type": "array", "maxItems": 9, "items": {"type": "string", "pattern": "^https?://", "maxLength": 1024}},
+		"buttons": %s
+	}
+}`
+
+const orderSchema = `{
+	"type": "object", "required": ["order_id", "title", "amount", "currency"], "additionalProperties": false,
+	"properties": {
+		"order_id": {"type": "string", "minLength": 1, "maxLength": 64},
+		"title": {"type": "string", "minLength": 1, "maxLength": 100},
+		"amount": {"type": "number", "minimum": 0},
+		"currency": {"type": "string", "pattern": "^[A-Z]{3}$"},
+		"status": {"type": "string", "maxLength": 20},
+		"image_url": {"type": "string", "pattern": "^https?://", "maxLength": 1024},
+		"buttons": %s
+	}
+}`
+
+const productSchema = `{
+	"type": "object", "required": ["product_id", "title", "price", "currency"], "additionalProperties": false,
+	"properties": {
+		"product_id": {"type": "string", "minLength": 1, "maxLength": 64},
+		"title": {"type": "string", "minLength": 1, "maxLength": 100},
+		"price": {"type": "number", "minimum": 0},
+		"currency": {"type": "string", "pattern": "^[A-Z]{3}$"},
+		"image_url": {"type": "string", "pattern": "^https?://", "maxLength": 1024},
+		"url": {"type": "string", "pattern": "^https?://", "maxLength": 1024},
+		"buttons": %s
+	}
+}`
+
+// builtinNames 内置类型，名称保留不能被注册
+var builtinNames = []string{"card", "order", "product"}
+
+var builtinTypes = map[string]*model.CustomType{
+	"card":    builtinType("card", cardSchema, "[卡片]"),
+	"order":   builtinType("order", orderSchema, "[订单]"),
+	"product": builtinType("product", productSchema, "[商品]"),
+}
+
+func builtinType(name, tpl, fallback string) *model.CustomType {
+	return &model.CustomType{
+		Name:     name,
+		Schema:   json.RawMessage(fmt.Sprintf(tpl, buttonsSchema)),
+		Fallback: fallback,
+		Version:  1,
+	}
+}
+
+// ErrNoCallback 卡片所属方没有配置回调
+var ErrNoCallback = errors.New("card has no callback")
+
+// ActionRouter 把卡片按钮回调路由到卡片所属的bot或webhook
+type ActionRouter interface {
+	Route(ctx context.Context, msg *model.Message, ct *model.CustomType, action *model.CardAction) (*model.CardActionResult, error)
+}
+
+// WebhookRouter 回调到类型注册时填写的地址
+type WebhookRouter struct {
+	client *webhook.Client
+}
+
+// NewWebhookRouter timeout单位毫秒
+func NewWebhookRouter(timeout int) *WebhookRouter {
+	return &WebhookRouter{client: webhook.NewClient(timeout)}
+}
+
+// Route .
+func (r *WebhookRouter) Route(ctx context.Context, msg *model.Message, ct *model.CustomType, action *model.CardAction) (*model.CardActionResult, error) {
+	if ct.Callback == "" {
+		return nil, ErrNoCallback
+	}
+	res := &model.CardActionResult{}
+	if err := r.client.Post(ctx, ct.Callback, ct.Secret, action, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CardActionReq 点击卡片按钮
+type CardActionReq struct {
+	MsgID    uint64 `json:"msg_id,string"`
+	ActionID string `json:"action_id"`
+}
+
+// CardAction 点击回调按钮，按钮的值取自服务端保存的消息，不信任客户端
+func (s *Service) CardAction(ctx context.Context, uid uint64, req *CardActionReq) (*model.CardActionResult, error) {
+	msg, err := s.loadMsg(ctx, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkView(ctx, uid, msg); err != nil {
+		return nil, err
+	}
+	if msg.Recalled() {
+		return nil, ierr.ErrMsgRecalled
+	}
+	if msg.Type != model.MsgCustom {
+		return nil, ierr.ErrCardAction
+	}
+	c := &model.CustomContent{}
+	if err = json.Unmarshal([]byte(msg.Content), c); err != nil {
+		log.ErrorContextf(ctx, "bad custom content, msg:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	buttons, err := cardButtons(c.Payload)
+	if err != nil {
+		return nil, err
+	}
+	var button *model.CardButton
+	for _, b := range buttons {
+		if b.ID == req.ActionID && b.Kind == model.ButtonCallback {
+			button = b
+			break
+		}
+	}
+	if button == nil {
+		return nil, ierr.ErrCardAction
+	}
+	ct, err := s.customType(ctx, c.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkCardSender(ctx, ct, msg.Sender); err != nil {
+		return nil, err
+	}
+
+	action := &model.CardAction{
+		Type:     c.Type,
+		MsgID:    msg.ID,
+		ConvID:   msg.ConvID,
+		Sender:   msg.Sender,
+		Operator: uid,
+		ActionID: button.ID,
+		Value:    button.Value,
+		Time:     time.Now().UnixMilli(),
+	}
+	res, err := s.router.Route(ctx, msg, ct, action)
+	if err == ErrNoCallback {
+		return nil, ierr.ErrCardAction
+	}
+	if err != nil {
+		log.WarnContextf(ctx, "card callback fail, msg:%d, type:%s, action:%s, err:%v", msg.ID, c.Type, button.ID, err)
+		return nil, ierr.ErrCardCallback
+	}
+	return res, nil
+}
+
+// checkCardSender 注册类型的回调只接受注册者或其机器人发出的卡片，其他人发的同类型卡片不能触发注册者的回调
+func (s *Service) checkCardSender(ctx context.Context, ct *model.CustomType, sender uint64) error {
+	if ct.Owner == 0 || ct.Owner == sender {
+		return nil
+	}
+	b, err := s.store.Bot.Get(ctx, sender)
+	if err == store.ErrNotFound {
+		return ierr.ErrCardAction
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get bot fail, uid:%d, err:%v", sender, err)
+		return ierr.ErrSystem
+	}
+	if b.Owner != ct.Owner {
+		return ierr.ErrCardAction
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package message
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const maxCipherSize = 256 << 10 // 加密消息全部信封的最大字节数
+
+// tenant 用户所属租户的配置，没有配置时返回nil
+func (s *Service) tenant(ctx context.Context, uid uint64) *cfg.Tenant {
+	user, err := s.store.User.Get(ctx, uid)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.WarnContextf(ctx, "get user fail, uid:%d, err:%v", uid, err)
+		}
+		return nil
+	}
+	return cfg.AppConfig().Tenant(user.TenantID)
+}
+
+// checkE2E 发送方或接收方的租户要求端到端加密时，单聊只允许发送加密消息
+func (s *Service) checkE2E(ctx context.Context, msg *model.Message) error {
+	if msg.Type == model.MsgCipher {
+		return nil
+	}
+	for _, uid := range []uint64{msg.Sender, msg.Receiver} {
+		if t := s.tenant(ctx, uid); t != nil && t.E2ERequired {
+			return ierr.ErrE2ERequired
+		}
+	}
+	return nil
+}
+
+// prepareCipher 校验加密消息的信封，服务端不解密，只要求信封与密钥目录中双方的设备一一对应：
+// 接收者的全部设备，以及发送者除当前设备以外的其他设备，不一致时客户端需要重新获取公钥后再发
+func (s *Service) prepareCipher(ctx context.Context, msg *model.Message) error {
+	if msg.ConvType != model.ConvSingle || len(msg.Content) > maxCipherSize {
+		return ierr.ErrParam
+	}
+	c := &model.CipherContent{}
+	if err := json.Unmarshal([]byte(msg.Content), c); err != nil || c.SenderDevice == "" || len(c.Envelopes) == 0 {
+		return ierr.ErrParam
+	}
+	got := make(map[string]bool, len(c.Envelopes))
+	for _, e := range c.Envelopes {
+		if e == nil || e.Uid != msg.Sender && e.Uid != msg.Receiver {
+			return ierr.ErrParam
+		}
+		if b, err := base64.StdEncoding.DecodeString(e.Body); err != nil || len(b) == 0 {
+			return ierr.ErrParam
+		}
+		k := deviceName(e.Uid, e.DeviceID)
+		if got[k] {
+			return ierr.ErrParam
+		}
+		got[k] = true
+	}
+
+	want, err := s.cipherDevices(ctx, msg.Sender, msg.Receiver, c.SenderDevice)
+	if err != nil {
+		return err
+	}
+	var missing, stale []string
+	for k := range want {
+		if !got[k] {
+			missing = append(missing, k)
+		}
+	}
+	for k := range got {
+		if !want[k] {
+			stale = append(stale, k)
+		}
+	}
+	if len(missing) > 0 || len(stale) > 0 {
+		sort.Strings(missing)
+		sort.Strings(stale)
+		return ierr.New(ierr.CodeDeviceMismatch, fmt.Sprintf("%s: missing[%s] stale[%s]",
+			ierr.ErrDeviceMismatch.Msg, strings.Join(missing, ","), strings.Join(stale, ",")))
+	}
+	return setContent(msg, c)
+}
+
+// cipherDevices 加密消息需要覆盖的设备，发送设备必须已发布密钥，接收者没有任何设备时无法加密
+func (s *Service) cipherDevices(ctx context.Context, sender, receiver uint64, senderDevice string) (map[string]bool, error) {
+	want := make(map[string]bool)
+	self := false
+	for _, uid := range []uint64{receiver, sender} {
+		devices, err := s.store.Key.Devices(ctx, uid)
+		if err != nil {
+			log.ErrorContextf(ctx, "list devices fail, uid:%d, err:%v", uid, err)
+			return nil, ierr.ErrSystem
+		}
+		if uid == receiver && len(devices) == 0 {
+			return nil, ierr.ErrKeyNotFound
+		}
+		for _, d := range devices {
+			if uid == sender && d.DeviceID == senderDevice {
+				self = true
+				continue
+			}
+			want[deviceName(uid, d.DeviceID)] = true
+		}
+	}
+	if !self {
+		return nil, ierr.ErrKeyNotFound
+	}
+	return want, nil
+}
+
+func deviceName(uid uint64, deviceID string) string {
+	return fmt.Sprintf("%d/%s", uid, deviceID)
+}
@@ -0,0 +1,133 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// prepareContent 按消息类型校验并生成消息内容，媒体消息的内容由服务端根据上传记录生成
+func (s *Service) prepareContent(ctx context.Context, uid uint64, msg *model.Message, req *SendReq) error {
+	if msg.Type == 0 {
+		msg.Type = model.MsgText
+	}
+	switch msg.Type {
+	case model.MsgText:
+		if msg.Content == "" {
+			return ierr.ErrParam
+		}
+		return nil
+	case model.MsgImage:
+		m, err := s.loadMedia(ctx, uid, req.MediaID, model.MediaImage)
+		if err != nil {
+			return err
+		}
+		msg.MediaID = m.ID
+		return setContent(msg, media.ImageContent(m, media.StoreURL(ctx, s.blobs.Media)))
+	case model.MsgFile:
+		m, err := s.loadMedia(ctx, uid, req.MediaID, model.MediaFile)
+		if err != nil {
+			return err
+		}
+		msg.MediaID = m.ID
+		return setContent(msg, media.FileContent(m, media.StoreURL(ctx, s.blobs.Media)))
+	case model.MsgVoice:
+		m, err := s.loadMedia(ctx, uid, req.MediaID, model.MediaVoice)
+		if err != nil {
+			return err
+		}
+		msg.MediaID = m.ID
+		return setContent(msg, media.VoiceContent(m, media.StoreURL(ctx, s.blobs.Media)))
+	case model.MsgCustom:
+		return s.prepareCustom(ctx, msg)
+	case model.MsgRich:
+		return s.prepareRich(msg)
+	case model.MsgCipher:
+		return s.prepareCipher(ctx, msg)
+	}
+	return ierr.ErrParam
+}
+
+// loadMedia 获取当前用户上传的指定类型媒体记录
+func (s *Service) loadMedia(ctx context.Context, uid, mediaID uint64, kind model.MediaKind) (*model.Media, error) {
+	if mediaID == 0 {
+		return nil, ierr.ErrParam
+	}
+	m, err := s.store.Media.Get(ctx, mediaID)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrMediaNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get media fail, id:%d, err:%v", mediaID, err)
+		return nil, ierr.ErrSystem
+	}
+	if m.Kind != kind || m.Owner != uid {
+		return nil, ierr.ErrMediaNotFound
+	}
+	return m, nil
+}
+
+// attachMedia 为消息复制一条独立的媒体记录，之后删除这条消息的附件只释放它自己的引用
+func (s *Service) attachMedia(ctx context.Context, msg *model.Message) error {
+	if len(msg.Media) > 0 {
+		return s.attachMerged(ctx, msg)
+	}
+	if msg.MediaID == 0 {
+		return nil
+	}
+	c, err := s.cloneMedia(ctx, msg.MediaID, msg.Sender)
+	if err != nil {
+		return err
+	}
+	msg.MediaID = c.ID
+	return setContent(msg, media.Content(c, media.StoreURL(ctx, s.blobs.Media)))
+}
+
+// cloneMedia 复制一条引用同一对象的媒体记录，归属到owner
+func (s *Service) cloneMedia(ctx context.Context, mediaID, owner uint64) (*model.Media, error) {
+	m, err := s.store.Media.Get(ctx, mediaID)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrMediaNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get media fail, id:%d, err:%v", mediaID, err)
+		return nil, ierr.ErrSystem
+	}
+	c, err := s.refs.Clone(ctx, m, owner)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrMediaNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "clone media fail, id:%d, err:%v", m.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	return c, nil
+}
+
+// releaseMedia 释放消息持有的媒体记录
+func (s *Service) releaseMedia(ctx context.Context, msg *model.Message) {
+	ids := msg.Media
+	if msg.MediaID != 0 {
+		ids = append([]uint64{msg.MediaID}, ids...)
+	}
+	for _, id := range ids {
+		if err := s.refs.Release(ctx, id); err != nil {
+			log.WarnContextf(ctx, "release media fail, msg:%d, media:%d, err:%v", msg.ID, id, err)
+		}
+	}
+}
+
+// setContent 把结构化内容序列化到消息中
+func setContent(msg *model.Message, content interface{}) error {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return ierr.ErrSystem
+	}
+	msg.Content = string(b)
+	return nil
+}
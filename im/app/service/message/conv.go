@@ -0,0 +1,69 @@
+package message
+
+import (
+	"context"
+
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// ConvFeed 最近会话列表，消息落地、修改和已读时同步更新
+type ConvFeed interface {
+	// Deliver 新消息更新各接收者的会话，返回其中设置了免打扰的用户
+	Deliver(ctx context.Context, msg *model.Message, uids []uint64) map[uint64]bool
+	// Refresh 消息编辑或撤回后更新会话摘要
+	Refresh(ctx context.Context, msg *model.Message, uids []uint64)
+	// Unmention 撤回@了用户的消息后删除@标记，按剩余的标记更新会话提醒
+	Unmention(ctx context.Context, msg *model.Message, uids []uint64)
+	// Read 用户已读到seq
+	Read(ctx context.Context, uid uint64, convID string, seq uint64)
+}
+
+// deliver 新消息扩散给接收者，群聊读扩散时不写收件箱，只在线推送
+func (s *Service) deliver(ctx context.Context, msg *model.Message, uids []uint64, muted map[uint64]bool) {
+	ev := &model.Event{
+		Type:     model.EventNewMessage,
+		ConvID:   msg.ConvID,
+		MsgID:    msg.ID,
+		Operator: msg.Sender,
+		Time:     msg.SendTime,
+		Message:  msg,
+	}
+	if msg.ConvType != model.ConvGroup || !readDiffusion() {
+		s.appendInbox(ctx, uids, ev)
+	}
+	if msg.ConvType == model.ConvGroup && !readDiffusion() {
+		for _, uid := range uids {
+			if err := s.store.Timeline.Append(ctx, uid, msg.ConvID, msg.Seq, msg.ID); err != nil {
+				log.ErrorContextf(ctx, "append timeline fail, uid:%d, msg:%d, err:%v", uid, msg.ID, err)
+			}
+		}
+	}
+	s.pushMuted(ctx, uids, muted, ev)
+}
+
+// pushMuted 在线推送新消息，免打扰的用户改为静默推送，@提醒另外以高优先级推送
+func (s *Service) pushMuted(ctx context.Context, uids []uint64, muted map[uint64]bool, ev *model.Event) {
+	loud := make([]uint64, 0, len(uids))
+	quiet := make([]uint64, 0, len(muted))
+	for _, uid := range uids {
+		if muted[uid] {
+			quiet = append(quiet, uid)
+		} else {
+			loud = append(loud, uid)
+		}
+	}
+	silent := *ev
+	silent.Priority = model.PrioritySilent
+	for _, p := range []struct {
+		uids []uint64
+		ev   *model.Event
+	}{{loud, ev}, {quiet, &silent}} {
+		if len(p.uids) == 0 {
+			continue
+		}
+		if err := s.pusher.Push(ctx, p.uids, p.ev); err != nil {
+			log.WarnContextf(ctx, "push event fail, type:%d, conv:%s, err:%v", ev.Type, ev.ConvID, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/schema"
+	"github.com/binbin6363/icuc/im/app/store"
+	"github.com/binbin6363/icuc/im/app/webhook"
+)
+
+const (
+	maxFallbackLen = 200      // 兼容文本最多的字符数
+	maxPayloadSize = 32 << 10 // 自定义消息负载最大字节数
+	maxSchemaSize  = 64 << 10 // 注册schema最大字节数
+)
+
+var typeNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_.-]{1,63}$`)
+
+// compiledType 编译后的类型，按版本缓存
+type compiledType struct {
+	version int
+	schema  *schema.Schema
+}
+
+// schemaCache 注册类型的schema编译缓存，类型更新后版本变化自动重新编译
+type schemaCache struct {
+	mu    sync.Mutex
+	types map[string]*compiledType
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{types: make(map[string]*compiledType)}
+}
+
+func (c *schemaCache) get(ct *model.CustomType) (*schema.Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.types[ct.Name]; ok && t.version == ct.Version {
+		return t.schema, nil
+	}
+	sc, err := schema.Compile(ct.Schema)
+	if err != nil {
+		return nil, err
+	}
+	c.types[ct.Name] = &compiledType{version: ct.Version, schema: sc}
+	return sc, nil
+}
+
+// customType 查找类型，内置类型优先
+func (s *Service) customType(ctx context.Context, name string) (*model.CustomType, error) {
+	if ct, ok := builtinTypes[name]; ok {
+		return ct, nil
+	}
+	ct, err := s.store.Custom.Get(ctx, name)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrCustomType
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get custom type fail, name:%s, err:%v", name, err)
+		return nil, ierr.ErrSystem
+	}
+	return ct, nil
+}
+
+// prepareCustom 校验自定义消息的负载并补齐兼容文本，内容按服务端格式重新序列化
+func (s *Service) prepareCustom(ctx context.Context, msg *model.Message) error {
+	if len(msg.Content) > maxPayloadSize {
+		return ierr.ErrParam
+	}
+	c := &model.CustomContent{}
+	if err := json.Unmarshal([]byte(msg.Content), c); err != nil || len(c.Payload) == 0 {
+		return ierr.ErrParam
+	}
+	ct, err := s.customType(ctx, c.Type)
+	if err != nil {
+		return err
+	}
+	sc, err := s.schemas.get(ct)
+	if err != nil {
+		log.ErrorContextf(ctx, "compile custom schema fail, name:%s, version:%d, err:%v", ct.Name, ct.Version, err)
+		return ierr.ErrSystem
+	}
+	if err = sc.ValidateJSON(c.Payload); err != nil {
+		return ierr.New(ierr.CodeCustomPayload, ierr.ErrCustomPayload.Msg+": "+err.Error())
+	}
+	buttons, err := cardButtons(c.Payload)
+	if err != nil {
+		return err
+	}
+	if err = checkButtons(buttons); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(c.Fallback) > maxFallbackLen {
+		return ierr.ErrParam
+	}
+	if c.Fallback == "" {
+		c.Fallback = defaultFallback(ct, c.Payload)
+	}
+	c.Version = ct.Version
+	return setContent(msg, c)
+}
+
+// defaultFallback 类型的兼容文本，负载带title时附上标题
+func defaultFallback(ct *model.CustomType, payload json.RawMessage) string {
+	text := ct.Fallback
+	if text == "" {
+		text = "[消息]"
+	}
+	var p struct {
+		Title string `json:"title"`
+	}
+	if json.Unmarshal(payload, &p) == nil && p.Title != "" {
+		text += " " + p.Title
+	}
+	if r := []rune(text); len(r) > maxFallbackLen {
+		text = string(r[:maxFallbackLen])
+	}
+	return text
+}
+
+// cardButtons 取出负载中的按钮
+func cardButtons(payload json.RawMessage) ([]*model.CardButton, error) {
+	var p struct {
+		Buttons []*model.CardButton `json:"buttons"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, ierr.ErrCustomPayload
+	}
+	return p.Buttons, nil
+}
+
+// checkButtons 按钮id不能重复，url按钮只允许http和https
+func checkButtons(buttons []*model.CardButton) error {
+	ids := make(map[string]bool, len(buttons))
+	for _, b := range buttons {
+		if b == nil || b.ID == "" || ids[b.ID] {
+			return ierr.ErrCustomPayload
+		}
+		ids[b.ID] = true
+		switch b.Kind {
+		case model.ButtonCallback:
+		case model.ButtonURL:
+			if !httpURL(b.Value) {
+				return ierr.ErrCustomPayload
+			}
+		default:
+			return ierr.ErrCustomPayload
+		}
+	}
+	return nil
+}
+
+func httpURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// RegisterTypeReq 注册或更新自定义消息类型
+type RegisterTypeReq struct {
+	Name     string          `json:"name"`
+	Schema   json.RawMessage `json:"schema"`
+	Fallback string          `json:"fallback"`
+	Callback string          `json:"callback"` // 按钮回调地址，没有回调按钮时可不填
+	Secret   string          `json:"secret"`   // 回调签名密钥
+}
+
+// RegisterTypeRsp .
+type RegisterTypeRsp struct {
+	Version int `json:"version"`
+}
+
+// RegisterType 注册自定义消息类型，已存在时只有注册者可以更新，内置类型不能覆盖
+func (s *Service) RegisterType(ctx context.Context, uid uint64, req *RegisterTypeReq) (*RegisterTypeRsp, error) {
+	req.Name = strings.ToLower(req.Name)
+	if !typeNameRegexp.MatchString(req.Name) || len(req.Schema) == 0 || len(req.Schema) > maxSchemaSize ||
+		utf8.RuneCountInString(req.Fallback) > maxFallbackLen || (req.Callback != "" && !httpURL(req.Callback)) {
+		return nil, ierr.ErrParam
+	}
+	if _, ok := builtinTypes[req.Name]; ok {
+		return nil, ierr.ErrCustomOwner
+	}
+	if _, err := schema.Compile(req.Schema); err != nil {
+		return nil, ierr.New(ierr.CodeParam, ierr.ErrParam.Msg+": "+err.Error())
+	}
+	if req.Callback != "" {
+		if err := webhook.CheckURL(ctx, req.Callback); err != nil {
+			log.InfoContextf(ctx, "reject custom type callback, name:%s, url:%s, err:%v", req.Name, req.Callback, err)
+			return nil, ierr.ErrParam
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	ct, err := s.store.Custom.Get(ctx, req.Name)
+	switch err {
+	case nil:
+		if ct.Owner != uid {
+			return nil, ierr.ErrCustomOwner
+		}
+	case store.ErrNotFound:
+		ct = &model.CustomType{Name: req.Name, Owner: uid, CreateTime: now}
+	default:
+		log.ErrorContextf(ctx, "get custom type fail, name:%s, err:%v", req.Name, err)
+		return nil, ierr.ErrSystem
+	}
+	ct.Schema = req.Schema
+	ct.Fallback = req.Fallback
+	ct.Callback = req.Callback
+	ct.Secret = req.Secret
+	ct.Version++
+	ct.UpdateTime = now
+	if err = s.store.Custom.Save(ctx, ct); err != nil {
+		log.ErrorContextf(ctx, "save custom type fail, name:%s, err:%v", req.Name, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "register custom type, name:%s, owner:%d, version:%d", ct.Name, uid, ct.Version)
+	return &RegisterTypeRsp{Version: ct.Version}, nil
+}
+
+// TypesRsp 全部自定义消息类型
+type TypesRsp struct {
+	Types []*model.CustomType `json:"types"`
+}
+
+// Types 返回内置及注册的类型，客户端据此决定能渲染哪些类型，回调地址只返回给注册者
+func (s *Service) Types(ctx context.Context, uid uint64) (*TypesRsp, error) {
+	list, err := s.store.Custom.List(ctx)
+	if err != nil {
+		log.ErrorContextf(ctx, "list custom types fail, err:%v", err)
+		return nil, ierr.ErrSystem
+	}
+	rsp := &TypesRsp{Types: make([]*model.CustomType, 0, len(builtinTypes)+len(list))}
+	for _, name := range builtinNames {
+		rsp.Types = append(rsp.Types, builtinTypes[name])
+	}
+	for _, ct := range list {
+		if ct.Owner != uid {
+			ct.Callback = ""
+		}
+		rsp.Types = append(rsp.Types, ct)
+	}
+	return rsp, nil
+}
@@ -0,0 +1,49 @@
+package message
+
+import (
+	"fmt"
+	"sync"
+)
+
+// keyLock 按key加锁，保证同一个客户端消息id的并发重试串行处理
+type keyLock struct {
+	mu    sync.Mutex
+	locks map[string]*keyLockEntry
+}
+
+type keyLockEntry struct {
+	mu  sync.Mutex
+	ref int
+}
+
+func newKeyLock() *keyLock {
+	return &keyLock{locks: make(map[string]*keyLockEntry)}
+}
+
+// Lock 锁住key，返回解锁函数
+func (l *keyLock) Lock(key string) func() {
+	l.mu.Lock()
+	e, ok := l.locks[key]
+	if !ok {
+		e = &keyLockEntry{}
+		l.locks[key] = e
+	}
+	e.ref++
+	l.mu.Unlock()
+
+	e.mu.Lock()
+	return func() {
+		e.mu.Unlock()
+		l.mu.Lock()
+		e.ref--
+		if e.ref == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// dedupKey 去重key，客户端消息id只在发送者维度唯一
+func dedupKey(sender uint64, clientID string) string {
+	return fmt.Sprintf("%d:%s", sender, clientID)
+}
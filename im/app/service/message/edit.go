@@ -0,0 +1,134 @@
+package message
+
+import (
+	"context"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// EditReq 编辑消息请求
+type EditReq struct {
+	MsgID   uint64 `json:"msg_id,string"`
+	Content string `json:"content"`
+}
+
+// EditRsp 编辑消息回包
+type EditRsp struct {
+	Version  int   `json:"version"`
+	EditTime int64 `json:"edit_time"`
+}
+
+// Edit 编辑文本和富文本消息，转发的消息不可编辑，权限和时间限制与撤回一致，seq保持不变
+func (s *Service) Edit(ctx context.Context, uid uint64, req *EditReq) (*EditRsp, error) {
+	if req.Content == "" {
+		return nil, ierr.ErrParam
+	}
+	msg, err := s.loadMsg(ctx, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Recalled() {
+		return nil, ierr.ErrMsgRecalled
+	}
+	if msg.Type != model.MsgText && msg.Type != model.MsgRich || msg.Forward != nil {
+		return nil, ierr.ErrMsgNotEditable
+	}
+	next := &model.Message{ID: msg.ID, ConvID: msg.ConvID, Sender: uid, Type: msg.Type, Content: req.Content}
+	if msg.Type == model.MsgRich {
+		if err = s.prepareRich(next); err != nil {
+			return nil, err
+		}
+	}
+	window := time.Duration(cfg.AppConfig().MsgInfo.RecallWindow) * time.Second
+	if err = s.checkModify(ctx, uid, msg, window, ierr.ErrMsgEditLate); err != nil {
+		return nil, err
+	}
+	if err = s.moderate(ctx, next); err != nil {
+		return nil, err
+	}
+
+	// 按读到的版本号更新，并发的编辑只有一个成功，其余的需要刷新后重试；期间的其他修改(如开始阅后即焚倒计时)保留
+	now := time.Now().UnixMilli()
+	prev := msg.Version
+	origin := &model.Revision{MsgID: msg.ID, Content: msg.Content, Editor: msg.Sender, Time: msg.SendTime}
+	msg, err = s.updateMsg(ctx, msg, func(m *model.Message) error {
+		switch {
+		case m.Recalled():
+			return ierr.ErrMsgRecalled
+		case m.Expired() || m.Due(now):
+			return ierr.ErrMsgNotFound
+		case m.Version != prev:
+			return ierr.ErrMsgConflict
+		}
+		m.Version++
+		m.Content, m.Plain, m.HTML = next.Content, next.Plain, next.HTML
+		m.EditTime = now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.indexMsg(msg)
+
+	// 更新成功后再记录历史版本，首次编辑时把原文记为版本0
+	revs := []*model.Revision{{MsgID: msg.ID, Version: msg.Version, Content: msg.Content, Editor: uid, Time: now}}
+	if prev == 0 {
+		revs = append([]*model.Revision{origin}, revs...)
+	}
+	for _, rev := range revs {
+		if err = s.store.Revision.Add(ctx, rev); err != nil {
+			log.ErrorContextf(ctx, "save revision fail, id:%d, version:%d, err:%v", msg.ID, rev.Version, err)
+		}
+	}
+
+	uids, err := s.recipients(ctx, msg)
+	if err != nil {
+		log.ErrorContextf(ctx, "get recipients fail, msg:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	s.convs.Refresh(ctx, msg, uids)
+	s.notify(ctx, uids, &model.Event{
+		Type:     model.EventEdit,
+		ConvID:   msg.ConvID,
+		MsgID:    msg.ID,
+		Operator: uid,
+		Time:     now,
+		Message:  msg,
+	})
+	log.InfoContextf(ctx, "edit msg done, id:%d, version:%d, operator:%d", msg.ID, msg.Version, uid)
+	return &EditRsp{Version: msg.Version, EditTime: now}, nil
+}
+
+// RevisionsReq 查询编辑历史请求
+type RevisionsReq struct {
+	MsgID uint64 `form:"msg_id"`
+}
+
+// RevisionsRsp 查询编辑历史回包
+type RevisionsRsp struct {
+	Revisions []*model.Revision `json:"revisions"`
+}
+
+// Revisions 查询消息的编辑历史，撤回后不再返回
+func (s *Service) Revisions(ctx context.Context, uid uint64, req *RevisionsReq) (*RevisionsRsp, error) {
+	msg, err := s.loadMsg(ctx, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkView(ctx, uid, msg); err != nil {
+		return nil, err
+	}
+	if msg.Recalled() {
+		return nil, ierr.ErrMsgRecalled
+	}
+	revs, err := s.store.Revision.List(ctx, msg.ID)
+	if err != nil {
+		log.ErrorContextf(ctx, "list revisions fail, id:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	return &RevisionsRsp{Revisions: revs}, nil
+}
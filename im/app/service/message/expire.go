@@ -0,0 +1,297 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	expireLease = time.Minute // 领取到期消息的租约，实例中途退出时由其他实例在租约过期后接手
+	expireBatch = 100         // 每次领取的到期消息数
+)
+
+// instanceID 领取租约时使用的实例标识
+func instanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// checkTTL 校验存活时间和计时起点
+func checkTTL(ttl int, from model.TTLFrom) error {
+	if ttl < 0 || ttl > cfg.AppConfig().MsgInfo.MaxTTL {
+		return ierr.ErrParam
+	}
+	if from != model.TTLFromSend && from != model.TTLFromRead {
+		return ierr.ErrParam
+	}
+	return nil
+}
+
+// applyTTL 补齐消息的存活时间，消息没有指定时使用会话的设置；从发送开始计时的消息直接算出到期时间
+func (s *Service) applyTTL(ctx context.Context, msg *model.Message) error {
+	if msg.TTL == 0 {
+		setting, err := s.store.ConvTTL.Get(ctx, msg.ConvID)
+		switch err {
+		case nil:
+			msg.TTL, msg.TTLFrom = setting.TTL, setting.From
+		case store.ErrNotFound:
+		default:
+			log.ErrorContextf(ctx, "get conv ttl fail, conv:%s, err:%v", msg.ConvID, err)
+			return ierr.ErrSystem
+		}
+	}
+	if msg.TTL == 0 {
+		msg.TTLFrom = model.TTLFromSend
+		return nil
+	}
+	if err := checkTTL(msg.TTL, msg.TTLFrom); err != nil {
+		return err
+	}
+	if msg.TTLFrom == model.TTLFromSend {
+		msg.ExpireTime = msg.SendTime + int64(msg.TTL)*1000
+	}
+	return nil
+}
+
+// scheduleExpiry 消息落地后登记到期调度，阅后即焚的消息等首次阅读后再登记到期时间
+func (s *Service) scheduleExpiry(ctx context.Context, msg *model.Message) {
+	if msg.TTL == 0 {
+		return
+	}
+	var err error
+	if msg.ExpireTime > 0 {
+		err = s.store.Expiry.Schedule(ctx, msg.ID, msg.ExpireTime)
+	} else {
+		err = s.store.Expiry.Await(ctx, msg.ConvID, msg.Seq, msg.ID, msg.Sender)
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "schedule expiry fail, msg:%d, err:%v", msg.ID, err)
+	}
+}
+
+// startTTL 会话被uid读到seq，其他成员发送的阅后即焚消息开始倒计时
+func (s *Service) startTTL(ctx context.Context, uid uint64, convID string, seq uint64) {
+	ids, err := s.store.Expiry.Start(ctx, convID, seq, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "start ttl fail, uid:%d, conv:%s, err:%v", uid, convID, err)
+		return
+	}
+	now := time.Now().UnixMilli()
+	for _, id := range ids {
+		msg, err := s.store.Message.Get(ctx, id)
+		if err != nil {
+			log.WarnContextf(ctx, "get ttl msg fail, id:%d, err:%v", id, err)
+			continue
+		}
+		msg, err = s.updateMsg(ctx, msg, func(m *model.Message) error {
+			if m.ExpireTime > 0 || m.Expired() || m.Recalled() {
+				return errNoChange
+			}
+			m.ExpireTime = now + int64(m.TTL)*1000
+			return nil
+		})
+		if err == errNoChange {
+			continue
+		}
+		if err != nil {
+			log.ErrorContextf(ctx, "update msg expire time fail, id:%d, err:%v", id, err)
+			continue
+		}
+		if err = s.store.Expiry.Schedule(ctx, msg.ID, msg.ExpireTime); err != nil {
+			log.ErrorContextf(ctx, "schedule expiry fail, msg:%d, err:%v", msg.ID, err)
+			continue
+		}
+		uids, err := s.recipients(ctx, msg)
+		if err != nil {
+			log.ErrorContextf(ctx, "get recipients fail, msg:%d, err:%v", msg.ID, err)
+			continue
+		}
+		// 会话摘要带上到期时间，到期后列表中不再展示
+		s.convs.Refresh(ctx, msg, uids)
+		ev := &model.Event{Type: model.EventExpireAt, ConvID: msg.ConvID, MsgID: msg.ID, Operator: uid, Time: now, Message: msg}
+		if err = s.pusher.Push(ctx, uids, ev); err != nil {
+			log.WarnContextf(ctx, "push expire at fail, msg:%d, err:%v", msg.ID, err)
+		}
+	}
+}
+
+// RunSweeper 定期清理到期的消息，直到ctx结束，ExpiryStore是共享存储时多个实例可以同时运行
+func (s *Service) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SweepExpired(ctx)
+		}
+	}
+}
+
+// SweepExpired 分批领取到期的消息并删除内容，清理失败的消息在租约过期后重新领取
+func (s *Service) SweepExpired(ctx context.Context) {
+	for {
+		ids, err := s.store.Expiry.Claim(ctx, s.owner, time.Now().UnixMilli(), expireLease, expireBatch)
+		if err != nil {
+			log.ErrorContextf(ctx, "claim expired msgs fail, err:%v", err)
+			return
+		}
+		for _, id := range ids {
+			if !s.expire(ctx, id) {
+				continue
+			}
+			if err = s.store.Expiry.Remove(ctx, id); err != nil {
+				log.WarnContextf(ctx, "remove expiry fail, msg:%d, err:%v", id, err)
+			}
+		}
+		if len(ids) < expireBatch {
+			return
+		}
+	}
+}
+
+// expire 删除消息的内容、编辑历史、媒体文件和检索索引，只保留占位记录维持会话seq连续，返回是否处理完成
+func (s *Service) expire(ctx context.Context, id uint64) bool {
+	msg, err := s.store.Message.Get(ctx, id)
+	if err == store.ErrNotFound {
+		return true
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get expired msg fail, id:%d, err:%v", id, err)
+		return false
+	}
+	if msg.Expired() {
+		return true
+	}
+	if err = s.store.Revision.Delete(ctx, msg.ID); err != nil {
+		log.ErrorContextf(ctx, "delete revisions fail, id:%d, err:%v", msg.ID, err)
+		return false
+	}
+	// 条件更新，并发的编辑或撤回不会写回已删除的内容，更新成功后再释放媒体
+	var origin *model.Message
+	msg, err = s.updateMsg(ctx, msg, func(m *model.Message) error {
+		if m.Expired() {
+			return errNoChange
+		}
+		origin = m.Clone()
+		clearExpired(m)
+		return nil
+	})
+	if err == errNoChange || err == ierr.ErrMsgNotFound {
+		return true
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "update expired msg fail, id:%d, err:%v", id, err)
+		return false
+	}
+	s.releaseMedia(ctx, origin)
+	s.indexMsg(msg)
+
+	uids, err := s.recipients(ctx, msg)
+	if err != nil {
+		log.ErrorContextf(ctx, "get recipients fail, msg:%d, err:%v", msg.ID, err)
+		return true
+	}
+	s.convs.Refresh(ctx, msg, uids)
+	s.notify(ctx, uids, &model.Event{
+		Type:   model.EventExpire,
+		ConvID: msg.ConvID,
+		MsgID:  msg.ID,
+		Time:   time.Now().UnixMilli(),
+	})
+	log.InfoContextf(ctx, "expire msg done, id:%d, conv:%s", msg.ID, msg.ConvID)
+	return true
+}
+
+// clearExpired 清空到期消息的内容和媒体引用，只保留占位
+func clearExpired(m *model.Message) {
+	m.Content, m.Plain, m.HTML = "", "", ""
+	m.MediaID, m.Media = 0, nil
+	m.Status = model.MsgExpired
+}
+
+// TTLReq 设置会话的消息存活时间
+type TTLReq struct {
+	ConvID string        `json:"conv_id"`
+	TTL    int           `json:"ttl"` // 单位秒，0表示关闭
+	From   model.TTLFrom `json:"from"`
+}
+
+// TTLRsp .
+type TTLRsp struct{}
+
+// SetTTL 设置会话的消息存活时间，对之后发送的消息生效；单聊双方都可以设置，群聊只有群主和管理员可以设置
+func (s *Service) SetTTL(ctx context.Context, uid uint64, req *TTLReq) (*TTLRsp, error) {
+	if err := checkTTL(req.TTL, req.From); err != nil {
+		return nil, err
+	}
+	typ, err := s.checkConv(ctx, uid, req.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	_, ids, _ := model.ParseConvID(req.ConvID)
+	probe := &model.Message{ConvID: req.ConvID, ConvType: typ}
+	if typ == model.ConvSingle {
+		probe.Sender, probe.Receiver = ids[0], ids[1]
+	} else {
+		probe.GroupID = ids[0]
+		member, err := s.store.Group.Member(ctx, probe.GroupID, uid)
+		if err != nil {
+			log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", probe.GroupID, uid, err)
+			return nil, ierr.ErrSystem
+		}
+		if !member.IsManager() {
+			return nil, ierr.ErrConvNoPerm
+		}
+	}
+
+	setting := &model.ConvTTL{ConvID: req.ConvID, TTL: req.TTL, From: req.From, Operator: uid, Time: time.Now().UnixMilli()}
+	if err = s.store.ConvTTL.Save(ctx, setting); err != nil {
+		log.ErrorContextf(ctx, "save conv ttl fail, conv:%s, err:%v", req.ConvID, err)
+		return nil, ierr.ErrSystem
+	}
+	uids, err := s.recipients(ctx, probe)
+	if err != nil {
+		log.ErrorContextf(ctx, "get conv members fail, conv:%s, err:%v", req.ConvID, err)
+		return nil, ierr.ErrSystem
+	}
+	s.notify(ctx, uids, &model.Event{
+		Type:     model.EventConvTTL,
+		ConvID:   req.ConvID,
+		Operator: uid,
+		Time:     setting.Time,
+		TTL:      setting,
+	})
+	log.InfoContextf(ctx, "set conv ttl, conv:%s, ttl:%d, from:%d, operator:%d", req.ConvID, req.TTL, req.From, uid)
+	return &TTLRsp{}, nil
+}
+
+// GetTTLReq 查询会话的消息存活时间
+type GetTTLReq struct {
+	ConvID string `form:"conv_id"`
+}
+
+// GetTTL 查询会话的消息存活时间，没有设置过时返回关闭
+func (s *Service) GetTTL(ctx context.Context, uid uint64, req *GetTTLReq) (*model.ConvTTL, error) {
+	if _, err := s.checkConv(ctx, uid, req.ConvID); err != nil {
+		return nil, err
+	}
+	setting, err := s.store.ConvTTL.Get(ctx, req.ConvID)
+	if err == store.ErrNotFound {
+		return &model.ConvTTL{ConvID: req.ConvID}, nil
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get conv ttl fail, conv:%s, err:%v", req.ConvID, err)
+		return nil, ierr.ErrSystem
+	}
+	return setting, nil
+}
@@ -0,0 +1,87 @@
+package message
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/service/conversation"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// TestDueBeforeSweep 过了存活时间、清理任务还没处理到时，同步、引用摘要和会话摘要都不再返回内容
+func TestDueBeforeSweep(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemStore()
+	convs := conversation.New(conversation.WithStore(st))
+	s := New(WithStore(st), WithConvFeed(convs))
+
+	rsp, err := s.SendSingle(ctx, 1, &SendReq{To: 2, Type: model.MsgText, Content: "secret", TTL: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := s.SendSingle(ctx, 2, &SendReq{To: 1, Type: model.MsgText, Content: "ok", ReplyTo: rsp.MsgID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := s.SendSingle(ctx, 3, &SendReq{To: 2, Type: model.MsgText, Content: "last", TTL: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	list, err := convs.List(ctx, 2, &conversation.ListReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range list.Convs {
+		if c.ConvID == model.SingleConvID(2, 3) && (c.Last.MsgID != last.MsgID || c.Last.Snippet != "") {
+			t.Fatalf("conv preview got %+v", c.Last)
+		}
+	}
+
+	sync, err := s.Sync(ctx, 2, &SyncReq{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := 0
+	for _, item := range sync.Items {
+		msg := item.Event.Message
+		switch {
+		case msg == nil:
+		case msg.ID == rsp.MsgID:
+			checked++
+			if msg.Content != "" || !msg.Expired() {
+				t.Fatalf("synced due msg got %+v", msg)
+			}
+		case msg.ID == reply.MsgID:
+			checked++
+			if msg.Ref == nil || msg.Ref.Snippet != "" {
+				t.Fatalf("ref of due msg got %+v", msg.Ref)
+			}
+		}
+	}
+	if checked != 2 {
+		t.Fatalf("checked %d synced msgs", checked)
+	}
+
+	// 清理后存储中的内容被删除，与读取时看到的一致
+	s.SweepExpired(ctx)
+	msg, err := st.Message.Get(ctx, rsp.MsgID)
+	if err != nil || msg.Content != "" || !msg.Expired() {
+		t.Fatalf("swept msg got %+v, err:%v", msg, err)
+	}
+}
+
+func TestSnippetDue(t *testing.T) {
+	now := time.Now().UnixMilli()
+	msg := &model.Message{Type: model.MsgText, Content: "hello", ExpireTime: now + 60000}
+	if msg.Snippet() != "hello" {
+		t.Fatalf("snippet got %q", msg.Snippet())
+	}
+	msg.ExpireTime = now - 1
+	if msg.Snippet() != "" {
+		t.Fatalf("due snippet got %q", msg.Snippet())
+	}
+}
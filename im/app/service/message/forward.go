@@ -0,0 +1,280 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	maxForwardTargets = 20  // 单次转发的最多目标会话数
+	maxForwardMsgs    = 20  // 逐条转发的最多消息数
+	maxMergedMsgs     = 100 // 合并转发的最多消息数
+	maxMergedTitleLen = 100 // 合并转发标题最多的字符数
+	defaultMergedName = "聊天记录"
+)
+
+// ForwardTarget 转发的目标会话，To和GroupID只能填一个
+type ForwardTarget struct {
+	To      uint64 `json:"to"`       // 单聊接收者uid
+	GroupID uint64 `json:"group_id"` // 群聊群id
+}
+
+// ForwardReq 逐条转发消息
+type ForwardReq struct {
+	MsgIDs  []string         `json:"msg_ids"`
+	Targets []*ForwardTarget `json:"targets"`
+}
+
+// MergeReq 合并转发消息
+type MergeReq struct {
+	MsgIDs  []string         `json:"msg_ids"` // 必须来自同一个会话，按会话内的顺序展示
+	Title   string           `json:"title"`
+	Targets []*ForwardTarget `json:"targets"`
+}
+
+// ForwardResult 转发到一个目标会话的结果，失败只影响该目标，已发出的消息仍然返回
+type ForwardResult struct {
+	To       uint64     `json:"to,omitempty"`
+	GroupID  uint64     `json:"group_id,omitempty"`
+	Messages []*SendRsp `json:"messages"`
+	Code     int        `json:"code"`
+	Msg      string     `json:"msg,omitempty"`
+}
+
+// ForwardRsp 转发回包，结果与请求中的目标一一对应
+type ForwardRsp struct {
+	Results []*ForwardResult `json:"results"`
+}
+
+// Forward 把消息逐条转发到多个会话，转发的消息带原消息的来源，每个目标会话单独校验权限并审核
+func (s *Service) Forward(ctx context.Context, uid uint64, req *ForwardReq) (*ForwardRsp, error) {
+	if err := checkTargets(req.Targets); err != nil {
+		return nil, err
+	}
+	srcs, err := s.loadForward(ctx, uid, req.MsgIDs, maxForwardMsgs)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*model.Message, 0, len(srcs))
+	for _, src := range srcs {
+		msgs = append(msgs, forwardMsg(uid, src))
+	}
+	log.InfoContextf(ctx, "forward msgs, uid:%d, msgs:%d, targets:%d", uid, len(msgs), len(req.Targets))
+	return s.forwardTo(ctx, uid, req.Targets, msgs), nil
+}
+
+// Merge 把同一会话的多条消息合并成一条聊天记录转发，记录是原消息的快照，媒体由合并消息自己持有
+func (s *Service) Merge(ctx context.Context, uid uint64, req *MergeReq) (*ForwardRsp, error) {
+	if err := checkTargets(req.Targets); err != nil {
+		return nil, err
+	}
+	if req.Title == "" {
+		req.Title = defaultMergedName
+	}
+	if utf8.RuneCountInString(req.Title) > maxMergedTitleLen {
+		return nil, ierr.ErrParam
+	}
+	srcs, err := s.loadForward(ctx, uid, req.MsgIDs, maxMergedMsgs)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := mergeMsgs(uid, req.Title, srcs)
+	if err != nil {
+		return nil, err
+	}
+	log.InfoContextf(ctx, "merge forward msgs, uid:%d, conv:%s, msgs:%d, targets:%d",
+		uid, srcs[0].ConvID, len(srcs), len(req.Targets))
+	return s.forwardTo(ctx, uid, req.Targets, []*model.Message{msg}), nil
+}
+
+func checkTargets(targets []*ForwardTarget) error {
+	if len(targets) == 0 || len(targets) > maxForwardTargets {
+		return ierr.ErrParam
+	}
+	for _, t := range targets {
+		if t == nil || (t.To == 0) == (t.GroupID == 0) {
+			return ierr.ErrParam
+		}
+	}
+	return nil
+}
+
+// loadForward 加载要转发的消息，只能转发自己可见的消息，已撤回和加密的消息不能转发
+// 已到期的消息由loadMsg视为不存在；带存活时间的消息(阅后即焚、自动过期)也不能转发，避免复制出不会过期的副本
+func (s *Service) loadForward(ctx context.Context, uid uint64, raw []string, limit int) ([]*model.Message, error) {
+	if len(raw) == 0 || len(raw) > limit {
+		return nil, ierr.ErrParam
+	}
+	seen := make(map[uint64]bool, len(raw))
+	msgs := make([]*model.Message, 0, len(raw))
+	for _, r := range raw {
+		id, err := strconv.ParseUint(r, 10, 64)
+		if err != nil || seen[id] {
+			return nil, ierr.ErrParam
+		}
+		seen[id] = true
+		msg, err := s.loadMsg(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkView(ctx, uid, msg); err != nil {
+			return nil, err
+		}
+		if msg.Recalled() {
+			return nil, ierr.ErrMsgRecalled
+		}
+		if msg.Type == model.MsgCipher || msg.TTL > 0 {
+			return nil, ierr.ErrMsgNoForward
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// forwardMsg 复制原消息的内容，不带引用和@，多次转发时保留最初的来源，带存活时间的消息在loadForward中已被拒绝
+func forwardMsg(uid uint64, src *model.Message) *model.Message {
+	fwd := src.Forward
+	if fwd == nil {
+		fwd = &model.ForwardInfo{MsgID: src.ID, Sender: src.Sender, SendTime: src.SendTime}
+	}
+	return &model.Message{
+		Sender:  uid,
+		Type:    src.Type,
+		Content: src.Content,
+		Plain:   src.Plain,
+		HTML:    src.HTML,
+		Forward: fwd,
+		MediaID: src.MediaID,
+		Media:   src.Media,
+	}
+}
+
+// mergeMsgs 按会话顺序生成合并转发消息，媒体条目的原媒体记录按顺序记在Media中，发送时再复制
+func mergeMsgs(uid uint64, title string, srcs []*model.Message) (*model.Message, error) {
+	sort.Slice(srcs, func(i, j int) bool { return srcs[i].Seq < srcs[j].Seq })
+	c := &model.MergedContent{Title: title, Items: make([]*model.MergedItem, 0, len(srcs))}
+	msg := &model.Message{Sender: uid, Type: model.MsgMerged}
+	texts := []string{title}
+	for _, src := range srcs {
+		if src.ConvID != srcs[0].ConvID {
+			return nil, ierr.ErrParam
+		}
+		// 聊天记录中不再嵌套聊天记录
+		if src.Type == model.MsgMerged {
+			return nil, ierr.ErrMsgNoForward
+		}
+		if src.Type.HasMedia() {
+			if src.MediaID == 0 {
+				return nil, ierr.ErrMsgNoForward
+			}
+			msg.Media = append(msg.Media, src.MediaID)
+		}
+		c.Items = append(c.Items, &model.MergedItem{
+			MsgID:    src.ID,
+			Sender:   src.Sender,
+			Type:     src.Type,
+			Content:  src.Content,
+			SendTime: src.SendTime,
+		})
+		if text := searchText(src); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	msg.Plain = strings.Join(texts, "\n")
+	return msg, setContent(msg, c)
+}
+
+// attachMerged 为聊天记录中的每个媒体条目复制独立的媒体记录，并改写条目内容指向新记录
+func (s *Service) attachMerged(ctx context.Context, msg *model.Message) error {
+	c := &model.MergedContent{}
+	if err := json.Unmarshal([]byte(msg.Content), c); err != nil {
+		return ierr.ErrSystem
+	}
+	n := 0
+	for _, item := range c.Items {
+		if item.Type.HasMedia() {
+			n++
+		}
+	}
+	if n != len(msg.Media) {
+		log.ErrorContextf(ctx, "merged media mismatch, sender:%d, items:%d, media:%d", msg.Sender, n, len(msg.Media))
+		return ierr.ErrSystem
+	}
+
+	url := media.StoreURL(ctx, s.blobs.Media)
+	ids := make([]uint64, 0, n)
+	for _, item := range c.Items {
+		if !item.Type.HasMedia() {
+			continue
+		}
+		m, err := s.cloneMedia(ctx, msg.Media[len(ids)], msg.Sender)
+		if err != nil {
+			s.releaseMedia(ctx, &model.Message{ID: msg.ID, Media: ids})
+			return err
+		}
+		ids = append(ids, m.ID)
+		b, err := json.Marshal(media.Content(m, url))
+		if err != nil {
+			s.releaseMedia(ctx, &model.Message{ID: msg.ID, Media: ids})
+			return ierr.ErrSystem
+		}
+		item.Content = string(b)
+	}
+	msg.Media = ids
+	return setContent(msg, c)
+}
+
+// forwardTo 把消息依次发到每个目标会话，某个目标失败时跳过该目标剩余的消息
+func (s *Service) forwardTo(ctx context.Context, uid uint64, targets []*ForwardTarget, msgs []*model.Message) *ForwardRsp {
+	rsp := &ForwardRsp{Results: make([]*ForwardResult, 0, len(targets))}
+	for _, t := range targets {
+		res := &ForwardResult{To: t.To, GroupID: t.GroupID, Messages: []*SendRsp{}}
+		if err := s.forwardOne(ctx, uid, t, msgs, res); err != nil {
+			log.InfoContextf(ctx, "forward to target fail, uid:%d, to:%d, group:%d, err:%v", uid, t.To, t.GroupID, err)
+			res.Code, res.Msg = ierr.Code(err), ierr.Msg(err)
+		}
+		rsp.Results = append(rsp.Results, res)
+	}
+	return rsp
+}
+
+// forwardOne 按目标会话校验发送权限后发送，每条消息和直接发送一样经过限流、存活时间和内容审核
+func (s *Service) forwardOne(ctx context.Context, uid uint64, t *ForwardTarget, msgs []*model.Message, res *ForwardResult) error {
+	if t.GroupID != 0 {
+		_, err := s.store.Group.Member(ctx, t.GroupID, uid)
+		if err == store.ErrNotFound {
+			return ierr.ErrNotGroupMember
+		}
+		if err != nil {
+			log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", t.GroupID, uid, err)
+			return ierr.ErrSystem
+		}
+	}
+	for _, m := range msgs {
+		msg := m.Clone()
+		if t.GroupID != 0 {
+			msg.ConvID, msg.ConvType, msg.GroupID = model.GroupConvID(t.GroupID), model.ConvGroup, t.GroupID
+		} else {
+			msg.ConvID, msg.ConvType, msg.Receiver = model.SingleConvID(uid, t.To), model.ConvSingle, t.To
+			if err := s.checkE2E(ctx, msg); err != nil {
+				return err
+			}
+		}
+		rsp, err := s.send(ctx, msg)
+		if err != nil {
+			return err
+		}
+		res.Messages = append(res.Messages, rsp)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package message
+
+import (
+	"strconv"
+
+	"github.com/binbin6363/icuc/common/api"
+	"github.com/binbin6363/icuc/common/codec/httpx"
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册消息相关的http接口，需要挂在jwt鉴权中间件之后
+func (s *Service) RegisterRoutes(r gin.IRoutes) {
+	r.POST(api.PathMsgSendSingle, s.handleSendSingle)
+	r.POST(api.PathMsgSendGroup, s.handleSendGroup)
+	r.GET(api.PathMsgSync, s.handleSync)
+	r.POST(api.PathMsgRecall, s.handleRecall)
+	r.POST(api.PathMsgEdit, s.handleEdit)
+	r.GET(api.PathMsgRevisions, s.handleRevisions)
+	r.GET(api.PathMsgThread, s.handleThread)
+	r.POST(api.PathMsgReactAdd, s.handleAddReaction)
+	r.POST(api.PathMsgReactDel, s.handleRemoveReaction)
+	r.GET(api.PathMsgReactions, s.handleReactions)
+	r.POST(api.PathMsgRead, s.handleRead)
+	r.GET(api.PathMsgMentions, s.handleMentions)
+	r.POST(api.PathMsgPlay, s.handlePlay)
+	r.GET(api.PathMsgPlayed, s.handlePlayed)
+	r.POST(api.PathMsgTypeReg, s.handleRegisterType)
+	r.GET(api.PathMsgTypes, s.handleTypes)
+	r.POST(api.PathMsgCardAction, s.handleCardAction)
+	r.GET(api.PathMsgSearch, s.handleSearch)
+	r.GET(api.PathMsgHistory, s.handleHistory)
+	r.POST(api.PathMsgDelete, s.handleDelete)
+	r.POST(api.PathMsgTTL, s.handleSetTTL)
+	r.GET(api.PathMsgTTL, s.handleGetTTL)
+	r.POST(api.PathMsgSignal, s.handleSignal)
+	r.POST(api.PathMsgForward, s.handleForward)
+	r.POST(api.PathMsgMerge, s.handleMerge)
+	r.POST(api.PathMsgSchedule, s.handleSchedule)
+	r.GET(api.PathMsgSchedules, s.handleListSchedules)
+	r.POST(api.PathMsgSchedEdit, s.handleEditSchedule)
+	r.POST(api.PathMsgSchedDel, s.handleCancelSchedule)
+}
+
+// currentUid 从鉴权中间件写入的上下文中获取当前用户
+func currentUid(c *gin.Context) uint64 {
+	uid, _ := strconv.ParseUint(c.GetString(api.HeadUid), 10, 64)
+	return uid
+}
+
+func (s *Service) handleSendSingle(c *gin.Context) {
+	req := &SendReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.SendSingle(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSendGroup(c *gin.Context) {
+	req := &SendReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.SendGroup(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSync(c *gin.Context) {
+	req := &SyncReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Sync(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRecall(c *gin.Context) {
+	req := &RecallReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Recall(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleEdit(c *gin.Context) {
+	req := &EditReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Edit(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRevisions(c *gin.Context) {
+	req := &RevisionsReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Revisions(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleThread(c *gin.Context) {
+	req := &ThreadReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Thread(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleAddReaction(c *gin.Context) {
+	req := &ReactReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.AddReaction(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRemoveReaction(c *gin.Context) {
+	req := &ReactReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.RemoveReaction(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleReactions(c *gin.Context) {
+	req := &ReactionsReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Reactions(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRead(c *gin.Context) {
+	req := &ReadReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Read(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleMentions(c *gin.Context) {
+	rsp, e := s.Mentions(c, currentUid(c))
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handlePlay(c *gin.Context) {
+	req := &PlayReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Play(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handlePlayed(c *gin.Context) {
+	req := &PlayedReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Played(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleRegisterType(c *gin.Context) {
+	req := &RegisterTypeReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.RegisterType(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleTypes(c *gin.Context) {
+	rsp, e := s.Types(c, currentUid(c))
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleCardAction(c *gin.Context) {
+	req := &CardActionReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.CardAction(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSearch(c *gin.Context) {
+	req := &SearchReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Search(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleHistory(c *gin.Context) {
+	req := &HistoryReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.History(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleDelete(c *gin.Context) {
+	req := &DeleteReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Delete(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSetTTL(c *gin.Context) {
+	req := &TTLReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.SetTTL(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleGetTTL(c *gin.Context) {
+	req := &GetTTLReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.GetTTL(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSignal(c *gin.Context) {
+	req := &SignalReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Signal(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleForward(c *gin.Context) {
+	req := &ForwardReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Forward(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleMerge(c *gin.Context) {
+	req := &MergeReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Merge(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleSchedule(c *gin.Context) {
+	req := &ScheduleReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.Schedule(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleListSchedules(c *gin.Context) {
+	req := &ListScheduleReq{}
+	if e := c.ShouldBindQuery(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.ListSchedules(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleEditSchedule(c *gin.Context) {
+	req := &EditScheduleReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.EditSchedule(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
+
+func (s *Service) handleCancelSchedule(c *gin.Context) {
+	req := &CancelScheduleReq{}
+	if e := c.ShouldBindJSON(req); e != nil {
+		httpx.SendResponse(c, nil, ierr.ErrParam)
+		return
+	}
+	rsp, e := s.CancelSchedule(c, currentUid(c), req)
+	httpx.SendResponse(c, rsp, e)
+}
@@ -0,0 +1,230 @@
+package message
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+	maxDeleteCount      = 100
+)
+
+// readDiffusion 群聊是否读扩散，切换只影响之后发送的消息
+func readDiffusion() bool {
+	return cfg.AppConfig().MsgInfo.GroupDiffusion == cfg.DiffusionRead
+}
+
+// HistoryReq 拉取会话历史消息，锚点可以是seq或消息id，都不填时从最新或最早的消息开始
+type HistoryReq struct {
+	ConvID  string `form:"conv_id"`
+	Seq     uint64 `form:"seq"`     // 锚点seq，结果不包含锚点
+	MsgID   uint64 `form:"msg_id"`  // 锚点消息id，优先于seq
+	Forward bool   `form:"forward"` // true拉取锚点之后更新的消息，默认拉取更早的消息
+	Limit   int    `form:"limit"`
+}
+
+// HistoryRsp 历史消息，按seq升序，HasMore表示请求方向上是否还有更多
+type HistoryRsp struct {
+	Messages []*model.Message `json:"messages"`
+	HasMore  bool             `json:"has_more"`
+}
+
+// historyPage 按翻页规则取一段消息，结果按seq升序
+type historyPage func(ctx context.Context, anchor uint64, forward bool, limit int) ([]*model.Message, error)
+
+// History 拉取会话历史消息，撤回和编辑按当前状态返回，过滤掉用户自己删除的和已到期的消息
+func (s *Service) History(ctx context.Context, uid uint64, req *HistoryReq) (*HistoryRsp, error) {
+	if req.Limit <= 0 || req.Limit > maxHistoryLimit {
+		req.Limit = defaultHistoryLimit
+	}
+	typ, err := s.checkConv(ctx, uid, req.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	anchor := req.Seq
+	if req.MsgID != 0 {
+		msg, err := s.loadMsg(ctx, req.MsgID)
+		if err != nil {
+			return nil, err
+		}
+		if msg.ConvID != req.ConvID {
+			return nil, ierr.ErrParam
+		}
+		anchor = msg.Seq
+	}
+	page, since, err := s.historySource(ctx, uid, typ, req.ConvID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按请求方向收集，多取一条用于判断是否还有更多
+	var out []*model.Message
+	exhausted := false
+	now := time.Now().UnixMilli()
+	for !exhausted && len(out) <= req.Limit {
+		want := req.Limit + 1 - len(out)
+		batch, err := page(ctx, anchor, req.Forward, want)
+		if err != nil {
+			log.ErrorContextf(ctx, "list history fail, uid:%d, conv:%s, anchor:%d, err:%v", uid, req.ConvID, anchor, err)
+			return nil, ierr.ErrSystem
+		}
+		if len(batch) < want {
+			exhausted = true
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if !req.Forward {
+			reverse(batch)
+		}
+		anchor = batch[len(batch)-1].Seq
+		deleted, err := s.deleted(ctx, uid, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range batch {
+			// 读扩散时成员只能看到入群之后的消息
+			if msg.SendTime < since {
+				if !req.Forward {
+					exhausted = true
+					break
+				}
+				continue
+			}
+			if !deleted[msg.ID] && !msg.Expired() && !msg.Due(now) {
+				out = append(out, msg)
+			}
+		}
+	}
+
+	rsp := &HistoryRsp{HasMore: len(out) > req.Limit}
+	if rsp.HasMore {
+		out = out[:req.Limit]
+	}
+	if !req.Forward {
+		reverse(out)
+	}
+	for _, msg := range out {
+		s.resolveRef(ctx, msg)
+	}
+	rsp.Messages = out
+	if rsp.Messages == nil {
+		rsp.Messages = []*model.Message{}
+	}
+	return rsp, nil
+}
+
+// historySource 群聊写扩散时读成员自己的会话索引，其余读会话消息；since为可见消息的最早发送时间
+func (s *Service) historySource(ctx context.Context, uid uint64, typ model.ConvType, convID string) (historyPage, int64, error) {
+	byConv := func(ctx context.Context, anchor uint64, forward bool, limit int) ([]*model.Message, error) {
+		return s.store.Message.List(ctx, convID, anchor, forward, limit)
+	}
+	if typ != model.ConvGroup {
+		return byConv, 0, nil
+	}
+	if readDiffusion() {
+		_, ids, _ := model.ParseConvID(convID)
+		member, err := s.store.Group.Member(ctx, ids[0], uid)
+		if err != nil {
+			log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", ids[0], uid, err)
+			return nil, 0, ierr.ErrSystem
+		}
+		return byConv, member.JoinTime, nil
+	}
+	byUser := func(ctx context.Context, anchor uint64, forward bool, limit int) ([]*model.Message, error) {
+		ids, err := s.store.Timeline.List(ctx, uid, convID, anchor, forward, limit)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]*model.Message, 0, len(ids))
+		for _, id := range ids {
+			msg, err := s.store.Message.Get(ctx, id)
+			if err == store.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, msg)
+		}
+		return list, nil
+	}
+	return byUser, 0, nil
+}
+
+// deleted 返回列表中被用户自己删除的消息
+func (s *Service) deleted(ctx context.Context, uid uint64, msgs []*model.Message) (map[uint64]bool, error) {
+	ids := make([]uint64, 0, len(msgs))
+	for _, msg := range msgs {
+		ids = append(ids, msg.ID)
+	}
+	deleted, err := s.store.Deletion.Filter(ctx, uid, ids)
+	if err != nil {
+		log.ErrorContextf(ctx, "filter deleted msgs fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	return deleted, nil
+}
+
+func reverse(msgs []*model.Message) {
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+}
+
+// DeleteReq 仅对自己删除消息
+type DeleteReq struct {
+	MsgIDs []string `json:"msg_ids"`
+}
+
+// DeleteRsp .
+type DeleteRsp struct{}
+
+// Delete 仅对自己删除消息，其他成员不受影响，删除事件同步到用户的其他端
+func (s *Service) Delete(ctx context.Context, uid uint64, req *DeleteReq) (*DeleteRsp, error) {
+	if len(req.MsgIDs) == 0 || len(req.MsgIDs) > maxDeleteCount {
+		return nil, ierr.ErrParam
+	}
+	msgs := make([]*model.Message, 0, len(req.MsgIDs))
+	ids := make([]uint64, 0, len(req.MsgIDs))
+	for _, raw := range req.MsgIDs {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, ierr.ErrParam
+		}
+		msg, err := s.loadMsg(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkView(ctx, uid, msg); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+		ids = append(ids, id)
+	}
+	if err := s.store.Deletion.Add(ctx, uid, ids); err != nil {
+		log.ErrorContextf(ctx, "add deletion fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	now := time.Now().UnixMilli()
+	for _, msg := range msgs {
+		s.notify(ctx, []uint64{uid}, &model.Event{
+			Type:     model.EventDelete,
+			ConvID:   msg.ConvID,
+			MsgID:    msg.ID,
+			Operator: uid,
+			Time:     now,
+		})
+	}
+	log.InfoContextf(ctx, "delete msgs for self, uid:%d, count:%d", uid, len(ids))
+	return &DeleteRsp{}, nil
+}
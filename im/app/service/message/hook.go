@@ -0,0 +1,68 @@
+package message
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+var commandRegexp = regexp.MustCompile(`(?s)^/([A-Za-z0-9_-]{1,32})(?:\s+(.*))?$`)
+
+// parseCommand 解析 /name args 格式的斜杠命令，命令名不区分大小写
+func parseCommand(msg *model.Message) *model.Command {
+	if msg.Type != model.MsgText {
+		return nil
+	}
+	m := commandRegexp.FindStringSubmatch(strings.TrimSpace(msg.Content))
+	if m == nil {
+		return nil
+	}
+	return &model.Command{Name: strings.ToLower(m[1]), Args: strings.TrimSpace(m[2])}
+}
+
+// isBot 发送者是否是机器人
+func (s *Service) isBot(ctx context.Context, uid uint64) (bool, error) {
+	_, err := s.store.Bot.Get(ctx, uid)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// hookMessage 消息投递后为会话中的机器人生成出站事件，斜杠命令只推给处理该命令的机器人，加密消息不推送
+func (s *Service) hookMessage(ctx context.Context, msg *model.Message, uids []uint64) {
+	if msg.Type == model.MsgCipher {
+		return
+	}
+	bots, err := s.store.Bot.Bots(ctx, uids)
+	if err != nil {
+		log.ErrorContextf(ctx, "get conv bots fail, conv:%s, err:%v", msg.ConvID, err)
+		return
+	}
+	cmd := parseCommand(msg)
+	for _, b := range bots {
+		if b.Uid == msg.Sender {
+			continue
+		}
+		ev := &model.HookEvent{
+			ID:      s.ids.Next(),
+			Type:    model.HookMessage,
+			Bot:     b.Uid,
+			ConvID:  msg.ConvID,
+			Message: msg,
+			Time:    msg.SendTime,
+		}
+		if cmd != nil && b.HasCommand(cmd.Name) {
+			ev.Type, ev.Command = model.HookCommand, cmd
+		} else if !b.Subscribed(model.HookMessage) {
+			continue
+		}
+		if err = s.store.Hook.Enqueue(ctx, model.NewHookDelivery(ev)); err != nil {
+			log.ErrorContextf(ctx, "enqueue hook event fail, bot:%d, msg:%d, err:%v", b.Uid, msg.ID, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/ratelimit"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// newDupDetector 按配置的窗口创建重复内容检测
+func newDupDetector() *ratelimit.DupDetector {
+	window := 60
+	if info := cfg.AppConfig().LimitInfo; info != nil {
+		window = info.DupWindow
+	}
+	return ratelimit.NewDupDetector(time.Duration(window) * time.Second)
+}
+
+func limitOf(l *cfg.RateLimit) ratelimit.Limit {
+	if l == nil {
+		return ratelimit.Limit{}
+	}
+	return ratelimit.Limit{Rate: l.Rate, Burst: l.Burst}
+}
+
+// checkRate 发送前检查禁言、限流和群发重复内容，判定为垃圾消息时自动禁言并记录待复核
+// 机器人使用单独的更宽松的限流，告警等集成的突发消息不做重复内容检测
+func (s *Service) checkRate(ctx context.Context, msg *model.Message) error {
+	info := cfg.AppConfig().LimitInfo
+	if info == nil {
+		return nil
+	}
+	now := time.Now()
+	until, err := s.store.Mute.Until(ctx, msg.Sender)
+	if err != nil {
+		log.ErrorContextf(ctx, "get mute fail, uid:%d, err:%v", msg.Sender, err)
+		return ierr.ErrSystem
+	}
+	if left := time.UnixMilli(until).Sub(now); left > 0 {
+		return ierr.RateLimited(left)
+	}
+	bot, err := s.isBot(ctx, msg.Sender)
+	if err != nil {
+		log.ErrorContextf(ctx, "get bot fail, uid:%d, err:%v", msg.Sender, err)
+		return ierr.ErrSystem
+	}
+	if bot {
+		req := ratelimit.Req{Key: "bot:" + strconv.FormatUint(msg.Sender, 10), Limit: limitOf(info.Bot)}
+		if ok, wait := s.limiter.Allow(now, req); !ok {
+			return ierr.RateLimited(wait)
+		}
+		return nil
+	}
+
+	reqs, err := s.limitReqs(ctx, msg, info, now)
+	if err != nil {
+		return err
+	}
+	if ok, wait := s.limiter.Allow(now, reqs...); !ok {
+		// 每次被限流消耗一个刷屏令牌，短时间内耗尽说明在持续刷屏
+		strike := ratelimit.Req{
+			Key:   "strike:" + strconv.FormatUint(msg.Sender, 10),
+			Limit: ratelimit.Limit{Rate: float64(info.Strikes) / 60, Burst: info.Strikes},
+		}
+		if ok, _ = s.limiter.Allow(now, strike); !ok {
+			return s.muteSpammer(ctx, msg, info, "持续刷屏")
+		}
+		return ierr.RateLimited(wait)
+	}
+
+	if text := searchText(msg); utf8.RuneCountInString(text) >= info.DupMinLen {
+		if n := s.dups.Add(msg.Sender, text, msg.ConvID, now); n >= info.DupConvs {
+			return s.muteSpammer(ctx, msg, info, fmt.Sprintf("相同内容发往%d个会话", n))
+		}
+	}
+	return nil
+}
+
+// limitReqs 发送者需要满足的令牌桶：按会话类型限制，新账号和发给非好友时叠加更严格的限制
+func (s *Service) limitReqs(ctx context.Context, msg *model.Message, info *cfg.LimitInfo, now time.Time) ([]ratelimit.Req, error) {
+	uid := strconv.FormatUint(msg.Sender, 10)
+	reqs := []ratelimit.Req{{Key: "single:" + uid, Limit: limitOf(info.Single)}}
+	if msg.ConvType == model.ConvGroup {
+		reqs = []ratelimit.Req{{Key: "group:" + uid, Limit: limitOf(info.Group)}}
+	}
+
+	user, err := s.store.User.Get(ctx, msg.Sender)
+	if err != nil && err != store.ErrNotFound {
+		log.ErrorContextf(ctx, "get user fail, uid:%d, err:%v", msg.Sender, err)
+		return nil, ierr.ErrSystem
+	}
+	if user != nil && now.Sub(time.UnixMilli(user.CreateTime)) < time.Duration(info.NewAccountHours)*time.Hour {
+		reqs = append(reqs, ratelimit.Req{Key: "new:" + uid, Limit: limitOf(info.NewAccount)})
+	}
+
+	if msg.ConvType == model.ConvSingle && msg.Receiver != msg.Sender {
+		friend, err := s.store.Friend.IsFriend(ctx, msg.Sender, msg.Receiver)
+		if err != nil {
+			log.ErrorContextf(ctx, "check friend fail, uid:%d, to:%d, err:%v", msg.Sender, msg.Receiver, err)
+			return nil, ierr.ErrSystem
+		}
+		if !friend {
+			reqs = append(reqs, ratelimit.Req{Key: "stranger:" + uid, Limit: limitOf(info.Stranger)})
+		}
+	}
+	return reqs, nil
+}
+
+// muteSpammer 自动禁言发送者并记录待复核
+func (s *Service) muteSpammer(ctx context.Context, msg *model.Message, info *cfg.LimitInfo, reason string) error {
+	mute := time.Duration(info.MuteTime) * time.Second
+	now := time.Now()
+	if err := s.store.Mute.Mute(ctx, msg.Sender, now.Add(mute).UnixMilli()); err != nil {
+		log.ErrorContextf(ctx, "mute spammer fail, uid:%d, err:%v", msg.Sender, err)
+		return ierr.ErrSystem
+	}
+	rec := &model.ReviewRecord{
+		MsgID:   msg.ID,
+		ConvID:  msg.ConvID,
+		Sender:  msg.Sender,
+		Type:    msg.Type,
+		Content: msg.Content,
+		Reason:  reason,
+		Time:    now.UnixMilli(),
+	}
+	if err := s.store.Review.Record(ctx, rec); err != nil {
+		log.ErrorContextf(ctx, "record review fail, uid:%d, err:%v", msg.Sender, err)
+	}
+	log.WarnContextf(ctx, "spammer muted, uid:%d, reason:%s, duration:%v", msg.Sender, reason, mute)
+	return ierr.RateLimited(mute)
+}
@@ -0,0 +1,29 @@
+package message
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+func TestMain(m *testing.M) {
+	cfg.Init("../../etc/config.yaml")
+	dir, err := os.MkdirTemp("", "message")
+	if err != nil {
+		panic(err)
+	}
+	log.InitLogger(filepath.Join(dir, "test.log"), 10, 1, 1, 0, 1)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestService 使用独立内存存储的消息服务
+func newTestService() (*Service, *store.Store) {
+	st := store.NewMemStore()
+	return New(WithStore(st)), st
+}
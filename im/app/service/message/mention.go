@@ -0,0 +1,140 @@
+package message
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// mentionRegexp 匹配文本中的@uid和@all
+var mentionRegexp = regexp.MustCompile(`@(all|\d+)\b`)
+
+// parseMentions 解析文本中@的用户，结果去重
+func parseMentions(content string) ([]uint64, bool) {
+	var (
+		uids []uint64
+		all  bool
+		seen = make(map[uint64]bool)
+	)
+	for _, m := range mentionRegexp.FindAllStringSubmatch(content, -1) {
+		if m[1] == "all" {
+			all = true
+			continue
+		}
+		uid, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil || uid == 0 || seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		uids = append(uids, uid)
+	}
+	return uids, all
+}
+
+// attachMentions 解析群文本和富文本消息中的@，富文本按纯文本渲染解析，只保留群成员，@all仅群主和管理员可用
+func (s *Service) attachMentions(ctx context.Context, sender *model.GroupMember, msg *model.Message) error {
+	var text string
+	switch msg.Type {
+	case model.MsgText:
+		text = msg.Content
+	case model.MsgRich:
+		text = msg.Plain
+	default:
+		return nil
+	}
+	uids, all := parseMentions(text)
+	if all && !sender.IsManager() {
+		return ierr.ErrMentionAllPerm
+	}
+	msg.MentionAll = all
+	for _, uid := range uids {
+		if uid == sender.Uid {
+			continue
+		}
+		if _, err := s.store.Group.Member(ctx, msg.GroupID, uid); err != nil {
+			continue
+		}
+		msg.Mentions = append(msg.Mentions, uid)
+	}
+	return nil
+}
+
+// notifyMentions 给被@的用户打上会话标记，并发送高优先级提醒，免打扰时同样提醒
+func (s *Service) notifyMentions(ctx context.Context, msg *model.Message, members []uint64) {
+	targets := msg.Mentions
+	if msg.MentionAll {
+		targets = members
+	}
+	mention := &model.Mention{
+		ConvID: msg.ConvID,
+		MsgID:  msg.ID,
+		Seq:    msg.Seq,
+		Sender: msg.Sender,
+		All:    msg.MentionAll,
+		Time:   msg.SendTime,
+	}
+	uids := make([]uint64, 0, len(targets))
+	for _, uid := range targets {
+		if uid == msg.Sender {
+			continue
+		}
+		if err := s.store.Mention.Add(ctx, uid, mention); err != nil {
+			log.ErrorContextf(ctx, "add mention fail, uid:%d, msg:%d, err:%v", uid, msg.ID, err)
+			continue
+		}
+		uids = append(uids, uid)
+	}
+	ev := &model.Event{
+		Type:     model.EventMention,
+		ConvID:   msg.ConvID,
+		MsgID:    msg.ID,
+		Operator: msg.Sender,
+		Time:     msg.SendTime,
+		Priority: model.PriorityHigh,
+	}
+	if err := s.pusher.Push(ctx, uids, ev); err != nil {
+		log.WarnContextf(ctx, "push mention fail, msg:%d, err:%v", msg.ID, err)
+	}
+}
+
+// ReadReq 上报会话已读
+type ReadReq struct {
+	ConvID string `json:"conv_id"`
+	Seq    uint64 `json:"seq"` // 已读到的会话seq
+}
+
+// ReadRsp 已读回包
+type ReadRsp struct{}
+
+// Read 会话已读到seq，清除该范围内的@标记并更新会话未读数，阅后即焚的消息开始倒计时
+func (s *Service) Read(ctx context.Context, uid uint64, req *ReadReq) (*ReadRsp, error) {
+	if _, err := s.checkConv(ctx, uid, req.ConvID); err != nil {
+		return nil, err
+	}
+	if err := s.store.Mention.Clear(ctx, uid, req.ConvID, req.Seq); err != nil {
+		log.ErrorContextf(ctx, "clear mention fail, uid:%d, conv:%s, err:%v", uid, req.ConvID, err)
+		return nil, ierr.ErrSystem
+	}
+	s.convs.Read(ctx, uid, req.ConvID, req.Seq)
+	s.startTTL(ctx, uid, req.ConvID, req.Seq)
+	return &ReadRsp{}, nil
+}
+
+// MentionsRsp 当前用户未读的@标记
+type MentionsRsp struct {
+	Mentions []*model.Mention `json:"mentions"`
+}
+
+// Mentions 查询当前用户未读的@标记
+func (s *Service) Mentions(ctx context.Context, uid uint64) (*MentionsRsp, error) {
+	list, err := s.store.Mention.List(ctx, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list mentions fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	return &MentionsRsp{Mentions: list}, nil
+}
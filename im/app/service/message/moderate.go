@@ -0,0 +1,160 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/moderation"
+)
+
+// newFilter 按配置创建敏感词过滤器并加载词表
+func newFilter() *moderation.Filter {
+	info := cfg.AppConfig().ModerationInfo
+	if info == nil {
+		return moderation.NewFilter("", moderation.ActionBlock, '*')
+	}
+	action, ok := moderation.ParseAction(info.DefaultAction)
+	if !ok {
+		action = moderation.ActionBlock
+	}
+	mask := '*'
+	if r := []rune(info.Mask); len(r) > 0 {
+		mask = r[0]
+	}
+	f := moderation.NewFilter(info.WordFile, action, mask)
+	if err := f.Load(); err != nil {
+		log.Errorf("load sensitive words fail, file:%s, err:%v", info.WordFile, err)
+	}
+	return f
+}
+
+// WatchWords 定期检查敏感词表变化，ctx结束后退出
+func (s *Service) WatchWords(ctx context.Context, interval time.Duration) {
+	s.filter.Watch(ctx, interval)
+}
+
+// moderate 消息落地前审核：先过敏感词，再送外部审核
+// 拦截时返回ErrContentBlocked，掩码时改写消息内容，标记时记录待复核
+func (s *Service) moderate(ctx context.Context, msg *model.Message) error {
+	res, err := s.checkWords(msg)
+	if err != nil {
+		return err
+	}
+	ext := s.checkExternal(ctx, msg)
+	if ext.Action == moderation.ActionMask {
+		ext.Action = moderation.ActionBlock
+	}
+	action := res.Action
+	if ext.Action > action {
+		action = ext.Action
+	}
+	switch action {
+	case moderation.ActionBlock:
+		log.InfoContextf(ctx, "msg blocked, sender:%d, conv:%s, words:%v, reason:%s",
+			msg.Sender, msg.ConvID, res.Words, ext.Reason)
+		return ierr.ErrContentBlocked
+	case moderation.ActionPass:
+		return nil
+	}
+	if res.Action == moderation.ActionFlag || ext.Action == moderation.ActionFlag {
+		rec := &model.ReviewRecord{
+			MsgID:   msg.ID,
+			ConvID:  msg.ConvID,
+			Sender:  msg.Sender,
+			Type:    msg.Type,
+			Content: msg.Content,
+			Words:   res.Words,
+			Reason:  ext.Reason,
+			Time:    time.Now().UnixMilli(),
+		}
+		if err = s.store.Review.Record(ctx, rec); err != nil {
+			log.ErrorContextf(ctx, "record review fail, msg:%d, err:%v", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+// checkWords 按消息类型过滤可见文本，掩码直接改写内容
+// 自定义消息的负载是结构化数据，合并转发是原消息的快照，都不做掩码，命中掩码的词按拦截处理
+func (s *Service) checkWords(msg *model.Message) (*moderation.Result, error) {
+	switch msg.Type {
+	case model.MsgText:
+		res := s.filter.Check(msg.Content)
+		if res.Action == moderation.ActionMask {
+			msg.Content = res.Text
+		}
+		return res, nil
+	case model.MsgRich:
+		c := &model.RichContent{}
+		if err := json.Unmarshal([]byte(msg.Content), c); err != nil {
+			return nil, ierr.ErrSystem
+		}
+		res := s.filter.Check(c.Markdown)
+		if res.Action == moderation.ActionMask {
+			msg.Content = res.Text
+			if err := s.prepareRich(msg); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case model.MsgFile:
+		c := &model.FileContent{}
+		if err := json.Unmarshal([]byte(msg.Content), c); err != nil {
+			return nil, ierr.ErrSystem
+		}
+		res := s.filter.Check(c.Name)
+		if res.Action == moderation.ActionMask {
+			c.Name = res.Text
+			if err := setContent(msg, c); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case model.MsgCustom:
+		c := &model.CustomContent{}
+		if err := json.Unmarshal([]byte(msg.Content), c); err != nil {
+			return nil, ierr.ErrSystem
+		}
+		res := s.filter.Check(c.Fallback + "\n" + string(c.Payload))
+		if res.Action == moderation.ActionMask {
+			res.Action = moderation.ActionBlock
+		}
+		return res, nil
+	case model.MsgMerged:
+		res := s.filter.Check(msg.Plain)
+		if res.Action == moderation.ActionMask {
+			res.Action = moderation.ActionBlock
+		}
+		return res, nil
+	}
+	return &moderation.Result{}, nil
+}
+
+// checkExternal 送外部审核，审核服务出错时放行，避免影响正常收发
+func (s *Service) checkExternal(ctx context.Context, msg *model.Message) *moderation.Result {
+	c := &moderation.Content{MsgType: msg.Type, Text: searchText(msg)}
+	if msg.MediaID != 0 {
+		m, err := s.store.Media.Get(ctx, msg.MediaID)
+		if err != nil {
+			log.WarnContextf(ctx, "get media for moderation fail, id:%d, err:%v", msg.MediaID, err)
+		} else {
+			c.Media = m
+			c.URL = media.StoreURL(ctx, s.blobs.Media)(m.Path)
+		}
+	}
+	if c.Text == "" && c.Media == nil {
+		return &moderation.Result{}
+	}
+	res, err := s.checker.Check(ctx, c)
+	if err != nil || res == nil {
+		log.WarnContextf(ctx, "external moderation fail, sender:%d, type:%d, err:%v", msg.Sender, msg.Type, err)
+		return &moderation.Result{}
+	}
+	return res
+}
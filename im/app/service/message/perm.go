@@ -0,0 +1,151 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// loadMsg 获取消息，区分不存在和系统错误，已到期的消息不论是否已被清理都视为不存在
+func (s *Service) loadMsg(ctx context.Context, msgID uint64) (*model.Message, error) {
+	msg, err := s.store.Message.Get(ctx, msgID)
+	if err == store.ErrNotFound || err == nil && (msg.Expired() || msg.Due(time.Now().UnixMilli())) {
+		return nil, ierr.ErrMsgNotFound
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get msg fail, id:%d, err:%v", msgID, err)
+		return nil, ierr.ErrSystem
+	}
+	return msg, nil
+}
+
+// errNoChange updateMsg的修改函数返回该错误表示最新状态下不需要修改
+var errNoChange = errors.New("msg unchanged")
+
+const maxUpdateRetry = 3
+
+// updateMsg 在读到的消息上调用fn修改后条件更新，期间被其他请求修改时重新读取最新状态再调用fn，
+// 撤回、编辑、到期等并发的修改不会互相覆盖。fn返回的错误原样返回，消息已不存在时返回ErrMsgNotFound，
+// 多次冲突时返回ErrMsgConflict
+func (s *Service) updateMsg(ctx context.Context, msg *model.Message, fn func(msg *model.Message) error) (*model.Message, error) {
+	cur := msg.Clone()
+	for i := 0; ; i++ {
+		if err := fn(cur); err != nil {
+			return nil, err
+		}
+		err := s.store.Message.UpdateIf(ctx, cur)
+		if err == nil {
+			return cur, nil
+		}
+		if err == store.ErrNotFound {
+			return nil, ierr.ErrMsgNotFound
+		}
+		if err != store.ErrConflict {
+			log.ErrorContextf(ctx, "update msg fail, id:%d, err:%v", msg.ID, err)
+			return nil, ierr.ErrSystem
+		}
+		if i+1 == maxUpdateRetry {
+			log.WarnContextf(ctx, "update msg conflict, id:%d", msg.ID)
+			return nil, ierr.ErrMsgConflict
+		}
+		if cur, err = s.store.Message.Get(ctx, msg.ID); err != nil {
+			if err == store.ErrNotFound {
+				return nil, ierr.ErrMsgNotFound
+			}
+			log.ErrorContextf(ctx, "get msg fail, id:%d, err:%v", msg.ID, err)
+			return nil, ierr.ErrSystem
+		}
+	}
+}
+
+// checkModify 校验uid是否可以修改(撤回、编辑)消息
+// 发送者在window时间内可操作，群主和管理员不受时间限制，发送者超时返回lateErr
+func (s *Service) checkModify(ctx context.Context, uid uint64, msg *model.Message, window time.Duration, lateErr error) error {
+	if uid == msg.Sender && time.Since(time.UnixMilli(msg.SendTime)) <= window {
+		return nil
+	}
+	if msg.ConvType == model.ConvGroup {
+		member, err := s.store.Group.Member(ctx, msg.GroupID, uid)
+		if err != nil && err != store.ErrNotFound {
+			log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", msg.GroupID, uid, err)
+			return ierr.ErrSystem
+		}
+		if member != nil && member.IsManager() {
+			return nil
+		}
+	}
+	if uid == msg.Sender {
+		return lateErr
+	}
+	return ierr.ErrMsgNoPerm
+}
+
+// checkView 校验uid是否是消息所在会话的成员
+func (s *Service) checkView(ctx context.Context, uid uint64, msg *model.Message) error {
+	if msg.ConvType == model.ConvSingle {
+		if uid == msg.Sender || uid == msg.Receiver {
+			return nil
+		}
+		return ierr.ErrMsgNoPerm
+	}
+	_, err := s.store.Group.Member(ctx, msg.GroupID, uid)
+	if err == store.ErrNotFound {
+		return ierr.ErrMsgNoPerm
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", msg.GroupID, uid, err)
+		return ierr.ErrSystem
+	}
+	return nil
+}
+
+// ViewMedia 校验uid能否查看消息，且消息引用了该媒体记录，供媒体服务刷新访问地址
+func (s *Service) ViewMedia(ctx context.Context, uid, msgID, mediaID uint64) error {
+	msg, err := s.loadMsg(ctx, msgID)
+	if err != nil {
+		return err
+	}
+	if err = s.checkView(ctx, uid, msg); err != nil {
+		return err
+	}
+	if msg.Recalled() {
+		return ierr.ErrMsgRecalled
+	}
+	if msg.MediaID == mediaID {
+		return nil
+	}
+	for _, id := range msg.Media {
+		if id == mediaID {
+			return nil
+		}
+	}
+	return ierr.ErrMediaNotFound
+}
+
+// checkConv 校验uid是否是会话成员，返回会话类型
+func (s *Service) checkConv(ctx context.Context, uid uint64, convID string) (model.ConvType, error) {
+	typ, ids, ok := model.ParseConvID(convID)
+	if !ok {
+		return 0, ierr.ErrParam
+	}
+	if typ == model.ConvSingle {
+		if uid != ids[0] && uid != ids[1] {
+			return 0, ierr.ErrConvNoPerm
+		}
+		return typ, nil
+	}
+	_, err := s.store.Group.Member(ctx, ids[0], uid)
+	if err == store.ErrNotFound {
+		return 0, ierr.ErrConvNoPerm
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", ids[0], uid, err)
+		return 0, ierr.ErrSystem
+	}
+	return typ, nil
+}
@@ -0,0 +1,201 @@
+package message
+
+import (
+	"context"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const maxEmojiLen = 16 // 单个表情最多的字符数，兼容组合emoji
+
+// emojiTable 可以单独作为表情的字符，覆盖常用的emoji区段
+var emojiTable = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21a9, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1},
+		{Lo: 0x2328, Hi: 0x23cf, Stride: 167},
+		{Lo: 0x23e9, Hi: 0x23f3, Stride: 1},
+		{Lo: 0x23f8, Hi: 0x23fa, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25ab, Stride: 1},
+		{Lo: 0x25b6, Hi: 0x25c0, Stride: 10},
+		{Lo: 0x25fb, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b07, Stride: 1},
+		{Lo: 0x2b1b, Hi: 0x2b1c, Stride: 1},
+		{Lo: 0x2b50, Hi: 0x2b55, Stride: 5},
+		{Lo: 0x3030, Hi: 0x303d, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1faff, Stride: 1},
+	},
+}
+
+// isEmoji 是否是单个emoji，允许肤色、变体选择符、零宽连接符组合的emoji，以及国旗和键帽序列
+func isEmoji(s string) bool {
+	runes := []rune(s)
+	pictured := false
+	for i, r := range runes {
+		switch {
+		case unicode.Is(emojiTable, r):
+			pictured = true
+		case r == 0x200d || r == 0xfe0e || r == 0xfe0f || r >= 0xe0020 && r <= 0xe007f:
+			// 连接符、变体选择符和旗帜标签只能跟在其他字符之后
+			if i == 0 {
+				return false
+			}
+		case r == 0x20e3:
+			if i == 0 {
+				return false
+			}
+			pictured = true
+		case r >= '0' && r <= '9' || r == '#' || r == '*':
+			// 键帽序列的数字后面必须跟变体选择符或键帽符
+			if i+1 >= len(runes) || runes[i+1] != 0xfe0f && runes[i+1] != 0x20e3 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return pictured
+}
+
+// ReactReq 添加或取消表情回应
+type ReactReq struct {
+	MsgID uint64 `json:"msg_id,string"`
+	Emoji string `json:"emoji"`
+}
+
+// ReactRsp 回应后该表情的数量
+type ReactRsp struct {
+	Count int `json:"count"`
+}
+
+// AddReaction 添加表情回应
+func (s *Service) AddReaction(ctx context.Context, uid uint64, req *ReactReq) (*ReactRsp, error) {
+	msg, err := s.checkReact(ctx, uid, req)
+	if err != nil {
+		return nil, err
+	}
+	info := cfg.AppConfig().MsgInfo
+	added, count, err := s.store.Reaction.Add(ctx, msg.ID, req.Emoji, uid, info.MaxEmojis, info.MaxUserEmojis)
+	if err == store.ErrLimit {
+		return nil, ierr.ErrReactionLimit
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "add reaction fail, msg:%d, uid:%d, err:%v", msg.ID, uid, err)
+		return nil, ierr.ErrSystem
+	}
+	if added {
+		s.pushReaction(ctx, msg, &model.ReactionDelta{Emoji: req.Emoji, Uid: uid, Added: true, Count: count})
+	}
+	return &ReactRsp{Count: count}, nil
+}
+
+// RemoveReaction 取消表情回应
+func (s *Service) RemoveReaction(ctx context.Context, uid uint64, req *ReactReq) (*ReactRsp, error) {
+	msg, err := s.checkReact(ctx, uid, req)
+	if err != nil {
+		return nil, err
+	}
+	removed, count, err := s.store.Reaction.Remove(ctx, msg.ID, req.Emoji, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "remove reaction fail, msg:%d, uid:%d, err:%v", msg.ID, uid, err)
+		return nil, ierr.ErrSystem
+	}
+	if removed {
+		s.pushReaction(ctx, msg, &model.ReactionDelta{Emoji: req.Emoji, Uid: uid, Count: count})
+	}
+	return &ReactRsp{Count: count}, nil
+}
+
+// checkReact 校验回应请求，返回被回应的消息
+func (s *Service) checkReact(ctx context.Context, uid uint64, req *ReactReq) (*model.Message, error) {
+	if utf8.RuneCountInString(req.Emoji) > maxEmojiLen || !isEmoji(req.Emoji) {
+		return nil, ierr.ErrParam
+	}
+	msg, err := s.loadMsg(ctx, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkView(ctx, uid, msg); err != nil {
+		return nil, err
+	}
+	if msg.Recalled() {
+		return nil, ierr.ErrMsgRecalled
+	}
+	return msg, nil
+}
+
+// pushReaction 回应变化只做在线推送，不写收件箱也不计未读，离线的客户端通过Reactions拉取
+func (s *Service) pushReaction(ctx context.Context, msg *model.Message, delta *model.ReactionDelta) {
+	uids, err := s.recipients(ctx, msg)
+	if err != nil {
+		log.ErrorContextf(ctx, "get recipients fail, msg:%d, err:%v", msg.ID, err)
+		return
+	}
+	ev := &model.Event{
+		Type:     model.EventReaction,
+		ConvID:   msg.ConvID,
+		MsgID:    msg.ID,
+		Operator: delta.Uid,
+		Time:     time.Now().UnixMilli(),
+		Reaction: delta,
+	}
+	if err = s.pusher.Push(ctx, uids, ev); err != nil {
+		log.WarnContextf(ctx, "push reaction fail, msg:%d, err:%v", msg.ID, err)
+	}
+}
+
+// ReactionsReq 查询消息的表情回应
+type ReactionsReq struct {
+	MsgID uint64 `form:"msg_id"`
+}
+
+// ReactionsRsp 表情回应汇总
+type ReactionsRsp struct {
+	Reactions []*model.Reaction `json:"reactions"`
+}
+
+// Reactions 查询消息的表情回应汇总，包含当前用户是否回应，回应用户列表有上限
+func (s *Service) Reactions(ctx context.Context, uid uint64, req *ReactionsReq) (*ReactionsRsp, error) {
+	msg, err := s.loadMsg(ctx, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkView(ctx, uid, msg); err != nil {
+		return nil, err
+	}
+	list, err := s.store.Reaction.List(ctx, msg.ID)
+	if err != nil {
+		log.ErrorContextf(ctx, "list reactions fail, msg:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	limit := cfg.AppConfig().MsgInfo.MaxReactors
+	for _, r := range list {
+		for _, u := range r.Reactors {
+			if u == uid {
+				r.Reacted = true
+				break
+			}
+		}
+		if len(r.Reactors) > limit {
+			r.Reactors = r.Reactors[:limit]
+		}
+	}
+	return &ReactionsRsp{Reactions: list}, nil
+}
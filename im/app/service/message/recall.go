@@ -0,0 +1,99 @@
+package message
+
+import (
+	"context"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// RecallReq 撤回消息请求
+type RecallReq struct {
+	MsgID uint64 `json:"msg_id,string"`
+}
+
+// RecallRsp 撤回消息回包
+type RecallRsp struct {
+	RecallTime int64 `json:"recall_time"`
+}
+
+// Recall 撤回消息，发送者在可撤回时间内可撤回，群主和管理员可撤回群内任意消息
+func (s *Service) Recall(ctx context.Context, uid uint64, req *RecallReq) (*RecallRsp, error) {
+	msg, err := s.loadMsg(ctx, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Recalled() {
+		return nil, ierr.ErrMsgRecalled
+	}
+	window := time.Duration(cfg.AppConfig().MsgInfo.RecallWindow) * time.Second
+	if err = s.checkModify(ctx, uid, msg, window, ierr.ErrMsgRecallLate); err != nil {
+		return nil, err
+	}
+
+	// 条件更新，不会覆盖并发的编辑或到期清理，到期后也不会恢复出内容
+	now := time.Now().UnixMilli()
+	var origin *model.Message
+	msg, err = s.updateMsg(ctx, msg, func(m *model.Message) error {
+		switch {
+		case m.Recalled():
+			return ierr.ErrMsgRecalled
+		case m.Expired() || m.Due(now):
+			return ierr.ErrMsgNotFound
+		}
+		origin = m.Clone()
+		m.Content, m.Plain, m.HTML = "", "", ""
+		m.Mentions, m.MentionAll = nil, false
+		m.Status = model.MsgRecalled
+		m.RecallTime = now
+		m.RecallBy = uid
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.indexMsg(msg)
+
+	// 未开启审计时原文不保留，编辑历史一并删除
+	if !s.auditRecall(ctx, uid, origin) && origin.Edited() {
+		if err = s.store.Revision.Delete(ctx, msg.ID); err != nil {
+			log.ErrorContextf(ctx, "delete revisions fail, id:%d, err:%v", msg.ID, err)
+		}
+	}
+
+	uids, err := s.recipients(ctx, msg)
+	if err != nil {
+		log.ErrorContextf(ctx, "get recipients fail, msg:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	s.convs.Refresh(ctx, msg, uids)
+	if len(origin.Mentions) > 0 || origin.MentionAll {
+		s.convs.Unmention(ctx, origin, uids)
+	}
+	s.notify(ctx, uids, &model.Event{
+		Type:     model.EventRecall,
+		ConvID:   msg.ConvID,
+		MsgID:    msg.ID,
+		Operator: uid,
+		Time:     now,
+		Message:  msg,
+	})
+	log.InfoContextf(ctx, "recall msg done, id:%d, operator:%d", msg.ID, uid)
+	return &RecallRsp{RecallTime: now}, nil
+}
+
+// auditRecall 租户开启审计时保留撤回前的原文，返回是否需要保留
+func (s *Service) auditRecall(ctx context.Context, uid uint64, msg *model.Message) bool {
+	tenant := s.tenant(ctx, msg.Sender)
+	if tenant == nil || !tenant.AuditRecall {
+		return false
+	}
+	rec := &model.AuditRecord{Msg: msg.Clone(), Operator: uid, Time: time.Now().UnixMilli()}
+	if err := s.store.Audit.Record(ctx, rec); err != nil {
+		log.ErrorContextf(ctx, "audit recalled msg fail, id:%d, err:%v", msg.ID, err)
+	}
+	return true
+}
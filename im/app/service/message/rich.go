@@ -0,0 +1,35 @@
+package message
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/richtext"
+)
+
+// prepareRich 解析Markdown并过滤，内容替换为语法树和由它重新生成的Markdown，同时生成纯文本和html渲染
+func (s *Service) prepareRich(msg *model.Message) error {
+	info := cfg.AppConfig().MsgInfo
+	// 原文按渲染上限的4倍限制，先挡住明显超长的输入再解析
+	if len(msg.Content) > info.MaxRichText*4 {
+		return ierr.ErrMsgTooLong
+	}
+	doc := richtext.Parse(msg.Content, &richtext.Options{Schemes: info.LinkSchemes})
+	plain := richtext.PlainText(doc)
+	if strings.TrimSpace(plain) == "" {
+		return ierr.ErrParam
+	}
+	if utf8.RuneCountInString(plain) > info.MaxRichText {
+		return ierr.ErrMsgTooLong
+	}
+	// 原文可能带有被过滤掉的html和链接，下发的是由语法树重新生成的Markdown
+	if err := setContent(msg, &model.RichContent{Markdown: richtext.Markdown(doc), Doc: doc}); err != nil {
+		return err
+	}
+	msg.Plain = plain
+	msg.HTML = richtext.HTML(doc)
+	return nil
+}
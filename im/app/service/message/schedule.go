@@ -0,0 +1,410 @@
+package message
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	maxPendingSchedules = 100                  // 每个用户最多等待发送的定时消息数
+	maxScheduleAhead    = 365 * 24 * time.Hour // 最远可以定时到多久之后
+	scheduleLease       = time.Minute          // 领取定时消息的租约，实例中途退出时由其他实例在租约过期后接手
+	scheduleBatch       = 100                  // 每次领取的定时消息数
+)
+
+// scheduleClientID 定时消息投递时使用的客户端消息id，同一实例内重试时由发送去重返回首次的结果；
+// 跨实例和重启后不会重新发送，见sendScheduled
+func scheduleClientID(id uint64) string {
+	return "schedule-" + strconv.FormatUint(id, 10)
+}
+
+// sendReq 按定时消息生成普通的发送请求
+func sendReq(m *model.ScheduledMsg) *SendReq {
+	return &SendReq{
+		ClientID: scheduleClientID(m.ID),
+		To:       m.Receiver,
+		GroupID:  m.GroupID,
+		Type:     m.Type,
+		Content:  m.Content,
+		ReplyTo:  m.ReplyTo,
+		RefMode:  m.RefMode,
+		MediaID:  m.MediaID,
+		TTL:      m.TTL,
+		TTLFrom:  m.TTLFrom,
+	}
+}
+
+// checkSchedule 创建和修改时按发送的规则预先校验，到时间后发送时还会重新校验一次
+func (s *Service) checkSchedule(ctx context.Context, m *model.ScheduledMsg) error {
+	now := time.Now()
+	if m.SendAt <= now.UnixMilli() || m.SendAt > now.Add(maxScheduleAhead).UnixMilli() {
+		return ierr.ErrParam
+	}
+	if (m.Receiver == 0) == (m.GroupID == 0) {
+		return ierr.ErrParam
+	}
+	req := sendReq(m)
+	msg := &model.Message{Sender: m.Sender, Type: m.Type, Content: m.Content, TTL: m.TTL, TTLFrom: m.TTLFrom}
+	if m.GroupID != 0 {
+		msg.ConvID, msg.ConvType, msg.GroupID = model.GroupConvID(m.GroupID), model.ConvGroup, m.GroupID
+		_, err := s.store.Group.Member(ctx, m.GroupID, m.Sender)
+		if err == store.ErrNotFound {
+			return ierr.ErrNotGroupMember
+		}
+		if err != nil {
+			log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", m.GroupID, m.Sender, err)
+			return ierr.ErrSystem
+		}
+	} else {
+		msg.ConvID, msg.ConvType, msg.Receiver = model.SingleConvID(m.Sender, m.Receiver), model.ConvSingle, m.Receiver
+		if err := s.checkE2E(ctx, msg); err != nil {
+			return err
+		}
+	}
+	if err := checkTTL(m.TTL, m.TTLFrom); err != nil {
+		return err
+	}
+	if err := s.prepareContent(ctx, m.Sender, msg, req); err != nil {
+		return err
+	}
+	return s.attachRef(ctx, msg, req)
+}
+
+// holdMedia 定时消息复制一条自己持有的媒体记录，等待发送期间上传记录过期清理不影响发送
+func (s *Service) holdMedia(ctx context.Context, m *model.ScheduledMsg) error {
+	if m.MediaID == 0 {
+		return nil
+	}
+	c, err := s.cloneMedia(ctx, m.MediaID, m.Sender)
+	if err != nil {
+		return err
+	}
+	m.MediaID = c.ID
+	return nil
+}
+
+// releaseScheduled 释放定时消息持有的媒体记录
+func (s *Service) releaseScheduled(ctx context.Context, id, mediaID uint64) {
+	if mediaID == 0 {
+		return
+	}
+	if err := s.refs.Release(ctx, mediaID); err != nil {
+		log.WarnContextf(ctx, "release scheduled media fail, schedule:%d, media:%d, err:%v", id, mediaID, err)
+	}
+}
+
+// loadSchedule 获取当前用户的定时消息，不是作者时视为不存在
+func (s *Service) loadSchedule(ctx context.Context, uid, id uint64) (*model.ScheduledMsg, error) {
+	m, err := s.store.Schedule.Get(ctx, id)
+	if err == store.ErrNotFound || err == nil && m.Sender != uid {
+		return nil, ierr.ErrScheduleGone
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get scheduled msg fail, id:%d, err:%v", id, err)
+		return nil, ierr.ErrSystem
+	}
+	return m, nil
+}
+
+// ScheduleReq 创建定时消息，字段含义与SendReq一致
+type ScheduleReq struct {
+	To      uint64        `json:"to"`
+	GroupID uint64        `json:"group_id"`
+	Type    model.MsgType `json:"type"`
+	Content string        `json:"content"`
+	ReplyTo uint64        `json:"reply_to,string"`
+	RefMode model.RefMode `json:"ref_mode"`
+	MediaID uint64        `json:"media_id,string"`
+	TTL     int           `json:"ttl"`
+	TTLFrom model.TTLFrom `json:"ttl_from"`
+	SendAt  int64         `json:"send_at"` // 计划发送时间，单位毫秒
+}
+
+// Schedule 创建定时消息，到时间后以当前用户的身份发送
+func (s *Service) Schedule(ctx context.Context, uid uint64, req *ScheduleReq) (*model.ScheduledMsg, error) {
+	if req.Type == 0 {
+		req.Type = model.MsgText
+	}
+	now := time.Now().UnixMilli()
+	m := &model.ScheduledMsg{
+		ID:         s.ids.Next(),
+		Sender:     uid,
+		Receiver:   req.To,
+		GroupID:    req.GroupID,
+		Type:       req.Type,
+		Content:    req.Content,
+		MediaID:    req.MediaID,
+		ReplyTo:    req.ReplyTo,
+		RefMode:    req.RefMode,
+		TTL:        req.TTL,
+		TTLFrom:    req.TTLFrom,
+		SendAt:     req.SendAt,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := s.checkSchedule(ctx, m); err != nil {
+		return nil, err
+	}
+	list, err := s.store.Schedule.List(ctx, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list scheduled msgs fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	pending := 0
+	for _, item := range list {
+		if item.Status == model.SchedulePending {
+			pending++
+		}
+	}
+	if pending >= maxPendingSchedules {
+		return nil, ierr.ErrParam
+	}
+	if err = s.holdMedia(ctx, m); err != nil {
+		return nil, err
+	}
+	if err = s.store.Schedule.Create(ctx, m); err != nil {
+		s.releaseScheduled(ctx, m.ID, m.MediaID)
+		log.ErrorContextf(ctx, "create scheduled msg fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	log.InfoContextf(ctx, "schedule msg, id:%d, sender:%d, send at:%d", m.ID, uid, m.SendAt)
+	return m, nil
+}
+
+// ListScheduleReq 查询定时消息，默认只返回等待发送的
+type ListScheduleReq struct {
+	Status model.ScheduleStatus `form:"status"`
+}
+
+// ListScheduleRsp .
+type ListScheduleRsp struct {
+	Items []*model.ScheduledMsg `json:"items"`
+}
+
+// ListSchedules 按计划发送时间升序列出当前用户指定状态的定时消息
+func (s *Service) ListSchedules(ctx context.Context, uid uint64, req *ListScheduleReq) (*ListScheduleRsp, error) {
+	list, err := s.store.Schedule.List(ctx, uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "list scheduled msgs fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+	rsp := &ListScheduleRsp{Items: []*model.ScheduledMsg{}}
+	for _, m := range list {
+		if m.Status == req.Status {
+			rsp.Items = append(rsp.Items, m)
+		}
+	}
+	return rsp, nil
+}
+
+// EditScheduleReq 修改定时消息的内容或发送时间，会话不能修改，未填的字段保持不变
+type EditScheduleReq struct {
+	ID      uint64        `json:"id,string"`
+	Type    model.MsgType `json:"type"`
+	Content string        `json:"content"`
+	MediaID uint64        `json:"media_id,string"`
+	SendAt  int64         `json:"send_at"`
+}
+
+// EditSchedule 修改等待发送的定时消息，已经开始投递的不能再修改
+func (s *Service) EditSchedule(ctx context.Context, uid uint64, req *EditScheduleReq) (*model.ScheduledMsg, error) {
+	m, err := s.loadSchedule(ctx, uid, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Status != model.SchedulePending {
+		return nil, ierr.ErrScheduleGone
+	}
+	held := m.MediaID
+	if req.Type != 0 && req.Type != m.Type {
+		m.Type, m.Content, m.MediaID = req.Type, "", 0
+	}
+	if req.Content != "" {
+		m.Content = req.Content
+	}
+	if req.MediaID != 0 {
+		m.MediaID = req.MediaID
+	}
+	if req.SendAt != 0 {
+		m.SendAt = req.SendAt
+	}
+	if err = s.checkSchedule(ctx, m); err != nil {
+		return nil, err
+	}
+	if m.MediaID != held {
+		if err = s.holdMedia(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+	m.UpdateTime = time.Now().UnixMilli()
+	if err = s.store.Schedule.Update(ctx, m); err != nil {
+		if m.MediaID != held {
+			s.releaseScheduled(ctx, m.ID, m.MediaID)
+		}
+		if err == store.ErrNotFound {
+			return nil, ierr.ErrScheduleGone
+		}
+		log.ErrorContextf(ctx, "update scheduled msg fail, id:%d, err:%v", m.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	if m.MediaID != held {
+		s.releaseScheduled(ctx, m.ID, held)
+	}
+	log.InfoContextf(ctx, "edit scheduled msg, id:%d, sender:%d, send at:%d", m.ID, uid, m.SendAt)
+	return m, nil
+}
+
+// CancelScheduleReq 取消定时消息
+type CancelScheduleReq struct {
+	ID uint64 `json:"id,string"`
+}
+
+// CancelScheduleRsp .
+type CancelScheduleRsp struct{}
+
+// CancelSchedule 取消等待发送的定时消息，已经开始投递的不能再取消
+func (s *Service) CancelSchedule(ctx context.Context, uid uint64, req *CancelScheduleReq) (*CancelScheduleRsp, error) {
+	m, err := s.loadSchedule(ctx, uid, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Status != model.SchedulePending {
+		return nil, ierr.ErrScheduleGone
+	}
+	m.Status = model.ScheduleCanceled
+	m.UpdateTime = time.Now().UnixMilli()
+	err = s.store.Schedule.Update(ctx, m)
+	if err == store.ErrNotFound {
+		return nil, ierr.ErrScheduleGone
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "cancel scheduled msg fail, id:%d, err:%v", m.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	s.releaseScheduled(ctx, m.ID, m.MediaID)
+	log.InfoContextf(ctx, "cancel scheduled msg, id:%d, sender:%d", m.ID, uid)
+	return &CancelScheduleRsp{}, nil
+}
+
+// RunScheduler 定期投递到时间的定时消息，直到ctx结束，ScheduleStore是共享存储时多个实例可以同时运行
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SendDue(ctx)
+		}
+	}
+}
+
+// SendDue 分批领取到时间的定时消息并发送，确认没有发出的系统错误或限流在租约过期后重新领取
+func (s *Service) SendDue(ctx context.Context) {
+	for {
+		list, err := s.store.Schedule.Claim(ctx, s.owner, time.Now().UnixMilli(), scheduleLease, scheduleBatch)
+		if err != nil {
+			log.ErrorContextf(ctx, "claim scheduled msgs fail, err:%v", err)
+			return
+		}
+		for _, m := range list {
+			if m.Status == model.ScheduleSending {
+				s.settleScheduled(ctx, m)
+				continue
+			}
+			s.sendScheduled(ctx, m)
+		}
+		if len(list) < scheduleBatch {
+			return
+		}
+	}
+}
+
+// sendScheduled 以作者的身份走普通的发送流程，权限、审核和限流都按发送时的状态校验
+// 发送前先把定时消息改为正在投递并记录预先分配的消息id，这一步与领取的租约在存储中原子地完成，
+// 之后即使本实例中断，其他实例和重启后也不会再发送，投递最多一次
+func (s *Service) sendScheduled(ctx context.Context, m *model.ScheduledMsg) {
+	if m.MsgID == 0 {
+		m.MsgID = s.ids.Next()
+	}
+	if err := s.store.Schedule.Assign(ctx, m.ID, m.MsgID, s.owner); err != nil {
+		log.WarnContextf(ctx, "assign scheduled msg id fail, id:%d, err:%v", m.ID, err)
+		return
+	}
+	m.Status = model.ScheduleSending
+
+	req := sendReq(m)
+	req.msgID = m.MsgID
+	var err error
+	if m.GroupID != 0 {
+		_, err = s.SendGroup(ctx, m.Sender, req)
+	} else {
+		_, err = s.SendSingle(ctx, m.Sender, req)
+	}
+	if code := ierr.Code(err); code == ierr.CodeSystem || code == ierr.CodeRateLimited {
+		s.retryScheduled(ctx, m, err)
+		return
+	}
+	s.finishScheduled(ctx, m, err)
+}
+
+// retryScheduled 系统错误或限流时，消息确认没有落地才退回等待发送，租约过期后重新领取；
+// 已经落地说明是落地之后的步骤出错，记为已发送；无法确认时保持正在投递，租约过期后按中断处理
+func (s *Service) retryScheduled(ctx context.Context, m *model.ScheduledMsg, err error) {
+	_, gerr := s.store.Message.Get(ctx, m.MsgID)
+	switch gerr {
+	case nil:
+		s.finishScheduled(ctx, m, nil)
+	case store.ErrNotFound:
+		log.WarnContextf(ctx, "send scheduled msg fail, retry later, id:%d, err:%v", m.ID, err)
+		if err = s.store.Schedule.Reset(ctx, m.ID, s.owner); err != nil {
+			log.WarnContextf(ctx, "reset scheduled msg fail, id:%d, err:%v", m.ID, err)
+		}
+	default:
+		log.ErrorContextf(ctx, "get scheduled msg fail, id:%d, msg:%d, err:%v", m.ID, m.MsgID, gerr)
+	}
+}
+
+// settleScheduled 投递中断(正在投递时租约过期)的定时消息只记录结果，不再发送：
+// 消息存储中已有这条消息时记为已发送，否则记为失败，由作者确认后重新发送
+func (s *Service) settleScheduled(ctx context.Context, m *model.ScheduledMsg) {
+	_, err := s.store.Message.Get(ctx, m.MsgID)
+	switch err {
+	case nil:
+		log.InfoContextf(ctx, "scheduled msg already sent, id:%d, msg:%d", m.ID, m.MsgID)
+		s.finishScheduled(ctx, m, nil)
+	case store.ErrNotFound:
+		log.WarnContextf(ctx, "scheduled msg interrupted, id:%d, msg:%d", m.ID, m.MsgID)
+		s.finishScheduled(ctx, m, ierr.ErrScheduleBroken)
+	default:
+		log.ErrorContextf(ctx, "get scheduled msg fail, id:%d, msg:%d, err:%v", m.ID, m.MsgID, err)
+	}
+}
+
+// finishScheduled 按发送结果记录定时消息并释放租约
+func (s *Service) finishScheduled(ctx context.Context, m *model.ScheduledMsg, err error) {
+	switch code := ierr.Code(err); {
+	case err == nil || code == ierr.CodeMsgConflict:
+		// 消息id冲突说明其他实例已用同一个id发出
+		m.Status = model.ScheduleSent
+	default:
+		log.InfoContextf(ctx, "send scheduled msg fail, id:%d, sender:%d, err:%v", m.ID, m.Sender, err)
+		m.Status, m.MsgID, m.Code, m.Reason = model.ScheduleFailed, 0, code, ierr.Msg(err)
+	}
+	m.UpdateTime = time.Now().UnixMilli()
+	if err = s.store.Schedule.Finish(ctx, m, s.owner); err != nil {
+		log.WarnContextf(ctx, "finish scheduled msg fail, id:%d, err:%v", m.ID, err)
+		return
+	}
+	// 发出的消息持有自己复制的媒体记录
+	s.releaseScheduled(ctx, m.ID, m.MediaID)
+	s.notify(ctx, []uint64{m.Sender}, &model.Event{Type: model.EventSchedule, MsgID: m.MsgID, Time: m.UpdateTime, Schedule: m})
+	log.InfoContextf(ctx, "scheduled msg done, id:%d, status:%d, msg:%d", m.ID, m.Status, m.MsgID)
+}
@@ -0,0 +1,67 @@
+package message
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// TestSendDueAtMostOnce 投递中断的定时消息由其他实例接手时只记录结果，不会再发送一次
+func TestSendDueAtMostOnce(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestService()
+	now := time.Now().UnixMilli()
+	conv := model.SingleConvID(1, 2)
+	for id := uint64(1); id <= 3; id++ {
+		m := &model.ScheduledMsg{ID: id, Sender: 1, Receiver: 2, Type: model.MsgText, Content: "hi", SendAt: now - 10}
+		if err := st.Schedule.Create(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 另一个实例领取了2和3，记录消息id后中断，其中3已经发出
+	claimed, err := st.Schedule.Claim(ctx, "dead", now, 0, 10)
+	if err != nil || len(claimed) != 3 {
+		t.Fatalf("claim got %d, err:%v", len(claimed), err)
+	}
+	for _, id := range []uint64{2, 3} {
+		if err = st.Schedule.Assign(ctx, id, 100+id, "dead"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = st.Message.Save(ctx, &model.Message{ID: 103, ConvID: conv, ConvType: model.ConvSingle,
+		Sender: 1, Receiver: 2, Type: model.MsgText, Content: "hi", SendTime: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SendDue(ctx)
+
+	want := map[uint64]model.ScheduleStatus{1: model.ScheduleSent, 2: model.ScheduleFailed, 3: model.ScheduleSent}
+	for id, status := range want {
+		m, err := st.Schedule.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Status != status {
+			t.Fatalf("schedule %d status %d, want %d", id, m.Status, status)
+		}
+		if id == 2 && m.Code != ierr.CodeScheduleBroken {
+			t.Fatalf("interrupted schedule code %d", m.Code)
+		}
+	}
+	msgs, err := st.Message.List(ctx, conv, 0, false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("stored %d msgs, want 2", len(msgs))
+	}
+
+	// 已有结果的定时消息不会再被领取
+	s.SendDue(ctx)
+	if msgs, _ = st.Message.List(ctx, conv, 0, false, 10); len(msgs) != 2 {
+		t.Fatalf("stored %d msgs after second sweep", len(msgs))
+	}
+}
@@ -0,0 +1,250 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"unicode/utf8"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/search"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+const (
+	maxSearchLimit   = 50
+	maxKeywordLen    = 64
+	defaultSearchLen = 20
+	indexBatch       = 500 // 从存储补齐索引时每次读取的改动数
+)
+
+// SearchReq 搜索当前用户能看到的消息
+type SearchReq struct {
+	// 关键词按空白和标点切分，每段都要出现；中日韩文字匹配任意连续的字，
+	// 拉丁文字和数字按词的前缀匹配，如meet能搜到meeting，但eting搜不到
+	Keyword string        `form:"keyword"`
+	ConvID  string        `form:"conv_id"`
+	Sender  uint64        `form:"sender"`
+	Type    model.MsgType `form:"type"`
+	Start   int64         `form:"start"`  // 发送时间下限，单位毫秒
+	End     int64         `form:"end"`    // 发送时间上限，单位毫秒
+	Cursor  uint64        `form:"cursor"` // 上一页返回的next_cursor，首页不填
+	Limit   int           `form:"limit"`
+}
+
+// SearchItem 一条搜索结果，高亮区间是Text中按字符计数的位置
+type SearchItem struct {
+	Message    *model.Message `json:"message"`
+	Text       string         `json:"text"` // 参与检索的文本，富文本为纯文本渲染
+	Highlights []search.Range `json:"highlights"`
+}
+
+// SearchRsp 搜索结果，按发送时间从新到旧
+type SearchRsp struct {
+	Items      []*SearchItem `json:"items"`
+	NextCursor uint64        `json:"next_cursor,string,omitempty"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// Search 按关键词搜索消息，只返回当前用户在会话中能看到的消息，不包含用户自己删除的消息
+func (s *Service) Search(ctx context.Context, uid uint64, req *SearchReq) (*SearchRsp, error) {
+	if req.Keyword == "" || utf8.RuneCountInString(req.Keyword) > maxKeywordLen {
+		return nil, ierr.ErrParam
+	}
+	if req.Limit <= 0 || req.Limit > maxSearchLimit {
+		req.Limit = defaultSearchLen
+	}
+	if req.ConvID != "" {
+		if _, err := s.checkConv(ctx, uid, req.ConvID); err != nil {
+			return nil, err
+		}
+	}
+	hits, more := s.index.Search(&search.Query{
+		Keyword: req.Keyword,
+		ConvID:  req.ConvID,
+		Sender:  req.Sender,
+		Type:    int(req.Type),
+		Start:   req.Start,
+		End:     req.End,
+		Before:  req.Cursor,
+		Limit:   req.Limit,
+		Visible: s.visibleFunc(ctx, uid),
+	})
+
+	ids := make([]uint64, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.Doc.ID)
+	}
+	deleted, err := s.store.Deletion.Filter(ctx, uid, ids)
+	if err != nil {
+		log.ErrorContextf(ctx, "filter deleted msgs fail, uid:%d, err:%v", uid, err)
+		return nil, ierr.ErrSystem
+	}
+
+	rsp := &SearchRsp{Items: make([]*SearchItem, 0, len(hits)), HasMore: more}
+	for _, hit := range hits {
+		rsp.NextCursor = hit.Doc.ID
+		if deleted[hit.Doc.ID] {
+			continue
+		}
+		msg, err := s.store.Message.Get(ctx, hit.Doc.ID)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			log.ErrorContextf(ctx, "get msg fail, id:%d, err:%v", hit.Doc.ID, err)
+			return nil, ierr.ErrSystem
+		}
+		// 其他实例上的改动还没补齐到索引时，按存储中的当前内容更新索引并重新校验
+		if !searchable(msg) {
+			s.indexMsg(msg)
+			continue
+		}
+		text, highlights := hit.Doc.Text, hit.Highlights
+		if cur := searchText(msg); cur != text {
+			s.indexMsg(msg)
+			var ok bool
+			if highlights, ok = search.Highlight(cur, req.Keyword); !ok {
+				continue
+			}
+			text = cur
+		}
+		s.resolveRef(ctx, msg)
+		rsp.Items = append(rsp.Items, &SearchItem{Message: msg, Text: text, Highlights: highlights})
+	}
+	if !more {
+		rsp.NextCursor = 0
+	}
+	return rsp, nil
+}
+
+// convView 用户在一个会话中能看到哪些消息，群聊读扩散时只能看到入群之后的，写扩散时只能看到自己会话索引中的
+type convView struct {
+	since    int64
+	timeline bool
+}
+
+// visibleFunc 与历史消息的可见范围一致，同一次搜索内缓存会话的结果
+func (s *Service) visibleFunc(ctx context.Context, uid uint64) func(doc *search.Doc) bool {
+	cache := make(map[string]*convView)
+	return func(doc *search.Doc) bool {
+		v, ok := cache[doc.ConvID]
+		if !ok {
+			v = s.convView(ctx, uid, doc.ConvID)
+			cache[doc.ConvID] = v
+		}
+		if v == nil {
+			return false
+		}
+		if !v.timeline {
+			return doc.Time >= v.since
+		}
+		has, err := s.store.Timeline.Has(ctx, uid, doc.ConvID, doc.Seq)
+		if err != nil {
+			log.ErrorContextf(ctx, "check timeline fail, uid:%d, conv:%s, seq:%d, err:%v", uid, doc.ConvID, doc.Seq, err)
+			return false
+		}
+		return has
+	}
+}
+
+// convView 不是会话成员或出错时返回nil
+func (s *Service) convView(ctx context.Context, uid uint64, convID string) *convView {
+	typ, err := s.checkConv(ctx, uid, convID)
+	if err != nil {
+		return nil
+	}
+	if typ != model.ConvGroup {
+		return &convView{}
+	}
+	if !readDiffusion() {
+		return &convView{timeline: true}
+	}
+	_, ids, _ := model.ParseConvID(convID)
+	member, err := s.store.Group.Member(ctx, ids[0], uid)
+	if err != nil {
+		log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", ids[0], uid, err)
+		return nil
+	}
+	return &convView{since: member.JoinTime}
+}
+
+// RunIndexer 启动时从存储重建索引，之后定期补齐其他实例上的发送、编辑、撤回和到期，直到ctx结束
+func (s *Service) RunIndexer(ctx context.Context, interval time.Duration) {
+	after := s.SyncIndex(ctx, 0)
+	log.InfoContextf(ctx, "search index rebuilt, cursor:%d", after)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			after = s.SyncIndex(ctx, after)
+		}
+	}
+}
+
+// SyncIndex 按写入顺序把存储中Change大于after的消息更新到索引，返回下次开始读取的位置
+func (s *Service) SyncIndex(ctx context.Context, after uint64) uint64 {
+	for {
+		list, err := s.store.Message.Changes(ctx, after, indexBatch)
+		if err != nil {
+			log.ErrorContextf(ctx, "read msg changes fail, after:%d, err:%v", after, err)
+			return after
+		}
+		for _, msg := range list {
+			s.indexMsg(msg)
+			after = msg.Change
+		}
+		if len(list) < indexBatch {
+			return after
+		}
+	}
+}
+
+// indexMsg 发送、编辑、撤回和到期后按消息的当前状态更新索引，本实例和补齐其他实例的改动都走这里，
+// 撤回、到期和没有可检索文本的消息从索引中删除
+func (s *Service) indexMsg(msg *model.Message) {
+	if !searchable(msg) {
+		s.index.Delete(msg.ID)
+		return
+	}
+	s.index.Put(&search.Doc{
+		ID:     msg.ID,
+		ConvID: msg.ConvID,
+		Seq:    msg.Seq,
+		Sender: msg.Sender,
+		Type:   int(msg.Type),
+		Time:   msg.SendTime,
+		Text:   searchText(msg),
+	})
+}
+
+// searchable 消息当前能否被搜到
+func searchable(msg *model.Message) bool {
+	return !msg.Recalled() && !msg.Expired() && !msg.Due(time.Now().UnixMilli())
+}
+
+// searchText 消息中参与检索的文本
+func searchText(msg *model.Message) string {
+	switch msg.Type {
+	case model.MsgText:
+		return msg.Content
+	case model.MsgRich, model.MsgMerged:
+		return msg.Plain
+	case model.MsgCustom:
+		c := &model.CustomContent{}
+		if json.Unmarshal([]byte(msg.Content), c) == nil {
+			return c.Fallback
+		}
+	case model.MsgFile:
+		c := &model.FileContent{}
+		if json.Unmarshal([]byte(msg.Content), c) == nil {
+			return c.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package message
+
+import (
+	"context"
+	"testing"
+
+	"github.com/binbin6363/icuc/common/idgen"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/search"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// TestSyncIndexChanges 两个实例共用存储，一个实例上的发送、编辑和撤回由另一个实例补齐到索引
+func TestSyncIndexChanges(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemStore()
+	ids := idgen.NewSnowflake(0, 0)
+	a, b := New(WithStore(st), WithIDs(ids)), New(WithStore(st), WithIDs(ids))
+	indexed := func(keyword string) bool {
+		hits, _ := b.index.Search(&search.Query{Keyword: keyword, Limit: 10})
+		return len(hits) > 0
+	}
+
+	rsp, err := a.SendSingle(ctx, 1, &SendReq{To: 2, Type: model.MsgText, Content: "team meeting at 10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := b.SyncIndex(ctx, 0)
+	if !indexed("meet") {
+		t.Fatal("sent msg not synced")
+	}
+
+	if _, err = a.Edit(ctx, 1, &EditReq{MsgID: rsp.MsgID, Content: "lunch at noon"}); err != nil {
+		t.Fatal(err)
+	}
+	cursor = b.SyncIndex(ctx, cursor)
+	if indexed("meet") || !indexed("lunch") {
+		t.Fatal("edit not synced")
+	}
+	res, err := b.Search(ctx, 2, &SearchReq{Keyword: "lun"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 1 || res.Items[0].Message.ID != rsp.MsgID {
+		t.Fatalf("search got %+v", res.Items)
+	}
+
+	if _, err = a.Recall(ctx, 1, &RecallReq{MsgID: rsp.MsgID}); err != nil {
+		t.Fatal(err)
+	}
+	if next := b.SyncIndex(ctx, cursor); next <= cursor {
+		t.Fatalf("cursor not advanced, %d -> %d", cursor, next)
+	}
+	if indexed("lunch") {
+		t.Fatal("recall not synced")
+	}
+}
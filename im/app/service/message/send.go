@@ -0,0 +1,289 @@
+package message
+
+import (
+	"context"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// SendReq 发送消息请求，SingleMessage和GroupMessage的pb请求暂未定义字段，先走http接口
+type SendReq struct {
+	ClientID string        `json:"client_id"`       // 客户端生成的消息id，重试时保持不变
+	To       uint64        `json:"to"`              // 单聊接收者uid
+	GroupID  uint64        `json:"group_id"`        // 群聊群id
+	Type     model.MsgType `json:"type"`            // 消息类型
+	Content  string        `json:"content"`         // 消息内容
+	ReplyTo  uint64        `json:"reply_to,string"` // 引用或回复的父消息id
+	RefMode  model.RefMode `json:"ref_mode"`        // 引用方式，默认引用回复
+	MediaID  uint64        `json:"media_id,string"` // 图片等媒体消息上传后得到的id
+	TTL      int           `json:"ttl"`             // 存活时间，单位秒，不填时使用会话的设置
+	TTLFrom  model.TTLFrom `json:"ttl_from"`        // 存活时间的计时起点，默认从发送开始
+
+	msgID uint64 // 预先分配的消息id，定时消息投递前记录在定时消息上
+}
+
+// SendRsp 发送消息回包
+type SendRsp struct {
+	MsgID    uint64 `json:"msg_id,string"`
+	Seq      uint64 `json:"seq"`
+	SendTime int64  `json:"send_time"`
+}
+
+// SendSingle 发送单聊消息
+func (s *Service) SendSingle(ctx context.Context, uid uint64, req *SendReq) (*SendRsp, error) {
+	if req.To == 0 {
+		return nil, ierr.ErrParam
+	}
+	msg := &model.Message{
+		ID:       req.msgID,
+		ConvID:   model.SingleConvID(uid, req.To),
+		ConvType: model.ConvSingle,
+		ClientID: req.ClientID,
+		Sender:   uid,
+		Receiver: req.To,
+		Type:     req.Type,
+		Content:  req.Content,
+		TTL:      req.TTL,
+		TTLFrom:  req.TTLFrom,
+	}
+	if err := s.checkE2E(ctx, msg); err != nil {
+		return nil, err
+	}
+	if err := s.prepareContent(ctx, uid, msg, req); err != nil {
+		return nil, err
+	}
+	if err := s.attachRef(ctx, msg, req); err != nil {
+		return nil, err
+	}
+	return s.send(ctx, msg)
+}
+
+// SendGroup 发送群聊消息
+func (s *Service) SendGroup(ctx context.Context, uid uint64, req *SendReq) (*SendRsp, error) {
+	if req.GroupID == 0 {
+		return nil, ierr.ErrParam
+	}
+	member, err := s.store.Group.Member(ctx, req.GroupID, uid)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return nil, ierr.ErrNotGroupMember
+		}
+		log.ErrorContextf(ctx, "get group member fail, group:%d, uid:%d, err:%v", req.GroupID, uid, err)
+		return nil, ierr.ErrSystem
+	}
+	msg := &model.Message{
+		ID:       req.msgID,
+		ConvID:   model.GroupConvID(req.GroupID),
+		ConvType: model.ConvGroup,
+		ClientID: req.ClientID,
+		Sender:   uid,
+		GroupID:  req.GroupID,
+		Type:     req.Type,
+		Content:  req.Content,
+		TTL:      req.TTL,
+		TTLFrom:  req.TTLFrom,
+	}
+	if err = s.prepareContent(ctx, uid, msg, req); err != nil {
+		return nil, err
+	}
+	if err = s.attachRef(ctx, msg, req); err != nil {
+		return nil, err
+	}
+	if err = s.attachMentions(ctx, member, msg); err != nil {
+		return nil, err
+	}
+	return s.send(ctx, msg)
+}
+
+const maxClientIDLen = 64
+
+// send 落地消息并扩散给会话成员，带客户端消息id时在去重窗口内重试返回首次发送的结果
+func (s *Service) send(ctx context.Context, msg *model.Message) (*SendRsp, error) {
+	if msg.ClientID == "" {
+		return s.doSend(ctx, msg)
+	}
+	if len(msg.ClientID) > maxClientIDLen {
+		return nil, ierr.ErrParam
+	}
+	key := dedupKey(msg.Sender, msg.ClientID)
+	unlock := s.sendMu.Lock(key)
+	defer unlock()
+
+	res, err := s.store.Dedup.Get(ctx, key)
+	if err == nil {
+		log.InfoContextf(ctx, "duplicate send, key:%s, msg:%d", key, res.MsgID)
+		return &SendRsp{MsgID: res.MsgID, Seq: res.Seq, SendTime: res.SendTime}, nil
+	}
+	if err != store.ErrNotFound {
+		log.ErrorContextf(ctx, "get dedup fail, key:%s, err:%v", key, err)
+		return nil, ierr.ErrSystem
+	}
+
+	rsp, err := s.doSend(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	res = &model.SendResult{MsgID: rsp.MsgID, Seq: rsp.Seq, SendTime: rsp.SendTime}
+	if err = s.store.Dedup.Set(ctx, key, res); err != nil {
+		log.WarnContextf(ctx, "set dedup fail, key:%s, err:%v", key, err)
+	}
+	return rsp, nil
+}
+
+func (s *Service) doSend(ctx context.Context, msg *model.Message) (*SendRsp, error) {
+	if msg.ID == 0 {
+		msg.ID = s.ids.Next()
+	}
+	msg.SendTime = time.Now().UnixMilli()
+	if err := s.checkRate(ctx, msg); err != nil {
+		return nil, err
+	}
+	if err := s.applyTTL(ctx, msg); err != nil {
+		return nil, err
+	}
+	if err := s.attachMedia(ctx, msg); err != nil {
+		return nil, err
+	}
+	if err := s.moderate(ctx, msg); err != nil {
+		s.releaseMedia(ctx, msg)
+		return nil, err
+	}
+	if err := s.store.Message.Save(ctx, msg); err != nil {
+		s.releaseMedia(ctx, msg)
+		// 预先分配的消息id已被使用，说明同一条消息已经发出
+		if err == store.ErrConflict {
+			log.InfoContextf(ctx, "msg already saved, id:%d, conv:%s", msg.ID, msg.ConvID)
+			return nil, ierr.ErrMsgConflict
+		}
+		log.ErrorContextf(ctx, "save msg fail, conv:%s, err:%v", msg.ConvID, err)
+		return nil, ierr.ErrSystem
+	}
+	s.indexMsg(msg)
+	s.scheduleExpiry(ctx, msg)
+	if msg.Ref != nil && msg.Ref.Mode == model.RefThread {
+		if _, err := s.store.Thread.AddReply(ctx, msg.Ref.RootID, msg.ID, msg.SendTime); err != nil {
+			log.ErrorContextf(ctx, "add thread reply fail, root:%d, msg:%d, err:%v", msg.Ref.RootID, msg.ID, err)
+		}
+	}
+
+	uids, err := s.recipients(ctx, msg)
+	if err != nil {
+		log.ErrorContextf(ctx, "get recipients fail, msg:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	muted := s.convs.Deliver(ctx, msg, uids)
+	s.deliver(ctx, msg, uids, muted)
+	if len(msg.Mentions) > 0 || msg.MentionAll {
+		s.notifyMentions(ctx, msg, uids)
+	}
+	s.hookMessage(ctx, msg, uids)
+	log.InfoContextf(ctx, "send msg done, id:%d, conv:%s, seq:%d", msg.ID, msg.ConvID, msg.Seq)
+	return &SendRsp{MsgID: msg.ID, Seq: msg.Seq, SendTime: msg.SendTime}, nil
+}
+
+// recipients 消息的全部接收者，包含发送者自己用于多端同步
+func (s *Service) recipients(ctx context.Context, msg *model.Message) ([]uint64, error) {
+	if msg.ConvType == model.ConvSingle {
+		if msg.Sender == msg.Receiver {
+			return []uint64{msg.Sender}, nil
+		}
+		return []uint64{msg.Sender, msg.Receiver}, nil
+	}
+	members, err := s.store.Group.Members(ctx, msg.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]uint64, 0, len(members))
+	for _, m := range members {
+		uids = append(uids, m.Uid)
+	}
+	return uids, nil
+}
+
+// notify 事件写入各接收者的收件箱供离线同步，同时在线推送
+func (s *Service) notify(ctx context.Context, uids []uint64, ev *model.Event) {
+	s.appendInbox(ctx, uids, ev)
+	if err := s.pusher.Push(ctx, uids, ev); err != nil {
+		log.WarnContextf(ctx, "push event fail, type:%d, conv:%s, err:%v", ev.Type, ev.ConvID, err)
+	}
+}
+
+// appendInbox 事件写入各接收者的收件箱
+func (s *Service) appendInbox(ctx context.Context, uids []uint64, ev *model.Event) {
+	for _, uid := range uids {
+		if _, err := s.store.Inbox.Append(ctx, uid, ev); err != nil {
+			log.ErrorContextf(ctx, "append inbox fail, uid:%d, type:%d, err:%v", uid, ev.Type, err)
+		}
+	}
+}
+
+// SyncReq 离线同步请求
+type SyncReq struct {
+	Seq   uint64 `form:"seq"`   // 客户端已同步到的seq
+	Limit int    `form:"limit"` // 单次拉取数量
+}
+
+// SyncRsp 离线同步回包
+type SyncRsp struct {
+	Items   []*model.InboxItem `json:"items"`
+	HasMore bool               `json:"has_more"`
+}
+
+const maxSyncLimit = 200
+
+// Sync 拉取收件箱中的事件
+func (s *Service) Sync(ctx context.Context, uid uint64, req *SyncReq) (*SyncRsp, error) {
+	if req.Limit <= 0 || req.Limit > maxSyncLimit {
+		req.Limit = maxSyncLimit
+	}
+	items, err := s.store.Inbox.Sync(ctx, uid, req.Seq, req.Limit+1)
+	if err != nil {
+		log.ErrorContextf(ctx, "sync inbox fail, uid:%d, seq:%d, err:%v", uid, req.Seq, err)
+		return nil, ierr.ErrSystem
+	}
+	rsp := &SyncRsp{Items: items}
+	if len(items) > req.Limit {
+		rsp.Items = items[:req.Limit]
+		rsp.HasMore = true
+	}
+	for i, item := range rsp.Items {
+		if item.Event.Message == nil {
+			continue
+		}
+		// 收件箱里的事件是共享的，拷贝后换成消息的当前状态，撤回、编辑和到期后不再返回投递时的原文
+		msg, err := s.syncMsg(ctx, item.Event.Message)
+		if err != nil {
+			return nil, err
+		}
+		ev := *item.Event
+		ev.Message = msg
+		// 消息已不存在时保留这条记录的seq，只返回事件本身，避免同步游标卡住
+		if msg != nil {
+			s.resolveRef(ctx, ev.Message)
+		}
+		rsp.Items[i] = &model.InboxItem{Seq: item.Seq, Event: &ev}
+	}
+	return rsp, nil
+}
+
+// syncMsg 收件箱里的消息是投递时的快照，按存储中的当前状态返回，消息已不存在时返回nil
+func (s *Service) syncMsg(ctx context.Context, msg *model.Message) (*model.Message, error) {
+	cur, err := s.store.Message.Get(ctx, msg.ID)
+	if err == store.ErrNotFound {
+		log.WarnContextf(ctx, "synced msg not found, id:%d", msg.ID)
+		return nil, nil
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get synced msg fail, id:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	// 已过存活时间、清理任务还没处理到的消息按到期删除后的样子返回
+	if !cur.Expired() && cur.Due(time.Now().UnixMilli()) {
+		clearExpired(cur)
+	}
+	return cur, nil
+}
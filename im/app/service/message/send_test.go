@@ -0,0 +1,65 @@
+package message
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/moderation"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// slowChecker 拉长发送过程，让并发的重试在第一次发送完成前到达
+type slowChecker struct {
+	moderation.LocalChecker
+}
+
+func (c slowChecker) Check(ctx context.Context, content *moderation.Content) (*moderation.Result, error) {
+	time.Sleep(20 * time.Millisecond)
+	return c.LocalChecker.Check(ctx, content)
+}
+
+func TestSendDedupConcurrent(t *testing.T) {
+	st := store.NewMemStore()
+	s := New(WithStore(st), WithChecker(slowChecker{}))
+	ctx := context.Background()
+	const n = 16
+	rsps := make([]*SendRsp, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rsps[i], errs[i] = s.SendSingle(ctx, 1, &SendReq{ClientID: "c-1", To: 2, Type: model.MsgText, Content: "hello"})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("send %d: %v", i, errs[i])
+		}
+		if *rsps[i] != *rsps[0] {
+			t.Fatalf("send %d got %+v, want %+v", i, rsps[i], rsps[0])
+		}
+	}
+	msgs, err := st.Message.List(ctx, model.SingleConvID(1, 2), 0, false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != rsps[0].MsgID || msgs[0].Seq != rsps[0].Seq {
+		t.Fatalf("stored %d msgs, want one with id %d", len(msgs), rsps[0].MsgID)
+	}
+
+	// 不同的客户端消息id各自发送
+	rsp, err := s.SendSingle(ctx, 1, &SendReq{ClientID: "c-2", To: 2, Type: model.MsgText, Content: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.MsgID == rsps[0].MsgID {
+		t.Fatalf("different client id reused msg %d", rsp.MsgID)
+	}
+}
@@ -1,40 +1,147 @@
 package message
 
 import (
-	"context"
-
 	apppb "github.com/binbin6363/icuc-pb/protobuf/im/app"
+	"github.com/binbin6363/icuc/common/idgen"
+	"github.com/binbin6363/icuc/im/app/blob"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/media"
+	"github.com/binbin6363/icuc/im/app/moderation"
+	"github.com/binbin6363/icuc/im/app/push"
+	"github.com/binbin6363/icuc/im/app/ratelimit"
+	"github.com/binbin6363/icuc/im/app/search"
+	"github.com/binbin6363/icuc/im/app/service/conversation"
+	"github.com/binbin6363/icuc/im/app/store"
 )
 
 type Service struct {
+	// pb中的发消息请求还没有定义字段，这些接口由嵌入的实现返回Unimplemented，发送走handler.go中的http接口
 	apppb.UnimplementedMessageServiceServer
+
+	store  *store.Store
+	blobs  *blob.Buckets
+	pusher push.Pusher
+	ids    *idgen.Snowflake
+	refs   *media.Refs
+	sendMu *keyLock // 同一客户端消息id的发送互斥
+
+	schemas *schemaCache
+	router  ActionRouter
+	index   *search.Index
+	convs   ConvFeed
+	filter  *moderation.Filter
+	checker moderation.Checker
+	limiter *ratelimit.Limiter
+	dups    *ratelimit.DupDetector
+	owner   string // 清理到期消息时领取租约的实例标识
+}
+
+// Option 创建Service时的可选项
+type Option func(*Service)
+
+// WithStore 指定存储，不指定时使用内存存储
+func WithStore(st *store.Store) Option {
+	return func(s *Service) {
+		s.store = st
+	}
+}
+
+// WithBlobs 指定对象存储，不指定时按配置创建
+func WithBlobs(b *blob.Buckets) Option {
+	return func(s *Service) {
+		s.blobs = b
+	}
+}
+
+// WithActionRouter 指定卡片按钮回调的路由，不指定时回调到类型注册的地址
+func WithActionRouter(r ActionRouter) Option {
+	return func(s *Service) {
+		s.router = r
+	}
+}
+
+// WithIndex 指定消息检索索引，不指定时新建
+func WithIndex(x *search.Index) Option {
+	return func(s *Service) {
+		s.index = x
+	}
 }
 
-func (s *Service) SingleMessage(ctx context.Context, request *apppb.SingleMessageRequest) (*apppb.SingleMessageResponse, error) {
-	//TODO implement me
-	panic("implement me")
+// WithConvFeed 指定最近会话列表，不指定时在同一份存储上新建
+func WithConvFeed(f ConvFeed) Option {
+	return func(s *Service) {
+		s.convs = f
+	}
 }
 
-func (s *Service) GroupMessage(ctx context.Context, request *apppb.GroupMessageRequest) (*apppb.GroupMessageResponse, error) {
-	//TODO implement me
-	panic("implement me")
+// WithFilter 指定敏感词过滤器，不指定时按配置加载词表
+func WithFilter(f *moderation.Filter) Option {
+	return func(s *Service) {
+		s.filter = f
+	}
 }
 
-func (s *Service) ImageMessage(ctx context.Context, request *apppb.ImageMessageRequest) (*apppb.ImageMessageResponse, error) {
-	//TODO implement me
-	panic("implement me")
+// WithChecker 指定外部内容审核，不指定时全部放行
+func WithChecker(c moderation.Checker) Option {
+	return func(s *Service) {
+		s.checker = c
+	}
 }
 
-func (s *Service) FileMessage(ctx context.Context, request *apppb.FileMessageRequest) (*apppb.FileMessageResponse, error) {
-	//TODO implement me
-	panic("implement me")
+// WithPusher 指定在线推送的实现
+func WithPusher(p push.Pusher) Option {
+	return func(s *Service) {
+		s.pusher = p
+	}
 }
 
-func (s *Service) mustEmbedUnimplementedMessageServiceServer() {
-	//TODO implement me
-	panic("implement me")
+// WithIDs 指定消息和媒体记录的id生成器，不指定时按配置新建，进程内共用存储的服务要传入同一个
+func WithIDs(ids *idgen.Snowflake) Option {
+	return func(s *Service) {
+		s.ids = ids
+	}
 }
 
-func New() *Service {
-	return &Service{}
+func New(opts ...Option) *Service {
+	s := &Service{
+		pusher:  push.LogPusher{},
+		sendMu:  newKeyLock(),
+		schemas: newSchemaCache(),
+		limiter: ratelimit.NewLimiter(),
+		dups:    newDupDetector(),
+		owner:   instanceID(),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.ids == nil {
+		if info := cfg.AppConfig().ServerInfo; info != nil {
+			s.ids = idgen.NewSnowflake(info.DataCenterId, info.WorkerId)
+		} else {
+			s.ids = idgen.NewSnowflake(0, 0)
+		}
+	}
+	if s.store == nil {
+		s.store = store.NewMemStore()
+	}
+	if s.blobs == nil {
+		s.blobs = blob.NewBuckets(cfg.AppConfig().ServerInfo, cfg.AppConfig().CosInfo)
+	}
+	if s.index == nil {
+		s.index = search.NewIndex()
+	}
+	if s.convs == nil {
+		s.convs = conversation.New(conversation.WithStore(s.store), conversation.WithPusher(s.pusher))
+	}
+	if s.filter == nil {
+		s.filter = newFilter()
+	}
+	if s.checker == nil {
+		s.checker = moderation.LocalChecker{}
+	}
+	if s.router == nil {
+		s.router = NewWebhookRouter(cfg.AppConfig().MsgInfo.CallbackTimeout)
+	}
+	s.refs = media.NewRefs(s.store, s.blobs.Media, s.ids)
+	return s
 }
@@ -0,0 +1,91 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	cfg "github.com/binbin6363/icuc/im/app/config"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/ratelimit"
+)
+
+// signalLimit 每个发送者在所有会话上发送状态的总频率
+var signalLimit = ratelimit.Limit{Rate: 5, Burst: 10}
+
+// SignalReq 发送正在输入等瞬时状态
+type SignalReq struct {
+	ConvID string           `json:"conv_id"`
+	Kind   model.SignalKind `json:"kind"`
+}
+
+// SignalRsp Relayed为false表示被节流丢弃，客户端不需要重试
+type SignalRsp struct {
+	Relayed    bool  `json:"relayed"`
+	ExpireTime int64 `json:"expire_time,omitempty"`
+}
+
+// Signal 把瞬时状态转发给会话中的其他在线成员，不写收件箱、不更新会话、不计未读；
+// 同一会话的同一状态在间隔内重复发送时直接丢弃，超过人数上限的群不转发
+func (s *Service) Signal(ctx context.Context, uid uint64, req *SignalReq) (*SignalRsp, error) {
+	if req.Kind < model.SignalStop || req.Kind > model.SignalUploading {
+		return nil, ierr.ErrParam
+	}
+	typ, err := s.checkConv(ctx, uid, req.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	info := cfg.AppConfig().MsgInfo
+	now := time.Now()
+	throttle := ratelimit.Req{
+		Key:   fmt.Sprintf("signal:%d:%s:%d", uid, req.ConvID, req.Kind),
+		Limit: ratelimit.Limit{Rate: 1000 / float64(info.SignalInterval), Burst: 1},
+	}
+	total := ratelimit.Req{Key: fmt.Sprintf("signal:%d", uid), Limit: signalLimit}
+	if ok, _ := s.limiter.Allow(now, throttle, total); !ok {
+		return &SignalRsp{}, nil
+	}
+
+	_, ids, _ := model.ParseConvID(req.ConvID)
+	var uids []uint64
+	if typ == model.ConvSingle {
+		for _, id := range ids {
+			if id != uid {
+				uids = append(uids, id)
+			}
+		}
+	} else {
+		members, err := s.store.Group.Members(ctx, ids[0])
+		if err != nil {
+			log.ErrorContextf(ctx, "get group members fail, group:%d, err:%v", ids[0], err)
+			return nil, ierr.ErrSystem
+		}
+		if len(members) > info.SignalMaxGroup {
+			return &SignalRsp{}, nil
+		}
+		for _, m := range members {
+			if m.Uid != uid {
+				uids = append(uids, m.Uid)
+			}
+		}
+	}
+	if len(uids) == 0 {
+		return &SignalRsp{}, nil
+	}
+
+	expire := now.Add(time.Duration(info.SignalTTL) * time.Second).UnixMilli()
+	ev := &model.Event{
+		Type:     model.EventSignal,
+		ConvID:   req.ConvID,
+		Operator: uid,
+		Time:     now.UnixMilli(),
+		Priority: model.PrioritySilent,
+		Signal:   &model.Signal{Kind: req.Kind, ExpireTime: expire},
+	}
+	if err = s.pusher.Push(ctx, uids, ev); err != nil {
+		log.WarnContextf(ctx, "push signal fail, uid:%d, conv:%s, err:%v", uid, req.ConvID, err)
+	}
+	return &SignalRsp{Relayed: true, ExpireTime: expire}, nil
+}
@@ -0,0 +1,132 @@
+package message
+
+import (
+	"context"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+	"github.com/binbin6363/icuc/im/app/store"
+)
+
+// attachRef 根据请求填充消息的引用信息，父消息必须在同一会话且未撤回
+func (s *Service) attachRef(ctx context.Context, msg *model.Message, req *SendReq) error {
+	if req.ReplyTo == 0 {
+		return nil
+	}
+	parent, err := s.loadMsg(ctx, req.ReplyTo)
+	if err != nil {
+		return err
+	}
+	if parent.ConvID != msg.ConvID {
+		return ierr.ErrParam
+	}
+	if parent.Recalled() {
+		return ierr.ErrMsgRecalled
+	}
+	ref := &model.MsgRef{
+		Mode:    req.RefMode,
+		MsgID:   parent.ID,
+		Sender:  parent.Sender,
+		Snippet: parent.Snippet(),
+		Edited:  parent.Edited(),
+	}
+	switch ref.Mode {
+	case 0:
+		ref.Mode = model.RefQuote
+	case model.RefQuote:
+	case model.RefThread:
+		// 回复话题内的消息时归到同一个根消息下
+		ref.RootID = parent.ID
+		if parent.Ref != nil && parent.Ref.Mode == model.RefThread {
+			ref.RootID = parent.Ref.RootID
+		}
+	default:
+		return ierr.ErrParam
+	}
+	msg.Ref = ref
+	return nil
+}
+
+// resolveRef 用父消息的当前状态刷新引用摘要，父消息撤回后不再展示原文
+func (s *Service) resolveRef(ctx context.Context, msg *model.Message) {
+	if msg.Ref == nil {
+		return
+	}
+	parent, err := s.store.Message.Get(ctx, msg.Ref.MsgID)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.WarnContextf(ctx, "get ref msg fail, id:%d, err:%v", msg.Ref.MsgID, err)
+		}
+		return
+	}
+	msg.Ref.Snippet = parent.Snippet()
+	msg.Ref.Recalled = parent.Recalled()
+	msg.Ref.Edited = parent.Edited()
+}
+
+// ThreadReq 分页拉取话题回复
+type ThreadReq struct {
+	RootID uint64 `form:"root_id"`
+	Cursor int    `form:"cursor"` // 上一页返回的next_cursor，首页为0
+	Limit  int    `form:"limit"`
+}
+
+// ThreadRsp 话题回复分页结果
+type ThreadRsp struct {
+	Info       *model.ThreadInfo `json:"info"`
+	Replies    []*model.Message  `json:"replies"`
+	NextCursor int               `json:"next_cursor"`
+	HasMore    bool              `json:"has_more"`
+}
+
+const maxThreadLimit = 100
+
+// Thread 按回复时间顺序分页拉取话题回复
+func (s *Service) Thread(ctx context.Context, uid uint64, req *ThreadReq) (*ThreadRsp, error) {
+	if req.Cursor < 0 {
+		return nil, ierr.ErrParam
+	}
+	if req.Limit <= 0 || req.Limit > maxThreadLimit {
+		req.Limit = maxThreadLimit
+	}
+	root, err := s.loadMsg(ctx, req.RootID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkView(ctx, uid, root); err != nil {
+		return nil, err
+	}
+
+	rsp := &ThreadRsp{Info: &model.ThreadInfo{RootID: root.ID}, NextCursor: req.Cursor}
+	info, err := s.store.Thread.Info(ctx, root.ID)
+	if err == store.ErrNotFound {
+		return rsp, nil
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "get thread info fail, root:%d, err:%v", root.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	rsp.Info = info
+
+	ids, err := s.store.Thread.Replies(ctx, root.ID, req.Cursor, req.Limit+1)
+	if err != nil {
+		log.ErrorContextf(ctx, "list thread replies fail, root:%d, err:%v", root.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	if len(ids) > req.Limit {
+		ids = ids[:req.Limit]
+		rsp.HasMore = true
+	}
+	for _, id := range ids {
+		msg, err := s.loadMsg(ctx, id)
+		if err != nil {
+			log.WarnContextf(ctx, "load thread reply fail, root:%d, id:%d, err:%v", root.ID, id, err)
+			continue
+		}
+		s.resolveRef(ctx, msg)
+		rsp.Replies = append(rsp.Replies, msg)
+	}
+	rsp.NextCursor = req.Cursor + len(ids)
+	return rsp, nil
+}
@@ -0,0 +1,102 @@
+package message
+
+import (
+	"context"
+	"time"
+
+	ierr "github.com/binbin6363/icuc/common/err"
+	"github.com/binbin6363/icuc/common/log"
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// PlayReq 标记语音已收听
+type PlayReq struct {
+	MsgID uint64 `json:"msg_id,string"`
+}
+
+// PlayRsp .
+type PlayRsp struct{}
+
+// Play 接收者首次收听语音时记录，并在线通知发送者和自己的其他端
+func (s *Service) Play(ctx context.Context, uid uint64, req *PlayReq) (*PlayRsp, error) {
+	msg, err := s.loadVoice(ctx, uid, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Sender == uid {
+		return &PlayRsp{}, nil
+	}
+	now := time.Now().UnixMilli()
+	first, err := s.store.Played.Mark(ctx, msg.ID, uid, now)
+	if err != nil {
+		log.ErrorContextf(ctx, "mark played fail, msg:%d, uid:%d, err:%v", msg.ID, uid, err)
+		return nil, ierr.ErrSystem
+	}
+	if first {
+		ev := &model.Event{
+			Type:     model.EventPlayed,
+			ConvID:   msg.ConvID,
+			MsgID:    msg.ID,
+			Operator: uid,
+			Time:     now,
+			Played:   &model.Played{Uid: uid, Time: now},
+		}
+		if err = s.pusher.Push(ctx, []uint64{msg.Sender, uid}, ev); err != nil {
+			log.WarnContextf(ctx, "push played fail, msg:%d, err:%v", msg.ID, err)
+		}
+	}
+	return &PlayRsp{}, nil
+}
+
+// PlayedReq 查询语音收听状态
+type PlayedReq struct {
+	MsgID uint64 `form:"msg_id"`
+}
+
+// PlayedRsp 收听状态，收听列表只返回给发送者
+type PlayedRsp struct {
+	Played bool            `json:"played"` // 当前用户是否已收听
+	List   []*model.Played `json:"list,omitempty"`
+}
+
+// Played 查询语音收听状态
+func (s *Service) Played(ctx context.Context, uid uint64, req *PlayedReq) (*PlayedRsp, error) {
+	msg, err := s.loadVoice(ctx, uid, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.store.Played.List(ctx, msg.ID)
+	if err != nil {
+		log.ErrorContextf(ctx, "list played fail, msg:%d, err:%v", msg.ID, err)
+		return nil, ierr.ErrSystem
+	}
+	rsp := &PlayedRsp{}
+	for _, p := range list {
+		if p.Uid == uid {
+			rsp.Played = true
+		}
+	}
+	if msg.Sender == uid {
+		rsp.Played = true
+		rsp.List = list
+	}
+	return rsp, nil
+}
+
+// loadVoice 获取当前用户可见且未撤回的语音消息
+func (s *Service) loadVoice(ctx context.Context, uid, msgID uint64) (*model.Message, error) {
+	msg, err := s.loadMsg(ctx, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkView(ctx, uid, msg); err != nil {
+		return nil, err
+	}
+	if msg.Type != model.MsgVoice {
+		return nil, ierr.ErrParam
+	}
+	if msg.Recalled() {
+		return nil, ierr.ErrMsgRecalled
+	}
+	return msg, nil
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemAuditStore 基于内存的审计记录
+type MemAuditStore struct {
+	mu      sync.Mutex
+	records []*model.AuditRecord
+}
+
+// NewMemAuditStore .
+func NewMemAuditStore() *MemAuditStore {
+	return &MemAuditStore{}
+}
+
+// Record .
+func (s *MemAuditStore) Record(ctx context.Context, rec *model.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	return nil
+}
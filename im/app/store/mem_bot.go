@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemBotStore 基于内存的机器人账号
+type MemBotStore struct {
+	mu     sync.RWMutex
+	bots   map[uint64]*model.Bot
+	tokens map[string]uint64
+}
+
+// NewMemBotStore .
+func NewMemBotStore() *MemBotStore {
+	return &MemBotStore{bots: make(map[uint64]*model.Bot), tokens: make(map[string]uint64)}
+}
+
+// Save .
+func (s *MemBotStore) Save(ctx context.Context, bot *model.Bot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.bots[bot.Uid]; ok {
+		delete(s.tokens, old.TokenHash)
+	}
+	s.bots[bot.Uid] = bot.Clone()
+	s.tokens[bot.TokenHash] = bot.Uid
+	return nil
+}
+
+// Get .
+func (s *MemBotStore) Get(ctx context.Context, uid uint64) (*model.Bot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.bots[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b.Clone(), nil
+}
+
+// ByToken .
+func (s *MemBotStore) ByToken(ctx context.Context, tokenHash string) (*model.Bot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	uid, ok := s.tokens[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.bots[uid].Clone(), nil
+}
+
+// List .
+func (s *MemBotStore) List(ctx context.Context, owner uint64) ([]*model.Bot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*model.Bot
+	for _, b := range s.bots {
+		if b.Owner == owner {
+			list = append(list, b.Clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreateTime < list[j].CreateTime })
+	return list, nil
+}
+
+// Bots .
+func (s *MemBotStore) Bots(ctx context.Context, uids []uint64) ([]*model.Bot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*model.Bot
+	for _, uid := range uids {
+		if b, ok := s.bots[uid]; ok {
+			list = append(list, b.Clone())
+		}
+	}
+	return list, nil
+}
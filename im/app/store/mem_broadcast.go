@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemBroadcastStore 基于内存的系统广播，时间线上第i条广播的seq为i+1
+type MemBroadcastStore struct {
+	mu        sync.Mutex
+	items     map[uint64]*model.Broadcast
+	timeline  []uint64
+	cursors   map[uint64]uint64
+	delivered map[uint64]int
+	reads     map[uint64]map[uint64]bool
+}
+
+// NewMemBroadcastStore .
+func NewMemBroadcastStore() *MemBroadcastStore {
+	return &MemBroadcastStore{
+		items:     make(map[uint64]*model.Broadcast),
+		cursors:   make(map[uint64]uint64),
+		delivered: make(map[uint64]int),
+		reads:     make(map[uint64]map[uint64]bool),
+	}
+}
+
+// Create .
+func (s *MemBroadcastStore) Create(ctx context.Context, b *model.Broadcast) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[b.ID] = b.Clone()
+	return nil
+}
+
+// Get .
+func (s *MemBroadcastStore) Get(ctx context.Context, id uint64) (*model.Broadcast, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b.Clone(), nil
+}
+
+// Cancel .
+func (s *MemBroadcastStore) Cancel(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.items[id]
+	if !ok || b.Status == model.BroadcastCanceled {
+		return ErrNotFound
+	}
+	b.Status = model.BroadcastCanceled
+	return nil
+}
+
+// PublishDue .
+func (s *MemBroadcastStore) PublishDue(ctx context.Context, now int64) ([]*model.Broadcast, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*model.Broadcast
+	for _, b := range s.items {
+		if b.Status == model.BroadcastScheduled && b.PublishTime <= now {
+			due = append(due, b)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].PublishTime != due[j].PublishTime {
+			return due[i].PublishTime < due[j].PublishTime
+		}
+		return due[i].ID < due[j].ID
+	})
+	out := make([]*model.Broadcast, 0, len(due))
+	for _, b := range due {
+		s.timeline = append(s.timeline, b.ID)
+		b.Seq = uint64(len(s.timeline))
+		b.Status = model.BroadcastPublished
+		out = append(out, b.Clone())
+	}
+	return out, nil
+}
+
+// Since .
+func (s *MemBroadcastStore) Since(ctx context.Context, after uint64, limit int) ([]*model.Broadcast, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*model.Broadcast
+	for i := after; i < uint64(len(s.timeline)) && len(out) < limit; i++ {
+		out = append(out, s.items[s.timeline[i]].Clone())
+	}
+	return out, nil
+}
+
+// Advance .
+func (s *MemBroadcastStore) Advance(ctx context.Context, uid uint64, seq uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.cursors[uid]
+	if seq > old {
+		s.cursors[uid] = seq
+	}
+	return old, nil
+}
+
+// AddDelivered .
+func (s *MemBroadcastStore) AddDelivered(ctx context.Context, ids []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.delivered[id]++
+	}
+	return nil
+}
+
+// MarkRead .
+func (s *MemBroadcastStore) MarkRead(ctx context.Context, id, uid uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.reads[id]
+	if !ok {
+		m = make(map[uint64]bool)
+		s.reads[id] = m
+	}
+	if m[uid] {
+		return false, nil
+	}
+	m[uid] = true
+	return true, nil
+}
+
+// Stats .
+func (s *MemBroadcastStore) Stats(ctx context.Context, id uint64) (*model.BroadcastStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		return nil, ErrNotFound
+	}
+	return &model.BroadcastStats{BroadcastID: id, Delivered: s.delivered[id], Read: len(s.reads[id])}, nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemConversationStore 基于内存的最近会话存储
+type MemConversationStore struct {
+	mu       sync.Mutex
+	convs    map[uint64]map[string]*model.Conversation
+	versions map[uint64]uint64
+}
+
+// NewMemConversationStore .
+func NewMemConversationStore() *MemConversationStore {
+	return &MemConversationStore{
+		convs:    make(map[uint64]map[string]*model.Conversation),
+		versions: make(map[uint64]uint64),
+	}
+}
+
+// Update .
+func (s *MemConversationStore) Update(ctx context.Context, uid uint64, convID string,
+	fn func(conv *model.Conversation) bool) (*model.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conv := &model.Conversation{Uid: uid, ConvID: convID}
+	if old, ok := s.convs[uid][convID]; ok {
+		conv = old.Clone()
+	}
+	if !fn(conv) {
+		return nil, nil
+	}
+	s.versions[uid]++
+	conv.Version = s.versions[uid]
+	if s.convs[uid] == nil {
+		s.convs[uid] = make(map[string]*model.Conversation)
+	}
+	s.convs[uid][convID] = conv
+	return conv.Clone(), nil
+}
+
+// Get .
+func (s *MemConversationStore) Get(ctx context.Context, uid uint64, convID string) (*model.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conv, ok := s.convs[uid][convID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return conv.Clone(), nil
+}
+
+// List .
+func (s *MemConversationStore) List(ctx context.Context, uid uint64) ([]*model.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*model.Conversation, 0, len(s.convs[uid]))
+	for _, conv := range s.convs[uid] {
+		list = append(list, conv.Clone())
+	}
+	return list, nil
+}
+
+// Changes .
+func (s *MemConversationStore) Changes(ctx context.Context, uid uint64, after uint64, limit int) ([]*model.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*model.Conversation
+	for _, conv := range s.convs[uid] {
+		if conv.Version > after {
+			list = append(list, conv.Clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemCustomTypeStore 基于内存的自定义消息类型存储
+type MemCustomTypeStore struct {
+	mu    sync.RWMutex
+	types map[string]*model.CustomType
+}
+
+// NewMemCustomTypeStore .
+func NewMemCustomTypeStore() *MemCustomTypeStore {
+	return &MemCustomTypeStore{types: make(map[string]*model.CustomType)}
+}
+
+// Save .
+func (s *MemCustomTypeStore) Save(ctx context.Context, ct *model.CustomType) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *ct
+	s.types[ct.Name] = &c
+	return nil
+}
+
+// Get .
+func (s *MemCustomTypeStore) Get(ctx context.Context, name string) (*model.CustomType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ct, ok := s.types[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *ct
+	return &c, nil
+}
+
+// List .
+func (s *MemCustomTypeStore) List(ctx context.Context) ([]*model.CustomType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*model.CustomType, 0, len(s.types))
+	for _, ct := range s.types {
+		c := *ct
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+const (
+	defaultDedupCapacity = 100000
+	defaultDedupTTL      = 5 * time.Minute
+)
+
+type dedupEntry struct {
+	key    string
+	res    model.SendResult
+	expire time.Time
+}
+
+// MemDedupStore 基于LRU和TTL的内存去重存储，超过容量时淘汰最久未访问的记录
+type MemDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// NewMemDedupStore capacity为最多保存的记录数，ttl为去重窗口
+func NewMemDedupStore(capacity int, ttl time.Duration) *MemDedupStore {
+	return &MemDedupStore{
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get .
+func (s *MemDedupStore) Get(ctx context.Context, key string) (*model.SendResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	e := el.Value.(*dedupEntry)
+	if time.Now().After(e.expire) {
+		s.remove(el)
+		return nil, ErrNotFound
+	}
+	s.ll.MoveToFront(el)
+	res := e.res
+	return &res, nil
+}
+
+// Set .
+func (s *MemDedupStore) Set(ctx context.Context, key string, res *model.SendResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expire := time.Now().Add(s.ttl)
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*dedupEntry)
+		e.res = *res
+		e.expire = expire
+		s.ll.MoveToFront(el)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&dedupEntry{key: key, res: *res, expire: expire})
+	for s.capacity > 0 && s.ll.Len() > s.capacity {
+		s.remove(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *MemDedupStore) remove(el *list.Element) {
+	s.ll.Remove(el)
+	delete(s.items, el.Value.(*dedupEntry).key)
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+func TestMemDedupStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemDedupStore(2, 50*time.Millisecond)
+	s.Set(ctx, "a", &model.SendResult{MsgID: 1})
+	s.Set(ctx, "b", &model.SendResult{MsgID: 2})
+	if res, err := s.Get(ctx, "a"); err != nil || res.MsgID != 1 {
+		t.Fatalf("get a: %v %v", res, err)
+	}
+	// 超过容量时淘汰最久未访问的b
+	s.Set(ctx, "c", &model.SendResult{MsgID: 3})
+	if _, err := s.Get(ctx, "b"); err != ErrNotFound {
+		t.Fatalf("b not evicted: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := s.Get(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("a not expired: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// MemDeletionStore 基于内存的仅自己删除记录
+type MemDeletionStore struct {
+	mu      sync.RWMutex
+	deleted map[uint64]map[uint64]bool
+}
+
+// NewMemDeletionStore .
+func NewMemDeletionStore() *MemDeletionStore {
+	return &MemDeletionStore{deleted: make(map[uint64]map[uint64]bool)}
+}
+
+// Add .
+func (s *MemDeletionStore) Add(ctx context.Context, uid uint64, msgIDs []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deleted[uid] == nil {
+		s.deleted[uid] = make(map[uint64]bool)
+	}
+	for _, id := range msgIDs {
+		s.deleted[uid][id] = true
+	}
+	return nil
+}
+
+// Filter .
+func (s *MemDeletionStore) Filter(ctx context.Context, uid uint64, msgIDs []uint64) (map[uint64]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deleted := make(map[uint64]bool)
+	for _, id := range msgIDs {
+		if s.deleted[uid][id] {
+			deleted[id] = true
+		}
+	}
+	return deleted, nil
+}
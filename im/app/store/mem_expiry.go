@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// expiryEntry 一条到期登记，owner非空且租约未过期时表示正在被某个实例清理
+type expiryEntry struct {
+	msgID    uint64
+	expireAt int64
+	owner    string
+	lease    int64
+}
+
+// awaitEntry 等待首次阅读的消息
+type awaitEntry struct {
+	seq    uint64
+	msgID  uint64
+	sender uint64
+}
+
+// MemExpiryStore 基于内存的到期调度，只在单个进程内有效，重启后登记丢失；多实例部署或需要重启后保留时使用SQLExpiryStore
+type MemExpiryStore struct {
+	mu      sync.Mutex
+	entries map[uint64]*expiryEntry
+	awaits  map[string][]awaitEntry
+}
+
+// NewMemExpiryStore .
+func NewMemExpiryStore() *MemExpiryStore {
+	return &MemExpiryStore{entries: make(map[uint64]*expiryEntry), awaits: make(map[string][]awaitEntry)}
+}
+
+// Schedule .
+func (s *MemExpiryStore) Schedule(ctx context.Context, msgID uint64, expireAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[msgID] = &expiryEntry{msgID: msgID, expireAt: expireAt}
+	return nil
+}
+
+// Await .
+func (s *MemExpiryStore) Await(ctx context.Context, convID string, seq, msgID, sender uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.awaits[convID] = append(s.awaits[convID], awaitEntry{seq: seq, msgID: msgID, sender: sender})
+	return nil
+}
+
+// Start .
+func (s *MemExpiryStore) Start(ctx context.Context, convID string, seq, reader uint64) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []uint64
+	rest := s.awaits[convID][:0]
+	for _, e := range s.awaits[convID] {
+		if e.seq <= seq && e.sender != reader {
+			ids = append(ids, e.msgID)
+			continue
+		}
+		rest = append(rest, e)
+	}
+	if len(rest) == 0 {
+		delete(s.awaits, convID)
+	} else {
+		s.awaits[convID] = rest
+	}
+	return ids, nil
+}
+
+// Claim .
+func (s *MemExpiryStore) Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*expiryEntry
+	for _, e := range s.entries {
+		if e.expireAt <= now && (e.owner == "" || e.lease <= now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].expireAt < due[j].expireAt })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	ids := make([]uint64, 0, len(due))
+	for _, e := range due {
+		e.owner = owner
+		e.lease = now + lease.Milliseconds()
+		ids = append(ids, e.msgID)
+	}
+	return ids, nil
+}
+
+// Remove .
+func (s *MemExpiryStore) Remove(ctx context.Context, msgID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, msgID)
+	return nil
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// MemFriendStore 基于内存的好友关系
+type MemFriendStore struct {
+	mu      sync.RWMutex
+	friends map[uint64]map[uint64]bool
+}
+
+// NewMemFriendStore .
+func NewMemFriendStore() *MemFriendStore {
+	return &MemFriendStore{friends: make(map[uint64]map[uint64]bool)}
+}
+
+// Add .
+func (s *MemFriendStore) Add(ctx context.Context, a, b uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range [][2]uint64{{a, b}, {b, a}} {
+		if s.friends[p[0]] == nil {
+			s.friends[p[0]] = make(map[uint64]bool)
+		}
+		s.friends[p[0]][p[1]] = true
+	}
+	return nil
+}
+
+// IsFriend .
+func (s *MemFriendStore) IsFriend(ctx context.Context, a, b uint64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.friends[a][b], nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemGroupStore 基于内存的群成员存储
+type MemGroupStore struct {
+	mu      sync.RWMutex
+	members map[uint64]map[uint64]*model.GroupMember
+}
+
+// NewMemGroupStore .
+func NewMemGroupStore() *MemGroupStore {
+	return &MemGroupStore{members: make(map[uint64]map[uint64]*model.GroupMember)}
+}
+
+// Member .
+func (s *MemGroupStore) Member(ctx context.Context, groupID, uid uint64) (*model.GroupMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.members[groupID][uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *m
+	return &c, nil
+}
+
+// Members .
+func (s *MemGroupStore) Members(ctx context.Context, groupID uint64) ([]*model.GroupMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*model.GroupMember, 0, len(s.members[groupID]))
+	for _, m := range s.members[groupID] {
+		c := *m
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+// AddMember .
+func (s *MemGroupStore) AddMember(ctx context.Context, member *model.GroupMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.members[member.GroupID] == nil {
+		s.members[member.GroupID] = make(map[uint64]*model.GroupMember)
+	}
+	c := *member
+	s.members[member.GroupID][member.Uid] = &c
+	return nil
+}
+
+// RemoveMember .
+func (s *MemGroupStore) RemoveMember(ctx context.Context, groupID, uid uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.members[groupID][uid]; !ok {
+		return ErrNotFound
+	}
+	delete(s.members[groupID], uid)
+	return nil
+}
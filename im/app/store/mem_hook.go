@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// hookEntry 一条投递记录，owner非空且租约未过期时表示正在被某个实例投递
+type hookEntry struct {
+	d     *model.HookDelivery
+	owner string
+	lease int64
+}
+
+// MemHookStore 基于内存的出站事件投递队列
+type MemHookStore struct {
+	mu      sync.Mutex
+	entries map[uint64]*hookEntry
+}
+
+// NewMemHookStore .
+func NewMemHookStore() *MemHookStore {
+	return &MemHookStore{entries: make(map[uint64]*hookEntry)}
+}
+
+// Enqueue .
+func (s *MemHookStore) Enqueue(ctx context.Context, d *model.HookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[d.ID] = &hookEntry{d: d.Clone()}
+	return nil
+}
+
+// Claim .
+func (s *MemHookStore) Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]*model.HookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*hookEntry
+	for _, e := range s.entries {
+		if e.d.Status == model.HookPending && e.d.NextTime <= now && (e.owner == "" || e.lease <= now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].d.NextTime < due[j].d.NextTime })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	list := make([]*model.HookDelivery, 0, len(due))
+	for _, e := range due {
+		e.owner = owner
+		e.lease = now + lease.Milliseconds()
+		list = append(list, e.d.Clone())
+	}
+	return list, nil
+}
+
+// Finish .
+func (s *MemHookStore) Finish(ctx context.Context, d *model.HookDelivery, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[d.ID]
+	if !ok || e.owner != owner || e.d.Status != model.HookPending {
+		return ErrNotFound
+	}
+	if d.Status == model.HookDelivered {
+		delete(s.entries, d.ID)
+		return nil
+	}
+	e.d = d.Clone()
+	e.owner, e.lease = "", 0
+	return nil
+}
+
+// Dead .
+func (s *MemHookStore) Dead(ctx context.Context, bot uint64, limit int) ([]*model.HookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*model.HookDelivery
+	for _, e := range s.entries {
+		if e.d.Bot == bot && e.d.Status == model.HookDead {
+			list = append(list, e.d.Clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdateTime > list[j].UpdateTime })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemInboxStore 基于内存的收件箱
+type MemInboxStore struct {
+	mu    sync.RWMutex
+	items map[uint64][]*model.InboxItem
+}
+
+// NewMemInboxStore .
+func NewMemInboxStore() *MemInboxStore {
+	return &MemInboxStore{items: make(map[uint64][]*model.InboxItem)}
+}
+
+// Append .
+func (s *MemInboxStore) Append(ctx context.Context, uid uint64, ev *model.Event) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.items[uid]
+	seq := uint64(1)
+	if n := len(items); n > 0 {
+		seq = items[n-1].Seq + 1
+	}
+	s.items[uid] = append(items, &model.InboxItem{Seq: seq, Event: ev})
+	return seq, nil
+}
+
+// Sync .
+func (s *MemInboxStore) Sync(ctx context.Context, uid uint64, afterSeq uint64, limit int) ([]*model.InboxItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := s.items[uid]
+	i := sort.Search(len(items), func(i int) bool { return items[i].Seq > afterSeq })
+	end := len(items)
+	if limit > 0 && i+limit < end {
+		end = i + limit
+	}
+	return append([]*model.InboxItem(nil), items[i:end]...), nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// deviceKey 用户的一个设备
+type deviceKey struct {
+	uid      uint64
+	deviceID string
+}
+
+// MemKeyStore 基于内存的公钥目录，一次性公钥按id升序取用
+type MemKeyStore struct {
+	mu      sync.Mutex
+	devices map[uint64]map[string]*model.DeviceKeys
+	prekeys map[deviceKey][]*model.PreKey
+}
+
+// NewMemKeyStore .
+func NewMemKeyStore() *MemKeyStore {
+	return &MemKeyStore{
+		devices: make(map[uint64]map[string]*model.DeviceKeys),
+		prekeys: make(map[deviceKey][]*model.PreKey),
+	}
+}
+
+// SaveDevice .
+func (s *MemKeyStore) SaveDevice(ctx context.Context, keys *model.DeviceKeys) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.devices[keys.Uid]
+	if !ok {
+		m = make(map[string]*model.DeviceKeys)
+		s.devices[keys.Uid] = m
+	}
+	m[keys.DeviceID] = keys.Clone()
+	return nil
+}
+
+// Devices .
+func (s *MemKeyStore) Devices(ctx context.Context, uid uint64) ([]*model.DeviceKeys, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*model.DeviceKeys, 0, len(s.devices[uid]))
+	for _, d := range s.devices[uid] {
+		list = append(list, d.Clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list, nil
+}
+
+// RemoveDevice .
+func (s *MemKeyStore) RemoveDevice(ctx context.Context, uid uint64, deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.devices[uid], deviceID)
+	if len(s.devices[uid]) == 0 {
+		delete(s.devices, uid)
+	}
+	delete(s.prekeys, deviceKey{uid: uid, deviceID: deviceID})
+	return nil
+}
+
+// AddPreKeys .
+func (s *MemKeyStore) AddPreKeys(ctx context.Context, uid uint64, deviceID string, keys []*model.PreKey) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := deviceKey{uid: uid, deviceID: deviceID}
+	list := s.prekeys[k]
+	for _, pk := range keys {
+		c := *pk
+		i := sort.Search(len(list), func(i int) bool { return list[i].ID >= pk.ID })
+		if i < len(list) && list[i].ID == pk.ID {
+			list[i] = &c
+			continue
+		}
+		list = append(list, nil)
+		copy(list[i+1:], list[i:])
+		list[i] = &c
+	}
+	s.prekeys[k] = list
+	return len(list), nil
+}
+
+// TakePreKey .
+func (s *MemKeyStore) TakePreKey(ctx context.Context, uid uint64, deviceID string) (*model.PreKey, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := deviceKey{uid: uid, deviceID: deviceID}
+	list := s.prekeys[k]
+	if len(list) == 0 {
+		return nil, 0, ErrNotFound
+	}
+	pk := list[0]
+	s.prekeys[k] = list[1:]
+	return pk, len(list) - 1, nil
+}
+
+// CountPreKeys .
+func (s *MemKeyStore) CountPreKeys(ctx context.Context, uid uint64, deviceID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.prekeys[deviceKey{uid: uid, deviceID: deviceID}]), nil
+}
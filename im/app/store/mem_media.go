@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemMediaStore 基于内存的媒体文件记录
+type MemMediaStore struct {
+	mu     sync.RWMutex
+	medias map[uint64]*model.Media
+}
+
+// NewMemMediaStore .
+func NewMemMediaStore() *MemMediaStore {
+	return &MemMediaStore{medias: make(map[uint64]*model.Media)}
+}
+
+// Save .
+func (s *MemMediaStore) Save(ctx context.Context, media *model.Media) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *media
+	s.medias[media.ID] = &c
+	return nil
+}
+
+// Get .
+func (s *MemMediaStore) Get(ctx context.Context, id uint64) (*model.Media, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.medias[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *m
+	return &c, nil
+}
+
+// Delete .
+func (s *MemMediaStore) Delete(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.medias, id)
+	return nil
+}
+
+// Stale .
+func (s *MemMediaStore) Stale(ctx context.Context, before int64, limit int) ([]*model.Media, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*model.Media
+	for _, m := range s.medias {
+		if len(list) >= limit {
+			break
+		}
+		if !m.Attached && m.CreateTime < before {
+			c := *m
+			list = append(list, &c)
+		}
+	}
+	return list, nil
+}
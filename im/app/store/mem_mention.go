@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemMentionStore 基于内存的@标记存储
+type MemMentionStore struct {
+	mu       sync.RWMutex
+	mentions map[uint64][]*model.Mention
+}
+
+// NewMemMentionStore .
+func NewMemMentionStore() *MemMentionStore {
+	return &MemMentionStore{mentions: make(map[uint64][]*model.Mention)}
+}
+
+// Add .
+func (s *MemMentionStore) Add(ctx context.Context, uid uint64, mention *model.Mention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *mention
+	s.mentions[uid] = append(s.mentions[uid], &c)
+	return nil
+}
+
+// Clear .
+func (s *MemMentionStore) Clear(ctx context.Context, uid uint64, convID string, uptoSeq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.mentions[uid][:0]
+	for _, m := range s.mentions[uid] {
+		if m.ConvID == convID && m.Seq <= uptoSeq {
+			continue
+		}
+		list = append(list, m)
+	}
+	s.mentions[uid] = list
+	return nil
+}
+
+// Remove .
+func (s *MemMentionStore) Remove(ctx context.Context, uid uint64, msgID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.mentions[uid][:0]
+	for _, m := range s.mentions[uid] {
+		if m.MsgID != msgID {
+			list = append(list, m)
+		}
+	}
+	s.mentions[uid] = list
+	return nil
+}
+
+// List .
+func (s *MemMentionStore) List(ctx context.Context, uid uint64) ([]*model.Mention, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*model.Mention, 0, len(s.mentions[uid]))
+	for _, m := range s.mentions[uid] {
+		c := *m
+		list = append(list, &c)
+	}
+	return list, nil
+}
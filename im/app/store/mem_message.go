@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemMessageStore 基于内存的消息存储
+type MemMessageStore struct {
+	mu    sync.RWMutex
+	msgs  map[uint64]*model.Message
+	seqs  map[string]uint64   // 会话id -> 当前最大seq
+	convs map[string][]uint64 // 会话id -> 按seq排列的消息id，下标为seq-1
+	log   []uint64            // 写入记录，下标为Change-1，值为消息id
+}
+
+// NewMemMessageStore .
+func NewMemMessageStore() *MemMessageStore {
+	return &MemMessageStore{
+		msgs:  make(map[uint64]*model.Message),
+		seqs:  make(map[string]uint64),
+		convs: make(map[string][]uint64),
+	}
+}
+
+// Save .
+func (s *MemMessageStore) Save(ctx context.Context, msg *model.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.msgs[msg.ID]; ok {
+		return ErrConflict
+	}
+	s.seqs[msg.ConvID]++
+	msg.Seq = s.seqs[msg.ConvID]
+	msg.Rev = 0
+	s.log = append(s.log, msg.ID)
+	msg.Change = uint64(len(s.log))
+	s.msgs[msg.ID] = msg.Clone()
+	s.convs[msg.ConvID] = append(s.convs[msg.ConvID], msg.ID)
+	return nil
+}
+
+// List .
+func (s *MemMessageStore) List(ctx context.Context, convID string, anchor uint64, forward bool, limit int) ([]*model.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := s.convs[convID]
+	start, end := 0, len(ids)
+	if forward {
+		if anchor < uint64(len(ids)) {
+			start = int(anchor)
+		} else {
+			start = len(ids)
+		}
+		if start+limit < end {
+			end = start + limit
+		}
+	} else {
+		if anchor > 0 && anchor-1 < uint64(len(ids)) {
+			end = int(anchor - 1)
+		}
+		if end > limit {
+			start = end - limit
+		}
+	}
+	list := make([]*model.Message, 0, end-start)
+	for _, id := range ids[start:end] {
+		list = append(list, s.msgs[id].Clone())
+	}
+	return list, nil
+}
+
+// Get .
+func (s *MemMessageStore) Get(ctx context.Context, msgID uint64) (*model.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	msg, ok := s.msgs[msgID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return msg.Clone(), nil
+}
+
+// UpdateIf .
+func (s *MemMessageStore) UpdateIf(ctx context.Context, msg *model.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.msgs[msg.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if old.Rev != msg.Rev {
+		return ErrConflict
+	}
+	msg.Rev++
+	s.log = append(s.log, msg.ID)
+	msg.Change = uint64(len(s.log))
+	c := msg.Clone()
+	c.Seq = old.Seq
+	s.msgs[msg.ID] = c
+	return nil
+}
+
+// Changes 跳过之后又被写入过的记录，只在最后一次写入的位置返回
+func (s *MemMessageStore) Changes(ctx context.Context, after uint64, limit int) ([]*model.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*model.Message
+	for i := after; i < uint64(len(s.log)) && len(list) < limit; i++ {
+		msg := s.msgs[s.log[i]]
+		if msg.Change == i+1 {
+			list = append(list, msg.Clone())
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// MemMuteStore 基于内存的账号禁言
+type MemMuteStore struct {
+	mu    sync.RWMutex
+	until map[uint64]int64
+}
+
+// NewMemMuteStore .
+func NewMemMuteStore() *MemMuteStore {
+	return &MemMuteStore{until: make(map[uint64]int64)}
+}
+
+// Mute .
+func (s *MemMuteStore) Mute(ctx context.Context, uid uint64, until int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until > s.until[uid] {
+		s.until[uid] = until
+	}
+	return nil
+}
+
+// Until .
+func (s *MemMuteStore) Until(ctx context.Context, uid uint64) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.until[uid], nil
+}
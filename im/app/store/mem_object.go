@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemObjectStore 基于内存的存储对象引用计数
+type MemObjectStore struct {
+	mu      sync.Mutex
+	objects map[string]*model.Object
+}
+
+// NewMemObjectStore .
+func NewMemObjectStore() *MemObjectStore {
+	return &MemObjectStore{objects: make(map[string]*model.Object)}
+}
+
+// Get .
+func (s *MemObjectStore) Get(ctx context.Context, key string) (*model.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *o
+	return &c, nil
+}
+
+// Acquire .
+func (s *MemObjectStore) Acquire(ctx context.Context, key string) (*model.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	o.RefCount++
+	c := *o
+	return &c, nil
+}
+
+// Create .
+func (s *MemObjectStore) Create(ctx context.Context, obj *model.Object) (*model.Object, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o, ok := s.objects[obj.Key]; ok {
+		o.RefCount++
+		c := *o
+		return &c, false, nil
+	}
+	c := *obj
+	c.RefCount = 1
+	s.objects[obj.Key] = &c
+	ret := c
+	return &ret, true, nil
+}
+
+// Release .
+func (s *MemObjectStore) Release(ctx context.Context, key string) (*model.Object, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, false, ErrNotFound
+	}
+	o.RefCount--
+	c := *o
+	if o.RefCount <= 0 {
+		delete(s.objects, key)
+		return &c, true, nil
+	}
+	return &c, false, nil
+}
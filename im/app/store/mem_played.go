@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemPlayedStore 基于内存的语音收听记录
+type MemPlayedStore struct {
+	mu     sync.RWMutex
+	played map[uint64][]*model.Played
+}
+
+// NewMemPlayedStore .
+func NewMemPlayedStore() *MemPlayedStore {
+	return &MemPlayedStore{played: make(map[uint64][]*model.Played)}
+}
+
+// Mark .
+func (s *MemPlayedStore) Mark(ctx context.Context, msgID, uid uint64, now int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.played[msgID] {
+		if p.Uid == uid {
+			return false, nil
+		}
+	}
+	s.played[msgID] = append(s.played[msgID], &model.Played{Uid: uid, Time: now})
+	return true, nil
+}
+
+// List .
+func (s *MemPlayedStore) List(ctx context.Context, msgID uint64) ([]*model.Played, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*model.Played, 0, len(s.played[msgID]))
+	for _, p := range s.played[msgID] {
+		c := *p
+		list = append(list, &c)
+	}
+	return list, nil
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+type memReaction struct {
+	emoji string
+	uids  []uint64
+}
+
+// MemReactionStore 基于内存的表情回应存储
+type MemReactionStore struct {
+	mu        sync.RWMutex
+	reactions map[uint64][]*memReaction
+}
+
+// NewMemReactionStore .
+func NewMemReactionStore() *MemReactionStore {
+	return &MemReactionStore{reactions: make(map[uint64][]*memReaction)}
+}
+
+// Add .
+func (s *MemReactionStore) Add(ctx context.Context, msgID uint64, emoji string, uid uint64, maxEmojis, maxUser int) (bool, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var r *memReaction
+	mine := 0
+	for _, item := range s.reactions[msgID] {
+		if item.emoji == emoji {
+			r = item
+		}
+		for _, u := range item.uids {
+			if u == uid {
+				if item == r {
+					return false, len(r.uids), nil
+				}
+				mine++
+				break
+			}
+		}
+	}
+	if mine >= maxUser || r == nil && len(s.reactions[msgID]) >= maxEmojis {
+		return false, 0, ErrLimit
+	}
+	if r == nil {
+		r = &memReaction{emoji: emoji}
+		s.reactions[msgID] = append(s.reactions[msgID], r)
+	}
+	r.uids = append(r.uids, uid)
+	return true, len(r.uids), nil
+}
+
+// Remove .
+func (s *MemReactionStore) Remove(ctx context.Context, msgID uint64, emoji string, uid uint64) (bool, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.reactions[msgID]
+	for i, r := range list {
+		if r.emoji != emoji {
+			continue
+		}
+		for j, u := range r.uids {
+			if u != uid {
+				continue
+			}
+			r.uids = append(r.uids[:j], r.uids[j+1:]...)
+			if len(r.uids) == 0 {
+				s.reactions[msgID] = append(list[:i], list[i+1:]...)
+			}
+			return true, len(r.uids), nil
+		}
+		return false, len(r.uids), nil
+	}
+	return false, 0, nil
+}
+
+// List .
+func (s *MemReactionStore) List(ctx context.Context, msgID uint64) ([]*model.Reaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*model.Reaction, 0, len(s.reactions[msgID]))
+	for _, r := range s.reactions[msgID] {
+		list = append(list, &model.Reaction{
+			Emoji:    r.emoji,
+			Count:    len(r.uids),
+			Reactors: append([]uint64(nil), r.uids...),
+		})
+	}
+	return list, nil
+}
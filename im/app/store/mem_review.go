@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemReviewStore 基于内存的待复核记录
+type MemReviewStore struct {
+	mu      sync.Mutex
+	records []*model.ReviewRecord
+}
+
+// NewMemReviewStore .
+func NewMemReviewStore() *MemReviewStore {
+	return &MemReviewStore{}
+}
+
+// Record .
+func (s *MemReviewStore) Record(ctx context.Context, rec *model.ReviewRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	return nil
+}
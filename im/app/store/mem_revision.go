@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemRevisionStore 基于内存的编辑历史
+type MemRevisionStore struct {
+	mu   sync.RWMutex
+	revs map[uint64][]*model.Revision
+}
+
+// NewMemRevisionStore .
+func NewMemRevisionStore() *MemRevisionStore {
+	return &MemRevisionStore{revs: make(map[uint64][]*model.Revision)}
+}
+
+// Add .
+func (s *MemRevisionStore) Add(ctx context.Context, rev *model.Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *rev
+	s.revs[rev.MsgID] = append(s.revs[rev.MsgID], &c)
+	return nil
+}
+
+// List .
+func (s *MemRevisionStore) List(ctx context.Context, msgID uint64) ([]*model.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*model.Revision, 0, len(s.revs[msgID]))
+	for _, r := range s.revs[msgID] {
+		c := *r
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+// Delete .
+func (s *MemRevisionStore) Delete(ctx context.Context, msgID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.revs, msgID)
+	return nil
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// scheduleEntry 一条定时消息，owner非空且租约未过期时表示正在被某个实例投递
+type scheduleEntry struct {
+	msg   *model.ScheduledMsg
+	owner string
+	lease int64
+}
+
+func (e *scheduleEntry) leased(now int64) bool {
+	return e.owner != "" && e.lease > now
+}
+
+// MemScheduleStore 基于内存的定时消息，只在单个进程内有效，多实例部署时使用SQLScheduleStore
+type MemScheduleStore struct {
+	mu      sync.Mutex
+	entries map[uint64]*scheduleEntry
+	senders map[uint64][]uint64
+}
+
+// NewMemScheduleStore .
+func NewMemScheduleStore() *MemScheduleStore {
+	return &MemScheduleStore{entries: make(map[uint64]*scheduleEntry), senders: make(map[uint64][]uint64)}
+}
+
+// Create .
+func (s *MemScheduleStore) Create(ctx context.Context, m *model.ScheduledMsg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[m.ID] = &scheduleEntry{msg: m.Clone()}
+	s.senders[m.Sender] = append(s.senders[m.Sender], m.ID)
+	return nil
+}
+
+// Get .
+func (s *MemScheduleStore) Get(ctx context.Context, id uint64) (*model.ScheduledMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return e.msg.Clone(), nil
+}
+
+// List .
+func (s *MemScheduleStore) List(ctx context.Context, sender uint64) ([]*model.ScheduledMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*model.ScheduledMsg, 0, len(s.senders[sender]))
+	for _, id := range s.senders[sender] {
+		list = append(list, s.entries[id].msg.Clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].SendAt < list[j].SendAt })
+	return list, nil
+}
+
+// Update .
+func (s *MemScheduleStore) Update(ctx context.Context, m *model.ScheduledMsg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[m.ID]
+	if !ok || e.msg.Status != model.SchedulePending || e.leased(time.Now().UnixMilli()) {
+		return ErrNotFound
+	}
+	e.msg = m.Clone()
+	return nil
+}
+
+// Claim .
+func (s *MemScheduleStore) Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]*model.ScheduledMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*scheduleEntry
+	for _, e := range s.entries {
+		if (e.msg.Status == model.SchedulePending && e.msg.SendAt <= now || e.msg.Status == model.ScheduleSending) && !e.leased(now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].msg.SendAt < due[j].msg.SendAt })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	list := make([]*model.ScheduledMsg, 0, len(due))
+	for _, e := range due {
+		e.owner = owner
+		e.lease = now + lease.Milliseconds()
+		list = append(list, e.msg.Clone())
+	}
+	return list, nil
+}
+
+// Assign .
+func (s *MemScheduleStore) Assign(ctx context.Context, id, msgID uint64, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok || e.owner != owner || e.msg.Status != model.SchedulePending {
+		return ErrNotFound
+	}
+	e.msg.Status, e.msg.MsgID = model.ScheduleSending, msgID
+	return nil
+}
+
+// Reset .
+func (s *MemScheduleStore) Reset(ctx context.Context, id uint64, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok || e.owner != owner || e.msg.Status != model.ScheduleSending {
+		return ErrNotFound
+	}
+	e.msg.Status = model.SchedulePending
+	return nil
+}
+
+// Finish .
+func (s *MemScheduleStore) Finish(ctx context.Context, m *model.ScheduledMsg, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[m.ID]
+	if !ok || e.owner != owner || e.msg.Status != model.SchedulePending && e.msg.Status != model.ScheduleSending {
+		return ErrNotFound
+	}
+	e.msg = m.Clone()
+	e.owner, e.lease = "", 0
+	return nil
+}
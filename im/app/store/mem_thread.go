@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+type memThread struct {
+	info    model.ThreadInfo
+	replies []uint64
+}
+
+// MemThreadStore 基于内存的话题索引
+type MemThreadStore struct {
+	mu      sync.RWMutex
+	threads map[uint64]*memThread
+}
+
+// NewMemThreadStore .
+func NewMemThreadStore() *MemThreadStore {
+	return &MemThreadStore{threads: make(map[uint64]*memThread)}
+}
+
+// AddReply .
+func (s *MemThreadStore) AddReply(ctx context.Context, rootID, msgID uint64, replyTime int64) (*model.ThreadInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.threads[rootID]
+	if !ok {
+		t = &memThread{info: model.ThreadInfo{RootID: rootID}}
+		s.threads[rootID] = t
+	}
+	t.replies = append(t.replies, msgID)
+	t.info.ReplyCount++
+	if replyTime > t.info.LastReplyTime {
+		t.info.LastReplyTime = replyTime
+	}
+	info := t.info
+	return &info, nil
+}
+
+// Info .
+func (s *MemThreadStore) Info(ctx context.Context, rootID uint64) (*model.ThreadInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.threads[rootID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	info := t.info
+	return &info, nil
+}
+
+// Replies .
+func (s *MemThreadStore) Replies(ctx context.Context, rootID uint64, offset, limit int) ([]uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.threads[rootID]
+	if !ok || offset >= len(t.replies) {
+		return nil, nil
+	}
+	end := len(t.replies)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return append([]uint64(nil), t.replies[offset:end]...), nil
+}
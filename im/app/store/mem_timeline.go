@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+type timelineEntry struct {
+	seq   uint64
+	msgID uint64
+}
+
+// MemTimelineStore 基于内存的用户会话消息索引
+type MemTimelineStore struct {
+	mu        sync.RWMutex
+	timelines map[uint64]map[string][]timelineEntry
+}
+
+// NewMemTimelineStore .
+func NewMemTimelineStore() *MemTimelineStore {
+	return &MemTimelineStore{timelines: make(map[uint64]map[string][]timelineEntry)}
+}
+
+// Append .
+func (s *MemTimelineStore) Append(ctx context.Context, uid uint64, convID string, seq, msgID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	convs := s.timelines[uid]
+	if convs == nil {
+		convs = make(map[string][]timelineEntry)
+		s.timelines[uid] = convs
+	}
+	list := convs[convID]
+	i := sort.Search(len(list), func(i int) bool { return list[i].seq >= seq })
+	if i < len(list) && list[i].seq == seq {
+		return nil
+	}
+	list = append(list, timelineEntry{})
+	copy(list[i+1:], list[i:])
+	list[i] = timelineEntry{seq: seq, msgID: msgID}
+	convs[convID] = list
+	return nil
+}
+
+// List .
+func (s *MemTimelineStore) List(ctx context.Context, uid uint64, convID string, anchor uint64, forward bool, limit int) ([]uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := s.timelines[uid][convID]
+	var start, end int
+	if forward {
+		start = sort.Search(len(list), func(i int) bool { return list[i].seq > anchor })
+		end = len(list)
+		if start+limit < end {
+			end = start + limit
+		}
+	} else {
+		end = len(list)
+		if anchor > 0 {
+			end = sort.Search(len(list), func(i int) bool { return list[i].seq >= anchor })
+		}
+		if end > limit {
+			start = end - limit
+		}
+	}
+	ids := make([]uint64, 0, end-start)
+	for _, e := range list[start:end] {
+		ids = append(ids, e.msgID)
+	}
+	return ids, nil
+}
+
+// Has .
+func (s *MemTimelineStore) Has(ctx context.Context, uid uint64, convID string, seq uint64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := s.timelines[uid][convID]
+	i := sort.Search(len(list), func(i int) bool { return list[i].seq >= seq })
+	return i < len(list) && list[i].seq == seq, nil
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemConvTTLStore 基于内存的会话消息存活时间设置
+type MemConvTTLStore struct {
+	mu   sync.RWMutex
+	ttls map[string]*model.ConvTTL
+}
+
+// NewMemConvTTLStore .
+func NewMemConvTTLStore() *MemConvTTLStore {
+	return &MemConvTTLStore{ttls: make(map[string]*model.ConvTTL)}
+}
+
+// Get .
+func (s *MemConvTTLStore) Get(ctx context.Context, convID string) (*model.ConvTTL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.ttls[convID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *t
+	return &c, nil
+}
+
+// Save .
+func (s *MemConvTTLStore) Save(ctx context.Context, ttl *model.ConvTTL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *ttl
+	s.ttls[ttl.ConvID] = &c
+	return nil
+}
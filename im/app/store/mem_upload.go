@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemUploadStore 基于内存的分片上传任务存储
+type MemUploadStore struct {
+	mu      sync.RWMutex
+	uploads map[uint64]*model.Upload
+}
+
+// NewMemUploadStore .
+func NewMemUploadStore() *MemUploadStore {
+	return &MemUploadStore{uploads: make(map[uint64]*model.Upload)}
+}
+
+func cloneUpload(up *model.Upload) *model.Upload {
+	c := *up
+	c.Done = append([]bool(nil), up.Done...)
+	return &c
+}
+
+// Create .
+func (s *MemUploadStore) Create(ctx context.Context, up *model.Upload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[up.ID] = cloneUpload(up)
+	return nil
+}
+
+// Get .
+func (s *MemUploadStore) Get(ctx context.Context, id uint64) (*model.Upload, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	up, ok := s.uploads[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneUpload(up), nil
+}
+
+// MarkChunk .
+func (s *MemUploadStore) MarkChunk(ctx context.Context, id uint64, index int, now int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up, ok := s.uploads[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if index >= 0 && index < len(up.Done) {
+		up.Done[index] = true
+	}
+	up.UpdateTime = now
+	return nil
+}
+
+// Delete .
+func (s *MemUploadStore) Delete(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, id)
+	return nil
+}
+
+// Stale .
+func (s *MemUploadStore) Stale(ctx context.Context, before int64) ([]*model.Upload, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*model.Upload
+	for _, up := range s.uploads {
+		if up.UpdateTime < before {
+			list = append(list, cloneUpload(up))
+		}
+	}
+	return list, nil
+}
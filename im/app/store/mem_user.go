@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// MemUserStore 基于内存的用户存储
+type MemUserStore struct {
+	mu    sync.RWMutex
+	users map[uint64]*model.User
+}
+
+// NewMemUserStore .
+func NewMemUserStore() *MemUserStore {
+	return &MemUserStore{users: make(map[uint64]*model.User)}
+}
+
+// Get .
+func (s *MemUserStore) Get(ctx context.Context, uid uint64) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *u
+	return &c, nil
+}
+
+// Save .
+func (s *MemUserStore) Save(ctx context.Context, user *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *user
+	s.users[user.Uid] = &c
+	return nil
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/binbin6363/icuc/common/log"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// OpenDB 连接MySQL，用于需要多个实例共享、重启后保留的存储
+func OpenDB(dsn string, maxIdle, maxOpen int, maxLife time.Duration) (*gorm.DB, error) {
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: log.NewZapGormLogger()})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxIdleConns(maxIdle)
+	sqlDB.SetMaxOpenConns(maxOpen)
+	sqlDB.SetConnMaxLifetime(maxLife)
+	return db, nil
+}
+
+// notFound 把gorm的记录不存在转换为ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// expiryRow 到期登记表，owner非空且租约未过期时表示正在被某个实例清理
+type expiryRow struct {
+	MsgID    uint64 `gorm:"primaryKey;autoIncrement:false"`
+	ExpireAt int64  `gorm:"index"`
+	Owner    string `gorm:"size:64"`
+	Lease    int64
+}
+
+// TableName .
+func (expiryRow) TableName() string {
+	return "msg_expiry"
+}
+
+// awaitRow 等待首次阅读的阅后即焚消息
+type awaitRow struct {
+	MsgID  uint64 `gorm:"primaryKey;autoIncrement:false"`
+	ConvID string `gorm:"size:64;index:idx_conv_seq,priority:1"`
+	Seq    uint64 `gorm:"index:idx_conv_seq,priority:2"`
+	Sender uint64
+}
+
+// TableName .
+func (awaitRow) TableName() string {
+	return "msg_expiry_await"
+}
+
+// SQLExpiryStore 基于MySQL的到期调度，重启后登记保留，多个实例共享同一张表时可以同时清理
+type SQLExpiryStore struct {
+	db *gorm.DB
+}
+
+// NewSQLExpiryStore 创建时自动建表
+func NewSQLExpiryStore(db *gorm.DB) (*SQLExpiryStore, error) {
+	migrator := db
+	if db.Dialector.Name() == "mysql" {
+		migrator = db.Set("gorm:table_options", "DEFAULT CHARSET=utf8mb4")
+	}
+	if err := migrator.AutoMigrate(&expiryRow{}, &awaitRow{}); err != nil {
+		return nil, err
+	}
+	return &SQLExpiryStore{db: db}, nil
+}
+
+// Schedule 重复登记时更新到期时间并释放租约
+func (s *SQLExpiryStore) Schedule(ctx context.Context, msgID uint64, expireAt int64) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "msg_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expire_at", "owner", "lease"}),
+	}).Create(&expiryRow{MsgID: msgID, ExpireAt: expireAt}).Error
+}
+
+// Await .
+func (s *SQLExpiryStore) Await(ctx context.Context, convID string, seq, msgID, sender uint64) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&awaitRow{MsgID: msgID, ConvID: convID, Seq: seq, Sender: sender}).Error
+}
+
+// Start 锁定并删除命中的等待记录，多个实例同时读到同一段消息时只有一个实例取到
+func (s *SQLExpiryStore) Start(ctx context.Context, convID string, seq, reader uint64) ([]uint64, error) {
+	var ids []uint64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var rows []*awaitRow
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conv_id = ? AND seq <= ? AND sender <> ?", convID, seq, reader).Find(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		ids = make([]uint64, 0, len(rows))
+		for _, r := range rows {
+			ids = append(ids, r.MsgID)
+		}
+		return tx.Where("msg_id IN ?", ids).Delete(&awaitRow{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Claim 先锁定到期的记录再写入租约，多个实例同时领取时跳过已被锁定的记录
+func (s *SQLExpiryStore) Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]uint64, error) {
+	var ids []uint64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var rows []*expiryRow
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("expire_at <= ? AND (owner = '' OR lease <= ?)", now, now).
+			Order("expire_at").Limit(limit).Find(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		ids = make([]uint64, 0, len(rows))
+		for _, r := range rows {
+			ids = append(ids, r.MsgID)
+		}
+		return tx.Model(&expiryRow{}).Where("msg_id IN ?", ids).
+			Updates(map[string]interface{}{"owner": owner, "lease": now + lease.Milliseconds()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Remove .
+func (s *SQLExpiryStore) Remove(ctx context.Context, msgID uint64) error {
+	return s.db.WithContext(ctx).Where("msg_id = ?", msgID).Delete(&expiryRow{}).Error
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// scheduleRow 定时消息表，owner非空且租约未过期时表示正在被某个实例投递
+type scheduleRow struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Sender     uint64 `gorm:"index"`
+	Receiver   uint64
+	GroupID    uint64
+	Type       model.MsgType
+	Content    string `gorm:"type:mediumtext"`
+	MediaID    uint64
+	ReplyTo    uint64
+	RefMode    model.RefMode
+	TTL        int
+	TTLFrom    model.TTLFrom
+	SendAt     int64                `gorm:"index:idx_due,priority:2"`
+	Status     model.ScheduleStatus `gorm:"index:idx_due,priority:1"`
+	MsgID      uint64
+	Code       int
+	Reason     string `gorm:"size:255"`
+	CreateTime int64
+	UpdateTime int64
+	Owner      string `gorm:"size:64"`
+	Lease      int64
+}
+
+// TableName .
+func (scheduleRow) TableName() string {
+	return "scheduled_msg"
+}
+
+// scheduleCols 定时消息本身的字段，更新时不改动租约
+var scheduleCols = []string{"receiver", "group_id", "type", "content", "media_id", "reply_to", "ref_mode",
+	"ttl", "ttl_from", "send_at", "status", "msg_id", "code", "reason", "update_time"}
+
+func newScheduleRow(m *model.ScheduledMsg) *scheduleRow {
+	return &scheduleRow{
+		ID: m.ID, Sender: m.Sender, Receiver: m.Receiver, GroupID: m.GroupID, Type: m.Type, Content: m.Content,
+		MediaID: m.MediaID, ReplyTo: m.ReplyTo, RefMode: m.RefMode, TTL: m.TTL, TTLFrom: m.TTLFrom, SendAt: m.SendAt,
+		Status: m.Status, MsgID: m.MsgID, Code: m.Code, Reason: m.Reason, CreateTime: m.CreateTime, UpdateTime: m.UpdateTime,
+	}
+}
+
+func (r *scheduleRow) msg() *model.ScheduledMsg {
+	return &model.ScheduledMsg{
+		ID: r.ID, Sender: r.Sender, Receiver: r.Receiver, GroupID: r.GroupID, Type: r.Type, Content: r.Content,
+		MediaID: r.MediaID, ReplyTo: r.ReplyTo, RefMode: r.RefMode, TTL: r.TTL, TTLFrom: r.TTLFrom, SendAt: r.SendAt,
+		Status: r.Status, MsgID: r.MsgID, Code: r.Code, Reason: r.Reason, CreateTime: r.CreateTime, UpdateTime: r.UpdateTime,
+	}
+}
+
+// SQLScheduleStore 基于MySQL的定时消息，重启后保留，多个实例共享同一张表时可以同时投递
+type SQLScheduleStore struct {
+	db *gorm.DB
+}
+
+// NewSQLScheduleStore 创建时自动建表
+func NewSQLScheduleStore(db *gorm.DB) (*SQLScheduleStore, error) {
+	migrator := db
+	if db.Dialector.Name() == "mysql" {
+		migrator = db.Set("gorm:table_options", "DEFAULT CHARSET=utf8mb4")
+	}
+	if err := migrator.AutoMigrate(&scheduleRow{}); err != nil {
+		return nil, err
+	}
+	return &SQLScheduleStore{db: db}, nil
+}
+
+// Create .
+func (s *SQLScheduleStore) Create(ctx context.Context, m *model.ScheduledMsg) error {
+	return s.db.WithContext(ctx).Create(newScheduleRow(m)).Error
+}
+
+// Get .
+func (s *SQLScheduleStore) Get(ctx context.Context, id uint64) (*model.ScheduledMsg, error) {
+	row := &scheduleRow{}
+	if err := s.db.WithContext(ctx).Take(row, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return row.msg(), nil
+}
+
+// List .
+func (s *SQLScheduleStore) List(ctx context.Context, sender uint64) ([]*model.ScheduledMsg, error) {
+	var rows []*scheduleRow
+	if err := s.db.WithContext(ctx).Where("sender = ?", sender).Order("send_at").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	list := make([]*model.ScheduledMsg, 0, len(rows))
+	for _, r := range rows {
+		list = append(list, r.msg())
+	}
+	return list, nil
+}
+
+// Update .
+func (s *SQLScheduleStore) Update(ctx context.Context, m *model.ScheduledMsg) error {
+	now := time.Now().UnixMilli()
+	res := s.db.WithContext(ctx).Model(&scheduleRow{}).
+		Where("id = ? AND status = ? AND (owner = '' OR lease <= ?)", m.ID, model.SchedulePending, now).
+		Select(scheduleCols).Updates(newScheduleRow(m))
+	return affected(res)
+}
+
+// Claim 先锁定到期的记录再写入租约，多个实例同时领取时跳过已被锁定的记录
+func (s *SQLScheduleStore) Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]*model.ScheduledMsg, error) {
+	var rows []*scheduleRow
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND send_at <= ? OR status = ?) AND (owner = '' OR lease <= ?)",
+				model.SchedulePending, now, model.ScheduleSending, now).
+			Order("send_at").Limit(limit).Find(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		ids := make([]uint64, 0, len(rows))
+		for _, r := range rows {
+			ids = append(ids, r.ID)
+		}
+		return tx.Model(&scheduleRow{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"owner": owner, "lease": now + lease.Milliseconds()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*model.ScheduledMsg, 0, len(rows))
+	for _, r := range rows {
+		list = append(list, r.msg())
+	}
+	return list, nil
+}
+
+// Assign 同一条件更新中校验领取者并改为正在投递，之后领取到的实例只记录结果
+func (s *SQLScheduleStore) Assign(ctx context.Context, id, msgID uint64, owner string) error {
+	res := s.db.WithContext(ctx).Model(&scheduleRow{}).
+		Where("id = ? AND owner = ? AND status = ?", id, owner, model.SchedulePending).
+		Updates(map[string]interface{}{"status": model.ScheduleSending, "msg_id": msgID})
+	return affected(res)
+}
+
+// Reset .
+func (s *SQLScheduleStore) Reset(ctx context.Context, id uint64, owner string) error {
+	res := s.db.WithContext(ctx).Model(&scheduleRow{}).
+		Where("id = ? AND owner = ? AND status = ?", id, owner, model.ScheduleSending).
+		Update("status", model.SchedulePending)
+	return affected(res)
+}
+
+// Finish .
+func (s *SQLScheduleStore) Finish(ctx context.Context, m *model.ScheduledMsg, owner string) error {
+	row := newScheduleRow(m)
+	res := s.db.WithContext(ctx).Model(&scheduleRow{}).
+		Where("id = ? AND owner = ? AND status IN ?", m.ID, owner,
+			[]model.ScheduleStatus{model.SchedulePending, model.ScheduleSending}).
+		Select(append(scheduleCols, "owner", "lease")).Updates(row)
+	return affected(res)
+}
+
+// affected 条件更新没有命中记录时返回ErrNotFound
+func affected(res *gorm.DB) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
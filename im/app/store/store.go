@@ -0,0 +1,377 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/binbin6363/icuc/im/app/model"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("record not found")
+
+// ErrConflict 条件更新时记录已被其他请求修改
+var ErrConflict = errors.New("record changed")
+
+// ErrLimit 超过数量上限
+var ErrLimit = errors.New("limit exceeded")
+
+// MessageStore 会话消息存储
+type MessageStore interface {
+	// Save 保存消息，为消息分配会话内递增的seq，消息id已存在时返回ErrConflict
+	Save(ctx context.Context, msg *model.Message) error
+	// Get 按消息id获取
+	Get(ctx context.Context, msgID uint64) (*model.Message, error)
+	// UpdateIf 仅当存储中的消息自读取后没有被修改(Rev相同)时更新，seq不变，成功后msg.Rev加一，否则返回ErrConflict
+	UpdateIf(ctx context.Context, msg *model.Message) error
+	// List 按seq升序返回会话中seq小于anchor(forward为true时大于anchor)的最多limit条消息，
+	// 向前翻页时取最靠近anchor的一段，anchor为0表示从最新的消息开始
+	List(ctx context.Context, convID string, anchor uint64, forward bool, limit int) ([]*model.Message, error)
+	// Changes 按写入顺序返回Change大于after的最多limit条消息的当前内容，发送、编辑、撤回和到期都算一次写入，
+	// 同一条消息只按最后一次写入返回；Change须按提交顺序递增，用于各实例重建和补齐检索索引
+	Changes(ctx context.Context, after uint64, limit int) ([]*model.Message, error)
+}
+
+// TimelineStore 用户维度的会话消息索引，群聊写扩散时每个成员一份，只包含入群后收到的消息
+type TimelineStore interface {
+	Append(ctx context.Context, uid uint64, convID string, seq, msgID uint64) error
+	// List 与MessageStore.List的翻页规则相同，返回消息id
+	List(ctx context.Context, uid uint64, convID string, anchor uint64, forward bool, limit int) ([]uint64, error)
+	// Has 用户的会话索引中是否有这条消息
+	Has(ctx context.Context, uid uint64, convID string, seq uint64) (bool, error)
+}
+
+// DeletionStore 用户仅对自己删除的消息
+type DeletionStore interface {
+	Add(ctx context.Context, uid uint64, msgIDs []uint64) error
+	// Filter 返回msgIDs中已被用户删除的消息
+	Filter(ctx context.Context, uid uint64, msgIDs []uint64) (map[uint64]bool, error)
+}
+
+// InboxStore 用户收件箱，供离线同步
+type InboxStore interface {
+	// Append 追加事件，返回用户维度的seq
+	Append(ctx context.Context, uid uint64, ev *model.Event) (uint64, error)
+	// Sync 拉取seq大于afterSeq的最多limit条记录
+	Sync(ctx context.Context, uid uint64, afterSeq uint64, limit int) ([]*model.InboxItem, error)
+}
+
+// GroupStore 群成员信息
+type GroupStore interface {
+	// Member 获取群成员，不是成员时返回ErrNotFound
+	Member(ctx context.Context, groupID, uid uint64) (*model.GroupMember, error)
+	// Members 获取全部群成员
+	Members(ctx context.Context, groupID uint64) ([]*model.GroupMember, error)
+	// AddMember 添加或更新群成员
+	AddMember(ctx context.Context, member *model.GroupMember) error
+	// RemoveMember 移除群成员，不是成员时返回ErrNotFound
+	RemoveMember(ctx context.Context, groupID, uid uint64) error
+}
+
+// UserStore 用户信息
+type UserStore interface {
+	Get(ctx context.Context, uid uint64) (*model.User, error)
+	Save(ctx context.Context, user *model.User) error
+}
+
+// FriendStore 好友关系，双向
+type FriendStore interface {
+	Add(ctx context.Context, a, b uint64) error
+	IsFriend(ctx context.Context, a, b uint64) (bool, error)
+}
+
+// MuteStore 账号禁言
+type MuteStore interface {
+	// Mute 禁言到until，单位毫秒，已有更晚的截止时间时保持不变
+	Mute(ctx context.Context, uid uint64, until int64) error
+	// Until 禁言截止时间，没有禁言时返回0
+	Until(ctx context.Context, uid uint64) (int64, error)
+}
+
+// ConvTTLStore 会话的消息存活时间设置
+type ConvTTLStore interface {
+	// Get 获取会话的设置，没有设置过时返回ErrNotFound
+	Get(ctx context.Context, convID string) (*model.ConvTTL, error)
+	Save(ctx context.Context, ttl *model.ConvTTL) error
+}
+
+// ExpiryStore 到期消息的调度，领取时带租约，实现共享存储时多个实例可以同时清理
+type ExpiryStore interface {
+	// Schedule 登记消息在expireAt到期，单位毫秒
+	Schedule(ctx context.Context, msgID uint64, expireAt int64) error
+	// Await 登记从首次阅读开始计时的消息，等待发送者以外的成员读到
+	Await(ctx context.Context, convID string, seq, msgID, sender uint64) error
+	// Start 取出会话中seq不大于seq且发送者不是reader的等待消息
+	Start(ctx context.Context, convID string, seq, reader uint64) ([]uint64, error)
+	// Claim 领取最多limit条在now之前到期、且没有被领取或租约已过期的消息，租约时长为lease
+	Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]uint64, error)
+	// Remove 清理完成后删除登记
+	Remove(ctx context.Context, msgID uint64) error
+}
+
+// ScheduleStore 定时消息，领取时带租约，实现共享存储时多个实例可以同时投递
+type ScheduleStore interface {
+	Create(ctx context.Context, m *model.ScheduledMsg) error
+	Get(ctx context.Context, id uint64) (*model.ScheduledMsg, error)
+	// List 按计划发送时间升序返回用户的全部定时消息
+	List(ctx context.Context, sender uint64) ([]*model.ScheduledMsg, error)
+	// Update 修改等待发送的定时消息，已发送、已取消或正在投递时返回ErrNotFound
+	Update(ctx context.Context, m *model.ScheduledMsg) error
+	// Claim 领取最多limit条没有被领取或租约已过期的定时消息，租约时长为lease：计划时间不晚于now的等待发送的消息，
+	// 以及投递中断(正在投递且租约已过期)的消息，后者只用于记录结果，不能再次发送
+	Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]*model.ScheduledMsg, error)
+	// Assign 发送前把owner领取的等待发送的消息改为正在投递并记录预先分配的消息id，与领取的条件在同一次条件更新中完成，
+	// 成功后其他实例不会再发送这条消息；不是owner领取的或不是等待发送时返回ErrNotFound
+	Assign(ctx context.Context, id, msgID uint64, owner string) error
+	// Reset 确认没有发出时把owner正在投递的消息退回等待发送，保留消息id和租约，租约过期后重新领取
+	Reset(ctx context.Context, id uint64, owner string) error
+	// Finish 记录等待发送或正在投递的消息的结果并释放租约，租约已被其他实例接手或已有结果时返回ErrNotFound
+	Finish(ctx context.Context, m *model.ScheduledMsg, owner string) error
+}
+
+// BotStore 机器人账号
+type BotStore interface {
+	// Save 创建或更新机器人，令牌变化时旧令牌失效
+	Save(ctx context.Context, bot *model.Bot) error
+	Get(ctx context.Context, uid uint64) (*model.Bot, error)
+	// ByToken 按令牌的sha256查找机器人，不存在时返回ErrNotFound
+	ByToken(ctx context.Context, tokenHash string) (*model.Bot, error)
+	// List 按创建时间升序返回用户创建的机器人
+	List(ctx context.Context, owner uint64) ([]*model.Bot, error)
+	// Bots 返回uids中是机器人的账号
+	Bots(ctx context.Context, uids []uint64) ([]*model.Bot, error)
+}
+
+// HookStore 出站事件的投递队列，领取时带租约，多个实例可以同时投递
+type HookStore interface {
+	Enqueue(ctx context.Context, d *model.HookDelivery) error
+	// Claim 领取最多limit条到了投递时间、且没有被领取或租约已过期的待投递记录，租约时长为lease
+	Claim(ctx context.Context, owner string, now int64, lease time.Duration, limit int) ([]*model.HookDelivery, error)
+	// Finish 记录投递结果并释放租约，投递成功的记录不再保留，租约已被其他实例接手时返回ErrNotFound
+	Finish(ctx context.Context, d *model.HookDelivery, owner string) error
+	// Dead 按时间倒序返回机器人最近的最多limit条死信
+	Dead(ctx context.Context, bot uint64, limit int) ([]*model.HookDelivery, error)
+}
+
+// KeyStore 端到端加密的公钥目录，按用户和设备保存
+type KeyStore interface {
+	// SaveDevice 发布或更新设备的身份公钥和签名预共享公钥
+	SaveDevice(ctx context.Context, keys *model.DeviceKeys) error
+	// Devices 用户已发布密钥的全部设备
+	Devices(ctx context.Context, uid uint64) ([]*model.DeviceKeys, error)
+	// RemoveDevice 删除设备的密钥和剩余的一次性公钥
+	RemoveDevice(ctx context.Context, uid uint64, deviceID string) error
+	// AddPreKeys 追加一次性公钥，id已存在时覆盖，返回设备剩余的数量
+	AddPreKeys(ctx context.Context, uid uint64, deviceID string, keys []*model.PreKey) (int, error)
+	// TakePreKey 取走一个一次性公钥，返回取走后剩余的数量，没有剩余时返回ErrNotFound
+	TakePreKey(ctx context.Context, uid uint64, deviceID string) (*model.PreKey, int, error)
+	// CountPreKeys 设备剩余的一次性公钥数量
+	CountPreKeys(ctx context.Context, uid uint64, deviceID string) (int, error)
+}
+
+// BroadcastStore 系统广播，已发布的广播组成一条全体用户共享的时间线
+type BroadcastStore interface {
+	Create(ctx context.Context, b *model.Broadcast) error
+	Get(ctx context.Context, id uint64) (*model.Broadcast, error)
+	// Cancel 取消广播，已取消时返回ErrNotFound
+	Cancel(ctx context.Context, id uint64) error
+	// PublishDue 把发布时间不晚于now的定时广播追加到时间线并分配seq，多个实例同时调用时每条只发布一次
+	PublishDue(ctx context.Context, now int64) ([]*model.Broadcast, error)
+	// Since 按seq升序返回时间线上seq大于after的最多limit条广播，包含已取消的
+	Since(ctx context.Context, after uint64, limit int) ([]*model.Broadcast, error)
+	// Advance 用户的投递游标推进到seq，只前进不后退，返回推进前的值
+	Advance(ctx context.Context, uid uint64, seq uint64) (uint64, error)
+	// AddDelivered 各广播的投递数加一
+	AddDelivered(ctx context.Context, ids []uint64) error
+	// MarkRead 记录用户已读，首次已读时阅读数加一并返回true
+	MarkRead(ctx context.Context, id, uid uint64) (bool, error)
+	Stats(ctx context.Context, id uint64) (*model.BroadcastStats, error)
+}
+
+// AuditStore 审计记录
+type AuditStore interface {
+	Record(ctx context.Context, rec *model.AuditRecord) error
+}
+
+// ReviewStore 内容审核标记的待复核记录
+type ReviewStore interface {
+	Record(ctx context.Context, rec *model.ReviewRecord) error
+}
+
+// RevisionStore 消息编辑历史
+type RevisionStore interface {
+	Add(ctx context.Context, rev *model.Revision) error
+	// List 按版本号升序返回
+	List(ctx context.Context, msgID uint64) ([]*model.Revision, error)
+	// Delete 删除消息的全部历史版本
+	Delete(ctx context.Context, msgID uint64) error
+}
+
+// ThreadStore 话题回复索引
+type ThreadStore interface {
+	// AddReply 追加话题回复，返回更新后的统计
+	AddReply(ctx context.Context, rootID, msgID uint64, replyTime int64) (*model.ThreadInfo, error)
+	// Info 获取话题统计，没有回复时返回ErrNotFound
+	Info(ctx context.Context, rootID uint64) (*model.ThreadInfo, error)
+	// Replies 按回复顺序返回从offset开始的最多limit条回复的消息id
+	Replies(ctx context.Context, rootID uint64, offset, limit int) ([]uint64, error)
+}
+
+// ReactionStore 消息表情回应
+type ReactionStore interface {
+	// Add 添加回应，返回是否新增及变化后该表情的数量；新增后消息上的不同表情数超过maxEmojis，
+	// 或用户在该消息上回应的不同表情数超过maxUser时返回ErrLimit
+	Add(ctx context.Context, msgID uint64, emoji string, uid uint64, maxEmojis, maxUser int) (bool, int, error)
+	// Remove 取消回应，返回是否存在及变化后该表情的数量
+	Remove(ctx context.Context, msgID uint64, emoji string, uid uint64) (bool, int, error)
+	// List 返回消息上的全部回应，按表情首次出现的顺序，Reactors按回应时间顺序且不截断
+	List(ctx context.Context, msgID uint64) ([]*model.Reaction, error)
+}
+
+// MentionStore 用户被@的标记
+type MentionStore interface {
+	Add(ctx context.Context, uid uint64, mention *model.Mention) error
+	// Clear 清除会话中seq不大于uptoSeq的标记
+	Clear(ctx context.Context, uid uint64, convID string, uptoSeq uint64) error
+	// Remove 删除某条消息的标记
+	Remove(ctx context.Context, uid uint64, msgID uint64) error
+	// List 返回用户全部未清除的标记
+	List(ctx context.Context, uid uint64) ([]*model.Mention, error)
+}
+
+// PlayedStore 语音消息的收听状态
+type PlayedStore interface {
+	// Mark 记录用户已收听，返回是否首次收听
+	Mark(ctx context.Context, msgID, uid uint64, now int64) (bool, error)
+	// List 按首次收听时间顺序返回收听记录
+	List(ctx context.Context, msgID uint64) ([]*model.Played, error)
+}
+
+// CustomTypeStore 自定义消息类型注册表
+type CustomTypeStore interface {
+	Save(ctx context.Context, ct *model.CustomType) error
+	Get(ctx context.Context, name string) (*model.CustomType, error)
+	// List 按名称顺序返回全部类型
+	List(ctx context.Context) ([]*model.CustomType, error)
+}
+
+// ConversationStore 用户的最近会话列表
+type ConversationStore interface {
+	// Update 原子地修改用户的会话，不存在时传入只有uid和会话id、Version为0的新记录；
+	// fn返回true时保存并分配用户维度递增的版本号，返回保存后的会话，否则返回nil
+	Update(ctx context.Context, uid uint64, convID string, fn func(conv *model.Conversation) bool) (*model.Conversation, error)
+	// Get 获取用户的会话，不存在时返回ErrNotFound
+	Get(ctx context.Context, uid uint64, convID string) (*model.Conversation, error)
+	// List 返回用户的全部会话，不保证顺序
+	List(ctx context.Context, uid uint64) ([]*model.Conversation, error)
+	// Changes 按版本号升序返回版本号大于after的最多limit条会话
+	Changes(ctx context.Context, uid uint64, after uint64, limit int) ([]*model.Conversation, error)
+}
+
+// DedupStore 发送去重，记录一段时间内key对应的发送结果
+type DedupStore interface {
+	// Get 获取key对应的发送结果，不存在或已过期时返回ErrNotFound
+	Get(ctx context.Context, key string) (*model.SendResult, error)
+	Set(ctx context.Context, key string, res *model.SendResult) error
+}
+
+// MediaStore 媒体文件记录
+type MediaStore interface {
+	Save(ctx context.Context, media *model.Media) error
+	Get(ctx context.Context, id uint64) (*model.Media, error)
+	Delete(ctx context.Context, id uint64) error
+	// Stale 未被持有且创建时间早于before的记录，最多返回limit条
+	Stale(ctx context.Context, before int64, limit int) ([]*model.Media, error)
+}
+
+// ObjectStore 按内容去重的存储对象及其引用计数
+type ObjectStore interface {
+	// Get 查询对象，不改变引用计数
+	Get(ctx context.Context, key string) (*model.Object, error)
+	// Acquire 对象存在时引用计数加一并返回，不存在时返回ErrNotFound
+	Acquire(ctx context.Context, key string) (*model.Object, error)
+	// Create 创建引用计数为1的对象，key已存在时改为给已有对象加一并返回已有对象，created为false
+	Create(ctx context.Context, obj *model.Object) (*model.Object, bool, error)
+	// Release 引用计数减一，归零时删除记录并返回true
+	Release(ctx context.Context, key string) (*model.Object, bool, error)
+}
+
+// UploadStore 分片上传任务
+type UploadStore interface {
+	Create(ctx context.Context, up *model.Upload) error
+	Get(ctx context.Context, id uint64) (*model.Upload, error)
+	// MarkChunk 标记分片已上传并刷新更新时间
+	MarkChunk(ctx context.Context, id uint64, index int, now int64) error
+	Delete(ctx context.Context, id uint64) error
+	// Stale 返回更新时间早于before的任务
+	Stale(ctx context.Context, before int64) ([]*model.Upload, error)
+}
+
+// Store 汇总各类存储，方便各个服务共享同一份实例
+type Store struct {
+	Message  MessageStore
+	Inbox    InboxStore
+	Group    GroupStore
+	User     UserStore
+	Audit    AuditStore
+	Revision RevisionStore
+	Thread   ThreadStore
+	Reaction ReactionStore
+	Mention  MentionStore
+	Dedup    DedupStore
+	Media    MediaStore
+	Upload   UploadStore
+	Object   ObjectStore
+	Played   PlayedStore
+	Custom   CustomTypeStore
+
+	Conversation ConversationStore
+	Timeline     TimelineStore
+	Deletion     DeletionStore
+	Review       ReviewStore
+	Friend       FriendStore
+	Mute         MuteStore
+	ConvTTL      ConvTTLStore
+	Expiry       ExpiryStore
+	Key          KeyStore
+	Broadcast    BroadcastStore
+	Schedule     ScheduleStore
+	Bot          BotStore
+	Hook         HookStore
+}
+
+// NewMemStore 新建基于内存的存储，用于单机部署和开发调试
+func NewMemStore() *Store {
+	return &Store{
+		Message:  NewMemMessageStore(),
+		Inbox:    NewMemInboxStore(),
+		Group:    NewMemGroupStore(),
+		User:     NewMemUserStore(),
+		Audit:    NewMemAuditStore(),
+		Revision: NewMemRevisionStore(),
+		Thread:   NewMemThreadStore(),
+		Reaction: NewMemReactionStore(),
+		Mention:  NewMemMentionStore(),
+		Dedup:    NewMemDedupStore(defaultDedupCapacity, defaultDedupTTL),
+		Media:    NewMemMediaStore(),
+		Upload:   NewMemUploadStore(),
+		Object:   NewMemObjectStore(),
+		Played:   NewMemPlayedStore(),
+		Custom:   NewMemCustomTypeStore(),
+
+		Conversation: NewMemConversationStore(),
+		Timeline:     NewMemTimelineStore(),
+		Deletion:     NewMemDeletionStore(),
+		Review:       NewMemReviewStore(),
+		Friend:       NewMemFriendStore(),
+		Mute:         NewMemMuteStore(),
+		ConvTTL:      NewMemConvTTLStore(),
+		Expiry:       NewMemExpiryStore(),
+		Key:          NewMemKeyStore(),
+		Broadcast:    NewMemBroadcastStore(),
+		Schedule:     NewMemScheduleStore(),
+		Bot:          NewMemBotStore(),
+		Hook:         NewMemHookStore(),
+	}
+}
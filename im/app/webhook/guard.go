@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// ErrForbiddenAddr 回调地址指向内网、本机或云厂商元数据等不允许访问的地址
+var ErrForbiddenAddr = errors.New("webhook address not allowed")
+
+// reservedNets 除标准库能判断的回环、私有和链路本地地址之外，同样不允许访问的网段
+var reservedNets = mustCIDRs(
+	"0.0.0.0/8",     // 本网络
+	"100.64.0.0/10", // 运营商级NAT
+	"192.0.0.0/24",  // IETF协议分配
+	"198.18.0.0/15", // 基准测试
+	"240.0.0.0/4",   // 保留
+	"64:ff9b::/96",  // NAT64，可能映射到内网IPv4
+	"2002::/16",     // 6to4，可能映射到内网IPv4
+)
+
+func mustCIDRs(list ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// PublicIP 是否是可以回调的公网地址
+func PublicIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL 校验回调地址是http(s)且域名解析出的地址都是公网地址，保存回调地址前调用
+// 解析结果之后可能变化，实际请求时每次建立连接还会按连接的地址再校验一次
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return fmt.Errorf("bad webhook url: %s", raw)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if !PublicIP(ip) {
+			return ErrForbiddenAddr
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		if !PublicIP(a.IP) {
+			return ErrForbiddenAddr
+		}
+	}
+	return nil
+}
+
+// dialControl 在连接建立前校验实际连接的地址，重定向和DNS重绑定都会经过这里
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicIP(ip) {
+		return ErrForbiddenAddr
+	}
+	return nil
+}
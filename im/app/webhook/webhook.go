@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeadSignature = "X-Icuc-Signature" // 请求体的hmac-sha256签名，十六进制
+	HeadTimestamp = "X-Icuc-Timestamp" // 签名时间，单位秒，参与签名防重放
+
+	maxRspSize = 1 << 20
+)
+
+// Client 调用第三方回调地址，请求体为json并按密钥签名
+type Client struct {
+	client *http.Client
+}
+
+// NewClient timeout单位毫秒，只能访问公网地址，不走环境变量中的代理
+func NewClient(timeout int) *Client {
+	dialer := &net.Dialer{Timeout: time.Duration(timeout) * time.Millisecond, Control: dialControl}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &Client{client: &http.Client{Timeout: time.Duration(timeout) * time.Millisecond, Transport: transport}}
+}
+
+// Sign 签名内容为 timestamp + "." + body
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Post 发送json请求，out不为nil时解析返回的json
+func (c *Client) Post(ctx context.Context, url, secret string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set(HeadTimestamp, strconv.FormatInt(ts, 10))
+		req.Header.Set(HeadSignature, Sign(secret, ts, body))
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(rsp.Body, maxRspSize))
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook %s fail, status:%d", url, rsp.StatusCode)
+	}
+	if out == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}